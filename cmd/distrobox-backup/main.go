@@ -0,0 +1,18 @@
+// Command distrobox-backup is the companion of distrobox-tool for headless
+// servers and containers. It runs the same subcommands, schedules and
+// trigger listener, but the menu, the terminal picker and the GUI file
+// picker are not part of it, and it never waits for input.
+package main
+
+import "github.com/noyzen/distrobox-backup-tool/internal/app"
+
+// version and buildDate are set like distrobox-tool's, with -X main.version
+// and -X main.buildDate.
+var (
+	version   = "dev"
+	buildDate = "unknown"
+)
+
+func main() {
+	app.RunHeadless(version, buildDate)
+}
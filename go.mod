@@ -1,3 +1,3 @@
-module dixtrobox-tool
+module github.com/noyzen/distrobox-backup-tool
 
 go 1.22.2
@@ -0,0 +1,404 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// backupJob describes a single container backup that runs without prompting.
+type backupJob struct {
+	Container Container
+	File      string // image archive path
+	// SeparateHome additionally archives an isolated home next to File;
+	// HomeChecksums also records the hash of every file in that archive.
+	SeparateHome  bool
+	HomeChecksums bool
+	// BundleHome stores an isolated home inside File itself.
+	BundleHome bool
+	// Note is stored in the manifest to remember why the backup exists.
+	Note string
+	// Compression and Level select how the image archive is compressed.
+	Compression backup.Compression
+	Level       int
+	// Encryption is applied to the image archive after compression.
+	Encryption backup.Encryption
+	// Upload, when set, receives the written files, which are then removed
+	// locally; File is in the upload cache then.
+	Upload *remoteTarget
+}
+
+// streams reports whether the job sends its image archive to the remote
+// host while writing it, rather than staging it in the upload cache. SSH
+// targets take a stream; rclone ones are uploaded from the cache.
+func (j backupJob) streams() bool {
+	return j.Upload != nil && !j.Upload.Rclone
+}
+
+// withEncryption sets the job's encryption. A separate home archive would
+// stay unencrypted, so an encrypted job bundles the home instead.
+func (j backupJob) withEncryption(enc backup.Encryption) backupJob {
+	j.Encryption = enc
+	if enc.Cipher != backup.EncryptNone && j.SeparateHome {
+		j.SeparateHome, j.HomeChecksums, j.BundleHome = false, false, true
+	}
+	return j
+}
+
+// backupFileFilters match every archive the tool can restore in file
+// pickers: plain, compressed and encrypted tarballs, but not their sidecars.
+var backupFileFilters = archivePatterns()
+
+func archivePatterns() []string {
+	exts := []string{".tar"}
+	for _, comp := range backup.Compressions {
+		exts = append(exts, ".tar"+comp.Ext())
+	}
+	var patterns []string
+	for _, ext := range exts {
+		patterns = append(patterns, "*"+ext)
+		for _, cipher := range backup.Ciphers {
+			patterns = append(patterns, "*"+ext+cipher.Ext())
+		}
+	}
+	return patterns
+}
+
+// matchesFilters reports whether a file name matches one of the patterns.
+func matchesFilters(name string, filters []string) bool {
+	for _, pattern := range filters {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// backupFileName builds the archive file name for a base name; the suffix is
+// what handleRestore uses to pick the container type.
+func backupFileName(base string, isolated bool, comp backup.Compression, cipher backup.Cipher) string {
+	if isolated {
+		return base + "-isolated.tar" + comp.Ext() + cipher.Ext()
+	}
+	return base + "-standard.tar" + comp.Ext() + cipher.Ext()
+}
+
+// templateBaseName fills in [backup] name_template for a backup of
+// container taken at t, or returns "" when no template is configured.
+func templateBaseName(container string, t time.Time) string {
+	if cfg.Backup.NameTemplate == "" {
+		return ""
+	}
+	host, _ := os.Hostname()
+	return strings.NewReplacer(
+		"{container}", container,
+		"{date}", t.Format("2006-01-02"),
+		"{time}", t.Format("150405"),
+		"{host}", host,
+	).Replace(cfg.Backup.NameTemplate)
+}
+
+// isIsolatedArchive reports whether a file name marks an isolated backup.
+func isIsolatedArchive(backupFile string) bool {
+	return strings.HasSuffix(backup.TrimExt(backupFile), "-isolated.tar")
+}
+
+// partialSuffix marks an archive that is still being written. Archives are
+// only renamed to their final name once they are complete, so a crash or a
+// full disk never leaves a truncated file that looks like a backup.
+const partialSuffix = ".part"
+
+// compressionRatio formats how much data bytes shrank to an archive of size
+// bytes, e.g. "3.1:1", or returns "" if either is unknown.
+func compressionRatio(size, data int64) string {
+	if size <= 0 || data <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1f:1", float64(data)/float64(size))
+}
+
+// checkNotPartial refuses a file left by an interrupted or failed save.
+func checkNotPartial(file string) error {
+	if strings.HasSuffix(file, partialSuffix) {
+		return fmt.Errorf("%s is an unfinished backup left by an interrupted or failed save and cannot be restored", file)
+	}
+	return nil
+}
+
+func homeArchivePath(backupFile string) string {
+	return strings.TrimSuffix(backup.TrimExt(backupFile), ".tar") + "-home.tar.gz"
+}
+
+// outputFiles lists every file the job will write.
+func (j backupJob) outputFiles() []string {
+	files := []string{j.File, manifestPath(j.File), checksumPath(j.File)}
+	if j.SeparateHome {
+		files = append(files, homeArchivePath(j.File), checksumPath(homeArchivePath(j.File)))
+		if j.HomeChecksums {
+			files = append(files, homeChecksumPath(j.File))
+		}
+	}
+	return files
+}
+
+// saveArchive writes the job's image archive to part, or for a job that
+// streams, to the remote host.
+func (j backupJob) saveArchive(image, part string, m *backup.Manifest, opts backup.SaveOptions) error {
+	if j.streams() {
+		return j.Upload.streamUpload(filepath.Base(j.File), m, func(w io.Writer) error {
+			return client.WriteArchive(image, w, m, opts)
+		})
+	}
+	return client.SaveArchive(image, part, m, opts)
+}
+
+// finishArchive moves the saved part into place with its sidecars. A
+// streamed archive is already on the remote host; only its sidecars are
+// written, and uploaded with it.
+func (j backupJob) finishArchive(part string, m *backup.Manifest) error {
+	if j.streams() {
+		return writeSidecars(j.File, m)
+	}
+	return finishBackupArchive(part, j.File, m)
+}
+
+// existingOutputs lists the files of the job that already exist at the
+// destination.
+func (j backupJob) existingOutputs() []string {
+	var existing []string
+	for _, f := range j.outputFiles() {
+		if j.Upload != nil {
+			if j.Upload.exists(filepath.Base(f)) {
+				existing = append(existing, j.Upload.join(filepath.Base(f)))
+			}
+		} else if fileExists(f) {
+			existing = append(existing, f)
+		}
+	}
+	return existing
+}
+
+// destination returns where the job's archive ends up, for messages.
+func (j backupJob) destination() string {
+	if j.Upload != nil {
+		return j.Upload.join(filepath.Base(j.File))
+	}
+	return j.File
+}
+
+// assumedCompressionRatio is how much of an image is expected to remain
+// after compression when checking the destination's free space.
+const assumedCompressionRatio = 0.5
+
+// spaceMargin is the room left free on top of a backup's estimated size.
+func spaceMargin(need uint64) uint64 {
+	return max(need/20, 256<<20)
+}
+
+// checkBackupSpace fails if the destination of job cannot hold a backup of
+// an image of imageBytes plus homeBytes of home, with a safety margin. A
+// remote backup is staged locally first, so both places are checked; a
+// streamed one only stages its separate home archive.
+func checkBackupSpace(job backupJob, imageBytes, homeBytes uint64) error {
+	need := imageBytes + homeBytes
+	if job.Compression != backup.CompressNone {
+		need = uint64(float64(need) * assumedCompressionRatio)
+	}
+	margin := spaceMargin(need)
+	check := func(where string, free uint64) error {
+		if free < need+margin {
+			return fmt.Errorf("not enough space in %s: the backup needs about %s plus a %s margin, but only %s is free", where, formatBytes(need), formatBytes(margin), formatBytes(free))
+		}
+		return nil
+	}
+	dir := filepath.Dir(job.File)
+	if !job.streams() || job.SeparateHome {
+		if free, err := getFreeDiskSpace(dir); err != nil {
+			logWarning(fmt.Sprintf("Could not determine the free space in %s: %v", dir, err))
+		} else if err := check(dir, free); err != nil {
+			return err
+		}
+	}
+	if job.Upload != nil {
+		// Many rclone backends and some SSH hosts cannot report it (0).
+		if free, err := job.Upload.prepare(); err == nil && free > 0 {
+			return check(job.Upload.String(), free)
+		}
+	}
+	return nil
+}
+
+// runBackupJob commits the container to a temporary image, saves it to the
+// job's archive with a sidecar manifest and, if requested, archives the
+// isolated home separately. It returns the manifest, with the sizes of the
+// archive and of the data in it.
+func runBackupJob(job backupJob) (manifest *backup.Manifest, err error) {
+	defer routeTo(job.Container)()
+	defer func(start time.Time) {
+		var size, data int64
+		if manifest != nil {
+			size, data = manifest.Size, manifest.DataSize
+		}
+		recordBackupResult(job.Container.Name, job.destination(), start, size, data, err)
+	}(time.Now())
+	logInfo(fmt.Sprintf("Backing up '%s' to '%s'...", job.Container.Name, job.destination()))
+	defer inhibitSleep(fmt.Sprintf("Backing up %s", job.Container.Name))()
+	isIsolated, homePath := isContainerIsolated(job.Container)
+	if isIsolated && podmanConnection != "" && (job.BundleHome || job.SeparateHome) {
+		logWarning(fmt.Sprintf("The isolated home of '%s' is on the machine behind connection '%s' and is not included.", job.Container.Name, podmanConnection))
+		job.BundleHome, job.SeparateHome, job.HomeChecksums = false, false, false
+	}
+	var homeBytes uint64
+	archivedHome := ""
+	if isIsolated && (job.BundleHome || job.SeparateHome) {
+		homeBytes, _ = dirSize(homePath)
+		archivedHome = homePath
+	}
+	excluded := sensitiveExcludes(job, archivedHome)
+	excluded = append(excluded, checkSecrets(job, archivedHome, excluded)...)
+	// Check with the container's size before the commit, which takes long,
+	// and with the committed image's exact size before saving it.
+	if rootfs, err := containerRootfsSize(job.Container.Name); err == nil {
+		if err := checkBackupSpace(job, rootfs, homeBytes); err != nil {
+			return nil, err
+		}
+	}
+	if writable, err := containerWritableSize(job.Container.Name); err == nil {
+		if free, err := getFreeDiskSpace(containerStoragePath); err == nil && free < writable+spaceMargin(writable) {
+			return nil, fmt.Errorf("not enough space in container storage (%s) to commit '%s': needs about %s, %s is free", containerStoragePath, job.Container.Name, formatBytes(writable), formatBytes(free))
+		}
+	}
+	tempImageName := newTempImageName("backup", job.Container)
+	done := make(chan bool)
+	go showSpinner("commit", "Processing container image...", done)
+	err = client.Commit(job.Container.Name, tempImageName)
+	done <- true
+	if err != nil {
+		releaseTempImage(tempImageName)
+		return nil, fmt.Errorf("failed to commit container: %w", err)
+	}
+	defer removeTempImage(tempImageName)
+	part := job.File + partialSuffix
+	homePart := homeArchivePath(job.File) + partialSuffix
+	defer removeOnInterrupt(func() []string { return []string{part, homePart} })()
+
+	manifest = newManifest(job.Container, isIsolated, homePath)
+	manifest.Note = job.Note
+	if isIsolated && (job.BundleHome || job.SeparateHome) {
+		manifest.HomeOwner, manifest.HomeXattrs = cfg.Backup.HomeOwner, cfg.Backup.HomeXattrs
+		manifest.HomeExcluded = excluded
+	}
+	opts := backup.SaveOptions{Compression: job.Compression, Level: job.Level, Encryption: job.Encryption, Home: manifest.HomeOptions()}
+	// The bar compares the bytes streamed out of the runtime with the
+	// image size; a bundled home adds to both.
+	total, err := client.ImageSize(tempImageName)
+	if err != nil {
+		total = 0
+	} else if err := checkBackupSpace(job, uint64(total), homeBytes); err != nil {
+		return nil, err
+	}
+	if job.BundleHome && isIsolated {
+		manifest.HomeBundled = true
+		opts.HomeDir = homePath
+		if total > 0 {
+			total += int64(homeBytes)
+		}
+		bar := startProgressBar("save", "Saving image and home directory...", total)
+		opts.Progress = bar.set
+		err := job.saveArchive(tempImageName, part, manifest, opts)
+		bar.finish()
+		if err != nil {
+			os.Remove(part)
+			return nil, fmt.Errorf("failed to save image and home to tar file: %w", err)
+		}
+		logSuccess("✅ Image and home directory backup completed successfully!")
+	} else {
+		bar := startProgressBar("save", "Saving image...", total)
+		opts.Progress = bar.set
+		err := job.saveArchive(tempImageName, part, manifest, opts)
+		bar.finish()
+		if err != nil {
+			os.Remove(part)
+			return nil, fmt.Errorf("failed to save image to tar file: %w", err)
+		}
+		logSuccess("✅ Image backup completed successfully!")
+	}
+	if job.streams() {
+		// The archive waits on the remote host as a part until its
+		// sidecars are uploaded.
+		defer func() {
+			if err != nil {
+				job.Upload.remove(filepath.Base(part))
+			}
+		}()
+	}
+
+	if job.Encryption.Cipher != backup.EncryptNone {
+		manifest.Encryption = job.Encryption.Cipher.String()
+		logSuccess(fmt.Sprintf("🔒 The backup is encrypted with %s for '%s'.", job.Encryption.Cipher, job.Encryption.Recipient))
+	}
+	doneSidecar := make(chan bool)
+	go showSpinner("checksum", "Writing backup manifest...", doneSidecar)
+	err = job.finishArchive(part, manifest)
+	doneSidecar <- true
+	if err != nil {
+		os.Remove(part)
+		return nil, fmt.Errorf("failed to write the backup manifest: %w", err)
+	}
+	if ratio := compressionRatio(manifest.Size, manifest.DataSize); ratio != "" {
+		logInfo(fmt.Sprintf("%s of data archived in %s (compression ratio %s).", formatBytes(uint64(manifest.DataSize)), formatBytes(uint64(manifest.Size)), ratio))
+	}
+
+	if job.SeparateHome {
+		homeBackupFile := homeArchivePath(job.File)
+		doneHome := make(chan bool)
+		go showSpinner("archive-home", "Archiving home directory...", doneHome)
+		// Created first so tar, which truncates it, keeps its permissions.
+		err := writeBackupFile(homePart, nil)
+		if err == nil {
+			args := append(append([]string{"-czf", homePart}, manifest.HomeOptions().CreateArgs()...), "-C", homePath, ".")
+			_, err = runCommand("tar", args...)
+		}
+		var sum string
+		if err == nil {
+			sum, err = fileSHA256(homePart, -1)
+		}
+		if err == nil {
+			err = writeChecksumFile(homeBackupFile, sum)
+		}
+		if err == nil {
+			if err = os.Rename(homePart, homeBackupFile); err != nil {
+				os.Remove(checksumPath(homeBackupFile))
+			}
+		}
+		doneHome <- true
+		if err != nil {
+			os.Remove(homePart)
+			return nil, fmt.Errorf("failed to backup home directory: %w", err)
+		}
+		logSuccess("✅ Home directory backup completed successfully!")
+
+		if job.HomeChecksums {
+			doneSums := make(chan bool)
+			go showSpinner("checksum-home", "Recording file checksums...", doneSums)
+			sums, err := hashHomeArchive(homeBackupFile)
+			if err == nil {
+				err = writeHomeChecksums(homeChecksumPath(job.File), sums)
+			}
+			doneSums <- true
+			if err != nil {
+				return nil, fmt.Errorf("failed to record home checksums: %w", err)
+			}
+			logSuccess(fmt.Sprintf("✅ Recorded checksums of %d files.", len(sums)))
+		}
+	}
+	if job.Upload != nil {
+		return manifest, uploadBackup(job)
+	}
+	return manifest, nil
+}
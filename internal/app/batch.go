@@ -0,0 +1,329 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// Failure policies for batch runs.
+const (
+	failureContinue = "continue"
+	failureStop     = "stop"
+	// failureRetry runs a failed container again after the others, up to
+	// [batch] retries times.
+	failureRetry = "retry"
+)
+
+// reasonStopped is the Reason of containers a failureStop batch did not
+// run.
+const reasonStopped = "not run (stopped after failure)"
+
+// batchResult is the outcome of one container in a batch run.
+type batchResult struct {
+	Container string
+	File      string
+	Err       error
+	Skipped   bool
+	// Reason says why a skipped container was not run.
+	Reason   string
+	Duration time.Duration
+	// Attempts counts the runs of a retried container.
+	Attempts int
+	// Size and DataSize are the archive of a backup and the data in it
+	// before compression, when known.
+	Size     int64
+	DataSize int64
+}
+
+// orderContainers sorts containers for a batch run: those named in
+// [batch] order come first in that order, the rest by descending priority
+// and then by name.
+func orderContainers(containers []Container) []Container {
+	position := map[string]int{}
+	for i, name := range cfg.Batch.Order {
+		if _, ok := position[name]; !ok {
+			position[name] = i
+		}
+	}
+	ordered := append([]Container(nil), containers...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		pa, aListed := position[a.Name]
+		pb, bListed := position[b.Name]
+		if aListed || bListed {
+			if aListed && bListed {
+				return pa < pb
+			}
+			return aListed
+		}
+		prioA, prioB := cfg.Containers[a.Name].Priority, cfg.Containers[b.Name].Priority
+		if prioA != prioB {
+			return prioA > prioB
+		}
+		return a.Name < b.Name
+	})
+	return ordered
+}
+
+// runBatchBackup backs up each container into dest, a local folder or a
+// remote target, with timestamped names, following the container ordering
+// and the given failure policy. With failureRetry, failed containers are
+// queued again behind the rest of the run, so a passing problem (a busy
+// disk, a dropped connection) has time to clear.
+func runBatchBackup(containers []Container, dest, onFailure, note string, comp backup.Compression, level int, enc backup.Encryption) []batchResult {
+	now := time.Now()
+	stamp := now.Format("20060102-150405")
+	ordered := orderContainers(containers)
+	results := make([]batchResult, len(ordered))
+	queue := make([]int, len(ordered))
+	for i := range ordered {
+		queue[i] = i
+	}
+	stopped := false
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		c := ordered[i]
+		isIsolated, _ := isContainerIsolated(c)
+		base := templateBaseName(c.Name, now)
+		if base == "" {
+			base = c.Name + "-" + stamp
+		}
+		file, upload, err := backupPath(dest, backupFileName(base, isIsolated, comp, enc.Cipher))
+		job := backupJob{Container: c, File: file, SeparateHome: isIsolated && hasTar, HomeChecksums: cfg.Backup.HomeChecksums, Note: note, Compression: comp, Level: level, Upload: upload}
+		if stopped {
+			results[i] = batchResult{Container: c.Name, File: job.destination(), Skipped: true, Reason: reasonStopped}
+			continue
+		}
+		attempts := results[i].Attempts + 1
+		if attempts > 1 {
+			logInfo(fmt.Sprintf("Retrying '%s' (attempt %d of %d)...", c.Name, attempts, cfg.Batch.Retries+1))
+		}
+		start := time.Now()
+		var m *backup.Manifest
+		if err == nil {
+			m, err = runBackupJob(job.withEncryption(enc))
+		}
+		results[i] = batchResult{Container: c.Name, File: job.destination(), Err: err, Duration: results[i].Duration + time.Since(start), Attempts: attempts}
+		if m != nil {
+			results[i].Size, results[i].DataSize = m.Size, m.DataSize
+		}
+		if err != nil {
+			logError(fmt.Sprintf("Backup of '%s' failed: %v", c.Name, err))
+			switch {
+			case onFailure == failureStop:
+				logWarning("Stopping the batch after the first failure.")
+				stopped = true
+			case onFailure == failureRetry && attempts <= cfg.Batch.Retries:
+				logInfo(fmt.Sprintf("'%s' will be retried after the other containers.", c.Name))
+				queue = append(queue, i)
+			}
+		}
+	}
+	return results
+}
+
+// runBatchRestore restores the archives planned by planRestore with up to
+// jobs restores running at once; init, nvidia and replace apply to all of
+// them. Containers are named after their manifests (or file names). An
+// archive starts only once every container it is restored after is done,
+// and is skipped when one of them failed. Every job loads its image under
+// its own unique tag, so archives of the same image cannot be mixed up.
+// Restores run unattended and cannot ask questions.
+func runBatchRestore(items []restoreItem, jobs int, init, nvidia, replace bool) []batchResult {
+	results := make([]batchResult, len(items))
+	remaining := map[string]int{} // unfinished archives per container
+	for _, it := range items {
+		remaining[it.Container]++
+	}
+	failed := map[string]bool{}
+	started := make([]bool, len(items))
+	finished := make(chan int)
+	running, left := 0, len(items)
+
+	finish := func(i int) {
+		it := items[i]
+		remaining[it.Container]--
+		if results[i].Err != nil || results[i].Skipped {
+			failed[it.Container] = true
+		}
+		left--
+	}
+	for left > 0 {
+		changed := false
+		for i, it := range items {
+			if started[i] {
+				continue
+			}
+			ready := true
+			for _, dep := range it.After {
+				if failed[dep] {
+					started[i], changed = true, true
+					results[i] = batchResult{Container: it.Container, File: it.File, Skipped: true, Reason: fmt.Sprintf("not run ('%s' was not restored)", dep)}
+					logWarning(fmt.Sprintf("Skipping '%s': '%s' was not restored.", it.File, dep))
+					finish(i)
+					break
+				}
+				if remaining[dep] > 0 {
+					ready = false
+				}
+			}
+			if started[i] || !ready || running >= jobs {
+				continue
+			}
+			started[i], changed = true, true
+			running++
+			go func(i int, file string) {
+				start := time.Now()
+				name, err := restoreUnattended(file, "", "", init, nvidia, replace, false)
+				if name == "" {
+					name = filepath.Base(file)
+				}
+				if err != nil {
+					logError(fmt.Sprintf("Restore of '%s' failed: %v", file, err))
+				}
+				results[i] = batchResult{Container: name, File: file, Err: err, Duration: time.Since(start)}
+				finished <- i
+			}(i, it.File)
+		}
+		if left == 0 || (running == 0 && !changed) {
+			break
+		}
+		if running > 0 && !changed {
+			finish(<-finished)
+			running--
+		}
+	}
+	return results
+}
+
+// restoreUnattended restores one archive without prompting for anything the
+// caller did not decide, returning the name of the new container. Empty
+// name and home are chosen from the manifest. A container that already has
+// the name is only replaced with replace set. A sandboxed restore ignores
+// init and nvidia and never replaces.
+func restoreUnattended(file, name, home string, init, nvidia, replace, sandbox bool) (string, error) {
+	src := restoreSource{File: file}
+	if _, _, remote := remoteFile(file); remote && !fileExists(file) {
+		var cleanup func()
+		var err error
+		if src, cleanup, err = fetchRemoteFile(file); err != nil {
+			return "", err
+		}
+		defer cleanup()
+	}
+	job, err := prepareRestore(src)
+	if err != nil {
+		return "", err
+	}
+	job.Name, job.Home, job.Init, job.Nvidia = name, home, init, nvidia
+	if sandbox {
+		job.Sandbox, job.Isolated, job.Init, job.Nvidia = true, true, false, false
+	} else if job.Manifest != nil {
+		job.Init = job.Init || job.Manifest.Init
+		job.Nvidia = job.Nvidia || job.Manifest.Nvidia
+	}
+	if job.Name == "" {
+		job.Name = defaultRestoreName(job)
+		if sandbox {
+			job.Name += "-sandbox"
+		}
+	}
+	if job.Name == "" {
+		removeTempImage(job.Image)
+		return "", fmt.Errorf("could not derive a container name")
+	}
+	if containers, err := getContainers(); err == nil {
+		if existing, taken := findContainer(containers, job.Name); taken {
+			if !replace || sandbox {
+				removeTempImage(job.Image)
+				return job.Name, fmt.Errorf("a container named '%s' already exists; pass --replace to replace it", job.Name)
+			}
+			return job.Name, restoreReplacing(job, existing)
+		}
+	}
+	if err := runRestoreJob(job); err != nil {
+		return job.Name, err
+	}
+	return job.Name, nil
+}
+
+func printBatchSummary(results []batchResult) {
+	fmt.Printf("\n%s=== Batch Summary ==================================================%s\n", colorBlue, colorReset)
+	for _, r := range results {
+		status := fmt.Sprintf("%sOK%s", colorGreen, colorReset)
+		detail := ""
+		if r.File != "" {
+			detail = filepath.Base(r.File)
+		}
+		switch {
+		case r.Skipped:
+			status = fmt.Sprintf("%sSKIPPED%s", colorYellow, colorReset)
+			detail = r.Reason
+		case r.Err != nil:
+			status = fmt.Sprintf("%sFAILED%s", colorRed, colorReset)
+			detail = r.Err.Error()
+		}
+		if ratio := compressionRatio(r.Size, r.DataSize); ratio != "" && r.Err == nil {
+			detail = fmt.Sprintf("%s (%s, ratio %s)", detail, formatBytes(uint64(r.Size)), ratio)
+		}
+		if r.Attempts > 1 {
+			detail = fmt.Sprintf("%s (%d attempts)", detail, r.Attempts)
+		}
+		fmt.Printf("  %-25s %-18s %-8s %s\n", r.Container, status, r.Duration.Round(time.Second), detail)
+	}
+	fmt.Printf("%s====================================================================%s\n", colorBlue, colorReset)
+}
+
+func handleBatchBackup(containers []Container) {
+	clearScreen()
+	printTitle(colorGreen, "📦 Batch Backup")
+	ordered := orderContainers(containers)
+	fmt.Printf("%s%sHint:%s Containers are listed in batch order (config: [batch] order, [containers.<name>] priority).\n\n", colorYellow, colorUnderline, colorReset)
+
+	chosen := selectContainers("the containers to back up", ordered)
+	if len(chosen) == 0 {
+		return
+	}
+	runInteractiveBatch(chosen)
+}
+
+func handleBackupAll(containers []Container) {
+	clearScreen()
+	printTitle(colorGreen, "📦 Backup All Containers")
+	printContainerList(orderContainers(containers))
+	fmt.Printf("%s%sHint:%s Every container is written to its own timestamped archive.\n\n", colorYellow, colorUnderline, colorReset)
+	runInteractiveBatch(containers)
+}
+
+// runInteractiveBatch asks for the destination, failure policy and note of a
+// batch backup, then runs it and prints the summary.
+func runInteractiveBatch(chosen []Container) {
+	logInfo("Please choose a backup destination folder.")
+	destDir, err := selectDirectory("Select Backup Folder")
+	if err != nil || destDir == "" {
+		if err != nil {
+			logError(err.Error())
+		}
+		logError("No valid destination directory selected. Aborting.")
+		return
+	}
+
+	onFailure := cfg.Batch.OnFailure
+	fmt.Printf("%s> On failure: (c)ontinue with the remaining containers, (s)top, or (r)etry it at the end? [default: %s]: %s", colorBold, onFailure, colorReset)
+	switch readUserInput() {
+	case "c", "C":
+		onFailure = failureContinue
+	case "s", "S":
+		onFailure = failureStop
+	case "r", "R":
+		onFailure = failureRetry
+	}
+
+	note := promptBackupNote()
+	printBatchSummary(runBatchBackup(chosen, destDir, onFailure, note, cfg.Backup.Compression, cfg.Backup.CompressionLevel, configuredEncryption()))
+}
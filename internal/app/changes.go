@@ -0,0 +1,147 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// changesTop is how many changed files `changes` lists without --files.
+const changesTop = 20
+
+// changedFilesScript prints the files of the container's root filesystem
+// whose inode changed after the time given as $1 (Unix seconds). The change
+// time is used rather than the modification time because package managers
+// keep the packaged mtime of the files they install. -xdev keeps find off
+// the host directories distrobox mounts into the container. A find without
+// -newerct (such as BusyBox's) makes it fail rather than report no changes.
+const changedFilesScript = `find / -maxdepth 0 -newerct "@$1" >/dev/null 2>&1 || { echo "find in the container does not support -newerct"; exit 1; }
+find / -xdev \( -path /proc -o -path /sys -o -path /dev -o -path /run -o -path /tmp -o -path /var/tmp \) -prune -o ! -type d -newerct "@$1" -print 2>/dev/null; true`
+
+// changedPackagesScript prints the packages installed or upgraded after the
+// time given as $1, read from the package database of the container.
+const changedPackagesScript = `if command -v rpm >/dev/null 2>&1; then rpm -qa --qf '%{INSTALLTIME} %{NAME}\n' | awk -v t="$1" '$1 > t { print $2 }'
+elif [ -d /var/lib/dpkg/info ]; then find /var/lib/dpkg/info -name '*.list' -newerct "@$1" | sed 's#.*/##; s#\.list$##; s#:.*##'
+elif [ -d /var/lib/pacman/local ]; then find /var/lib/pacman/local -mindepth 1 -maxdepth 1 -type d -newerct "@$1" | sed 's#.*/##; s#-[^-]*-[^-]*$##'
+fi 2>/dev/null | sort -u`
+
+// containerChanges is what changed in a container since a point in time.
+type containerChanges struct {
+	Since    time.Time
+	Files    []string
+	Packages []string
+}
+
+// latestBackup finds the newest backup of a container in the default
+// folder and every configured destination.
+func latestBackup(container string) (storedBackup, pruneDestination, bool) {
+	var newest storedBackup
+	var where pruneDestination
+	found := false
+	for _, d := range pruneDestinations() {
+		backups, err := d.scan()
+		if err != nil {
+			logWarning(fmt.Sprintf("Could not read %s: %v", d, err))
+			continue
+		}
+		for _, b := range backups {
+			if b.Container == container && (!found || b.Created.After(newest.Created)) {
+				newest, where, found = b, d, true
+			}
+		}
+	}
+	return newest, where, found
+}
+
+// changesSince lists the files and packages of a container that changed
+// after since. A stopped container is started for it and stopped again.
+func changesSince(c Container, since time.Time) (*containerChanges, error) {
+	stop, err := startForExec(c)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+	ts := strconv.FormatInt(since.Unix(), 10)
+	out, err := runCommand(containerRuntime, "exec", "--user", "root", c.Name, "sh", "-c", changedFilesScript, "sh", ts)
+	if err != nil {
+		return nil, fmt.Errorf("could not list the changed files of '%s': %s", c.Name, strings.TrimSpace(out))
+	}
+	changes := &containerChanges{Since: since}
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "/") {
+			changes.Files = append(changes.Files, line)
+		}
+	}
+	sort.Strings(changes.Files)
+	if out, err := runCommand(containerRuntime, "exec", "--user", "root", c.Name, "sh", "-c", changedPackagesScript, "sh", ts); err == nil {
+		changes.Packages = strings.Fields(out)
+	}
+	return changes, nil
+}
+
+// printChanges summarizes changed files per top-level directory and lists
+// the first of them, or all of them with allFiles.
+func printChanges(changes *containerChanges, allFiles bool) {
+	fmt.Printf("%sChanged files:%s %d\n", colorBold, colorReset, len(changes.Files))
+	perDir := map[string]int{}
+	var dirs []string
+	for _, f := range changes.Files {
+		dir := "/" + strings.SplitN(strings.TrimPrefix(f, "/"), "/", 2)[0]
+		if perDir[dir] == 0 {
+			dirs = append(dirs, dir)
+		}
+		perDir[dir]++
+	}
+	sort.SliceStable(dirs, func(i, j int) bool { return perDir[dirs[i]] > perDir[dirs[j]] })
+	for _, dir := range dirs {
+		fmt.Printf("  %8d  %s\n", perDir[dir], dir)
+	}
+	if len(changes.Files) > 0 {
+		fmt.Println()
+		for i, f := range changes.Files {
+			if i == changesTop && !allFiles {
+				fmt.Printf("  ... and %d more (--files lists them all)\n", len(changes.Files)-i)
+				break
+			}
+			fmt.Printf("  %s\n", f)
+		}
+	}
+	fmt.Printf("\n%sPackages installed or upgraded:%s %d\n", colorBold, colorReset, len(changes.Packages))
+	if len(changes.Packages) > 0 {
+		fmt.Printf("  %s\n", strings.Join(changes.Packages, " "))
+	}
+	fmt.Println()
+}
+
+// showChanges compares a container with its latest backup and says whether
+// a new backup looks warranted. It returns false if it could not compare.
+func showChanges(c Container, allFiles bool) bool {
+	latest, dest, ok := latestBackup(c.Name)
+	if !ok {
+		logWarning(fmt.Sprintf("'%s' has no backup with a manifest in any destination; back it up to start tracking changes.", c.Name))
+		return false
+	}
+	logInfo(fmt.Sprintf("Latest backup: %s in %s, taken %s (%s).", latest.Name, dest, latest.Created.Local().Format("2006-01-02 15:04"), formatAge(time.Now(), latest.Created)))
+	if d, err := inspectContainer(c.Name); err == nil && d.Created.After(latest.Created) {
+		logWarning(fmt.Sprintf("'%s' was created after that backup, so every file of its image counts as changed.", c.Name))
+	}
+
+	done := make(chan bool)
+	go showSpinner("changes", fmt.Sprintf("Looking for changes in '%s'...", c.Name), done)
+	changes, err := changesSince(c, latest.Created)
+	done <- true
+	if err != nil {
+		logError(err.Error())
+		return false
+	}
+	fmt.Println()
+	printChanges(changes, allFiles)
+	if len(changes.Files) == 0 && len(changes.Packages) == 0 {
+		logSuccess("✅ Nothing changed since the latest backup; a new one is not needed.")
+	} else {
+		logInfo(fmt.Sprintf("%d files and %d packages changed since the latest backup; consider a new backup. Deleted files are not detected.", len(changes.Files), len(changes.Packages)))
+	}
+	return true
+}
@@ -0,0 +1,1411 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+const cliUsage = `usage: distrobox-tool [--progress=text|json] [command] [flags]
+
+Without a command the interactive menu is started.
+
+Commands:
+  list     [--json]                                   list distrobox containers
+  connections [--json]                                list podman system connections for -connection
+  backup   --container NAME | --group GROUP | --all
+           [--dest DIR|NAME|HOST:PATH] [--name BASE]
+           [--separate-home] [--note TEXT]
+           [--compress FORMAT] [--level N]
+           [--encrypt age|gpg|none] [--recipient KEY]
+           [--home-checksums] [--yes]                 back up containers
+  restore  --file ARCHIVE... [--name NAME] [--home DIR]
+           [--init] [--nvidia] [--jobs N] [--sandbox]
+           [--replace] [--yes]                        restore one or more backups
+  delete   --container NAME | --group GROUP --yes     delete containers
+  status   [--group GROUP]                            show container states
+  edit     --container NAME --type isolated|standard
+           [--home DIR] | --rename NEW [--yes]        convert a container's home type, or rename it
+  upgrade  NAME                                       upgrade with a rollback snapshot
+  migrate  --container NAME --to HOST|REFERENCE
+           [--name NEW] [--create]                    copy a container's image to another host or a registry
+  verify   --file ARCHIVE                             check a backup's checksums and readability
+  usage    --container NAME                           show the largest directories of a container and its home
+  changes  [--files] NAME                             list files and packages changed since the latest backup
+  history  [--container NAME] [--limit N] [--json]    show past backups, restores, deletes and other operations
+  bundle   export [--dest DIR] [--compress FORMAT] [--level N]
+           | import --file BUNDLE [--replace]         move every container and the distrobox config to another machine
+  system   backup --container NAME [--dest DIR] [--paths P,...]
+           | restore --file ARCHIVE (--container NAME | --name NEW)
+                                                      back up /etc, /opt and /usr/local alone, or lay them over a container
+  export   --container NAME [--dest DIR] [--name BASE]
+           [--format tar|squashfs|raw|qcow2] [--yes]  export the root filesystem as a tarball, SquashFS or disk image
+  snapshot create|list --container NAME
+           | rollback --container NAME [--to TAG]     keep local snapshot images and roll back to one
+  prune    [--dest NAME] [--yes]                      delete backups the retention policy drops
+  gc       [--all] [--json] [--yes]                   remove temporary images left by crashed or killed runs
+  destination check [--json] [NAME]                  test login, writing, free space and latency of destinations
+  trigger  [--socket PATH | --listen ADDR]            answer backup requests from other programs
+  shutdown-snapshot [--budget DURATION]
+           [--print-unit | --install]                 snapshot the [shutdown] containers, or set up the systemd unit
+  run      [--force] JOBFILE                          run the backup, prune, verify and check steps of a YAML/JSON job file
+  version  [--verbose]                                print the version, or build and environment details for bug reports
+  config   [show] | path | get KEY | set KEY VALUE
+           | unset KEY | edit                         view and change the settings in the config file
+  fleet    [push] [--dir DIR] [--json]                publish this host's catalog, or show backup coverage of every host
+  schedule list | enable NAME | disable NAME
+           | run [--force] NAME                       manage the systemd timers of [schedules.NAME];
+                                                      --force ignores the window, blackouts and [power]
+
+--yes answers every confirmation with yes; without it, questions are read
+from stdin and an empty answer means no.
+`
+
+// runSubcommand executes a non-menu command given on the command line and
+// returns the process exit code.
+func runSubcommand(args []string) int {
+	switch args[0] {
+	case "list":
+		return cmdList(args[1:])
+	case "connections":
+		return cmdConnections(args[1:])
+	case "backup":
+		return cmdBackup(args[1:])
+	case "restore":
+		return cmdRestore(args[1:])
+	case "delete":
+		return cmdDelete(args[1:])
+	case "edit":
+		return cmdEdit(args[1:])
+	case "upgrade":
+		return cmdUpgrade(args[1:])
+	case "migrate":
+		return cmdMigrate(args[1:])
+	case "verify":
+		return cmdVerify(args[1:])
+	case "usage":
+		return cmdUsage(args[1:])
+	case "bundle":
+		return cmdBundle(args[1:])
+	case "system":
+		return cmdSystem(args[1:])
+	case "export":
+		return cmdExport(args[1:])
+	case "snapshot":
+		return cmdSnapshot(args[1:])
+	case "changes":
+		return cmdChanges(args[1:])
+	case "history":
+		return cmdHistory(args[1:])
+	case "status":
+		return cmdStatus(args[1:])
+	case "run":
+		return cmdRun(args[1:])
+	case "schedule":
+		return cmdSchedule(args[1:])
+	case "fleet":
+		return cmdFleet(args[1:])
+	case "config":
+		return cmdConfig(args[1:])
+	case "trigger":
+		return cmdTrigger(args[1:])
+	case "shutdown-snapshot":
+		return cmdShutdownSnapshot(args[1:])
+	case "prune":
+		return cmdPrune(args[1:])
+	case "gc":
+		return cmdGC(args[1:])
+	case "destination":
+		return cmdDestination(args[1:])
+	case "version":
+		return cmdVersion(args[1:])
+	case "help":
+		fmt.Print(cliUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], cliUsage)
+		return 2
+	}
+}
+
+// newCommandFlags returns a flag set for a subcommand that reports errors
+// instead of exiting.
+func newCommandFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.BoolVar(&assumeYes, "yes", false, "answer yes to every confirmation")
+	return fs
+}
+
+// parseCommandFlags parses args and maps parse errors to exit codes.
+func parseCommandFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0, false
+		}
+		return 2, false
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "%s: unexpected argument %q\n", fs.Name(), fs.Arg(0))
+		return 2, false
+	}
+	return 0, true
+}
+
+// lookupGroup resolves a configured group to its existing containers,
+// warning about members that do not exist.
+func lookupGroup(group string) ([]Container, bool) {
+	if _, ok := cfg.Groups[group]; !ok {
+		logError(fmt.Sprintf("Group '%s' is not configured.", group))
+		return nil, false
+	}
+	containers, err := getContainers()
+	if err != nil {
+		logError(err.Error())
+		return nil, false
+	}
+	members, missing := groupMembers(group, containers)
+	for _, name := range missing {
+		logWarning(fmt.Sprintf("Container '%s' of group '%s' does not exist.", name, group))
+	}
+	return members, true
+}
+
+// batchExitCode prints the summary of a batch run and returns 0 if every
+// container succeeded, if need be after retries, 3 if the run was stopped
+// after a failure with containers left over, and 1 otherwise.
+func batchExitCode(results []batchResult) int {
+	printBatchSummary(results)
+	code := 0
+	for _, r := range results {
+		if r.Skipped && r.Reason == reasonStopped {
+			return 3
+		}
+		if r.Err != nil || r.Skipped {
+			code = 1
+		}
+	}
+	return code
+}
+
+// lookupContainer finds a container by name, logging when it does not exist.
+func lookupContainer(name string) (Container, bool) {
+	if name == "" {
+		fmt.Fprintln(os.Stderr, "--container is required")
+		return Container{}, false
+	}
+	containers, err := getContainers()
+	if err != nil {
+		logError(err.Error())
+		return Container{}, false
+	}
+	container, ok := findContainer(containers, name)
+	if !ok {
+		logError(fmt.Sprintf("Container '%s' not found.", name))
+	}
+	return container, ok
+}
+
+func cmdList(args []string) int {
+	fs := newCommandFlags("list")
+	asJSON := fs.Bool("json", false, "print the containers as JSON")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	containers, err := getContainers()
+	if err != nil {
+		logError(err.Error())
+		return 1
+	}
+
+	type listedContainer struct {
+		Name          string     `json:"name"`
+		ID            string     `json:"id"`
+		Image         string     `json:"image"`
+		ImageID       string     `json:"image_id,omitempty"`
+		Distro        string     `json:"distro,omitempty"`
+		DistroVersion string     `json:"distro_version,omitempty"`
+		Isolated      bool       `json:"isolated"`
+		Home          string     `json:"home,omitempty"`
+		State         string     `json:"state,omitempty"`
+		Created       *time.Time `json:"created,omitempty"`
+		Rootful       bool       `json:"rootful,omitempty"`
+		Manager       string     `json:"manager,omitempty"`
+	}
+	listed := []listedContainer{}
+	for _, c := range containers {
+		isolated, home := isContainerIsolated(c)
+		l := listedContainer{c.Name, c.ID, c.Image, c.ImageID, c.Distro, c.DistroVersion, isolated, home, c.State, nil, c.Rootful, c.Manager}
+		if !c.Created.IsZero() {
+			l.Created = &c.Created
+		}
+		listed = append(listed, l)
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(listed, "", "  ")
+		fmt.Fprintln(dataOut, string(out))
+		return 0
+	}
+	for _, c := range listed {
+		typeText := "standard"
+		if c.Isolated {
+			typeText = "isolated"
+		}
+		image := c.Image
+		if c.Manager == backup.ManagerToolbox {
+			image += " [toolbx]"
+		}
+		if c.Rootful {
+			image += " [root]"
+		}
+		fmt.Printf("%-25s %-9s %-20s %s\n", c.Name, typeText, distroString(c.Distro, c.DistroVersion), image)
+	}
+	return 0
+}
+
+func cmdBackup(args []string) int {
+	fs := newCommandFlags("backup")
+	name := fs.String("container", "", "container to back up")
+	group := fs.String("group", "", "back up every container of a configured group")
+	all := fs.Bool("all", false, "back up every container")
+	dest := fs.String("dest", "", "destination directory, user@host:/path or configured destination (default: [backup] dir from the config)")
+	base := fs.String("name", "", "base name of the backup file (default: the container name)")
+	separateHome := fs.Bool("separate-home", false, "archive an isolated home as a separate .tar.gz instead of inside the backup")
+	homeChecksums := fs.Bool("home-checksums", cfg.Backup.HomeChecksums, "record per-file checksums of the separate home archive")
+	note := fs.String("note", "", "note stored in the backup manifest")
+	compress := fs.String("compress", cfg.Backup.Compression.String(), "compression: none, gzip, zstd or xz")
+	level := fs.Int("level", 0, "compression level (default: the configured or the format's default)")
+	encrypt := fs.String("encrypt", cfg.Encryption.Method.String(), "encryption: none, age or gpg")
+	recipient := fs.String("recipient", "", "age public key or recipients file, or gpg key ID (default: the configured recipient)")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	comp, err := backup.ParseCompression(*compress)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := checkCompressor(comp); err != nil {
+		logError(err.Error())
+		return 1
+	}
+	enc := backup.Encryption{Recipient: expandHome(*recipient)}
+	if enc.Cipher, err = backup.ParseCipher(*encrypt); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if enc.Recipient == "" && enc.Cipher == cfg.Encryption.Method {
+		enc.Recipient = configuredEncryption().Recipient
+	}
+	switch {
+	case enc.Cipher == backup.EncryptNone:
+		enc.Recipient = ""
+	case enc.Recipient == "":
+		fmt.Fprintf(os.Stderr, "--recipient is required for %s encryption\n", enc.Cipher)
+		return 2
+	case *separateHome:
+		fmt.Fprintln(os.Stderr, "--separate-home cannot be combined with encryption; the home is encrypted inside the backup")
+		return 2
+	}
+	if err := checkCipher(enc.Cipher); err != nil {
+		logError(err.Error())
+		return 1
+	}
+	if *level == 0 && comp == cfg.Backup.Compression {
+		*level = cfg.Backup.CompressionLevel
+	}
+	destDir := resolveBackupDest(*dest)
+
+	if *group != "" || *all {
+		if *name != "" || *base != "" || (*group != "" && *all) {
+			fmt.Fprintln(os.Stderr, "--all and --group cannot be combined with each other, --container or --name")
+			return 2
+		}
+		var members []Container
+		if *all {
+			containers, err := getContainers()
+			if err != nil {
+				logError(err.Error())
+				return 1
+			}
+			members = containers
+		} else {
+			var ok bool
+			if members, ok = lookupGroup(*group); !ok {
+				return 1
+			}
+		}
+		if err := prepareBackupDest(destDir); err != nil {
+			logError(err.Error())
+			return 1
+		}
+		return batchExitCode(runBatchBackup(members, destDir, cfg.Batch.OnFailure, *note, comp, *level, enc))
+	}
+
+	container, ok := lookupContainer(*name)
+	if !ok {
+		return 1
+	}
+	defer routeTo(container)()
+	if err := prepareBackupDest(destDir); err != nil {
+		logError(err.Error())
+		return 1
+	}
+	if *base != "" {
+		warnNameCollisions(*base, destDir)
+	}
+	if *base == "" {
+		*base = templateBaseName(container.Name, time.Now())
+	}
+	if *base == "" {
+		*base = container.Name
+	}
+	isIsolated, _ := isContainerIsolated(container)
+	file, upload, err := backupPath(destDir, backupFileName(*base, isIsolated, comp, enc.Cipher))
+	if err != nil {
+		logError(err.Error())
+		return 1
+	}
+	job := backupJob{
+		Container:     container,
+		File:          file,
+		Upload:        upload,
+		SeparateHome:  isIsolated && *separateHome,
+		BundleHome:    isIsolated && !*separateHome,
+		HomeChecksums: *homeChecksums,
+		Note:          *note,
+		Compression:   comp,
+		Level:         *level,
+		Encryption:    enc,
+	}
+	if isIsolated && !hasTar {
+		logError("The 'tar' command is required to back up an isolated home but was not found.")
+		return 1
+	}
+	if existing := job.existingOutputs(); len(existing) > 0 && !assumeYes {
+		logError(fmt.Sprintf("'%s' already exists; pass --yes to overwrite it.", existing[0]))
+		return 1
+	}
+	if _, err := runBackupJob(job); err != nil {
+		logError(err.Error())
+		return 1
+	}
+	return 0
+}
+
+func cmdRestore(args []string) int {
+	fs := newCommandFlags("restore")
+	var files stringList
+	fs.Var(&files, "file", "backup archive to restore (repeat to restore several)")
+	name := fs.String("name", "", "name of the new container (default: the name in the manifest)")
+	init := fs.Bool("init", false, "enable systemd (init) in the container; always on when the backed-up container had it")
+	nvidia := fs.Bool("nvidia", false, "enable NVIDIA GPU integration; always on when the backed-up container had it")
+	jobs := fs.Int("jobs", 1, "number of restores to run at the same time")
+	replace := fs.Bool("replace", false, "replace an existing container of the same name once the new one passes a smoke test")
+	home := fs.String("home", "", "new or empty folder for the isolated home (default: the one in the manifest, or under the home root)")
+	sandbox := fs.Bool("sandbox", false, "restore an untrusted backup into a locked-down container for inspection")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	switch {
+	case len(files) == 0:
+		fmt.Fprintln(os.Stderr, "--file is required")
+		return 2
+	case len(files) > 1 && (*name != "" || *home != ""):
+		fmt.Fprintln(os.Stderr, "--name and --home can only be used with a single --file")
+		return 2
+	case *sandbox && (len(files) > 1 || *replace || *init || *nvidia):
+		fmt.Fprintln(os.Stderr, "--sandbox takes a single --file and cannot be combined with --replace, --init or --nvidia")
+		return 2
+	case *jobs < 1:
+		fmt.Fprintln(os.Stderr, "--jobs must be at least 1")
+		return 2
+	case *jobs > 1 && !assumeYes:
+		fmt.Fprintln(os.Stderr, "parallel restores cannot ask questions; pass --yes with --jobs")
+		return 2
+	}
+
+	if len(files) > 1 {
+		items, err := planRestore(files)
+		if err != nil {
+			logError(err.Error())
+			return 1
+		}
+		printRestoreOrder(items)
+		return batchExitCode(runBatchRestore(items, *jobs, *init, *nvidia, *replace))
+	}
+
+	if *home != "" {
+		*home = filepath.Clean(expandHome(*home))
+		if err := checkHomeTarget(*home); err != nil {
+			fmt.Fprintf(os.Stderr, "--home: %v\n", err)
+			return 2
+		}
+	}
+	containerName, err := restoreUnattended(files[0], *name, *home, *init, *nvidia, *replace, *sandbox)
+	if err != nil {
+		logError(err.Error())
+		return 1
+	}
+	if !*sandbox {
+		maybeSmokeTest(containerName)
+	}
+	return 0
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func cmdDelete(args []string) int {
+	fs := newCommandFlags("delete")
+	name := fs.String("container", "", "container to delete")
+	group := fs.String("group", "", "delete every container of a configured group")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if *group != "" {
+		members, ok := lookupGroup(*group)
+		if !ok {
+			return 1
+		}
+		if !assumeYes {
+			logError(fmt.Sprintf("Refusing to delete group '%s' without --yes.", *group))
+			return 1
+		}
+		return batchExitCode(deleteContainers(members))
+	}
+	container, ok := lookupContainer(*name)
+	if !ok {
+		return 1
+	}
+	defer routeTo(container)()
+	if !assumeYes {
+		logError(fmt.Sprintf("Refusing to delete '%s' without --yes.", container.Name))
+		return 1
+	}
+	if err := deleteContainer(container); err != nil {
+		logError(fmt.Sprintf("Failed to delete container '%s': %v", container.Name, err))
+		return 1
+	}
+	logSuccess(fmt.Sprintf("🗑️ Container '%s' has been deleted.", container.Name))
+	return 0
+}
+
+func cmdEdit(args []string) int {
+	fs := newCommandFlags("edit")
+	name := fs.String("container", "", "container to convert or rename")
+	target := fs.String("type", "", "new home type: 'isolated' or 'standard'")
+	rename := fs.String("rename", "", "new name of the container")
+	home := fs.String("home", "", "folder for the isolated home with --type isolated (default: under the home root)")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if *home != "" && *target != backup.IsolationIsolated {
+		fmt.Fprintln(os.Stderr, "--home can only be used with --type isolated")
+		return 2
+	}
+	if (*target == "") == (*rename == "") {
+		fmt.Fprintln(os.Stderr, "give either --type or --rename")
+		return 2
+	}
+	if *rename == "" && *target != backup.IsolationIsolated && *target != backup.IsolationStandard {
+		fmt.Fprintln(os.Stderr, "--type must be 'isolated' or 'standard'")
+		return 2
+	}
+	container, ok := lookupContainer(*name)
+	if !ok {
+		return 1
+	}
+	defer routeTo(container)()
+	if *rename != "" {
+		if err := checkRenameTarget(container, *rename); err != nil {
+			logError(err.Error())
+			return 1
+		}
+		fmt.Printf("%s> Recreate '%s' as '%s'? (y/N): %s", colorBold, container.Name, *rename, colorReset)
+		if !confirmAction() || !safetyBackup(container, "rename") {
+			logInfo("Edit cancelled.")
+			return 1
+		}
+		if err := renameContainer(container, *rename); err != nil {
+			logError(err.Error())
+			return 1
+		}
+		logSuccess(fmt.Sprintf("✅ Container '%s' was renamed to '%s'.", container.Name, *rename))
+		return 0
+	}
+	if container.Manager == backup.ManagerToolbox {
+		logError(fmt.Sprintf("'%s' is a toolbx container, which always shares your home; it can only be renamed.", container.Name))
+		return 1
+	}
+	isIsolated, isolatedHomePath := isContainerIsolated(container)
+	toIsolated := *target == backup.IsolationIsolated
+	if toIsolated == isIsolated {
+		logInfo(fmt.Sprintf("Container '%s' is already %s.", container.Name, *target))
+		return 0
+	}
+
+	createOpts := containerCreateOptions(container.Name)
+	createOpts.Name = container.Name
+	if toIsolated {
+		createOpts.Home, _ = getIsolatedHomePath(container.Name)
+		if *home != "" {
+			createOpts.Home = filepath.Clean(expandHome(*home))
+		}
+	}
+	createOpts.Image = fmt.Sprintf("distrobox-convert-%s:<uuid>", container.ID)
+	printConversionPlan(container, toIsolated, isolatedHomePath, createOpts)
+	fmt.Printf("%s> Convert '%s' to %s following this plan? (y/N): %s", colorBold, container.Name, *target, colorReset)
+	if !confirmAction() {
+		logInfo("Edit cancelled.")
+		return 1
+	}
+	if !safetyBackup(container, "conversion") {
+		logInfo("Edit cancelled.")
+		return 1
+	}
+	if err := convertContainer(container, createOpts, isolatedHomePath); err != nil {
+		logError(err.Error())
+		return 1
+	}
+	logSuccess(fmt.Sprintf("✅ Container '%s' successfully converted to %s!", container.Name, *target))
+	return 0
+}
+
+func cmdMigrate(args []string) int {
+	fs := newCommandFlags("migrate")
+	name := fs.String("container", "", "container to migrate")
+	to := fs.String("to", "", "SSH host ([user@]host or a destination name), or an image reference such as docker://registry/repo:tag")
+	newName := fs.String("name", "", "name of the container on the other host (default: the same name)")
+	create := fs.Bool("create", false, "create the distrobox on the SSH host once the image is there")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if *to == "" {
+		fmt.Fprintln(os.Stderr, "--to is required")
+		return 2
+	}
+	container, ok := lookupContainer(*name)
+	if !ok {
+		return 1
+	}
+	defer routeTo(container)()
+	if *newName == "" {
+		*newName = container.Name
+	}
+	if err := migrateContainer(container, *to, *newName, *create); err != nil {
+		logError(err.Error())
+		return 1
+	}
+	return 0
+}
+
+func cmdUpgrade(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: distrobox-tool upgrade <container>")
+		return 2
+	}
+	container, ok := lookupContainer(args[0])
+	if !ok {
+		return 1
+	}
+	defer routeTo(container)()
+	if !upgradeWithSnapshot(container) {
+		return 1
+	}
+	return 0
+}
+
+func cmdChanges(args []string) int {
+	fs := newCommandFlags("changes")
+	allFiles := fs.Bool("files", false, "list every changed file, not only the first ones")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: distrobox-tool changes [--files] <container>")
+		return 2
+	}
+	container, ok := lookupContainer(fs.Arg(0))
+	if !ok {
+		return 1
+	}
+	if !showChanges(container, *allFiles) {
+		return 1
+	}
+	return 0
+}
+
+func cmdHistory(args []string) int {
+	fs := newCommandFlags("history")
+	name := fs.String("container", "", "only show the operations on this container")
+	limit := fs.Int("limit", 50, "show at most N operations, newest first (0 for all)")
+	asJSON := fs.Bool("json", false, "print the operations as JSON")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	records, skipped, err := readOperationHistory()
+	if err != nil {
+		logError(fmt.Sprintf("Could not read the operation log: %v", err))
+		return 1
+	}
+	if skipped > 0 {
+		logWarning(fmt.Sprintf("%d log lines could not be read (encrypted with another key, or damaged).", skipped))
+	}
+	records = filterHistory(records, *name, *limit)
+	if *asJSON {
+		if records == nil {
+			records = []logRecord{}
+		}
+		out, _ := json.MarshalIndent(records, "", "  ")
+		fmt.Fprintln(dataOut, string(out))
+		return 0
+	}
+	printHistory(records)
+	return 0
+}
+
+func cmdVerify(args []string) int {
+	fs := newCommandFlags("verify")
+	file := fs.String("file", "", "backup archive to check")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "--file is required")
+		return 2
+	}
+	if !verifyBackup(*file) {
+		return 1
+	}
+	return 0
+}
+
+func cmdUsage(args []string) int {
+	fs := newCommandFlags("usage")
+	name := fs.String("container", "", "container to measure")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	c, ok := lookupContainer(*name)
+	if !ok {
+		return 1
+	}
+	defer routeTo(c)()
+	if !showUsage(c) {
+		return 1
+	}
+	return 0
+}
+
+const bundleUsage = `usage: distrobox-tool bundle export [--dest DIR] [--compress FORMAT] [--level N]
+       distrobox-tool bundle import --file BUNDLE [--replace]`
+
+func cmdBundle(args []string) int {
+	if len(args) == 0 || (args[0] != "export" && args[0] != "import") {
+		fmt.Fprintln(os.Stderr, bundleUsage)
+		return 2
+	}
+	fs := newCommandFlags("bundle " + args[0])
+	if args[0] == "import" {
+		file := fs.String("file", "", "machine bundle to import")
+		replace := fs.Bool("replace", false, "replace containers that already exist")
+		if code, ok := parseCommandFlags(fs, args[1:]); !ok {
+			return code
+		}
+		if *file == "" {
+			fmt.Fprintln(os.Stderr, "--file is required")
+			return 2
+		}
+		results, err := importMachineBundle(expandHome(*file), *replace)
+		if err != nil {
+			logError(err.Error())
+			return 1
+		}
+		return batchExitCode(results)
+	}
+
+	dest := fs.String("dest", "", "local folder to write the bundle to (default: [backup] dir from the config)")
+	compress := fs.String("compress", cfg.Backup.Compression.String(), "compression of the archives inside: none, gzip, zstd or xz")
+	level := fs.Int("level", 0, "compression level (default: the configured or the format's default)")
+	if code, ok := parseCommandFlags(fs, args[1:]); !ok {
+		return code
+	}
+	comp, err := backup.ParseCompression(*compress)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := checkCompressor(comp); err != nil {
+		logError(err.Error())
+		return 1
+	}
+	if *level == 0 && comp == cfg.Backup.Compression {
+		*level = cfg.Backup.CompressionLevel
+	}
+	containers, err := getContainers()
+	if err != nil {
+		logError(err.Error())
+		return 1
+	}
+	path, results, err := exportMachineBundle(containers, resolveBackupDest(*dest), comp, *level)
+	code := batchExitCode(results)
+	if err != nil {
+		logError(fmt.Sprintf("The bundle could not be written: %v", err))
+		return 1
+	}
+	logSuccess(fmt.Sprintf("✅ Bundle written to %s.", path))
+	return code
+}
+
+const systemUsage = `usage: distrobox-tool system backup --container NAME [--dest DIR] [--paths P,...]
+       distrobox-tool system restore --file ARCHIVE (--container NAME | --name NEW)`
+
+func cmdSystem(args []string) int {
+	if len(args) == 0 || (args[0] != "backup" && args[0] != "restore") {
+		fmt.Fprintln(os.Stderr, systemUsage)
+		return 2
+	}
+	fs := newCommandFlags("system " + args[0])
+	if args[0] == "restore" {
+		file := fs.String("file", "", "system files backup to restore")
+		name := fs.String("container", "", "existing container to restore into")
+		newName := fs.String("name", "", "create this container from the backup's base image and restore into it")
+		if code, ok := parseCommandFlags(fs, args[1:]); !ok {
+			return code
+		}
+		if *file == "" {
+			fmt.Fprintln(os.Stderr, "--file is required")
+			return 2
+		}
+		if (*name == "") == (*newName == "") {
+			fmt.Fprintln(os.Stderr, "exactly one of --container and --name is required")
+			return 2
+		}
+		path := expandHome(*file)
+		m := quietManifest(path)
+		if m == nil || len(m.SystemPaths) == 0 {
+			logError(fmt.Sprintf("%s has no system files manifest.", path))
+			return 1
+		}
+		var target Container
+		if *newName != "" {
+			containers, err := getContainers()
+			if err != nil {
+				logError(err.Error())
+				return 1
+			}
+			if _, taken := findContainer(containers, *newName); taken {
+				logError(fmt.Sprintf("A container named '%s' already exists.", *newName))
+				return 1
+			}
+			if target, err = createFromBaseImage(m, *newName); err != nil {
+				logError(err.Error())
+				return 1
+			}
+		} else {
+			var ok bool
+			if target, ok = lookupContainer(*name); !ok {
+				return 1
+			}
+			defer routeTo(target)()
+		}
+		if err := restoreSystemFiles(path, target); err != nil {
+			logError(err.Error())
+			return 1
+		}
+		logSuccess(fmt.Sprintf("✅ System files restored into '%s'.", target.Name))
+		if !maybeCheckPackages(target, m.Packages) {
+			return 1
+		}
+		return 0
+	}
+
+	name := fs.String("container", "", "container to back up")
+	dest := fs.String("dest", "", "local folder to write the backup to (default: [backup] dir from the config)")
+	paths := fs.String("paths", strings.Join(cfg.Backup.SystemPaths, ","), "comma-separated absolute paths to archive")
+	if code, ok := parseCommandFlags(fs, args[1:]); !ok {
+		return code
+	}
+	var list []string
+	for _, p := range strings.Split(*paths, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if !strings.HasPrefix(p, "/") || p == "/" {
+			fmt.Fprintf(os.Stderr, "--paths: %q must be an absolute path below /\n", p)
+			return 2
+		}
+		list = append(list, p)
+	}
+	if len(list) == 0 {
+		fmt.Fprintln(os.Stderr, "--paths is empty")
+		return 2
+	}
+	c, ok := lookupContainer(*name)
+	if !ok {
+		return 1
+	}
+	defer routeTo(c)()
+	destDir := resolveBackupDest(*dest)
+	if _, remote := parseRemote(destDir); remote {
+		logError("System files are backed up to a local folder.")
+		return 1
+	}
+	if err := makeBackupDir(destDir); err != nil {
+		logError(fmt.Sprintf("could not create the destination folder: %v", err))
+		return 1
+	}
+	file := systemArchivePath(destDir, c.Name)
+	if err := backupSystemFiles(c, file, list); err != nil {
+		logError(err.Error())
+		return 1
+	}
+	logSuccess(fmt.Sprintf("✅ System files of '%s' saved to %s.", c.Name, file))
+	return 0
+}
+
+func cmdGC(args []string) int {
+	fs := newCommandFlags("gc")
+	all := fs.Bool("all", false, "also remove images that may be the only copy of a converted or renamed container")
+	asJSON := fs.Bool("json", false, "list the leftover images as JSON without removing them")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	orphans, err := findOrphanedImages()
+	if err != nil {
+		logError(fmt.Sprintf("Could not look for leftover images: %v", err))
+		return 1
+	}
+	if *asJSON {
+		if orphans == nil {
+			orphans = []orphanImage{}
+		}
+		out, _ := json.MarshalIndent(orphans, "", "  ")
+		fmt.Fprintln(dataOut, string(out))
+		return 0
+	}
+	if len(orphans) == 0 {
+		logInfo("No leftover temporary images.")
+		return 0
+	}
+	printOrphans(orphans)
+	removable, size, onlyCopies := orphanTotals(orphans)
+	if onlyCopies > 0 && !*all {
+		logWarning(fmt.Sprintf("%d image(s) may be the only copy of a container removed by an interrupted conversion or rename; they are kept. Recreate the container from one with 'distrobox create --name NAME --image IMAGE', or pass --all to remove them too.", onlyCopies))
+	}
+	if *all {
+		removable += onlyCopies
+		for _, o := range orphans {
+			if o.OnlyCopy {
+				size += o.Size
+			}
+		}
+	}
+	if removable == 0 {
+		return 0
+	}
+	fmt.Printf("%s> Remove %d image(s), reclaiming up to %s? (y/N): %s", colorBold, removable, formatBytes(uint64(size)), colorReset)
+	if !confirmAction() {
+		return 1
+	}
+	removed, freed := removeOrphanedImages(orphans, *all)
+	logSuccess(fmt.Sprintf("✅ Removed %d image(s), reclaiming up to %s.", removed, formatBytes(uint64(freed))))
+	if removed < removable {
+		return 1
+	}
+	return 0
+}
+
+func cmdExport(args []string) int {
+	fs := newCommandFlags("export")
+	name := fs.String("container", "", "container to export")
+	dest := fs.String("dest", "", "local folder to write the export to (default: [backup] dir from the config)")
+	base := fs.String("name", "", "base name of the export (default: the container name)")
+	format := fs.String("format", exportTar, "tar, squashfs, raw or qcow2")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if !slices.Contains(exportFormats, *format) {
+		fmt.Fprintf(os.Stderr, "--format must be one of %s\n", strings.Join(exportFormats, ", "))
+		return 2
+	}
+	c, ok := lookupContainer(*name)
+	if !ok {
+		return 1
+	}
+	defer routeTo(c)()
+	destDir := resolveBackupDest(*dest)
+	if _, remote := parseRemote(destDir); remote {
+		logError("Exports can only be written to a local folder.")
+		return 1
+	}
+	if err := makeBackupDir(destDir); err != nil {
+		logError(fmt.Sprintf("could not create the destination folder: %v", err))
+		return 1
+	}
+	if *base == "" {
+		*base = c.Name
+	}
+	file := exportFileName(destDir, *base, *format)
+	if fileExists(file) {
+		fmt.Printf("%s> %s already exists. Overwrite? (y/N): %s", colorYellow, file, colorReset)
+		if !confirmAction() {
+			return 1
+		}
+	}
+	if err := exportContainer(c, file, *format); err != nil {
+		logError(err.Error())
+		return 1
+	}
+	logSuccess(fmt.Sprintf("✅ Root filesystem of '%s' exported to %s.", c.Name, file))
+	logInfo(exportHint(file, *format))
+	return 0
+}
+
+const snapshotUsage = `usage: distrobox-tool snapshot create --container NAME
+       distrobox-tool snapshot list --container NAME
+       distrobox-tool snapshot rollback --container NAME [--to TAG]`
+
+func cmdSnapshot(args []string) int {
+	if len(args) == 0 || (args[0] != "create" && args[0] != "list" && args[0] != "rollback") {
+		fmt.Fprintln(os.Stderr, snapshotUsage)
+		return 2
+	}
+	fs := newCommandFlags("snapshot " + args[0])
+	name := fs.String("container", "", "container whose snapshots to use")
+	var to *string
+	if args[0] == "rollback" {
+		to = fs.String("to", "", "snapshot tag or image to roll back to (default: the newest)")
+	}
+	if code, ok := parseCommandFlags(fs, args[1:]); !ok {
+		return code
+	}
+	container, ok := lookupContainer(*name)
+	if !ok {
+		return 1
+	}
+	defer routeTo(container)()
+	switch args[0] {
+	case "create":
+		image, err := snapshotContainer(container)
+		if err != nil {
+			logError(err.Error())
+			return 1
+		}
+		logSuccess(fmt.Sprintf("✅ Snapshot saved as '%s'.", image))
+	case "list":
+		snaps := listSnapshots(container.Name, "")
+		if len(snaps) == 0 {
+			logInfo(fmt.Sprintf("'%s' has no snapshots.", container.Name))
+		}
+		printSnapshots(snaps)
+	case "rollback":
+		snaps := listSnapshots(container.Name, "")
+		snap, found := latestSnapshot(snaps)
+		if *to != "" {
+			snap, found = findSnapshot(snaps, *to)
+		}
+		if !found {
+			logError(fmt.Sprintf("No snapshot of '%s' to roll back to.", container.Name))
+			return 1
+		}
+		if !rollbackToSnapshot(container, snap) {
+			return 1
+		}
+	}
+	return 0
+}
+
+func cmdPrune(args []string) int {
+	fs := newCommandFlags("prune")
+	dest := fs.String("dest", "", "only prune this configured destination (default: all of them and the [backup] dir)")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	dests, ok := findPruneDestinations(*dest)
+	if !ok {
+		logError(fmt.Sprintf("Destination '%s' is not configured.", *dest))
+		return 1
+	}
+	plans := planPrune(dests)
+	count, _ := printPrunePlan(plans)
+	fmt.Println()
+	if count == 0 {
+		logInfo("Nothing to prune.")
+		return 0
+	}
+	if !assumeYes {
+		logInfo(fmt.Sprintf("%d backups would be deleted; pass --yes to delete them.", count))
+		return 0
+	}
+	if runPrune(plans) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func cmdRun(args []string) int {
+	fs := newCommandFlags("run")
+	force := fs.Bool("force", false, "ignore the [power] battery and metered-connection checks")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: distrobox-tool run [--force] <jobfile>")
+		return 2
+	}
+	jf, err := loadJobFile(fs.Arg(0))
+	if err != nil {
+		logError(err.Error())
+		return 2
+	}
+	return runScheduledJob(jf, *force)
+}
+
+// runScheduledJob runs a job once the [power] policy allows it, unless
+// force is set. A run the policy skips counts as a success.
+func runScheduledJob(jf *jobFile, force bool) int {
+	if !force && !waitForPower(jf.usesNetwork()) {
+		return 0
+	}
+	if !runJobFile(jf) {
+		return 1
+	}
+	return 0
+}
+
+func cmdFleet(args []string) int {
+	push := len(args) > 0 && args[0] == "push"
+	if push {
+		args = args[1:]
+	}
+	fs := newCommandFlags("fleet")
+	dirFlag := fs.String("dir", "", "fleet folder (default: [fleet] dir)")
+	asJSON := false
+	if !push {
+		fs.BoolVar(&asJSON, "json", false, "print the coverage as JSON")
+	}
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	dir, err := fleetDir(*dirFlag)
+	if err != nil {
+		logError(err.Error())
+		return 2
+	}
+
+	if push {
+		catalog, err := buildCatalog()
+		if err != nil {
+			logError(err.Error())
+			return 1
+		}
+		path, err := pushCatalog(dir, catalog)
+		if err != nil {
+			logError(fmt.Sprintf("Could not write the catalog: %v", err))
+			return 1
+		}
+		logSuccess(fmt.Sprintf("✅ Published %d container(s) and %d backup(s) to %s.", len(catalog.Containers), len(catalog.Backups), path))
+		return 0
+	}
+
+	catalogs, err := loadFleet(dir)
+	if err != nil {
+		logError(fmt.Sprintf("Could not read the fleet folder: %v", err))
+		return 1
+	}
+	now := time.Now()
+	views := fleetCoverage(catalogs, cfg.Fleet.StaleAfter, now)
+	if asJSON {
+		if views == nil {
+			views = []fleetHostView{}
+		}
+		out, _ := json.MarshalIndent(views, "", "  ")
+		fmt.Fprintln(dataOut, string(out))
+	} else if len(views) == 0 {
+		logInfo(fmt.Sprintf("No catalogs in %s yet; run 'distrobox-tool fleet push' on each host.", dir))
+	} else {
+		printFleet(views, now)
+	}
+	if fleetProblems(views) > 0 {
+		return 1
+	}
+	return 0
+}
+
+const configUsage = "usage: distrobox-tool config [show] | path | get KEY | set KEY VALUE | unset KEY | edit"
+
+func cmdConfig(args []string) int {
+	sub := "show"
+	if len(args) > 0 {
+		sub, args = args[0], args[1:]
+	}
+	wantArgs := map[string]int{"show": 0, "path": 0, "edit": 0, "get": 1, "unset": 1, "set": 2}
+	if n, ok := wantArgs[sub]; !ok || len(args) != n {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+	path, err := configPath()
+	if err != nil {
+		logError(err.Error())
+		return 1
+	}
+
+	switch sub {
+	case "show":
+		if fileExists(path) {
+			fmt.Printf("# %s\n", path)
+		} else {
+			fmt.Printf("# %s (not created yet; showing the defaults)\n", path)
+		}
+		printSettings(false)
+		fmt.Printf("\n%d group(s), %d destination(s), %d schedule(s) configured.\n", len(cfg.Groups), len(cfg.Destinations), len(cfg.Schedules))
+		return 0
+	case "path":
+		fmt.Println(path)
+		return 0
+	case "edit":
+		c, err := editConfigFile()
+		if err != nil {
+			logError(err.Error())
+			return 1
+		}
+		cfg = c
+		return 0
+	}
+
+	s, ok := findSetting(args[0])
+	if !ok {
+		logError(fmt.Sprintf("Unknown setting '%s'; 'distrobox-tool config' lists them. Other keys are changed with 'config edit'.", args[0]))
+		return 2
+	}
+	switch sub {
+	case "get":
+		fmt.Println(s.Value(cfg))
+		return 0
+	case "set":
+		if _, err := saveSetting(s.Key, settingLiteral(args[1])); err != nil {
+			logError(fmt.Sprintf("Not saved: %v", err))
+			return 1
+		}
+	case "unset":
+		if _, err := saveSetting(s.Key, ""); err != nil {
+			logError(fmt.Sprintf("Not saved: %v", err))
+			return 1
+		}
+	}
+	return 0
+}
+
+const scheduleUsage = "usage: distrobox-tool schedule list | enable NAME | disable NAME | run [--force] NAME"
+
+func cmdSchedule(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, scheduleUsage)
+		return 2
+	}
+	if args[0] == "list" {
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, scheduleUsage)
+			return 2
+		}
+		printSchedules()
+		return 0
+	}
+
+	fs := newCommandFlags("schedule " + args[0])
+	force := false
+	if args[0] == "run" {
+		fs.BoolVar(&force, "force", false, "ignore the schedule's window and blackouts and the [power] checks")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, scheduleUsage)
+		return 2
+	}
+	name := fs.Arg(0)
+	s, configured := cfg.Schedules[name]
+
+	switch args[0] {
+	case "enable":
+		if !configured {
+			logError(fmt.Sprintf("No schedule named '%s' in the config file.", name))
+			return 2
+		}
+		if err := enableSchedule(name, s); err != nil {
+			logError(fmt.Sprintf("Could not enable schedule '%s': %v", name, err))
+			return 1
+		}
+		logSuccess(fmt.Sprintf("✅ Schedule '%s' enabled (%s).", name, s.Calendar))
+		return 0
+	case "disable":
+		// Allowed for schedules since removed from the config.
+		if err := disableSchedule(name); err != nil {
+			logError(fmt.Sprintf("Could not disable schedule '%s': %v", name, err))
+			return 1
+		}
+		logSuccess(fmt.Sprintf("✅ Schedule '%s' disabled.", name))
+		return 0
+	case "run":
+		if !configured {
+			logError(fmt.Sprintf("No schedule named '%s' in the config file.", name))
+			return 2
+		}
+		jf, err := scheduleJob(s)
+		if err != nil {
+			logError(fmt.Sprintf("schedules.%s: %v", name, err))
+			return 2
+		}
+		if !force {
+			if !waitForHours(s.Hours, s.Outside) {
+				return 0
+			}
+			jf.hours = s.Hours
+		}
+		return runScheduledJob(jf, force)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown schedule command %q\n%s\n", args[0], scheduleUsage)
+		return 2
+	}
+}
+
+func cmdTrigger(args []string) int {
+	fs := newCommandFlags("trigger")
+	socket := fs.String("socket", cfg.Trigger.Socket, "unix socket to listen on (default: $XDG_RUNTIME_DIR/"+appName+".sock)")
+	listen := fs.String("listen", cfg.Trigger.Listen, "loopback address to serve HTTP on instead, e.g. 127.0.0.1:8765; needs [trigger] token")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if *socket != "" && *listen != "" {
+		fmt.Fprintln(os.Stderr, "--socket and --listen cannot be combined")
+		return 2
+	}
+	if *socket == "" && *listen == "" {
+		var err error
+		if *socket, err = defaultTriggerSocket(); err != nil {
+			logError(err.Error())
+			return 2
+		}
+	}
+	token := ""
+	if cfg.Trigger.Token != "" {
+		var err error
+		if token, err = resolveSecret(cfg.Trigger.Token); err != nil {
+			logError(fmt.Sprintf("trigger.token: %v", err))
+			return 1
+		}
+	}
+	if err := serveTrigger(expandHome(*socket), *listen, token); err != nil {
+		logError(err.Error())
+		return 1
+	}
+	return 0
+}
+
+func cmdShutdownSnapshot(args []string) int {
+	fs := newCommandFlags("shutdown-snapshot")
+	budget := fs.Duration("budget", cfg.Shutdown.TimeBudget, "stop starting snapshots after this long")
+	printUnit := fs.Bool("print-unit", false, "print the systemd user unit instead of taking snapshots")
+	install := fs.Bool("install", false, "write the systemd user unit to ~/.config/systemd/user")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if *budget <= 0 {
+		fmt.Fprintln(os.Stderr, "--budget must be positive")
+		return 2
+	}
+	switch {
+	case *printUnit && *install:
+		fmt.Fprintln(os.Stderr, "--print-unit and --install cannot be combined")
+		return 2
+	case *printUnit:
+		exe, err := os.Executable()
+		if err != nil {
+			logError(err.Error())
+			return 1
+		}
+		fmt.Print(shutdownUnit(exe, *budget))
+		return 0
+	case *install:
+		if err := unattendedUnlock(); err != nil {
+			logError(err.Error())
+			return 1
+		}
+		path, err := installShutdownUnit(*budget)
+		if err != nil {
+			logError(fmt.Sprintf("Could not write the unit: %v", err))
+			return 1
+		}
+		logSuccess(fmt.Sprintf("✅ Wrote %s.", path))
+		logInfo(fmt.Sprintf("Enable it with: systemctl --user daemon-reload && systemctl --user enable --now %s", shutdownUnitName))
+		return 0
+	}
+
+	containers, err := shutdownContainers()
+	if err != nil {
+		logError(err.Error())
+		return 1
+	}
+	if runShutdownSnapshots(containers, *budget) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func cmdStatus(args []string) int {
+	fs := newCommandFlags("status")
+	group := fs.String("group", "", "only show the containers of a configured group")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if *group == "" {
+		containers, err := getContainers()
+		if err != nil {
+			logError(err.Error())
+			return 1
+		}
+		printGroupStatus(containers, nil)
+		return 0
+	}
+	if _, ok := cfg.Groups[*group]; !ok {
+		logError(fmt.Sprintf("Group '%s' is not configured.", *group))
+		return 1
+	}
+	containers, err := getContainers()
+	if err != nil {
+		logError(err.Error())
+		return 1
+	}
+	members, missing := groupMembers(*group, containers)
+	printGroupStatus(members, missing)
+	if len(missing) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,40 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// copyIsolatedHome copies the isolated home src to dst for a clone, with
+// owners, modes and links preserved. On filesystems that support it (btrfs,
+// XFS) the files are reflinked, so the copy takes no space until either side
+// changes. Paths to src in well-known config files are changed to dst.
+func copyIsolatedHome(src, dst string) error {
+	if entries, err := os.ReadDir(dst); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s already exists and is not empty", dst)
+	}
+	size, _ := dirSize(src)
+	if free, err := getFreeDiskSpace(filepath.Dir(dst)); err == nil && free < size+spaceMargin(size) {
+		return fmt.Errorf("not enough space to copy the home: needs about %s, %s is free", formatBytes(size), formatBytes(free))
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	done := make(chan bool)
+	go showSpinner("copy-home", fmt.Sprintf("Copying the home directory (%s)...", formatBytes(size)), done)
+	_, err := runCommand("cp", "-a", "--reflink=auto", src+"/.", dst)
+	done <- true
+	if err != nil {
+		os.RemoveAll(dst)
+		return fmt.Errorf("copying %s failed: %w", src, err)
+	}
+	changed, err := rewriteHomePaths(dst, src, dst)
+	if err != nil {
+		logWarning(fmt.Sprintf("Could not update all paths to the source home: %v", err))
+	}
+	if len(changed) > 0 {
+		logInfo(fmt.Sprintf("Updated the home path in %d config file(s) of the copy.", len(changed)))
+	}
+	return nil
+}
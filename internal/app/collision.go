@@ -0,0 +1,112 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// archiveNames lists the names of the archives in the remote directory,
+// without reading any manifest.
+func (t remoteTarget) archiveNames() ([]string, error) {
+	var names []string
+	if t.Rclone {
+		entries, err := t.rcloneList()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+	} else {
+		out, err := t.run(fmt.Sprintf(`cd %s 2>/dev/null || exit 0
+for f in *.tar *.tar.*; do [ -f "$f" ] && printf '%%s\n' "$f"; done`, shellQuote(t.Path)))
+		if err != nil {
+			return nil, err
+		}
+		names = strings.Split(strings.TrimSpace(out), "\n")
+	}
+	var archives []string
+	for _, name := range names {
+		if isBackupArchiveName(name) {
+			archives = append(archives, name)
+		}
+	}
+	return archives, nil
+}
+
+// archiveNames lists the names of the archives in a destination.
+func (d pruneDestination) archiveNames() ([]string, error) {
+	if d.Remote != nil {
+		return d.Remote.archiveNames()
+	}
+	entries, err := os.ReadDir(d.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && isBackupArchiveName(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// isDestination reports whether dest, as given for a backup (a folder, a
+// remote spec or a destination name), is this destination.
+func (d pruneDestination) isDestination(dest string) bool {
+	if dest == d.Label {
+		return true
+	}
+	if d.Remote != nil {
+		t, ok := parseRemote(dest)
+		return ok && t.String() == d.Remote.String()
+	}
+	return filepath.Clean(expandHome(dest)) == filepath.Clean(d.Dir)
+}
+
+// nameCollisions finds archives with the backup name base in the
+// configured destinations other than dest. Names are compared without
+// their extensions and -standard/-isolated suffix, so "dev" matches
+// "dev-isolated.tar.zst". Destinations that cannot be read are skipped.
+func nameCollisions(base, dest string) []string {
+	want := containerNameFromFile(base)
+	var found []string
+	for _, d := range pruneDestinations() {
+		if d.isDestination(dest) {
+			continue
+		}
+		names, err := d.archiveNames()
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			if containerNameFromFile(name) == want {
+				found = append(found, fmt.Sprintf("%s in %s", name, d))
+			}
+		}
+	}
+	return found
+}
+
+// warnNameCollisions reports archives named like base in destinations
+// other than dest and returns whether there were any.
+func warnNameCollisions(base, dest string) bool {
+	done := make(chan bool)
+	go showSpinner("names", "Checking the other destinations for the name...", done)
+	found := nameCollisions(base, dest)
+	done <- true
+	if len(found) == 0 {
+		return false
+	}
+	logWarning(fmt.Sprintf("A backup named '%s' already exists elsewhere; two different archives with one name are easy to mix up when restoring:", base))
+	for _, f := range found {
+		fmt.Printf("  - %s\n", f)
+	}
+	return true
+}
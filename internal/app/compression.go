@@ -0,0 +1,58 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// checkCompressor reports an error if comp needs a host tool that is missing.
+func checkCompressor(comp backup.Compression) error {
+	if cmd := comp.Command(); cmd != "" && !commandExists(cmd) {
+		return fmt.Errorf("the '%s' command is required for %s compression but was not found", cmd, comp)
+	}
+	return nil
+}
+
+// promptCompression asks how to compress a backup, offering the configured
+// default. It returns false if the user cancelled.
+func promptCompression() (backup.Compression, int, bool) {
+	def := cfg.Backup.Compression
+	fmt.Printf("%s> Compression: (n)one, (g)zip, (z)std, (x)z [default: %s]: %s", colorBold, def, colorReset)
+	comp := def
+	switch readUserInput() {
+	case "n", "N":
+		comp = backup.CompressNone
+	case "g", "G":
+		comp = backup.CompressGzip
+	case "z", "Z":
+		comp = backup.CompressZstd
+	case "x", "X":
+		comp = backup.CompressXz
+	}
+	if comp == backup.CompressNone {
+		return comp, 0, true
+	}
+	if err := checkCompressor(comp); err != nil {
+		logError(err.Error())
+		return comp, 0, false
+	}
+
+	min, max, level := comp.Levels()
+	if comp == cfg.Backup.Compression && cfg.Backup.CompressionLevel != 0 {
+		level = cfg.Backup.CompressionLevel
+	}
+	for {
+		fmt.Printf("%s> Compression level (%d-%d, higher is smaller but slower) [default: %d]: %s", colorBold, min, max, level, colorReset)
+		input := readUserInput()
+		if input == "" {
+			return comp, level, true
+		}
+		n, err := strconv.Atoi(input)
+		if err == nil && n >= min && n <= max {
+			return comp, n, true
+		}
+		logWarning("Invalid input. Please enter a valid level.")
+	}
+}
@@ -0,0 +1,1001 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// Config holds the settings read from config.toml.
+type Config struct {
+	Batch        BatchConfig
+	Containers   map[string]ContainerConfig
+	Destinations map[string]DestinationConfig
+	// Groups maps a group name from [groups] to its container names.
+	Groups   map[string][]string
+	Security SecurityConfig
+	Transfer TransferConfig
+	Restore  RestoreConfig
+	Backup   BackupConfig
+	Edit     EditConfig
+	UI       UIConfig
+	Log      LogConfig
+	// Encryption holds the archive encryption defaults; Security is about
+	// the tool's own state.
+	Encryption EncryptionConfig
+	// Retention is the default policy of the prune command.
+	Retention RetentionPolicy
+	Trigger   TriggerConfig
+	Shutdown  ShutdownConfig
+	Snapshot  SnapshotConfig
+	Queue     QueueConfig
+	Power     PowerConfig
+	// Schedules maps a name from [schedules.<name>] to a backup run by a
+	// systemd user timer.
+	Schedules map[string]ScheduleConfig
+	Fleet     FleetConfig
+	Homes     HomesConfig
+	Podman    PodmanConfig
+}
+
+// PodmanConfig selects how podman is reached.
+type PodmanConfig struct {
+	// Connection names a `podman system connection` to work through
+	// instead of the local podman; see connection.go.
+	Connection string
+}
+
+// HomesConfig says where new isolated homes are created.
+type HomesConfig struct {
+	// Root holds one folder per container; "~/" is expanded. Empty means
+	// distrobox's container_home_prefix, or its default location.
+	Root string
+}
+
+// FleetConfig points at the shared folder that `fleet push` writes this
+// host's catalog to and `fleet` reads every host's catalog from.
+type FleetConfig struct {
+	Dir string
+	// Host names this machine's catalog; empty means the hostname.
+	Host string
+	// StaleAfter is how old a container's newest backup, or a host's
+	// catalog, may be before `fleet` flags it.
+	StaleAfter time.Duration
+}
+
+// ScheduleConfig is a backup run on a calendar by `schedule enable`. It
+// names exactly one of Containers, Group, All or Job.
+type ScheduleConfig struct {
+	// Calendar is a systemd OnCalendar expression such as "daily" or
+	// "Mon..Fri 02:00".
+	Calendar   string
+	Containers []string
+	Group      string
+	All        bool
+	// Job is a job file to run instead of a plain backup.
+	Job string
+	// Dest is a directory, a [destinations] name or a remote; empty means
+	// [backup] dir.
+	Dest string
+	Note string
+	// Check runs `destination check` on Dest before the backup, or alone
+	// when no containers are set. Prune and Verify add a prune of Dest and
+	// a verify of the new archives after the backup.
+	Check  bool
+	Prune  bool
+	Verify bool
+	// Hours limits when the schedule may run ("window", "blackout");
+	// Outside is outsideWait or outsideSkip for a timer firing outside them.
+	Hours   runHours
+	Outside string
+}
+
+// PowerConfig keeps scheduled runs (`run JOBFILE`) from draining a laptop's
+// battery or a metered connection.
+type PowerConfig struct {
+	// MinBattery is the charge in percent below which runs on battery are
+	// held back; 0 disables the check.
+	MinBattery int
+	// SkipMetered holds back runs that use remote destinations while
+	// NetworkManager reports a metered connection.
+	SkipMetered bool
+	// OnBlock is powerDefer (wait up to MaxDefer) or powerSkip.
+	OnBlock  string
+	MaxDefer time.Duration
+	// Inhibit keeps the machine from idling, suspending or shutting down
+	// while a backup or conversion runs.
+	Inhibit bool
+}
+
+// SnapshotConfig controls the local snapshot images of Snapshots.
+type SnapshotConfig struct {
+	// Keep is how many manual snapshots a container keeps; 0 keeps all.
+	Keep int
+}
+
+// QueueConfig controls the background job queue of the menu.
+type QueueConfig struct {
+	// Parallel is how many queued jobs run at once.
+	Parallel int
+}
+
+// ShutdownConfig selects the containers snapshotted on logout and shutdown.
+type ShutdownConfig struct {
+	Containers []string
+	Group      string
+	// TimeBudget bounds the whole run; containers not started in time are
+	// skipped so shutdown is not held up.
+	TimeBudget time.Duration
+}
+
+// TriggerConfig controls the `trigger` listener that lets other programs
+// request backups.
+type TriggerConfig struct {
+	// Socket is the unix socket to listen on; Listen a loopback host:port
+	// for HTTP over TCP. Without either, defaultTriggerSocket is used.
+	Socket string
+	Listen string
+	// Token is a credential reference; when set, requests must send it as
+	// "Authorization: Bearer <token>".
+	Token string
+}
+
+// RetentionPolicy says which backups of a container to keep in a
+// destination. A backup is kept if any rule selects it; a policy without
+// rules keeps everything.
+type RetentionPolicy struct {
+	KeepLast    int // the newest N backups
+	KeepDaily   int // the newest backup of each of the last N days with backups
+	KeepWeekly  int // ... of each of the last N ISO weeks
+	KeepMonthly int // ... of each of the last N months
+}
+
+// EncryptionConfig controls encryption of backup archives.
+type EncryptionConfig struct {
+	// Method is the default for new backups.
+	Method backup.Cipher
+	// Recipient is an age public key or recipients file, or a gpg key ID or
+	// email. Identity is the age identity file used to decrypt backups.
+	Recipient string
+	Identity  string
+}
+
+// LogConfig selects where log messages go.
+type LogConfig struct {
+	// Target is logStdout, logJournal or logBoth.
+	Target string
+	// File keeps the operation log in the state directory.
+	File bool
+}
+
+// UIConfig controls the interactive menu.
+type UIConfig struct {
+	// Messages is messagesEnter, messagesTimed or messagesNone.
+	Messages string
+	// Symbols is symbolsAuto, symbolsUnicode or symbolsASCII.
+	Symbols string
+	// TUI shows the menu and lists as pickers in a terminal; false keeps
+	// the numbered prompts.
+	TUI bool
+}
+
+// BackupConfig holds backup defaults.
+type BackupConfig struct {
+	// Dir is the default destination folder; "~/" is expanded.
+	Dir string
+	// Compression and CompressionLevel are the defaults for new archives
+	// (level 0 means the format's default).
+	Compression      backup.Compression
+	CompressionLevel int
+	// HomeChecksums records per-file hashes of separated home archives.
+	HomeChecksums bool
+	// HomeOwner is how home archives record file owners: backup.OwnerNames,
+	// OwnerNumeric or OwnerUser. HomeXattrs keeps SELinux labels, file
+	// capabilities and user.* attributes; it is on by default on SELinux
+	// hosts.
+	HomeOwner  string
+	HomeXattrs bool
+	// Secrets is what happens when credentials are found before an
+	// unencrypted cloud backup: secretsWarn, secretsExclude or
+	// secretsIgnore.
+	Secrets string
+	// NameTemplate names new archives, e.g. "{container}-{date}"; empty
+	// keeps the container name (plus a timestamp for batch backups).
+	NameTemplate string
+	// SystemPaths are the paths a system files backup archives.
+	SystemPaths []string
+	// SensitivePaths are the home-relative paths a destination with
+	// exclude_sensitive leaves out.
+	SensitivePaths []string
+	// FileMode and DirMode are the permissions of new backup files and
+	// folders, narrowed by the umask.
+	FileMode os.FileMode
+	DirMode  os.FileMode
+}
+
+// EditConfig controls the Standard/Isolated conversion.
+type EditConfig struct {
+	// PreBackup is preBackupAsk, preBackupAlways or preBackupNever.
+	PreBackup string
+	// SafetyDir is where safety backups go; empty means [backup] dir.
+	SafetyDir string
+}
+
+// RestoreConfig controls what happens after a container is restored.
+type RestoreConfig struct {
+	// SmokeTest is smokeAsk, smokeAlways or smokeNever.
+	SmokeTest string
+	// SmokeTestCommand runs via 'sh -c' inside the container; empty uses
+	// defaultSmokeTestCommand.
+	SmokeTestCommand string
+	// CheckPackages says whether the packages recorded in a system files
+	// backup are checked against the refreshed repositories after it is
+	// restored; it takes the SmokeTest modes.
+	CheckPackages string
+}
+
+// TransferConfig controls remote uploads and downloads.
+type TransferConfig struct {
+	// BandwidthLimit caps transfers in bytes per second; 0 is unlimited.
+	BandwidthLimit int64
+	// Retries is how often an interrupted transfer is resumed.
+	Retries int
+}
+
+// SecurityConfig controls encryption of local state.
+type SecurityConfig struct {
+	// EncryptState encrypts the journal, catalog and history at rest.
+	EncryptState bool
+	// Unlock is unlockPassphrase or unlockKeyring.
+	Unlock string
+}
+
+// BatchConfig controls multi-container runs.
+type BatchConfig struct {
+	// Order lists containers that run first, in this order.
+	Order []string
+	// OnFailure is failureContinue, failureStop or failureRetry.
+	OnFailure string
+	// Retries is how often failureRetry runs a failed container again.
+	Retries int
+}
+
+// ContainerConfig holds per-container settings from a [containers.<name>] table.
+type ContainerConfig struct {
+	// Priority orders batch runs; higher values run first.
+	Priority int
+	// Retention replaces the [retention] policy when HasRetention is set,
+	// i.e. when the table has any keep_* key.
+	Retention    RetentionPolicy
+	HasRetention bool
+	// RestoreAfter names containers a batch restore brings back first,
+	// e.g. the one owning a shared volume. It is stored in the manifest.
+	RestoreAfter []string
+}
+
+// DestinationConfig is a named backup location from a [destinations.<name>]
+// table. Path is a local directory or a remote spec such as user@host:/backups.
+type DestinationConfig struct {
+	Path string
+	// ExcludeSensitive leaves the [backup] sensitive_paths out of home
+	// archives written here. Without HasExcludeSensitive it is on for cloud
+	// destinations only.
+	ExcludeSensitive    bool
+	HasExcludeSensitive bool
+}
+
+// cfg is the active configuration, loaded once at startup.
+var cfg = defaultConfig()
+
+func defaultConfig() *Config {
+	return &Config{
+		Batch:        BatchConfig{OnFailure: failureContinue, Retries: 2},
+		Containers:   map[string]ContainerConfig{},
+		Destinations: map[string]DestinationConfig{},
+		Groups:       map[string][]string{},
+		Security:     SecurityConfig{Unlock: unlockPassphrase},
+		Transfer:     TransferConfig{Retries: 3},
+		Restore:      RestoreConfig{SmokeTest: smokeAsk, CheckPackages: smokeAsk},
+		Backup:       BackupConfig{Dir: "~/distrobox-backups", SystemPaths: []string{"/etc", "/opt", "/usr/local"}, SensitivePaths: sensitivePreset, FileMode: 0600, DirMode: 0700, HomeOwner: backup.OwnerNames, HomeXattrs: selinuxEnabled(), Secrets: secretsWarn},
+		Edit:         EditConfig{PreBackup: preBackupAsk},
+		UI:           UIConfig{Messages: messagesEnter, Symbols: symbolsAuto, TUI: true},
+		Log:          LogConfig{Target: logStdout, File: true},
+		Shutdown:     ShutdownConfig{TimeBudget: 2 * time.Minute},
+		Snapshot:     SnapshotConfig{Keep: 5},
+		Queue:        QueueConfig{Parallel: 1},
+		Power:        PowerConfig{OnBlock: powerDefer, MaxDefer: 2 * time.Hour, Inhibit: true},
+		Schedules:    map[string]ScheduleConfig{},
+		Fleet:        FleetConfig{StaleAfter: 48 * time.Hour},
+	}
+}
+
+// configDir returns $XDG_CONFIG_HOME/distrobox-backup-tool.
+func configDir() (string, error) {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(base, appName), nil
+}
+
+// configPath returns the config file: config.toml, or config.yaml (.yml)
+// when only that exists.
+func configPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "config.toml")
+	if fileExists(path) {
+		return path, nil
+	}
+	for _, name := range []string{"config.yaml", "config.yml"} {
+		if alt := filepath.Join(dir, name); fileExists(alt) {
+			return alt, nil
+		}
+	}
+	return path, nil
+}
+
+// isYAMLConfig reports whether path is a YAML config file.
+func isYAMLConfig(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// loadConfig reads the config file, keeping the defaults if it does not
+// exist. An invalid file stops the tool, except for the config command,
+// which is how it gets fixed.
+func loadConfig() {
+	path, err := configPath()
+	if err != nil {
+		return
+	}
+	c, err := readConfigFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil && flag.Arg(0) == "config" {
+		logWarning(fmt.Sprintf("Ignoring config file %s: %v", path, err))
+		return
+	}
+	if err != nil {
+		logError(fmt.Sprintf("Invalid config file %s: %v", path, err))
+		logInfo("Fix the file, or run 'distrobox-tool config edit'.")
+		os.Exit(1)
+	}
+	cfg = c
+}
+
+func readConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(string(data), isYAMLConfig(path))
+}
+
+// parseConfig decodes the text of a TOML or YAML config file.
+func parseConfig(text string, isYAML bool) (*Config, error) {
+	var values []tomlValue
+	var err error
+	if isYAML {
+		values, err = yamlConfigValues(text)
+	} else {
+		values, err = parseTOML(text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeConfig(values)
+}
+
+// decodeConfig maps parsed key paths onto a Config.
+func decodeConfig(values []tomlValue) (*Config, error) {
+	c := defaultConfig()
+	for _, v := range values {
+		var err error
+		switch key := v.key(); {
+		case key == "batch.order":
+			c.Batch.Order, err = v.containerList()
+		case key == "batch.on_failure":
+			c.Batch.OnFailure, err = v.enum(failureContinue, failureStop, failureRetry)
+		case key == "batch.retries":
+			if c.Batch.Retries, err = v.int(); err == nil && c.Batch.Retries < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		case key == "transfer.bandwidth_limit":
+			c.Transfer.BandwidthLimit, err = v.size()
+		case key == "transfer.retries":
+			c.Transfer.Retries, err = v.int()
+		case key == "backup.dir":
+			c.Backup.Dir, err = v.string()
+		case key == "backup.file_mode":
+			c.Backup.FileMode, err = v.fileMode()
+		case key == "backup.dir_mode":
+			c.Backup.DirMode, err = v.fileMode()
+		case key == "backup.compression":
+			var s string
+			if s, err = v.string(); err == nil {
+				c.Backup.Compression, err = backup.ParseCompression(s)
+			}
+		case key == "backup.compression_level":
+			c.Backup.CompressionLevel, err = v.int()
+		case key == "backup.system_paths":
+			if c.Backup.SystemPaths, err = v.stringList(); err == nil {
+				for _, p := range c.Backup.SystemPaths {
+					if !strings.HasPrefix(p, "/") || p == "/" {
+						err = fmt.Errorf("%q must be an absolute path below /", p)
+					}
+				}
+			}
+		case key == "backup.sensitive_paths":
+			if c.Backup.SensitivePaths, err = v.stringList(); err == nil {
+				for _, p := range c.Backup.SensitivePaths {
+					if clean := filepath.Clean(p); filepath.IsAbs(clean) || clean == "." || strings.HasPrefix(clean, "..") {
+						err = fmt.Errorf("%q must be a path inside the home", p)
+					}
+				}
+			}
+		case key == "backup.home_checksums":
+			c.Backup.HomeChecksums, err = v.bool()
+		case key == "backup.home_owner":
+			c.Backup.HomeOwner, err = v.enum(backup.OwnerNames, backup.OwnerNumeric, backup.OwnerUser)
+		case key == "backup.home_xattrs":
+			c.Backup.HomeXattrs, err = v.bool()
+		case key == "backup.secrets":
+			c.Backup.Secrets, err = v.enum(secretsWarn, secretsExclude, secretsIgnore)
+		case key == "backup.name_template":
+			if c.Backup.NameTemplate, err = v.string(); err == nil && !strings.Contains(c.Backup.NameTemplate, "{container}") {
+				err = fmt.Errorf("must contain {container}")
+			} else if err == nil && !strings.Contains(c.Backup.NameTemplate, "{date}") && !strings.Contains(c.Backup.NameTemplate, "{time}") {
+				// Without either, every run writes the same name, and a
+				// scheduled backup is skipped once the first one exists.
+				err = fmt.Errorf("must contain {date} or {time}")
+			}
+		case key == "encryption.method":
+			var s string
+			if s, err = v.string(); err == nil {
+				c.Encryption.Method, err = backup.ParseCipher(s)
+			}
+		case key == "encryption.recipient":
+			c.Encryption.Recipient, err = v.string()
+		case key == "encryption.identity":
+			c.Encryption.Identity, err = v.string()
+		case len(v.Path) == 2 && v.Path[0] == "retention":
+			err = decodeRetention(&c.Retention, v.Path[1], v)
+		case key == "trigger.socket":
+			c.Trigger.Socket, err = v.string()
+		case key == "trigger.listen":
+			c.Trigger.Listen, err = v.string()
+		case key == "trigger.token":
+			c.Trigger.Token, err = v.secret()
+		case key == "shutdown.containers":
+			c.Shutdown.Containers, err = v.containerList()
+		case key == "shutdown.group":
+			c.Shutdown.Group, err = v.string()
+		case key == "shutdown.time_budget":
+			c.Shutdown.TimeBudget, err = v.duration()
+		case key == "queue.parallel":
+			if c.Queue.Parallel, err = v.int(); err == nil && c.Queue.Parallel < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		case key == "snapshot.keep":
+			if c.Snapshot.Keep, err = v.int(); err == nil && c.Snapshot.Keep < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		case key == "power.min_battery":
+			if c.Power.MinBattery, err = v.int(); err == nil && (c.Power.MinBattery < 0 || c.Power.MinBattery > 100) {
+				err = fmt.Errorf("must be between 0 and 100")
+			}
+		case key == "power.skip_metered":
+			c.Power.SkipMetered, err = v.bool()
+		case key == "power.on_block":
+			c.Power.OnBlock, err = v.enum(powerDefer, powerSkip)
+		case key == "power.max_defer":
+			c.Power.MaxDefer, err = v.duration()
+		case key == "power.inhibit":
+			c.Power.Inhibit, err = v.bool()
+		case key == "homes.root":
+			c.Homes.Root, err = v.string()
+		case key == "podman.connection":
+			c.Podman.Connection, err = v.string()
+		case key == "fleet.dir":
+			c.Fleet.Dir, err = v.string()
+		case key == "fleet.host":
+			c.Fleet.Host, err = v.string()
+		case key == "fleet.stale_after":
+			c.Fleet.StaleAfter, err = v.duration()
+		case key == "edit.pre_backup":
+			c.Edit.PreBackup, err = v.enum(preBackupAsk, preBackupAlways, preBackupNever)
+		case key == "edit.safety_dir":
+			c.Edit.SafetyDir, err = v.string()
+		case key == "ui.messages":
+			c.UI.Messages, err = v.enum(messagesEnter, messagesTimed, messagesNone)
+		case key == "log.target":
+			c.Log.Target, err = v.enum(logStdout, logJournal, logBoth)
+		case key == "log.file":
+			c.Log.File, err = v.bool()
+		case key == "ui.symbols":
+			c.UI.Symbols, err = v.enum(symbolsAuto, symbolsUnicode, symbolsASCII)
+		case key == "ui.tui":
+			c.UI.TUI, err = v.bool()
+		case key == "restore.smoke_test":
+			c.Restore.SmokeTest, err = v.enum(smokeAsk, smokeAlways, smokeNever)
+		case key == "restore.check_packages":
+			c.Restore.CheckPackages, err = v.enum(smokeAsk, smokeAlways, smokeNever)
+		case key == "restore.smoke_test_command":
+			c.Restore.SmokeTestCommand, err = v.string()
+		case key == "security.encrypt_state":
+			c.Security.EncryptState, err = v.bool()
+		case key == "security.unlock":
+			c.Security.Unlock, err = v.enum(unlockPassphrase, unlockKeyring)
+		case len(v.Path) == 3 && v.Path[0] == "containers":
+			cc := c.Containers[v.Path[1]]
+			switch v.Path[2] {
+			case "priority":
+				cc.Priority, err = v.int()
+			case "restore_after":
+				cc.RestoreAfter, err = v.containerList()
+			case "keep_last", "keep_daily", "keep_weekly", "keep_monthly":
+				cc.HasRetention = true
+				err = decodeRetention(&cc.Retention, v.Path[2], v)
+			default:
+				err = errUnknownKey
+			}
+			c.Containers[v.Path[1]] = cc
+		case len(v.Path) == 2 && v.Path[0] == "groups":
+			c.Groups[v.Path[1]], err = v.containerList()
+		case len(v.Path) == 3 && v.Path[0] == "destinations":
+			dc := c.Destinations[v.Path[1]]
+			switch v.Path[2] {
+			case "path":
+				dc.Path, err = v.string()
+			case "exclude_sensitive":
+				dc.HasExcludeSensitive = true
+				dc.ExcludeSensitive, err = v.bool()
+			default:
+				err = errUnknownKey
+			}
+			c.Destinations[v.Path[1]] = dc
+		case len(v.Path) == 3 && v.Path[0] == "schedules":
+			sc, ok := c.Schedules[v.Path[1]]
+			if !ok {
+				sc.Calendar, sc.Outside = "daily", outsideWait
+			}
+			switch v.Path[2] {
+			case "calendar":
+				sc.Calendar, err = v.string()
+			case "containers":
+				sc.Containers, err = v.containerList()
+			case "group":
+				sc.Group, err = v.string()
+			case "all":
+				sc.All, err = v.bool()
+			case "job":
+				sc.Job, err = v.string()
+			case "dest":
+				sc.Dest, err = v.string()
+			case "note":
+				sc.Note, err = v.string()
+			case "check":
+				sc.Check, err = v.bool()
+			case "prune":
+				sc.Prune, err = v.bool()
+			case "verify":
+				sc.Verify, err = v.bool()
+			case "window":
+				var s string
+				if s, err = v.string(); err == nil {
+					var r clockRange
+					r, err = parseClockRange(s)
+					sc.Hours.Window = &r
+				}
+			case "blackout":
+				var list []string
+				if list, err = v.stringList(); err == nil {
+					sc.Hours.Blackouts = nil
+					for _, s := range list {
+						var b blackout
+						if b, err = parseBlackout(s); err != nil {
+							break
+						}
+						sc.Hours.Blackouts = append(sc.Hours.Blackouts, b)
+					}
+				}
+			case "outside_window":
+				sc.Outside, err = v.enum(outsideWait, outsideSkip)
+			default:
+				err = errUnknownKey
+			}
+			c.Schedules[v.Path[1]] = sc
+		default:
+			err = errUnknownKey
+		}
+		if err != nil {
+			return nil, settingError(v, err)
+		}
+	}
+	if level := c.Backup.CompressionLevel; level != 0 && c.Backup.Compression != backup.CompressNone {
+		if min, max, _ := c.Backup.Compression.Levels(); level < min || level > max {
+			return nil, keyError(values, fmt.Errorf("%s levels range from %d to %d", c.Backup.Compression, min, max), "backup", "compression_level")
+		}
+	}
+	if c.Encryption.Method != backup.EncryptNone && c.Encryption.Recipient == "" {
+		return nil, keyError(values, fmt.Errorf("encryption.recipient is required with %s", c.Encryption.Method), "encryption", "method")
+	}
+	for name, sc := range c.Schedules {
+		if err := sc.check(name); err != nil {
+			return nil, keyError(values, err, "schedules", name)
+		}
+	}
+	return c, nil
+}
+
+// decodeRetention sets the rule of p named by a keep_* key.
+func decodeRetention(p *RetentionPolicy, key string, v tomlValue) error {
+	rules := map[string]*int{
+		"keep_last":    &p.KeepLast,
+		"keep_daily":   &p.KeepDaily,
+		"keep_weekly":  &p.KeepWeekly,
+		"keep_monthly": &p.KeepMonthly,
+	}
+	rule, ok := rules[key]
+	if !ok {
+		return errUnknownKey
+	}
+	n, err := v.int()
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("must not be negative")
+	}
+	*rule = n
+	return nil
+}
+
+// --- Minimal TOML reader ---
+//
+// Supports the subset the config needs: [tables] with dotted and quoted
+// names, key = value pairs, strings, integers, booleans and single-line
+// arrays. Values are returned in file order with their full key path.
+
+type tomlValue struct {
+	Path []string // table path followed by the key
+	Line int
+	Raw  string
+	Text string // the whole line, for error messages
+	// Plain marks an unquoted YAML scalar: Raw is its text, which is read
+	// as a string, or as a boolean or integer where the key takes one.
+	Plain bool
+}
+
+// key returns the dotted form of the value's path, for messages and matching.
+func (v tomlValue) key() string {
+	return strings.Join(v.Path, ".")
+}
+
+func (v tomlValue) string() (string, error) {
+	raw := v.Raw
+	if v.Plain {
+		return raw, nil
+	}
+	if strings.HasPrefix(raw, "'") && strings.HasSuffix(raw, "'") && len(raw) >= 2 {
+		return raw[1 : len(raw)-1], nil
+	}
+	if strings.HasPrefix(raw, `"`) {
+		s, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return s, nil
+	}
+	return "", fmt.Errorf("expected a quoted string, got %s", raw)
+}
+
+func (v tomlValue) int() (int, error) {
+	n, err := strconv.Atoi(strings.ReplaceAll(v.Raw, "_", ""))
+	if err != nil {
+		return 0, fmt.Errorf("expected an integer, got %s", v.Raw)
+	}
+	return n, nil
+}
+
+func (v tomlValue) bool() (bool, error) {
+	switch v.Raw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected true or false, got %s", v.Raw)
+}
+
+// size parses a quoted size such as "20M".
+func (v tomlValue) size() (int64, error) {
+	s, err := v.string()
+	if err != nil {
+		return 0, err
+	}
+	return parseSize(s)
+}
+
+// fileMode parses quoted octal permissions such as "0640".
+func (v tomlValue) fileMode() (os.FileMode, error) {
+	s, err := v.string()
+	if err != nil {
+		return 0, err
+	}
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, fmt.Errorf("expected octal permissions such as \"0600\", got %s", v.Raw)
+	}
+	return os.FileMode(m), nil
+}
+
+// duration parses a quoted duration such as "90s" or "2m".
+func (v tomlValue) duration() (time.Duration, error) {
+	s, err := v.string()
+	if err != nil {
+		return 0, err
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("expected a positive duration such as \"2m\", got %s", v.Raw)
+	}
+	return d, nil
+}
+
+// secret returns a credential reference, refusing plaintext values.
+func (v tomlValue) secret() (string, error) {
+	s, err := v.string()
+	if err != nil {
+		return "", err
+	}
+	if !validSecretRef(s) {
+		return "", fmt.Errorf("plaintext credentials are not allowed; use \"keyring:<name>\", \"env:<VAR>\" or \"file:<path>\"")
+	}
+	return s, nil
+}
+
+func (v tomlValue) enum(allowed ...string) (string, error) {
+	s, err := v.string()
+	if err != nil {
+		return "", err
+	}
+	for _, a := range allowed {
+		if s == a {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("must be one of %s, got %q", strings.Join(allowed, ", "), s)
+}
+
+func (v tomlValue) stringList() ([]string, error) {
+	raw := strings.TrimSpace(v.Raw)
+	if !strings.HasPrefix(raw, "[") || !strings.HasSuffix(raw, "]") {
+		return nil, fmt.Errorf("expected an array, got %s", raw)
+	}
+	var list []string
+	for _, item := range splitTopLevel(raw[1:len(raw)-1], ',') {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		s, err := tomlValue{Line: v.Line, Raw: item}.string()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// containerList reads a list of container names. Names are matched
+// exactly, so a glob pattern in the list is refused rather than matching
+// nothing.
+func (v tomlValue) containerList() ([]string, error) {
+	list, err := v.stringList()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range list {
+		if strings.ContainsAny(name, "*?[") {
+			return nil, fmt.Errorf("%q is a pattern, but container names are matched exactly; list each container by name", name)
+		}
+	}
+	return list, nil
+}
+
+func parseTOML(input string) ([]tomlValue, error) {
+	var values []tomlValue
+	seen := map[string]bool{}
+	var table []string
+	for i, text := range strings.Split(input, "\n") {
+		lineNo := i + 1
+		line := strings.TrimSpace(stripComment(text))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, tomlSyntaxError(lineNo, text, "unterminated table header", "[backup]")
+			}
+			table = splitKeyPath(strings.TrimSpace(line[1 : len(line)-1]))
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, tomlSyntaxError(lineNo, text, "expected 'key = value'", `dir = "~/distrobox-backups"`)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if key == "" || value == "" {
+			return nil, tomlSyntaxError(lineNo, text, "expected 'key = value'", `dir = "~/distrobox-backups"`)
+		}
+		path := append(append([]string{}, table...), splitKeyPath(key)...)
+		id := strings.Join(path, "\x00")
+		v := tomlValue{Path: path, Line: lineNo, Raw: value, Text: strings.TrimSpace(text)}
+		if seen[id] {
+			return nil, settingError(v, errors.New("set a second time; keep one of the two lines"))
+		}
+		seen[id] = true
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// yamlConfigValues flattens a YAML config into the key paths and TOML
+// literals decodeConfig reads, so both formats share one decoder. Each
+// value keeps the line its key is on.
+func yamlConfigValues(text string) ([]tomlValue, error) {
+	doc, lines, err := parseYAMLLines(text)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, nil
+	}
+	root, ok := doc.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("the top level must be a mapping")
+	}
+	source := strings.Split(text, "\n")
+	var values []tomlValue
+	var walk func(path []string, m map[string]any) error
+	walk = func(path []string, m map[string]any) error {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := append(append([]string{}, path...), k)
+			if sub, ok := m[k].(map[string]any); ok {
+				if err := walk(p, sub); err != nil {
+					return err
+				}
+				continue
+			}
+			v := tomlValue{Path: p, Line: lines[strings.Join(p, ".")]}
+			if v.Line > 0 {
+				v.Text = strings.TrimSpace(source[v.Line-1])
+			}
+			raw, err := tomlLiteral(m[k])
+			if err != nil {
+				return settingError(v, err)
+			}
+			if raw != "" {
+				_, v.Plain = m[k].(yamlPlain)
+				v.Raw = raw
+				values = append(values, v)
+			}
+		}
+		return nil
+	}
+	return values, walk(nil, root)
+}
+
+// tomlLiteral writes a YAML scalar or list as TOML; null becomes "". A
+// plain scalar is kept as it is, so that it reads as true, false or an
+// integer where the key takes one (see tomlValue.Plain).
+func tomlLiteral(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return strconv.Quote(v), nil
+	case yamlPlain:
+		return string(v), nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			switch s := item.(type) {
+			case string:
+				items = append(items, strconv.Quote(s))
+			case yamlPlain:
+				items = append(items, strconv.Quote(string(s)))
+			default:
+				return "", fmt.Errorf("lists may only hold strings")
+			}
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	}
+	return "", fmt.Errorf("unsupported value")
+}
+
+// splitKeyPath splits a dotted key, honouring quoted segments such as
+// containers."my.box", and returns the unquoted segments.
+func splitKeyPath(key string) []string {
+	var parts []string
+	for _, part := range splitTopLevel(key, '.') {
+		part = strings.TrimSpace(part)
+		if s, err := strconv.Unquote(part); err == nil {
+			part = s
+		} else if len(part) >= 2 && part[0] == '\'' && part[len(part)-1] == '\'' {
+			part = part[1 : len(part)-1]
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// splitTopLevel splits s on sep outside of quoted strings.
+func splitTopLevel(s string, sep rune) []string {
+	var parts []string
+	var current strings.Builder
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == sep:
+			parts = append(parts, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	return append(parts, current.String())
+}
+
+// stripComment removes a trailing # comment that is not inside a string.
+func stripComment(line string) string {
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,228 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// A setting the tool cannot read stops it at startup instead of silently
+// falling back to a default: the error names the line, shows it as written
+// and how a valid setting looks. Unknown keys, usually typos, are errors
+// too and come with the closest known key.
+
+// errUnknownKey is the error for keys decodeConfig does not read.
+var errUnknownKey = errors.New("unknown key")
+
+// configExamples holds a valid value for every config key. "*" stands for
+// the name of a container, group, destination or schedule.
+var configExamples = map[string]string{
+	"backup.dir":                       `"~/distrobox-backups"`,
+	"backup.file_mode":                 `"0600"`,
+	"backup.dir_mode":                  `"0700"`,
+	"backup.compression":               `"zstd"`,
+	"backup.compression_level":         `3`,
+	"backup.system_paths":              `["/etc", "/opt", "/usr/local"]`,
+	"backup.sensitive_paths":           `[".ssh", ".gnupg", ".aws"]`,
+	"backup.home_checksums":            `true`,
+	"backup.home_owner":                `"names"`,
+	"backup.home_xattrs":               `true`,
+	"backup.secrets":                   `"warn"`,
+	"backup.name_template":             `"{container}-{date}"`,
+	"batch.order":                      `["db-box", "api-box"]`,
+	"batch.on_failure":                 `"continue"`,
+	"batch.retries":                    `1`,
+	"transfer.bandwidth_limit":         `"20M"`,
+	"transfer.retries":                 `3`,
+	"encryption.method":                `"age"`,
+	"encryption.recipient":             `"age1..."`,
+	"encryption.identity":              `"~/.config/age/key.txt"`,
+	"retention.keep_last":              `5`,
+	"retention.keep_daily":             `7`,
+	"retention.keep_weekly":            `4`,
+	"retention.keep_monthly":           `6`,
+	"trigger.socket":                   `"~/.cache/distrobox-backup.sock"`,
+	"trigger.listen":                   `"127.0.0.1:8765"`,
+	"trigger.token":                    `"keyring:distrobox-trigger"`,
+	"shutdown.containers":              `["dev-box"]`,
+	"shutdown.group":                   `"work"`,
+	"shutdown.time_budget":             `"2m"`,
+	"snapshot.keep":                    `3`,
+	"queue.parallel":                   `2`,
+	"power.min_battery":                `30`,
+	"power.skip_metered":               `true`,
+	"power.on_block":                   `"defer"`,
+	"power.max_defer":                  `"2h"`,
+	"power.inhibit":                    `true`,
+	"homes.root":                       `"/mnt/data/distrobox-homes"`,
+	"podman.connection":                `"server"`,
+	"fleet.dir":                        `"/mnt/nas/fleet"`,
+	"fleet.host":                       `"laptop"`,
+	"fleet.stale_after":                `"48h"`,
+	"edit.pre_backup":                  `"ask"`,
+	"edit.safety_dir":                  `"~/distrobox-safety"`,
+	"ui.messages":                      `"enter"`,
+	"ui.symbols":                       `"auto"`,
+	"ui.tui":                           `true`,
+	"log.target":                       `"stdout"`,
+	"log.file":                         `true`,
+	"restore.smoke_test":               `"ask"`,
+	"restore.check_packages":           `"ask"`,
+	"restore.smoke_test_command":       `"git --version"`,
+	"security.encrypt_state":           `true`,
+	"security.unlock":                  `"passphrase"`,
+	"containers.*.priority":            `10`,
+	"containers.*.restore_after":       `["db-box"]`,
+	"containers.*.keep_last":           `5`,
+	"containers.*.keep_daily":          `7`,
+	"containers.*.keep_weekly":         `4`,
+	"containers.*.keep_monthly":        `6`,
+	"groups.*":                         `["dev-box", "api-box"]`,
+	"destinations.*.path":              `"/mnt/backups"`,
+	"destinations.*.exclude_sensitive": `true`,
+	"schedules.*.calendar":             `"daily"`,
+	"schedules.*.containers":           `["dev-box"]`,
+	"schedules.*.group":                `"work"`,
+	"schedules.*.all":                  `true`,
+	"schedules.*.job":                  `"~/jobs.yaml"`,
+	"schedules.*.dest":                 `"nas"`,
+	"schedules.*.note":                 `"nightly"`,
+	"schedules.*.check":                `true`,
+	"schedules.*.prune":                `true`,
+	"schedules.*.verify":               `true`,
+	"schedules.*.window":               `"01:00-06:00"`,
+	"schedules.*.blackout":             `["weekdays 09:00-17:00", "Sun"]`,
+	"schedules.*.outside_window":       `"wait"`,
+}
+
+// namedTables are the tables whose second path segment is a name.
+var namedTables = []string{"containers", "groups", "destinations", "schedules"}
+
+// configExampleKey returns the configExamples key for a key path.
+func configExampleKey(path []string) string {
+	if len(path) >= 2 && containsString(namedTables, path[0]) {
+		return strings.Join(append([]string{path[0], "*"}, path[2:]...), ".")
+	}
+	return strings.Join(path, ".")
+}
+
+// closestConfigKey returns the known key closest to an unknown one, in the
+// same named table, or nil when none is close.
+func closestConfigKey(path []string) []string {
+	key := strings.Join(path, ".")
+	var best []string
+	bestDist := len(key)/3 + 2
+	known := make([]string, 0, len(configExamples))
+	for k := range configExamples {
+		known = append(known, k)
+	}
+	sort.Strings(known)
+	for _, k := range known {
+		candidate := strings.Split(k, ".")
+		if len(candidate) >= 2 && candidate[1] == "*" {
+			if len(path) < 2 {
+				continue
+			}
+			candidate[1] = path[1]
+		}
+		if d := editDistance(key, strings.Join(candidate, ".")); d < bestDist {
+			best, bestDist = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// configError is a setting of the config file that could not be read.
+type configError struct {
+	Path []string
+	// Line and Text locate the setting in the file.
+	Line int
+	Text string
+	Err  error
+}
+
+func (e *configError) Error() string {
+	var b strings.Builder
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "line %d: ", e.Line)
+	}
+	fmt.Fprintf(&b, "%s: %v", strings.Join(e.Path, "."), e.Err)
+	example := e.Path
+	if errors.Is(e.Err, errUnknownKey) {
+		example = closestConfigKey(e.Path)
+		if example != nil {
+			fmt.Fprintf(&b, "; did you mean %s?", strings.Join(example, "."))
+		}
+	}
+	if e.Text != "" {
+		fmt.Fprintf(&b, "\n    %d | %s", e.Line, e.Text)
+	}
+	if value, ok := configExamples[configExampleKey(example)]; ok && len(example) > 0 {
+		table, key := example[:len(example)-1], example[len(example)-1]
+		b.WriteString("\n  A valid setting looks like:")
+		if len(table) > 0 {
+			fmt.Fprintf(&b, "\n    [%s]", strings.Join(quoteKeyPath(table), "."))
+		}
+		fmt.Fprintf(&b, "\n    %s = %s", strings.Join(quoteKeyPath([]string{key}), "."), value)
+	}
+	return b.String()
+}
+
+// quoteKeyPath quotes the segments of a key path that TOML needs quoted.
+func quoteKeyPath(path []string) []string {
+	quoted := make([]string, len(path))
+	for i, p := range path {
+		quoted[i] = p
+		if p == "" || strings.ContainsFunc(p, func(r rune) bool {
+			return !(r == '-' || r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+		}) {
+			quoted[i] = fmt.Sprintf("%q", p)
+		}
+	}
+	return quoted
+}
+
+// settingError wraps err as a configError for the value v.
+func settingError(v tomlValue, err error) error {
+	return &configError{Path: v.Path, Line: v.Line, Text: v.Text, Err: err}
+}
+
+// keyError wraps err as a configError for the first setting in values whose
+// path starts with prefix, or for prefix itself when there is none.
+func keyError(values []tomlValue, err error, prefix ...string) error {
+	for _, v := range values {
+		if len(v.Path) >= len(prefix) && slices.Equal(v.Path[:len(prefix)], prefix) {
+			return settingError(v, err)
+		}
+	}
+	return &configError{Path: prefix, Err: err}
+}
+
+// tomlSyntaxError reports a line that is not valid TOML, showing it and how
+// a valid line looks.
+func tomlSyntaxError(line int, text, problem, example string) error {
+	return fmt.Errorf("line %d: %s\n    %d | %s\n  A valid line looks like:\n    %s", line, problem, line, strings.TrimSpace(text), example)
+}
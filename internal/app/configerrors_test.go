@@ -0,0 +1,115 @@
+package app
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClosestConfigKey(t *testing.T) {
+	tests := []struct {
+		path []string
+		want []string
+	}{
+		{[]string{"backup", "compresion"}, []string{"backup", "compression"}},
+		{[]string{"backup", "dirr"}, []string{"backup", "dir"}},
+		{[]string{"bakup", "dir"}, []string{"backup", "dir"}},
+		{[]string{"batch", "retry"}, []string{"batch", "retries"}},
+		{[]string{"schedules", "nightly", "calender"}, []string{"schedules", "nightly", "calendar"}},
+		{[]string{"containers", "dev-box", "priorty"}, []string{"containers", "dev-box", "priority"}},
+		{[]string{"completely", "unrelated"}, nil},
+		{[]string{"x"}, nil},
+	}
+	for _, tt := range tests {
+		if got := closestConfigKey(tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("closestConfigKey(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeConfigErrors(t *testing.T) {
+	tests := []struct {
+		name, text string
+		yaml       bool
+		path       string
+		line       int
+		unknown    bool
+		contains   string
+	}{
+		{
+			name: "unknown key", text: "[backup]\ncompresion = \"zstd\"\n",
+			path: "backup.compresion", line: 2, unknown: true, contains: "did you mean backup.compression?",
+		},
+		{
+			name: "wrong type", text: "[batch]\nretries = \"two\"\n",
+			path: "batch.retries", line: 2,
+		},
+		{
+			name: "negative retries", text: "[batch]\nretries = -1\n",
+			path: "batch.retries", line: 2, contains: "must not be negative",
+		},
+		{
+			name: "bad enum", text: "[batch]\non_failure = \"panic\"\n",
+			path: "batch.on_failure", line: 2,
+		},
+		{
+			name: "bad size", text: "[transfer]\nbandwidth_limit = \"fast\"\n",
+			path: "transfer.bandwidth_limit", line: 2,
+		},
+		{
+			name: "bad window", text: "[schedules.nightly]\ncalendar = \"daily\"\nall = true\nwindow = \"25:00-06:00\"\n",
+			path: "schedules.nightly.window", line: 4,
+		},
+		{
+			name: "yaml unknown key", text: "backup:\n  dir: /tmp/x\n  compresion: zstd\n", yaml: true,
+			path: "backup.compresion", line: 3, unknown: true, contains: "3 | compresion: zstd",
+		},
+		{
+			name: "yaml wrong type", text: "batch:\n  retries: two\n", yaml: true,
+			path: "batch.retries", line: 2,
+		},
+		{
+			name: "yaml plain yes is not a boolean", text: "backup:\n  home_xattrs: yes\n", yaml: true,
+			path: "backup.home_xattrs", line: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfig(tt.text, tt.yaml)
+			var ce *configError
+			if !errors.As(err, &ce) {
+				t.Fatalf("got %v, want a configError", err)
+			}
+			if got := strings.Join(ce.Path, "."); got != tt.path {
+				t.Errorf("path = %s, want %s", got, tt.path)
+			}
+			if ce.Line != tt.line {
+				t.Errorf("line = %d, want %d", ce.Line, tt.line)
+			}
+			if errors.Is(ce.Err, errUnknownKey) != tt.unknown {
+				t.Errorf("unknown key = %v, want %v", errors.Is(ce.Err, errUnknownKey), tt.unknown)
+			}
+			if !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("error %q does not contain %q", err, tt.contains)
+			}
+		})
+	}
+}
+
+func TestDecodeConfigValid(t *testing.T) {
+	toml := "[backup]\ndir = \"/tmp/x\"\ncompression_level = 3\n\n[batch]\nretries = 2\n"
+	yaml := "backup:\n  dir: /tmp/x\n  compression_level: 3\nbatch:\n  retries: 2\n"
+	for _, tt := range []struct {
+		text string
+		yaml bool
+	}{{toml, false}, {yaml, true}} {
+		c, err := parseConfig(tt.text, tt.yaml)
+		if err != nil {
+			t.Fatalf("parseConfig(yaml=%v): %v", tt.yaml, err)
+		}
+		if c.Backup.Dir != "/tmp/x" || c.Backup.CompressionLevel != 3 || c.Batch.Retries != 2 {
+			t.Errorf("parseConfig(yaml=%v) = dir %q, level %d, retries %d", tt.yaml, c.Backup.Dir, c.Backup.CompressionLevel, c.Batch.Retries)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// A podman system connection lets the tool work on the distroboxes of
+// another host or of a podman machine. podman commands get --remote
+// --connection NAME, and distrobox commands CONTAINER_CONNECTION, which
+// podman honors the same way. Images and archives travel over the
+// connection, but isolated homes are folders on the other machine, so they
+// are neither archived nor restored.
+
+// connectionFlag is the global -connection flag; it overrides [podman]
+// connection.
+var connectionFlag string
+
+// podmanConnection is the connection the session works through, if any.
+var podmanConnection string
+
+// podmanConnectionInfo is an entry of `podman system connection list`.
+type podmanConnectionInfo struct {
+	Name    string
+	URI     string
+	Default bool
+}
+
+// listConnections returns the podman system connections. It runs podman
+// where the other commands do, so from a Flatpak it lists the host's.
+func listConnections() ([]podmanConnectionInfo, error) {
+	out, err := commandRunner(containerRuntime, "system", "connection", "list", "--format", "json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not list podman connections: %w", err)
+	}
+	var conns []podmanConnectionInfo
+	if err := json.Unmarshal(out, &conns); err != nil {
+		return nil, fmt.Errorf("could not parse the podman connection list: %w", err)
+	}
+	return conns, nil
+}
+
+// enableConnection makes the session work through the podman connection
+// name.
+func enableConnection(name string) error {
+	if containerRuntime != "podman" && containerRuntime != "podman-launcher" {
+		return fmt.Errorf("connections are a podman feature, but distrobox uses %s", containerRuntime)
+	}
+	if rootMode {
+		return fmt.Errorf("-root and a podman connection cannot be combined; configure the connection to log in as root instead")
+	}
+	conns, err := listConnections()
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, c := range conns {
+		if c.Name == name {
+			podmanConnection = name
+			commandRunner = connectionRunner(commandRunner, name)
+			return nil
+		}
+		names = append(names, c.Name)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("podman connection '%s' does not exist and none are configured; add one with 'podman system connection add'", name)
+	}
+	return fmt.Errorf("podman connection '%s' does not exist; configured: %s", name, strings.Join(names, ", "))
+}
+
+// connectionRunner wraps run so that podman and distrobox commands go
+// through the connection name.
+func connectionRunner(run backup.Runner, name string) backup.Runner {
+	return func(cmd string, args ...string) *exec.Cmd {
+		if cmd == containerRuntime {
+			return run(cmd, append([]string{"--remote", "--connection", name}, args...)...)
+		}
+		c := run(cmd, args...)
+		if strings.HasPrefix(cmd, "distrobox") {
+			setCommandEnv(c, "CONTAINER_CONNECTION="+name)
+		}
+		return c
+	}
+}
+
+// cmdConnections lists the podman connections.
+func cmdConnections(args []string) int {
+	fs := newCommandFlags("connections")
+	asJSON := fs.Bool("json", false, "print the connections as JSON")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	conns, err := listConnections()
+	if err != nil {
+		logError(err.Error())
+		return 1
+	}
+	if *asJSON {
+		type listedConnection struct {
+			Name    string `json:"name"`
+			URI     string `json:"uri"`
+			Default bool   `json:"default"`
+			Active  bool   `json:"active"`
+		}
+		listed := []listedConnection{}
+		for _, c := range conns {
+			listed = append(listed, listedConnection{c.Name, c.URI, c.Default, c.Name == podmanConnection})
+		}
+		out, _ := json.MarshalIndent(listed, "", "  ")
+		fmt.Fprintln(dataOut, string(out))
+		return 0
+	}
+	if len(conns) == 0 {
+		fmt.Println("No podman connections configured; add one with 'podman system connection add'.")
+		return 0
+	}
+	for _, c := range conns {
+		mark := ""
+		if c.Default {
+			mark = " (default)"
+		}
+		if c.Name == podmanConnection {
+			mark += " (in use)"
+		}
+		fmt.Printf("%-20s %s%s\n", c.Name, c.URI, mark)
+	}
+	return 0
+}
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// assumedCommitRate is a deliberately conservative commit throughput used
+// for time estimates.
+const assumedCommitRate = 80 << 20 // bytes per second
+
+// dirSize sums the sizes of the regular files below path.
+func dirSize(path string) (uint64, error) {
+	var total uint64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // unreadable entries are skipped, not fatal
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += uint64(info.Size())
+			}
+		}
+		return nil
+	})
+	return total, err
+}
+
+// containerWritableSize returns the size of a container's writable layer,
+// which is what a commit has to copy.
+func containerWritableSize(name string) (uint64, error) {
+	out, err := runCommand(containerRuntime, "inspect", "--type", "container", "--size", "--format", "{{.SizeRw}}", name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(out), 10, 64)
+}
+
+// containerRootfsSize returns the size of a container's whole filesystem,
+// image layers included, which is about what a backup of it saves.
+func containerRootfsSize(name string) (uint64, error) {
+	out, err := runCommand(containerRuntime, "inspect", "--type", "container", "--size", "--format", "{{.SizeRootFs}}", name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(out), 10, 64)
+}
+
+// printConversionPlan shows every step of a Standard/Isolated conversion,
+// including the directories touched and a rough duration estimate.
+func printConversionPlan(container Container, toIsolated bool, oldHome string, createOpts backup.CreateOptions) {
+	printTitle(colorUnderline, "Conversion plan")
+	step := 0
+	line := func(format string, args ...any) {
+		step++
+		fmt.Printf("  %s%d.%s %s\n", colorBold, step, colorReset, fmt.Sprintf(format, args...))
+	}
+
+	switch cfg.Edit.PreBackup {
+	case preBackupAlways:
+		line("Back up image and home to %s", defaultBackupDir())
+	case preBackupAsk:
+		line("Optional safety backup to %s (you will be asked)", defaultBackupDir())
+	}
+	line("%s%s stop %s%s", colorCyan, containerRuntime, container.Name, colorReset)
+	line("%s%s commit %s %s%s", colorCyan, containerRuntime, container.Name, createOpts.Image, colorReset)
+	line("%sdistrobox-rm -f %s%s", colorCyan, container.Name, colorReset)
+	line("%sdistrobox-create %s%s", colorCyan, strings.Join(createOpts.Args(), " "), colorReset)
+	if toIsolated {
+		line("Create the isolated home %s%s%s (starts empty; host dotfiles are not copied)", colorGreen, createOpts.Home, colorReset)
+	} else {
+		size := "unknown size"
+		if n, err := dirSize(oldHome); err == nil {
+			size = formatBytes(n)
+		}
+		line("%sPERMANENTLY DELETE%s %s (%s)", colorRed, colorReset, oldHome, size)
+	}
+
+	fmt.Println()
+	if n, err := containerWritableSize(container.Name); err == nil {
+		estimate := time.Duration(float64(n)/assumedCommitRate*float64(time.Second)) + 15*time.Second
+		fmt.Printf("  %s\n", symbols(fmt.Sprintf("Changes to commit: %s — estimated time: ~%s", formatBytes(n), estimate.Round(time.Second))))
+	} else {
+		fmt.Printf("  Estimated time: unknown (could not determine the container's size)\n")
+	}
+	fmt.Println()
+}
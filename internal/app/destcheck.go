@@ -0,0 +1,322 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// `destination check` tests a destination the way a backup uses it, without
+// writing one: that it can be logged in to without a prompt, that a file
+// can be written there and removed, that there is room for another backup
+// as large as the largest one already there, and how long a round trip
+// takes. Run from a schedule ahead of the nightly backup, broken NAS
+// credentials show up as a failed check instead of a failed backup.
+
+// Results of a destination test.
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// slowRoundTrip is the round trip above which a destination check warns.
+const slowRoundTrip = time.Second
+
+// destCheck is the result of one test of a destination.
+type destCheck struct {
+	Test   string `json:"test"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// destReport is the outcome of checking one destination.
+type destReport struct {
+	Destination string      `json:"destination"`
+	Target      string      `json:"target"`
+	Checks      []destCheck `json:"checks"`
+}
+
+func (r *destReport) add(test, status, detail string) {
+	r.Checks = append(r.Checks, destCheck{Test: test, Status: status, Detail: detail})
+}
+
+// failed reports whether a test of the destination failed.
+func (r destReport) failed() bool {
+	for _, c := range r.Checks {
+		if c.Status == checkFail {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDestination runs the tests of a destination. A destination that
+// cannot be reached is not tested further.
+func checkDestination(d pruneDestination) destReport {
+	r := destReport{Destination: d.Label, Target: d.Dir}
+	var free uint64
+	var freeKnown bool
+	switch {
+	case d.Remote != nil && d.Remote.Rclone:
+		t := *d.Remote
+		r.Target = t.String()
+		if !commandExists("rclone") {
+			r.add("credentials", checkFail, "'rclone' is not installed")
+			return r
+		}
+		if out, err := runCommand("rclone", "lsf", "--max-depth", "1", "--dirs-only", t.Host+":"); err != nil {
+			r.add("credentials", checkFail, fmt.Sprintf("rclone could not list %s: %s; run 'rclone config reconnect %[1]s' if its token expired", t.Host+":", commandProblem(out, err)))
+			return r
+		}
+		r.add("credentials", checkOK, fmt.Sprintf("rclone remote %s: answers", t.Host))
+		probe := t.rcloneFile(".distrobox-tool-check-" + newUUID())
+		out, err := runCommand("rclone", "mkdir", t.Host+":"+t.Path)
+		if err == nil {
+			if out, err = runCommand("rclone", "touch", probe); err == nil {
+				out, err = runCommand("rclone", "deletefile", probe)
+			}
+		}
+		if err != nil {
+			r.add("write", checkFail, fmt.Sprintf("could not write to %s: %s", t, commandProblem(out, err)))
+			return r
+		}
+		r.add("write", checkOK, "a test file was written and removed")
+		if free, err = t.prepare(); err == nil && free > 0 {
+			freeKnown = true
+		}
+		start := time.Now()
+		if out, err := runCommand("rclone", "lsf", "--max-depth", "1", t.Host+":"+t.Path); err != nil {
+			r.add("latency", checkFail, commandProblem(out, err))
+			return r
+		}
+		r.add(latencyCheck(time.Since(start), "to list the folder with rclone"))
+
+	case d.Remote != nil:
+		t := *d.Remote
+		r.Target = t.String()
+		// BatchMode fails where a password or passphrase would be asked,
+		// as a scheduled run cannot answer one.
+		start := time.Now()
+		args := append([]string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=15"}, t.sshArgs()...)
+		if out, err := runCommand("ssh", append(args, "true")...); err != nil {
+			r.add("credentials", checkFail, fmt.Sprintf("could not log in to %s without a prompt: %s; set up an SSH key (with ssh-agent for a passphrase)", t.Host, commandProblem(out, err)))
+			return r
+		}
+		r.add("credentials", checkOK, fmt.Sprintf("logged in to %s without a prompt in %s", t.Host, time.Since(start).Round(time.Millisecond)))
+		probe := shellQuote(path.Join(t.Path, ".distrobox-tool-check-"+newUUID()))
+		if out, err := t.run(fmt.Sprintf("mkdir -p %s && : > %s && rm -f %s", shellQuote(t.Path), probe, probe)); err != nil {
+			r.add("write", checkFail, fmt.Sprintf("could not write to %s: %s", t, commandProblem(out, err)))
+			return r
+		}
+		r.add("write", checkOK, "a test file was written and removed")
+		var err error
+		if free, err = t.prepare(); err != nil {
+			r.add("free space", checkFail, err.Error())
+		} else {
+			freeKnown = true
+		}
+		start = time.Now()
+		if out, err := t.run("true"); err != nil {
+			r.add("latency", checkFail, commandProblem(out, err))
+			return r
+		}
+		r.add(latencyCheck(time.Since(start), "per command over the open connection"))
+
+	default:
+		// The folder is not created: a missing one usually means a drive
+		// or share that is not mounted, which a check should report.
+		if info, err := os.Stat(d.Dir); err != nil || !info.IsDir() {
+			r.add("folder", checkFail, fmt.Sprintf("%s does not exist; is its drive mounted?", d.Dir))
+			return r
+		}
+		r.add("folder", checkOK, d.Dir+" exists")
+		if _, configured := cfg.Destinations[d.Label]; configured {
+			if base, ok := unmountedBelow(d.Dir); ok {
+				r.add("mount", checkWarn, fmt.Sprintf("%s is on the same filesystem as %s; nothing is mounted for it, so backups would fill that disk instead", d.Dir, base))
+			}
+		}
+		start := time.Now()
+		f, err := os.CreateTemp(d.Dir, ".distrobox-tool-check-*")
+		if err == nil {
+			_, err = f.Write(make([]byte, 64*1024))
+			if err == nil {
+				err = f.Sync()
+			}
+			f.Close()
+			if rmErr := os.Remove(f.Name()); err == nil {
+				err = rmErr
+			}
+		}
+		elapsed := time.Since(start)
+		if err != nil {
+			r.add("write", checkFail, fmt.Sprintf("could not write to %s: %v", d.Dir, err))
+			return r
+		}
+		r.add("write", checkOK, "a test file was written and removed")
+		if free, err = getFreeDiskSpace(d.Dir); err != nil {
+			r.add("free space", checkFail, err.Error())
+		} else {
+			freeKnown = true
+		}
+		r.add(latencyCheck(elapsed, "to write and sync 64 KiB"))
+	}
+
+	// Another backup needs about as much room as the largest one there.
+	var largest int64
+	if backups, err := d.scan(); err == nil {
+		for _, b := range backups {
+			largest = max(largest, b.Size)
+		}
+	}
+	switch {
+	case !freeKnown && d.Remote != nil && d.Remote.Rclone:
+		r.add("free space", checkWarn, "the backend does not report its free space")
+	case !freeKnown:
+	case largest > 0 && free < uint64(largest):
+		r.add("free space", checkFail, fmt.Sprintf("%s free, less than the largest backup here (%s)", formatBytes(free), formatBytes(uint64(largest))))
+	case largest > 0:
+		r.add("free space", checkOK, fmt.Sprintf("%s free; the largest backup here is %s", formatBytes(free), formatBytes(uint64(largest))))
+	default:
+		r.add("free space", checkOK, formatBytes(free)+" free")
+	}
+	return r
+}
+
+// mountRoots are the folders drives and network shares are mounted below.
+var mountRoots = []string{"/mnt", "/media", "/run/media"}
+
+// unmountedBelow reports whether dir lies below one of mountRoots without
+// anything mounted in between, as when a NAS share is not mounted and its
+// mount point is an empty folder, and returns that root.
+func unmountedBelow(dir string) (string, bool) {
+	dev, ok := fileDevice(dir)
+	if !ok {
+		return "", false
+	}
+	for _, root := range mountRoots {
+		if !strings.HasPrefix(dir, root+"/") {
+			continue
+		}
+		rootDev, ok := fileDevice(root)
+		return root, ok && rootDev == dev
+	}
+	return "", false
+}
+
+// fileDevice returns the device of the filesystem holding path.
+func fileDevice(path string) (uint64, bool) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
+
+// commandProblem returns the last line a failed command printed, which
+// usually says what went wrong, or else its error.
+func commandProblem(out string, err error) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return strings.TrimSuffix(last, ".")
+	}
+	return err.Error()
+}
+
+// latencyCheck rates a measured round trip.
+func latencyCheck(d time.Duration, what string) (test, status, detail string) {
+	status = checkOK
+	if d > slowRoundTrip {
+		status = checkWarn
+	}
+	return "latency", status, fmt.Sprintf("%s %s", d.Round(time.Millisecond), what)
+}
+
+func printDestReport(r destReport) {
+	fmt.Printf("%s%s%s  (%s)\n", colorBold, r.Destination, colorReset, r.Target)
+	for _, c := range r.Checks {
+		mark, color := "✅", colorGreen
+		switch c.Status {
+		case checkWarn:
+			mark, color = "⚠️", colorYellow
+		case checkFail:
+			mark, color = "❌", colorRed
+		}
+		fmt.Printf("  %s %s%-12s%s %s\n", symbols(mark), color, c.Test, colorReset, c.Detail)
+	}
+}
+
+// checkDestinations checks dests one after another, printing each report
+// unless quiet, and returns the reports.
+func checkDestinations(dests []pruneDestination, quiet bool) []destReport {
+	var reports []destReport
+	for _, d := range dests {
+		var done chan bool
+		if !quiet {
+			done = make(chan bool)
+			go showSpinner("check", fmt.Sprintf("Checking %s...", d), done)
+		}
+		r := checkDestination(d)
+		if !quiet {
+			done <- true
+			printDestReport(r)
+			if r.failed() {
+				logError(fmt.Sprintf("Destination '%s' is not ready for backups.", r.Destination))
+			} else {
+				logSuccess(fmt.Sprintf("✅ Destination '%s' is ready for backups.", r.Destination))
+			}
+			fmt.Println()
+		}
+		reports = append(reports, r)
+	}
+	return reports
+}
+
+const destinationUsage = "usage: distrobox-tool destination check [--json] [NAME|DIR|HOST:PATH]"
+
+// cmdDestination runs `destination check`: every destination, or the one
+// named, is tested and the exit code is 1 when a test failed.
+func cmdDestination(args []string) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, destinationUsage)
+		return 2
+	}
+	fs := newCommandFlags("destination check")
+	asJSON := fs.Bool("json", false, "print the results as JSON")
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, destinationUsage)
+		return 2
+	}
+	dests, ok := findPruneDestinations(fs.Arg(0))
+	if !ok {
+		logError(fmt.Sprintf("Destination '%s' is not configured and is not a folder.", fs.Arg(0)))
+		return 2
+	}
+	reports := checkDestinations(dests, *asJSON)
+	if *asJSON {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			logError(err.Error())
+			return 1
+		}
+		fmt.Fprintln(dataOut, string(data))
+	}
+	for _, r := range reports {
+		if r.failed() {
+			return 1
+		}
+	}
+	return 0
+}
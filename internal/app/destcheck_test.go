@@ -0,0 +1,82 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckDestinationLocal(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "not-mounted")
+	tests := []struct {
+		name   string
+		dir    string
+		failed bool
+		tests  []string
+	}{
+		{"writable folder", dir, false, []string{"folder", "write", "latency", "free space"}},
+		{"missing folder", missing, true, []string{"folder"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := checkDestination(pruneDestination{Label: "test", Dir: tt.dir})
+			if r.failed() != tt.failed {
+				t.Errorf("failed = %v, want %v: %+v", r.failed(), tt.failed, r.Checks)
+			}
+			var got []string
+			for _, c := range r.Checks {
+				got = append(got, c.Test)
+			}
+			if !reflect.DeepEqual(got, tt.tests) {
+				t.Errorf("tests = %q, want %q", got, tt.tests)
+			}
+		})
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("checking %s created it", missing)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("the check left %d files behind in %s", len(entries), dir)
+	}
+}
+
+func TestCommandProblem(t *testing.T) {
+	err := errors.New("exit status 255")
+	tests := []struct {
+		out, want string
+	}{
+		{"", "exit status 255"},
+		{"  \n", "exit status 255"},
+		{"Permission denied (publickey).", "Permission denied (publickey)"},
+		{"Warning: added host key\nssh: connect to host nas port 22: No route to host\n", "ssh: connect to host nas port 22: No route to host"},
+	}
+	for _, tt := range tests {
+		if got := commandProblem(tt.out, err); got != tt.want {
+			t.Errorf("commandProblem(%q) = %q, want %q", tt.out, got, tt.want)
+		}
+	}
+}
+
+func TestLatencyCheck(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{20 * time.Millisecond, checkOK},
+		{slowRoundTrip, checkOK},
+		{slowRoundTrip + time.Millisecond, checkWarn},
+	}
+	for _, tt := range tests {
+		if test, status, _ := latencyCheck(tt.d, "per command"); test != "latency" || status != tt.want {
+			t.Errorf("latencyCheck(%s) = %s %s, want latency %s", tt.d, test, status, tt.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// distroboxConfigFiles lists the configuration files distrobox reads, in
+// order; later files override earlier ones.
+func distroboxConfigFiles() []string {
+	files := []string{
+		"/usr/share/distrobox/distrobox.conf",
+		"/usr/share/defaults/distrobox/distrobox.conf",
+		"/usr/etc/distrobox/distrobox.conf",
+		"/etc/distrobox/distrobox.conf",
+	}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	homeDir, _ := os.UserHomeDir()
+	if configHome == "" && homeDir != "" {
+		configHome = filepath.Join(homeDir, ".config")
+	}
+	if configHome != "" {
+		files = append(files, filepath.Join(configHome, "distrobox", "distrobox.conf"))
+	}
+	if homeDir != "" {
+		files = append(files, filepath.Join(homeDir, ".distroboxrc"))
+	}
+	return files
+}
+
+// distroboxConf holds the merged settings of all distrobox config files.
+var distroboxConf map[string]string
+
+// loadDistroboxConfig reads distrobox's own configuration. The files are
+// shell snippets; only plain `key=value` assignments are understood, which
+// is all distrobox documents for them.
+func loadDistroboxConfig() {
+	distroboxConf = map[string]string{}
+	for _, path := range distroboxConfigFiles() {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			line = strings.TrimPrefix(line, "export ")
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			distroboxConf[strings.TrimSpace(key)] = shellValue(strings.TrimSpace(value))
+		}
+		f.Close()
+	}
+}
+
+// shellValue unquotes a shell assignment value, expanding variables unless it
+// is single-quoted.
+func shellValue(v string) string {
+	if len(v) >= 2 && v[0] == '\'' && v[len(v)-1] == '\'' {
+		return v[1 : len(v)-1]
+	}
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		v = v[1 : len(v)-1]
+	} else if i := strings.Index(v, " #"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	return os.ExpandEnv(v)
+}
+
+// distroboxSetting returns a distrobox setting, letting its DBX_* environment
+// variable override the config files just as distrobox does.
+func distroboxSetting(key, env string) string {
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	if distroboxConf == nil {
+		loadDistroboxConfig()
+	}
+	return distroboxConf[key]
+}
+
+// distroboxHomeRoot is the directory isolated homes are created in: the
+// tool's [homes] root, distrobox's container_home_prefix, or distrobox's
+// default.
+func distroboxHomeRoot() (string, error) {
+	if cfg.Homes.Root != "" {
+		return expandHome(cfg.Homes.Root), nil
+	}
+	if prefix := distroboxSetting("container_home_prefix", "DBX_CONTAINER_HOME_PREFIX"); prefix != "" {
+		return expandHome(prefix), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".local", "share", "distrobox", "homes"), nil
+}
+
+// runtimeOrder is the order in which distrobox autodetects the container
+// manager. podman-launcher is a self-contained podman and used like it.
+var runtimeOrder = []string{"podman", "podman-launcher", "docker", "lilipod"}
+
+// detectRuntime picks the container manager the way distrobox does: the
+// configured container_manager (or DBX_CONTAINER_MANAGER) wins, otherwise
+// the first of runtimeOrder that is installed. Falling back to another
+// runtime than distrobox's would show other containers, so a configured
+// manager that is missing or unsupported is an error.
+func detectRuntime() (string, error) {
+	switch manager := distroboxSetting("container_manager", "DBX_CONTAINER_MANAGER"); manager {
+	case "", "autodetect":
+	case "podman", "podman-launcher", "docker", "lilipod":
+		if !commandExists(manager) {
+			return "", fmt.Errorf("distrobox is configured to use '%s', but it is not installed", manager)
+		}
+		return supportedRuntime(manager)
+	default:
+		return "", fmt.Errorf("container manager '%s' from the distrobox configuration is not supported; use podman or docker", manager)
+	}
+	for _, runtime := range runtimeOrder {
+		if commandExists(runtime) {
+			return supportedRuntime(runtime)
+		}
+	}
+	return "", fmt.Errorf("none of %s found", strings.Join(runtimeOrder, ", "))
+}
+
+// supportedRuntime returns runtime, or an error for lilipod.
+func supportedRuntime(runtime string) (string, error) {
+	if runtime == "lilipod" {
+		// lilipod has stop and rmi, but no commit, save or load to map the
+		// backup and restore steps to, and an image it did not pull from a
+		// registry cannot be turned into a container.
+		return "", fmt.Errorf("distrobox uses lilipod, which cannot commit, save or load images, so its containers cannot be backed up; set container_manager to podman or docker in distrobox.conf")
+	}
+	return runtime, nil
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// checkCipher reports an error if cipher needs a host tool that is missing.
+func checkCipher(cipher backup.Cipher) error {
+	if cmd := cipher.Command(); cmd != "" && !commandExists(cmd) {
+		return fmt.Errorf("the '%s' command is required for %s encryption but was not found", cmd, cipher)
+	}
+	return nil
+}
+
+// configuredEncryption is the encryption new backups get by default.
+func configuredEncryption() backup.Encryption {
+	return backup.Encryption{Cipher: cfg.Encryption.Method, Recipient: expandHome(cfg.Encryption.Recipient)}
+}
+
+// promptEncryption asks whether to encrypt a backup, offering the configured
+// method and recipient as defaults. It returns false if the user cancelled.
+func promptEncryption() (backup.Encryption, bool) {
+	def := configuredEncryption()
+	fmt.Printf("%s> Encryption: (n)one, (a)ge, (g)pg [default: %s]: %s", colorBold, def.Cipher, colorReset)
+	enc := def
+	switch readUserInput() {
+	case "n", "N":
+		enc = backup.Encryption{}
+	case "a", "A":
+		enc.Cipher = backup.EncryptAge
+	case "g", "G":
+		enc.Cipher = backup.EncryptGPG
+	}
+	if enc.Cipher == backup.EncryptNone {
+		return enc, true
+	}
+	if err := checkCipher(enc.Cipher); err != nil {
+		logError(err.Error())
+		return enc, false
+	}
+
+	if enc.Cipher != def.Cipher {
+		enc.Recipient = ""
+	}
+	if enc.Recipient != "" {
+		fmt.Printf("%s> Recipient [default: %s]: %s", colorBold, enc.Recipient, colorReset)
+	} else if enc.Cipher == backup.EncryptAge {
+		fmt.Printf("%s> Recipient (age public key or recipients file): %s", colorBold, colorReset)
+	} else {
+		fmt.Printf("%s> Recipient (gpg key ID or email): %s", colorBold, colorReset)
+	}
+	if input := readUserInput(); input != "" {
+		enc.Recipient = expandHome(input)
+	}
+	if enc.Recipient == "" {
+		logWarning("Encryption needs a recipient.")
+		return enc, false
+	}
+	return enc, true
+}
+
+// checkDecryption reports an error if an encrypted archive cannot be
+// decrypted on this host.
+func checkDecryption(file string) error {
+	cipher, err := backup.FileCipher(file)
+	if err != nil {
+		return err
+	}
+	return checkCipherDecryption(cipher)
+}
+
+// checkCipherDecryption reports an error if archives encrypted with cipher
+// cannot be decrypted on this host.
+func checkCipherDecryption(cipher backup.Cipher) error {
+	if cipher == backup.EncryptNone {
+		return nil
+	}
+	if err := checkCipher(cipher); err != nil {
+		return err
+	}
+	if cipher == backup.EncryptAge && client.Identity == "" {
+		return fmt.Errorf("the backup is encrypted with age; set 'identity' in the [encryption] section of the config to your age identity file")
+	}
+	logInfo(fmt.Sprintf("The backup is encrypted with %s; it is decrypted while loading.", cipher))
+	return nil
+}
@@ -0,0 +1,197 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Formats a container's root filesystem can be exported in. The disk
+// images hold a single ext4 filesystem without a partition table.
+const (
+	exportTar      = "tar"
+	exportSquashfs = "squashfs"
+	exportRaw      = "raw"
+	exportQcow2    = "qcow2"
+)
+
+var exportFormats = []string{exportTar, exportSquashfs, exportRaw, exportQcow2}
+
+// exportDiskHeadroom is the free space virt-make-fs leaves on a disk image
+// beyond what the files take, so the VM has room to work.
+const exportDiskHeadroom = "+1G"
+
+// exportFileName names the export of base in format.
+func exportFileName(dir, base, format string) string {
+	switch format {
+	case exportSquashfs:
+		return filepath.Join(dir, base+".squashfs")
+	case exportRaw:
+		return filepath.Join(dir, base+".img")
+	case exportQcow2:
+		return filepath.Join(dir, base+".qcow2")
+	}
+	return filepath.Join(dir, base+"-rootfs.tar")
+}
+
+// exportTool returns the host command that converts the rootfs tarball to
+// format, or an error naming what to install.
+func exportTool(format string) (string, error) {
+	switch format {
+	case exportSquashfs:
+		for _, tool := range []string{"sqfstar", "tar2sqfs"} {
+			if commandExists(tool) {
+				return tool, nil
+			}
+		}
+		return "", fmt.Errorf("squashfs export needs 'sqfstar' (squashfs-tools 4.6 or later) or 'tar2sqfs' (squashfs-tools-ng)")
+	case exportRaw, exportQcow2:
+		if !commandExists("virt-make-fs") {
+			return "", fmt.Errorf("disk image export needs 'virt-make-fs' (guestfs-tools or libguestfs-tools)")
+		}
+		return "virt-make-fs", nil
+	}
+	return "", nil
+}
+
+// exportContainer writes the root filesystem of a container to file in
+// format. Other formats than tar are converted from a tarball written next
+// to file first, which keeps the owners and modes of the files without root
+// on the host. The result only gets its name once it is complete.
+func exportContainer(c Container, file, format string) error {
+	tool, err := exportTool(format)
+	if err != nil {
+		return err
+	}
+	part := file + partialSuffix
+	tarball := part
+	if format != exportTar {
+		tarball = file + ".rootfs.tar" + partialSuffix
+		defer os.Remove(tarball)
+	}
+	defer removeOnInterrupt(func() []string { return []string{part, tarball} })()
+
+	done := make(chan bool)
+	go showSpinner("export", "Exporting root filesystem...", done)
+	err = client.Export(c.Name, tarball)
+	done <- true
+	if err != nil {
+		os.Remove(tarball)
+		return fmt.Errorf("failed to export the container's filesystem: %w", err)
+	}
+	if err := reclaimFile(tarball); err != nil {
+		logWarning(fmt.Sprintf("Could not make %s yours: %v", tarball, err))
+	}
+
+	if format != exportTar {
+		os.Remove(part) // left by an earlier run; the tools will not overwrite it
+		var args []string
+		switch tool {
+		case "sqfstar":
+			args = []string{"-quiet", part}
+		case "tar2sqfs":
+			args = []string{"--quiet", part}
+		default:
+			args = []string{"--type=ext4", "--format=" + format, "--size=" + exportDiskHeadroom, tarball, part}
+		}
+		var stderr bytes.Buffer
+		cmd := commandRunner(tool, args...)
+		cmd.Stderr = &stderr
+		if tool != "virt-make-fs" {
+			in, err := os.Open(tarball)
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+			cmd.Stdin = in
+		}
+		doneConvert := make(chan bool)
+		go showSpinner("convert", fmt.Sprintf("Building the %s image with %s...", format, tool), doneConvert)
+		err = cmd.Run()
+		doneConvert <- true
+		if err != nil {
+			os.Remove(part)
+			return fmt.Errorf("%s failed: %w: %s", tool, err, strings.TrimSpace(stderr.String()))
+		}
+	}
+	return os.Rename(part, file)
+}
+
+// exportHint says how to use an export of format.
+func exportHint(file, format string) string {
+	name := filepath.Base(file)
+	switch format {
+	case exportSquashfs:
+		return fmt.Sprintf("Mount it with 'sudo mount -t squashfs %s /mnt', or use it as a read-only root for systemd-nspawn with 'sudo systemd-nspawn -i %s'.", name, name)
+	case exportRaw, exportQcow2:
+		return fmt.Sprintf("The image holds the root filesystem only: a VM needs a kernel, e.g. 'qemu-system-x86_64 -kernel vmlinuz -initrd initrd.img -append root=/dev/vda -drive file=%s,format=%s,if=virtio'. Install a kernel and bootloader into it with virt-customize for a self-contained VM.", name, format)
+	}
+	return fmt.Sprintf("Use it with e.g. 'sudo mkdir rootfs && sudo tar -xpf %s -C rootfs && sudo systemd-nspawn -D rootfs'.", name)
+}
+
+func handleExport(containers []Container) {
+	clearScreen()
+	printTitle(colorYellow, "📤 Export Root Filesystem")
+	fmt.Printf("%s%sHint:%s This writes a flattened rootfs tarball for systemd-nspawn, chroot or LXC, or a SquashFS or disk image for a VM.\n", colorYellow, colorUnderline, colorReset)
+	fmt.Printf("%s%sHint:%s It cannot be restored as a distrobox; use Backup for that.\n\n", colorYellow, colorUnderline, colorReset)
+
+	containerIndex := selectContainer("the container to export", containers)
+	if containerIndex == 0 {
+		return
+	}
+	selectedContainer := containers[containerIndex-1]
+	defer routeTo(selectedContainer)()
+
+	fmt.Printf("\n  %s1)%s Root filesystem tarball (.tar)\n", colorGreen, colorReset)
+	fmt.Printf("  %s2)%s SquashFS image (.squashfs)\n", colorCyan, colorReset)
+	fmt.Printf("  %s3)%s Raw disk image with ext4 (.img)\n", colorCyan, colorReset)
+	fmt.Printf("  %s4)%s qcow2 disk image with ext4 (.qcow2)\n\n", colorCyan, colorReset)
+	formatIndex := selectItem("Select a format", len(exportFormats))
+	if formatIndex == 0 {
+		return
+	}
+	format := exportFormats[formatIndex-1]
+	if _, err := exportTool(format); err != nil {
+		logError(err.Error())
+		return
+	}
+
+	logInfo("Please choose a destination folder.")
+	destDir, err := selectDirectory("Select Export Folder")
+	if err != nil || destDir == "" {
+		if err != nil {
+			logError(err.Error())
+		}
+		logError("No valid destination directory selected. Aborting.")
+		return
+	}
+	if _, remote := parseRemote(destDir); remote {
+		logError("Exports can only be written to a local folder. Aborting.")
+		return
+	}
+
+	fmt.Printf("%s> Enter a base name for the export (default '%s'): %s", colorBold, selectedContainer.Name, colorReset)
+	baseName := readUserInput()
+	if baseName == "" {
+		baseName = selectedContainer.Name
+	}
+	exportFile := exportFileName(destDir, baseName, format)
+
+	if _, err := os.Stat(exportFile); err == nil {
+		fmt.Printf("%s%s%s", colorYellow, symbols(fmt.Sprintf("⚠️  File '%s' already exists. Overwrite? (y/N): ", exportFile)), colorReset)
+		if !confirmAction() {
+			logInfo("Export cancelled by user.")
+			return
+		}
+	}
+
+	logInfo(fmt.Sprintf("Exporting '%s' to '%s'...", selectedContainer.Name, exportFile))
+	if err := exportContainer(selectedContainer, exportFile, format); err != nil {
+		logError(err.Error())
+		return
+	}
+	logSuccess(fmt.Sprintf("✅ Root filesystem exported to '%s'.", exportFile))
+	logInfo(exportHint(exportFile, format))
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// distrobox-export writes launchers for apps as
+// ~/.local/share/applications/<container>-<app>.desktop and wrapper scripts
+// for binaries (by default in ~/.local/bin) marked "# distrobox_binary".
+
+// exportedBinCommand finds the container and the wrapped binary in an
+// exported binary's distrobox-enter line.
+var exportedBinCommand = regexp.MustCompile(`distrobox-enter"?\s+-n\s+(\S+)\s+--\s+'([^']+)'`)
+
+// dataHome returns $XDG_DATA_HOME, or ~/.local/share.
+func dataHome() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return dir, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".local", "share"), nil
+}
+
+// containerExports lists the apps and binaries a container has exported to
+// the host.
+func containerExports(name string) []backup.Export {
+	var exports []backup.Export
+	if dir, err := dataHome(); err == nil {
+		launchers, _ := filepath.Glob(filepath.Join(dir, "applications", name+"-*.desktop"))
+		sort.Strings(launchers)
+		for _, f := range launchers {
+			data, err := os.ReadFile(f)
+			if err != nil || !strings.Contains(string(data), "distrobox-enter") || !strings.Contains(string(data), "-n "+name+" ") {
+				continue
+			}
+			app := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(f), name+"-"), ".desktop")
+			exports = append(exports, backup.Export{App: app})
+		}
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		binDir := filepath.Join(homeDir, ".local", "bin")
+		entries, _ := os.ReadDir(binDir)
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(binDir, e.Name()))
+			if err != nil || !strings.Contains(string(data), "# distrobox_binary") {
+				continue
+			}
+			if m := exportedBinCommand.FindStringSubmatch(string(data)); m != nil && m[1] == name {
+				exports = append(exports, backup.Export{Bin: m[2], ExportPath: binDir})
+			}
+		}
+	}
+	return exports
+}
+
+// exportLabel describes an export in messages.
+func exportLabel(e backup.Export) string {
+	if e.App != "" {
+		return "app " + e.App
+	}
+	return "binary " + e.Bin
+}
+
+// reexport runs distrobox-export inside a restored container for every
+// export recorded in its backup, so launchers and wrappers point at it.
+// Binaries exported below the backup host's home go below this one's.
+// Failures are reported but do not fail the restore.
+func reexport(container string, m *backup.Manifest) {
+	if m == nil || len(m.Exports) == 0 {
+		return
+	}
+	currentHome, _ := os.UserHomeDir()
+	logInfo(fmt.Sprintf("Re-exporting %d app(s) and binaries from '%s' (the first start may take a while)...", len(m.Exports), container))
+	failed := 0
+	for _, e := range m.Exports {
+		args := []string{"-n", container, "--", "distrobox-export"}
+		if e.App != "" {
+			args = append(args, "--app", e.App)
+		} else {
+			exportPath := e.ExportPath
+			if m.HostHome != "" && currentHome != "" && strings.HasPrefix(exportPath, m.HostHome+string(os.PathSeparator)) {
+				exportPath = filepath.Join(currentHome, strings.TrimPrefix(exportPath, m.HostHome))
+			}
+			args = append(args, "--bin", e.Bin, "--export-path", exportPath)
+		}
+		done := make(chan bool)
+		go showSpinner("export", fmt.Sprintf("Exporting %s...", exportLabel(e)), done)
+		_, err := runCommand("distrobox-enter", args...)
+		done <- true
+		if err != nil {
+			failed++
+			logWarning(fmt.Sprintf("Could not re-export %s: %v", exportLabel(e), err))
+		}
+	}
+	if failed == 0 {
+		logSuccess(fmt.Sprintf("✅ %d export(s) recreated.", len(m.Exports)))
+	}
+}
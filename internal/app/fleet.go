@@ -0,0 +1,288 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A fleet folder is a directory shared between machines (an NFS export, a
+// Syncthing folder) holding one <host>.json catalog per machine. Every host
+// only ever replaces its own file, and does so with a rename, so pushes
+// from several machines never conflict and readers never see half a file.
+
+const catalogVersion = 1
+
+// hostCatalog is what `fleet push` publishes about this machine.
+type hostCatalog struct {
+	Version    int                `json:"version"`
+	Host       string             `json:"host"`
+	Generated  time.Time          `json:"generated"`
+	Containers []catalogContainer `json:"containers"`
+	Backups    []catalogBackup    `json:"backups"`
+}
+
+type catalogContainer struct {
+	Name   string `json:"name"`
+	Image  string `json:"image"`
+	Distro string `json:"distro,omitempty"`
+}
+
+type catalogBackup struct {
+	Container   string    `json:"container"`
+	File        string    `json:"file"`
+	Destination string    `json:"destination"`
+	Created     time.Time `json:"created"`
+	Size        int64     `json:"size"`
+	// DataSize is the data archived before compression, when recorded.
+	DataSize int64 `json:"data_size,omitempty"`
+}
+
+// Coverage states of a container in the fleet view.
+const (
+	coverageOK      = "ok"
+	coverageStale   = "stale"
+	coverageMissing = "missing"
+	// coverageRemoved marks backups of a container the host no longer has.
+	coverageRemoved = "removed"
+)
+
+var unsafeCatalogChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// fleetHost returns the name this machine publishes its catalog under.
+func fleetHost() (string, error) {
+	if cfg.Fleet.Host != "" {
+		return cfg.Fleet.Host, nil
+	}
+	return os.Hostname()
+}
+
+// fleetDir returns the configured fleet folder, or dir when given.
+func fleetDir(dir string) (string, error) {
+	if dir == "" {
+		dir = cfg.Fleet.Dir
+	}
+	if dir == "" {
+		return "", fmt.Errorf("no fleet folder: set [fleet] dir in the config file or pass --dir")
+	}
+	return expandHome(dir), nil
+}
+
+// buildCatalog lists this machine's containers and the backups found in
+// every destination. Destinations that cannot be read are left out with a
+// warning, so one offline NAS does not stop the push.
+func buildCatalog() (*hostCatalog, error) {
+	host, err := fleetHost()
+	if err != nil {
+		return nil, err
+	}
+	containers, err := getContainers()
+	if err != nil {
+		return nil, err
+	}
+	c := &hostCatalog{Version: catalogVersion, Host: host, Generated: time.Now().UTC(), Containers: []catalogContainer{}, Backups: []catalogBackup{}}
+	for _, ct := range containers {
+		c.Containers = append(c.Containers, catalogContainer{Name: ct.Name, Image: ct.Image, Distro: distroString(ct.Distro, ct.DistroVersion)})
+	}
+	for _, d := range pruneDestinations() {
+		backups, err := d.scan()
+		if err != nil {
+			logWarning(fmt.Sprintf("Could not read %s: %v", d, err))
+			continue
+		}
+		for _, b := range backups {
+			c.Backups = append(c.Backups, catalogBackup{Container: b.Container, File: b.Name, Destination: d.Label, Created: b.Created.UTC(), Size: b.Size, DataSize: b.DataSize})
+		}
+	}
+	return c, nil
+}
+
+// pushCatalog writes c to dir as <host>.json.
+func pushCatalog(dir string, c *hostCatalog) (string, error) {
+	if err := makeBackupDir(dir); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, unsafeCatalogChars.ReplaceAllString(c.Host, "_")+".json")
+	tmp, err := os.CreateTemp(dir, ".catalog-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(backupFileMode()); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// loadFleet reads every catalog in dir. Files that cannot be read are
+// reported and skipped.
+func loadFleet(dir string) ([]hostCatalog, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var catalogs []hostCatalog
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			logWarning(fmt.Sprintf("Skipping %s: %v", filepath.Base(f), err))
+			continue
+		}
+		var c hostCatalog
+		if err := json.Unmarshal(data, &c); err != nil || c.Host == "" {
+			logWarning(fmt.Sprintf("Skipping %s: not a host catalog", filepath.Base(f)))
+			continue
+		}
+		if c.Version > catalogVersion {
+			logWarning(fmt.Sprintf("Skipping %s: written by a newer version (catalog version %d)", filepath.Base(f), c.Version))
+			continue
+		}
+		catalogs = append(catalogs, c)
+	}
+	sort.Slice(catalogs, func(i, j int) bool { return catalogs[i].Host < catalogs[j].Host })
+	return catalogs, nil
+}
+
+// fleetEntry is the coverage of one container on one host.
+type fleetEntry struct {
+	Host        string     `json:"host"`
+	Container   string     `json:"container"`
+	Status      string     `json:"status"`
+	Backups     int        `json:"backups"`
+	LastBackup  *time.Time `json:"last_backup,omitempty"`
+	Destination string     `json:"destination,omitempty"`
+}
+
+// fleetHostView is a host's coverage, with whether its catalog is outdated.
+type fleetHostView struct {
+	Host         string       `json:"host"`
+	Generated    time.Time    `json:"generated"`
+	CatalogStale bool         `json:"catalog_stale"`
+	Containers   []fleetEntry `json:"containers"`
+}
+
+// fleetCoverage merges the backups of each host onto its containers. A
+// container whose newest backup is older than staleAfter at now is stale;
+// backups of containers that are gone are listed as removed.
+func fleetCoverage(catalogs []hostCatalog, staleAfter time.Duration, now time.Time) []fleetHostView {
+	var views []fleetHostView
+	for _, c := range catalogs {
+		view := fleetHostView{Host: c.Host, Generated: c.Generated, CatalogStale: now.Sub(c.Generated) > staleAfter}
+		byContainer := map[string]*fleetEntry{}
+		var names []string
+		entry := func(name string) *fleetEntry {
+			if e, ok := byContainer[name]; ok {
+				return e
+			}
+			e := &fleetEntry{Host: c.Host, Container: name, Status: coverageRemoved}
+			byContainer[name] = e
+			names = append(names, name)
+			return e
+		}
+		for _, ct := range c.Containers {
+			entry(ct.Name).Status = coverageMissing
+		}
+		for _, b := range c.Backups {
+			e := entry(b.Container)
+			e.Backups++
+			if e.LastBackup == nil || b.Created.After(*e.LastBackup) {
+				created := b.Created
+				e.LastBackup, e.Destination = &created, b.Destination
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			e := byContainer[name]
+			if e.Status != coverageRemoved && e.LastBackup != nil {
+				e.Status = coverageOK
+				if now.Sub(*e.LastBackup) > staleAfter {
+					e.Status = coverageStale
+				}
+			}
+			view.Containers = append(view.Containers, *e)
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+// formatAge renders how long ago t was, to the hour or day.
+func formatAge(now, t time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Hour:
+		return "just now"
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
+
+// fleetProblems counts the stale catalogs and the containers without a
+// recent backup.
+func fleetProblems(views []fleetHostView) int {
+	problems := 0
+	for _, v := range views {
+		if v.CatalogStale {
+			problems++
+		}
+		for _, e := range v.Containers {
+			if e.Status == coverageStale || e.Status == coverageMissing {
+				problems++
+			}
+		}
+	}
+	return problems
+}
+
+func printFleet(views []fleetHostView, now time.Time) {
+	for _, v := range views {
+		header := fmt.Sprintf("%s%s%s  catalog pushed %s", colorBold, v.Host, colorReset, formatAge(now, v.Generated))
+		if v.CatalogStale {
+			header += fmt.Sprintf("  %s(outdated)%s", colorRed, colorReset)
+		}
+		fmt.Println(header)
+		if len(v.Containers) == 0 {
+			fmt.Println("  no containers")
+		}
+		for _, e := range v.Containers {
+			color := colorGreen
+			switch e.Status {
+			case coverageStale, coverageMissing:
+				color = colorRed
+			case coverageRemoved:
+				color = colorYellow
+			}
+			last := "never backed up"
+			if e.LastBackup != nil {
+				last = fmt.Sprintf("last %s to %s, %d backup(s)", formatAge(now, *e.LastBackup), e.Destination, e.Backups)
+			}
+			fmt.Printf("  %s%-8s%s %-25s %s\n", color, strings.ToUpper(e.Status), colorReset, e.Container, last)
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,197 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// tempImageKinds are the jobs whose temporary images are named
+// distrobox-<kind>-<container ID>:<UUID>.
+var tempImageKinds = []string{"backup", "clone", "convert", "rename", "restore"}
+
+// orphanImage is a temporary image left behind by a run that crashed or was
+// killed before it could clean up.
+type orphanImage struct {
+	Ref   string     `json:"image"`
+	Kind  string     `json:"kind"`
+	Owner string     `json:"container,omitempty"`
+	Size  int64      `json:"size"`
+	Taken *time.Time `json:"started,omitempty"`
+	// OnlyCopy marks the image of a conversion or rename whose container
+	// is gone: it may be all that is left of the container.
+	OnlyCopy bool `json:"only_copy"`
+}
+
+// tempImageKind returns the kind of job a temporary image name belongs to,
+// and the container ID in it.
+func tempImageKind(ref string) (kind, id string, ok bool) {
+	ref = strings.TrimPrefix(ref, "localhost/")
+	for _, k := range tempImageKinds {
+		if rest, found := strings.CutPrefix(ref, "distrobox-"+k+"-"); found {
+			id, _, _ = strings.Cut(rest, ":")
+			return k, id, true
+		}
+	}
+	return "", "", false
+}
+
+// processAlive reports whether a process with the given PID still runs.
+func processAlive(pid int) bool {
+	if pid == os.Getpid() {
+		return true
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// findOrphanedImages lists the temporary images that no running job owns
+// and no container uses: those recorded in the journal by a process that is
+// gone, and any image named like a temporary one that the journal does not
+// know about, e.g. from a version of the tool without a journal. Journal
+// entries of runs that are gone and whose image no longer exists are
+// dropped on the way.
+func findOrphanedImages() ([]orphanImage, error) {
+	entries, err := readJournal()
+	if err != nil {
+		return nil, err
+	}
+	journaled := map[string]journalEntry{}
+	for _, e := range entries {
+		journaled[strings.TrimPrefix(e.Image, "localhost/")] = e
+	}
+	images, err := listDistroboxImages(containerRuntime)
+	if err != nil {
+		return nil, err
+	}
+	containers, err := getContainers()
+	if err != nil {
+		return nil, err
+	}
+	names, ids := map[string]bool{}, map[string]string{}
+	for _, c := range containers {
+		names[c.Name] = true
+		ids[c.ID] = c.Name
+	}
+
+	existing := map[string]bool{}
+	for _, img := range images {
+		existing[strings.TrimPrefix(img.Ref, "localhost/")] = true
+	}
+	updateJournal(func(entries []journalEntry) []journalEntry {
+		kept := entries[:0]
+		for _, e := range entries {
+			if existing[strings.TrimPrefix(e.Image, "localhost/")] || processAlive(e.PID) {
+				kept = append(kept, e)
+			}
+		}
+		return kept
+	})
+
+	var orphans []orphanImage
+	for _, img := range images {
+		if len(img.InUseBy) > 0 {
+			continue
+		}
+		kind, id, named := tempImageKind(img.Ref)
+		e, recorded := journaled[strings.TrimPrefix(img.Ref, "localhost/")]
+		if !named && !recorded {
+			continue
+		}
+		if recorded && processAlive(e.PID) {
+			continue
+		}
+		o := orphanImage{Ref: img.Ref, Kind: kind}
+		if recorded {
+			o.Kind, o.Owner, o.Taken = e.Kind, e.Container, &e.Started
+		} else if name, ok := ids[id]; ok {
+			o.Owner = name
+		}
+		if o.Kind == "convert" || o.Kind == "rename" {
+			o.OnlyCopy = o.Owner == "" || !names[o.Owner]
+		}
+		o.Size, _ = client.ImageSize(img.Ref)
+		orphans = append(orphans, o)
+	}
+	sort.SliceStable(orphans, func(i, j int) bool { return orphans[i].Ref < orphans[j].Ref })
+	return orphans, nil
+}
+
+// orphanTotals adds up the images that are safe to remove and counts those
+// that may be the only copy of a container.
+func orphanTotals(orphans []orphanImage) (removable int, size int64, onlyCopies int) {
+	for _, o := range orphans {
+		if o.OnlyCopy {
+			onlyCopies++
+			continue
+		}
+		removable++
+		size += o.Size
+	}
+	return removable, size, onlyCopies
+}
+
+func printOrphans(orphans []orphanImage) {
+	for _, o := range orphans {
+		owner := o.Owner
+		if owner == "" {
+			owner = "?"
+		}
+		note := ""
+		switch {
+		case o.OnlyCopy && o.Owner != "":
+			note = fmt.Sprintf("  %smay be the only copy of '%s'%s", colorRed, o.Owner, colorReset)
+		case o.OnlyCopy:
+			note = fmt.Sprintf("  %smay be the only copy of a removed container%s", colorRed, colorReset)
+		}
+		fmt.Printf("  %-70s %-8s %-20s %10s%s\n", o.Ref, o.Kind, owner, formatBytes(uint64(o.Size)), note)
+	}
+}
+
+// removeOrphanedImages removes the orphans, leaving those that may be the
+// only copy of a container unless includeOnlyCopies is set, and returns how
+// many were removed and the space their sizes add up to. Shared layers are
+// only freed once no image uses them, so the space is an upper bound.
+func removeOrphanedImages(orphans []orphanImage, includeOnlyCopies bool) (int, int64) {
+	removed, freed := 0, int64(0)
+	for _, o := range orphans {
+		if o.OnlyCopy && !includeOnlyCopies {
+			continue
+		}
+		if err := client.RemoveImage(o.Ref); err != nil {
+			logWarning(fmt.Sprintf("Could not remove '%s': %v", o.Ref, err))
+			continue
+		}
+		releaseTempImage(o.Ref)
+		removed++
+		freed += o.Size
+		logInfo(fmt.Sprintf("Removed '%s' (%s).", o.Ref, formatBytes(uint64(o.Size))))
+	}
+	return removed, freed
+}
+
+// offerOrphanCleanup runs at menu startup: if earlier runs left temporary
+// images behind, it says how much space they take and offers to remove
+// them.
+func offerOrphanCleanup() {
+	orphans, err := findOrphanedImages()
+	if err != nil || len(orphans) == 0 {
+		return
+	}
+	removable, size, onlyCopies := orphanTotals(orphans)
+	if onlyCopies > 0 {
+		logWarning(fmt.Sprintf("%d temporary image(s) of an interrupted conversion or rename may be the only copy of their container; see 'distrobox-tool gc'.", onlyCopies))
+	}
+	if removable > 0 {
+		fmt.Printf("%s> Interrupted runs left %d temporary image(s) taking up to %s. Remove them now? (y/N): %s", colorBold, removable, formatBytes(uint64(size)), colorReset)
+		if confirmAction() {
+			removed, freed := removeOrphanedImages(orphans, false)
+			logSuccess(fmt.Sprintf("✅ Removed %d image(s), reclaiming up to %s.", removed, formatBytes(uint64(freed))))
+		}
+	}
+	acknowledge("Press Enter to continue...")
+}
@@ -0,0 +1,148 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// groupNames returns the configured group names, sorted.
+func groupNames() []string {
+	names := make([]string, 0, len(cfg.Groups))
+	for name := range cfg.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// groupMembers resolves a group against the existing containers. Members
+// that do not exist (anymore) are returned separately.
+func groupMembers(group string, containers []Container) (members []Container, missing []string) {
+	for _, name := range cfg.Groups[group] {
+		if c, ok := findContainer(containers, name); ok {
+			members = append(members, c)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	return members, missing
+}
+
+// printGroupStatus shows the state, home type and distribution of every
+// member of a group.
+func printGroupStatus(members []Container, missing []string) {
+	for _, c := range members {
+		stateColor := colorYellow
+		if c.State == "running" {
+			stateColor = colorGreen
+		}
+		typeText := "Standard"
+		if isIsolated, _ := isContainerIsolated(c); isIsolated {
+			typeText = "Isolated"
+		}
+		fmt.Printf("  %-25s %s%-10s%s %-10s %s\n", c.Name, stateColor, c.State, colorReset, typeText, distroString(c.Distro, c.DistroVersion))
+	}
+	for _, name := range missing {
+		fmt.Printf("  %-25s %s%-10s%s\n", name, colorRed, "missing", colorReset)
+	}
+}
+
+// deleteContainer removes a container and records it in the history.
+func deleteContainer(c Container) error {
+	defer routeTo(c)()
+	start := time.Now()
+	err := removeBox(c)
+	recordOperationResult("delete", c.Name, "", start, err)
+	return err
+}
+
+// removeBox force-removes a distrobox, or a toolbx container with toolbox.
+func removeBox(c Container) error {
+	if c.Manager == backup.ManagerToolbox {
+		return client.RemoveToolbox(c.Name)
+	}
+	return client.RemoveContainer(c.Name)
+}
+
+// deleteContainers removes each container, reporting the outcome per container.
+func deleteContainers(containers []Container) []batchResult {
+	var results []batchResult
+	for _, c := range containers {
+		start := time.Now()
+		err := deleteContainer(c)
+		if err != nil {
+			logError(fmt.Sprintf("Failed to delete container '%s': %v", c.Name, err))
+		} else {
+			logSuccess(fmt.Sprintf("🗑️ Container '%s' has been deleted.", c.Name))
+		}
+		results = append(results, batchResult{Container: c.Name, Err: err, Duration: time.Since(start)})
+	}
+	return results
+}
+
+func handleGroups(containers []Container) {
+	clearScreen()
+	printTitle(colorBlue, "🗂️ Container Groups")
+	names := groupNames()
+	if len(names) == 0 {
+		logInfo("No groups are configured.")
+		path, _ := configPath()
+		fmt.Printf("%s%sHint:%s Define groups in %s, e.g. [groups] work = [\"dev-box\", \"api-box\"].\n", colorYellow, colorUnderline, colorReset, path)
+		return
+	}
+	rows := make([]string, len(names))
+	for i, name := range names {
+		rows[i] = fmt.Sprintf("%-15s %s", name, strings.Join(cfg.Groups[name], ", "))
+	}
+	chosen := chooseItems("the group", rows, names, false, func() {
+		for i, row := range rows {
+			fmt.Printf("  %s%d.%s %s\n", colorBold, i+1, colorReset, row)
+		}
+		fmt.Println()
+	})
+	if len(chosen) == 0 {
+		return
+	}
+	group := names[chosen[0]-1]
+	members, missing := groupMembers(group, containers)
+
+	clearScreen()
+	printTitle(colorBlue, fmt.Sprintf("🗂️ Group '%s'", group))
+	printGroupStatus(members, missing)
+	fmt.Printf("\n  %sb)%s Backup all   %sd)%s Delete all   %sEnter)%s Back\n\n", colorGreen, colorReset, colorRed, colorReset, colorWhite, colorReset)
+	fmt.Printf("%s> Select an action: %s", colorBold, colorReset)
+	switch strings.ToLower(readUserInput()) {
+	case "b":
+		if len(members) == 0 {
+			logWarning("The group has no existing containers.")
+			return
+		}
+		logInfo("Please choose a backup destination folder.")
+		destDir, err := selectDirectory("Select Backup Folder")
+		if err != nil || destDir == "" {
+			if err != nil {
+				logError(err.Error())
+			}
+			logError("No valid destination directory selected. Aborting.")
+			return
+		}
+		note := promptBackupNote()
+		printBatchSummary(runBatchBackup(members, destDir, cfg.Batch.OnFailure, note, cfg.Backup.Compression, cfg.Backup.CompressionLevel, configuredEncryption()))
+	case "d":
+		if len(members) == 0 {
+			logWarning("The group has no existing containers.")
+			return
+		}
+		logWarning(fmt.Sprintf("You are about to permanently delete %d containers of group '%s'.", len(members), group))
+		fmt.Printf("%sThis cannot be undone. Type the group name to confirm: %s", colorRed, colorReset)
+		if readUserInput() != group {
+			logInfo("Deletion cancelled by user.")
+			return
+		}
+		printBatchSummary(deleteContainers(members))
+	}
+}
@@ -0,0 +1,326 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// actionHelp describes a menu action for its help screen: what it does, the
+// commands it runs and what can go wrong.
+type actionHelp struct {
+	Summary  string
+	Commands []string
+	Risks    []string
+}
+
+// menuHelp is keyed by menuEntry.Key.
+var menuHelp = map[int]actionHelp{
+	1: {
+		Summary: "Saves a container as an image archive you can restore later, optionally with its isolated home as a separate archive or bundled into the same file.",
+		Commands: []string{
+			"<runtime> commit NAME distrobox-backup-<ID>:<uuid>",
+			"<runtime> save distrobox-backup-<ID>:<uuid> (piped through gzip/zstd/xz and age/gpg if chosen)",
+			"tar -czf NAME-home.tar.gz -C <isolated home> .",
+			"<runtime> rmi distrobox-backup-<ID>:<uuid>",
+			"sha256sum FILE > FILE.sha256 (and FILE.json with the manifest)",
+			"ssh HOST 'cat > DIR/FILE.part' < FILE, then sha256sum and mv (remote destinations only)",
+		},
+		Risks: []string{
+			"The container is read while it runs; stop it first for a consistent snapshot.",
+			"Remote backups need room in ~/.cache for the archive until it is uploaded.",
+			"Standard containers share your host home, which is NOT part of the backup.",
+			"An encrypted backup can only be restored with the matching age identity or gpg secret key.",
+		},
+	},
+	2: {
+		Summary: "Creates a new container from a backup archive, including its isolated home when the backup has one.",
+		Commands: []string{
+			"<runtime> load -i FILE",
+			"distrobox-create --name NAME --image distrobox-restore-NAME:<uuid> [--home PATH]",
+			"tar -xzf NAME-home.tar.gz -C <isolated home>",
+		},
+		Risks: []string{
+			"Files already in the target home directory may be overwritten.",
+			"The loaded image stays in container storage as the new container's base.",
+		},
+	},
+	3: {
+		Summary: "Makes a copy of a container under a new name, keeping its home type.",
+		Commands: []string{
+			"<runtime> commit NAME distrobox-clone-<ID>:<uuid>",
+			"cp -a --reflink=auto <isolated home>/. <clone's home> (if you choose to copy the home)",
+			"distrobox-create --name NEW --image distrobox-clone-<ID>:<uuid> [--home PATH]",
+		},
+		Risks: []string{
+			"Needs free space in container storage for the committed image.",
+			"A copied isolated home needs as much space again, unless the filesystem supports reflinks (btrfs, XFS).",
+			"Without copying, the clone of an isolated container starts with an empty home.",
+		},
+	},
+	4: {
+		Summary: "Converts a container between Standard (shares your host home) and Isolated (has its own home directory), or renames it, by recreating it.",
+		Commands: []string{
+			"<runtime> stop NAME",
+			"<runtime> commit NAME distrobox-convert-<ID>:<uuid> (distrobox-rename-<ID>:<uuid> when renaming)",
+			"distrobox-rm -f NAME",
+			"mv <isolated home>/NAME <isolated home>/NEW (when renaming)",
+			"distrobox-create --name NAME|NEW --image distrobox-convert-<ID>:<uuid> [--home PATH]",
+			"distrobox-enter NEW -- distrobox-export ... (when renaming, for each exported app)",
+		},
+		Risks: []string{
+			"The original container is REMOVED and recreated; if creation fails the temporary image is kept for recovery.",
+			"Converting Isolated to Standard PERMANENTLY DELETES the isolated home directory.",
+			"Volumes and options not carried by the image may have to be set up again.",
+		},
+	},
+	5: {
+		Summary: "Removes a container for good.",
+		Commands: []string{
+			"distrobox-rm -f NAME",
+		},
+		Risks: []string{
+			"Irreversible: everything installed in the container is lost unless you have a backup.",
+			"An isolated home directory is left on disk and must be removed by hand.",
+		},
+	},
+	6: {
+		Summary: "Checks that a container can be entered and can run a command.",
+		Commands: []string{
+			"distrobox-enter NAME -- whoami",
+		},
+		Risks: []string{
+			"Starts the container if it is stopped.",
+		},
+	},
+	7: {
+		Summary: "Lists images in container storage, showing which are used by containers and which were left behind by this tool.",
+		Commands: []string{
+			"<runtime> images",
+			"<runtime> rmi IMAGE",
+		},
+		Risks: []string{
+			"Removing an image a backup or snapshot depends on makes it unrecoverable.",
+		},
+	},
+	8: {
+		Summary: "Upgrades the packages in a container after taking a snapshot you can roll back to.",
+		Commands: []string{
+			"<runtime> commit NAME distrobox-snapshot/NAME:pre-upgrade-<time>",
+			"distrobox-upgrade NAME",
+		},
+		Risks: []string{
+			"Rolling back recreates the container from the snapshot, dropping changes made since.",
+			"Snapshots use container storage until you remove them.",
+		},
+	},
+	9: {
+		Summary: "Backs up several containers in one go into the same directory.",
+		Commands: []string{
+			"The Backup commands, once per selected container",
+		},
+		Risks: []string{
+			"Needs room for every archive in the destination.",
+		},
+	},
+	10: {
+		Summary: "Writes a container's flattened filesystem to a plain tar file, a SquashFS image or an ext4 disk image for use outside distrobox.",
+		Commands: []string{
+			"<runtime> export -o FILE NAME",
+			"sqfstar FILE.squashfs < rootfs.tar (or tar2sqfs)",
+			"virt-make-fs --type=ext4 --format=raw|qcow2 --size=+1G rootfs.tar FILE",
+		},
+		Risks: []string{
+			"An export cannot be restored with Restore; it has no image layers or metadata.",
+		},
+	},
+	11: {
+		Summary: "Shows and edits the manifest embedded in a backup archive, such as its note.",
+		Commands: []string{
+			"Rewrites the archive in place with the updated manifest",
+		},
+		Risks: []string{
+			"The archive is rewritten; an interrupted write can damage it.",
+		},
+	},
+	12: {
+		Summary: "Shows the containers of each group from the config file and backs up or deletes a whole group.",
+		Commands: []string{
+			"The Backup or Delete commands, once per member",
+		},
+		Risks: []string{
+			"Deleting a group removes all of its containers.",
+		},
+	},
+	13: {
+		Summary: "Backs up every container into the same directory.",
+		Commands: []string{
+			"The Backup commands, once per container",
+		},
+		Risks: []string{
+			"Needs room for every archive in the destination.",
+		},
+	},
+	14: {
+		Summary: "Checks that a backup is intact: its sha256 against the recorded checksum, and that every member can be read.",
+		Commands: []string{
+			"sha256sum FILE (compared with FILE.sha256 or the manifest)",
+			"tar -t equivalent over the decrypted, decompressed archive",
+		},
+		Risks: []string{
+			"Read-only; encrypted backups need their key to be read.",
+		},
+	},
+	15: {
+		Summary: "Applies the retention policy to the backups of each container in the backup folder and every configured destination, showing what would be deleted first.",
+		Commands: []string{
+			"rm ARCHIVE ARCHIVE.json ARCHIVE.sha256 (and home archives), locally or over ssh",
+		},
+		Risks: []string{
+			"Deleted backups cannot be recovered; check the plan before confirming.",
+			"Backups without a manifest are never touched.",
+		},
+	},
+	16: {
+		Summary: "Shows the effective settings and changes one of them in the config file.",
+		Commands: []string{
+			"Rewrites ~/.config/distrobox-backup-tool/config.toml, keeping the rest of the file",
+		},
+		Risks: []string{
+			"A value that makes the config invalid is not saved.",
+			"YAML config files are only changed through 'distrobox-tool config edit'.",
+		},
+	},
+	17: {
+		Summary: "Packs every container, its isolated home and your distrobox config files into one distrobox-machine-HOST-DATE.tar to set up a new machine with.",
+		Commands: []string{
+			"The Backup commands for each container, writing into a hidden folder next to the bundle",
+			"Each archive is appended to the bundle and deleted before the next container is backed up",
+			"~/.config/distrobox/distrobox.conf and ~/.distroboxrc are added if they exist",
+		},
+		Risks: []string{
+			"The destination needs room for the whole bundle plus the largest single backup.",
+			"A container whose backup fails is left out; the summary and the bundle index list it.",
+			"Standard containers share your host home, which is NOT part of the bundle.",
+		},
+	},
+	18: {
+		Summary: "Recreates every container of a machine bundle, in their restore_after order, and installs the bundled distrobox config.",
+		Commands: []string{
+			"Extracts the bundle into ~/.cache/distrobox-backup-tool/bundles",
+			"The Restore commands for each archive",
+		},
+		Risks: []string{
+			"Needs room in ~/.cache for the extracted bundle while the import runs.",
+			"An existing distrobox config file is kept; the bundled one is written next to it as FILE.bundled.",
+			"Containers that already exist fail unless you choose to replace them.",
+		},
+	},
+	19: {
+		Summary: "Backs up only the system paths of a container ([backup] system_paths: /etc, /opt, /usr/local by default) to NAME-DATE-system.tar.gz, and lays such a backup over a fresh container of the same base image or over an existing one.",
+		Commands: []string{
+			"podman exec --user root <container> tar -cpf - -C / etc opt usr/local (compressed with gzip)",
+			"distrobox create --name <new> --image <base image> (restore into a new container)",
+			"podman exec -i --user root <container> tar -xpf - -C /",
+			"Optionally: a repository refresh (apt-get update, dnf makecache, ...) and a lookup of each recorded package",
+		},
+		Risks: []string{
+			"Packages are NOT part of the backup; files in /etc may refer to software the new container lacks.",
+			"Restoring overwrites the files of the backup in the container; other files are left alone.",
+			"A stopped container is started for the backup or restore and stopped again afterwards.",
+		},
+	},
+	20: {
+		Summary: "Commits a container to a local image in seconds and rolls it back to one of its snapshots with a single key. [snapshot] keep bounds how many are kept.",
+		Commands: []string{
+			"<runtime> commit NAME distrobox-snapshot/NAME:manual-<time>",
+			"<runtime> commit NAME distrobox-snapshot/NAME:pre-rollback-<time> (before a rollback)",
+			"distrobox rm, then distrobox create --image <snapshot> (rollback)",
+		},
+		Risks: []string{
+			"Snapshots live in container storage on this machine; they are not backups.",
+			"Rolling back drops changes made since the snapshot; the pre-rollback snapshot keeps them until the next rollback.",
+			"The isolated home is not part of a snapshot and is left as it is.",
+		},
+	},
+	21: {
+		Summary: "Shows the newest backups, restores, deletes, conversions, renames and rollbacks with their time, duration and result, read from the operation log.",
+		Commands: []string{
+			"Reads ~/.local/state/distrobox-backup-tool/log (and log.1)",
+		},
+		Risks: []string{
+			"The log also records every message and runtime command; set [log] file = false to stop writing it.",
+		},
+	},
+	22: {
+		Summary: "Queues backups and archive verifications to run in the background while the menu stays usable, and shows the progress of each job. Up to [queue] parallel jobs run at once.",
+		Commands: []string{
+			"distrobox-tool --progress=json backup --container <name> --dest <folder>",
+			"distrobox-tool --progress=json verify --file <archive>",
+		},
+		Risks: []string{
+			"Parallel backups compete for disk and network bandwidth and may be slower than one after the other.",
+			"Exiting the menu stops the unfinished jobs; each cleans up its partial archive as after Ctrl+C.",
+			"An encrypted state needs [security] unlock = \"keyring\", as background jobs cannot ask for the passphrase.",
+		},
+	},
+}
+
+// parseHelpChoice recognizes "h"/"?" (the help index) and "h N"/"?N" (help
+// for action N) at the menu prompt. key is 0 for the index.
+func parseHelpChoice(input string) (key int, ok bool) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	rest, found := strings.CutPrefix(input, "h")
+	if !found {
+		if rest, found = strings.CutPrefix(input, "?"); !found {
+			return 0, false
+		}
+	}
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, "elp"))
+	if rest == "" {
+		return 0, true
+	}
+	key, err := strconv.Atoi(rest)
+	if err != nil {
+		return 0, false
+	}
+	return key, true
+}
+
+// handleHelp shows the help screen for one action, or the index of all of
+// them when key is 0.
+func handleHelp(key int) {
+	clearScreen()
+	if key == 0 {
+		printTitle(colorCyan, "❓ Help")
+		for _, e := range menuEntries {
+			fmt.Printf("  %s%2d)%s %-13s %s\n", e.Color, e.Key, colorReset, e.Label, menuHelp[e.Key].Summary)
+		}
+		if !tuiEnabled() {
+			fmt.Printf("\n%s%sHint:%s Enter 'h' followed by a number (e.g. 'h 4') at the menu for the commands and risks of that action.\n", colorYellow, colorUnderline, colorReset)
+		}
+		return
+	}
+
+	entry, ok := findMenuEntry(key)
+	if !ok {
+		logWarning(fmt.Sprintf("There is no menu option %d.", key))
+		return
+	}
+	help := menuHelp[key]
+	printTitle(entry.Color, "❓ Help: "+entry.Label)
+	fmt.Printf("%s\n\n", help.Summary)
+	if len(help.Commands) > 0 {
+		fmt.Printf("%sCommands run:%s\n", colorBold, colorReset)
+		for _, c := range help.Commands {
+			fmt.Printf("  $ %s\n", c)
+		}
+		fmt.Println()
+	}
+	if len(help.Risks) > 0 {
+		fmt.Printf("%s%sRisks:%s\n", colorBold, colorRed, colorReset)
+		for _, r := range help.Risks {
+			fmt.Printf("  - %s\n", r)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package app
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The operation log is a JSON Lines file in the state directory recording
+// every log message and every command the tool runs through runCommand or
+// the backup client. One entry per backup, restore, delete and other
+// container operation goes to the history file next to it in the same
+// format, so the chatty log does not rotate them away. History reads the
+// operation entries back.
+
+const (
+	operationLogName = "log"
+	historyLogName   = "history"
+	// operationLogMax is the size at which either file is moved to
+	// NAME.1, replacing the previous one.
+	operationLogMax = 4 << 20
+	// logArgMax shortens long arguments such as inline scripts.
+	logArgMax = 200
+)
+
+// Kinds of operation log entries.
+const (
+	recordMessage   = "message"
+	recordCommand   = "command"
+	recordOperation = "operation"
+)
+
+// logRecord is one line of the operation log.
+type logRecord struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	PID     int       `json:"pid"`
+	Session string    `json:"session,omitempty"` // the subcommand; empty in the menu
+	Level   string    `json:"level,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Command string    `json:"command,omitempty"`
+	// Operation, Container and Detail describe an operation entry, e.g.
+	// "backup", "dev" and the archive written.
+	Operation  string `json:"operation,omitempty"`
+	Container  string `json:"container,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+	DurationMS int64  `json:"duration_ms,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// Size and DataSize are the archive of a backup and the data in it
+	// before compression.
+	Size     int64 `json:"size,omitempty"`
+	DataSize int64 `json:"data_size,omitempty"`
+}
+
+var (
+	operationLogMu     sync.Mutex
+	operationLogFailed bool
+	// operationLogReady is set once the config is loaded and the state
+	// unlocked, so nothing is written before [log] file and encrypt_state
+	// are known.
+	operationLogReady bool
+)
+
+func operationLogPath() (string, error) {
+	return logFilePath(operationLogName)
+}
+
+func historyLogPath() (string, error) {
+	return logFilePath(historyLogName)
+}
+
+func logFilePath(name string) (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// appendLogRecord writes r to the operation log, or an operation entry to
+// the history file. With state encryption each
+// line is sealed on its own and base64-encoded. A log that cannot be written
+// is reported once and then left alone.
+func appendLogRecord(r logRecord) {
+	if !operationLogReady || !cfg.Log.File || (cfg.Security.EncryptState && stateKey == nil) {
+		return
+	}
+	operationLogMu.Lock()
+	defer operationLogMu.Unlock()
+	if operationLogFailed {
+		return
+	}
+	r.Time, r.PID, r.Session = time.Now(), os.Getpid(), logCommand
+	err := func() error {
+		path, err := operationLogPath()
+		if r.Kind == recordOperation {
+			path, err = historyLogPath()
+		}
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(path); err == nil && info.Size() > operationLogMax {
+			os.Rename(path, path+".1")
+		}
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if stateKey != nil {
+			sealed, err := seal(stateKey, line)
+			if err != nil {
+				return err
+			}
+			line = []byte(base64.StdEncoding.EncodeToString(sealed))
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}()
+	if err != nil {
+		operationLogFailed = true
+		fmt.Fprintf(os.Stderr, "%s: cannot write the operation log: %v\n", appName, err)
+	}
+}
+
+func logMessageRecord(level, msg string) {
+	appendLogRecord(logRecord{Kind: recordMessage, Level: level, Message: msg})
+}
+
+// logCommandRecord records a host command with how long it took and how it
+// ended. It is the backup client's Trace hook.
+func logCommandRecord(name string, args []string, elapsed time.Duration, err error) {
+	parts := []string{name}
+	for _, a := range args {
+		if len(a) > logArgMax {
+			a = a[:logArgMax] + "..."
+		}
+		parts = append(parts, a)
+	}
+	r := logRecord{Kind: recordCommand, Command: strings.Join(parts, " "), DurationMS: elapsed.Milliseconds()}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	appendLogRecord(r)
+}
+
+// recordOperationResult records the outcome of an operation on a container
+// that started at start.
+func recordOperationResult(operation, container, detail string, start time.Time, err error) {
+	appendLogRecord(operationRecord(operation, container, detail, start, err))
+}
+
+// recordBackupResult records a backup with the sizes of its archive and of
+// the data in it.
+func recordBackupResult(container, detail string, start time.Time, size, data int64, err error) {
+	r := operationRecord("backup", container, detail, start, err)
+	r.Size, r.DataSize = size, data
+	appendLogRecord(r)
+}
+
+func operationRecord(operation, container, detail string, start time.Time, err error) logRecord {
+	r := logRecord{Kind: recordOperation, Operation: operation, Container: container, Detail: detail, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// readOperationHistory returns the operation entries of the history file
+// and of the previous one, oldest first, after those that older versions
+// wrote to the operation log. Lines that cannot be read, such as encrypted
+// lines while the state is locked, are skipped and counted.
+func readOperationHistory() ([]logRecord, int, error) {
+	logPath, err := operationLogPath()
+	if err != nil {
+		return nil, 0, err
+	}
+	path, err := historyLogPath()
+	if err != nil {
+		return nil, 0, err
+	}
+	var records []logRecord
+	skipped := 0
+	for _, p := range []string{logPath + ".1", logPath, path + ".1", path} {
+		f, err := os.Open(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1<<20)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) > 0 && line[0] != '{' {
+				sealed, err := base64.StdEncoding.DecodeString(string(line))
+				if err == nil && stateKey != nil {
+					line, err = openSealed(stateKey, sealed)
+				}
+				if err != nil || stateKey == nil {
+					skipped++
+					continue
+				}
+			}
+			var r logRecord
+			if json.Unmarshal(line, &r) != nil {
+				skipped++
+				continue
+			}
+			if r.Kind == recordOperation {
+				records = append(records, r)
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, 0, err
+		}
+	}
+	return records, skipped, nil
+}
+
+// filterHistory keeps the newest limit entries of a container (all
+// containers for ""), newest first; limit 0 keeps all.
+func filterHistory(records []logRecord, container string, limit int) []logRecord {
+	var out []logRecord
+	for i := len(records) - 1; i >= 0; i-- {
+		if container != "" && records[i].Container != container {
+			continue
+		}
+		out = append(out, records[i])
+		if limit > 0 && len(out) == limit {
+			break
+		}
+	}
+	return out
+}
+
+// printHistory prints operation entries as a table.
+func printHistory(records []logRecord) {
+	for _, r := range records {
+		result := colorGreen + "ok    " + colorReset
+		if r.Error != "" {
+			result = colorRed + "failed" + colorReset
+		}
+		duration := (time.Duration(r.DurationMS) * time.Millisecond).Round(time.Second)
+		detail := r.Detail
+		if ratio := compressionRatio(r.Size, r.DataSize); ratio != "" {
+			detail = fmt.Sprintf("%s (%s, ratio %s)", detail, formatBytes(uint64(r.Size)), ratio)
+		}
+		fmt.Printf("%s  %s  %-9s %-20s %7s  %s\n", r.Time.Local().Format("2006-01-02 15:04:05"), result, r.Operation, r.Container, duration, detail)
+		if r.Error != "" {
+			fmt.Printf("  %s%s%s\n", colorRed, r.Error, colorReset)
+		}
+	}
+}
+
+func handleHistory() {
+	clearScreen()
+	printTitle(colorBlue, "📜 History")
+	records, skipped, err := readOperationHistory()
+	if err != nil {
+		logError(fmt.Sprintf("Could not read the operation log: %v", err))
+		return
+	}
+	if skipped > 0 {
+		logWarning(fmt.Sprintf("%d log lines could not be read (encrypted with another key, or damaged).", skipped))
+	}
+	recent := filterHistory(records, "", 50)
+	if len(recent) == 0 {
+		logInfo("No operations recorded yet.")
+		return
+	}
+	printHistory(recent)
+	path, _ := operationLogPath()
+	fmt.Printf("\n%s%sHint:%s The newest %d operations are shown. Every message and command is in %s.\n", colorYellow, colorUnderline, colorReset, len(recent), path)
+}
@@ -0,0 +1,166 @@
+package app
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// homeChecksumPath returns the checksum database of a backup's home archive.
+// It uses the `sha256sum` format, so `sha256sum -c` can check an extracted
+// home by hand.
+func homeChecksumPath(backupFile string) string {
+	return homeArchivePath(backupFile) + ".sha256sums"
+}
+
+// hashHomeArchive computes the SHA-256 of every regular file in a home
+// archive, keyed by its path inside the archive.
+func hashHomeArchive(archive string) (map[string]string, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, _, err := client.Decompress(f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	sums := map[string]string{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", archive, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, tr); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", hdr.Name, err)
+		}
+		sums[cleanMemberName(hdr.Name)] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums, nil
+}
+
+func cleanMemberName(name string) string {
+	return "./" + strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// writeHomeChecksums stores sums in sha256sum format, sorted by path.
+func writeHomeChecksums(file string, sums map[string]string) error {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s  %s\n", sums[name], name)
+	}
+	return writeBackupFile(file, []byte(b.String()))
+}
+
+// readHomeChecksums loads a checksum database written by writeHomeChecksums.
+func readHomeChecksums(file string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sums := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		sum, name, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok || len(sum) != sha256.Size*2 {
+			return nil, fmt.Errorf("%s:%d: malformed checksum line", file, line)
+		}
+		sums[name] = sum
+	}
+	return sums, scanner.Err()
+}
+
+// homeVerifyResult lists the differences between a home archive and its
+// checksum database.
+type homeVerifyResult struct {
+	Checked  int
+	Corrupt  []string // content differs from the recorded hash
+	Missing  []string // recorded but no longer in the archive
+	Unlisted []string // in the archive but not recorded
+}
+
+func (r homeVerifyResult) ok() bool {
+	return len(r.Corrupt) == 0 && len(r.Missing) == 0 && len(r.Unlisted) == 0
+}
+
+// verifyHomeArchive re-hashes a home archive against its checksum database.
+func verifyHomeArchive(archive, sumsFile string) (homeVerifyResult, error) {
+	var result homeVerifyResult
+	want, err := readHomeChecksums(sumsFile)
+	if err != nil {
+		return result, err
+	}
+	got, err := hashHomeArchive(archive)
+	if err != nil {
+		return result, err
+	}
+	for name, sum := range want {
+		actual, ok := got[name]
+		switch {
+		case !ok:
+			result.Missing = append(result.Missing, name)
+		case actual != sum:
+			result.Corrupt = append(result.Corrupt, name)
+		default:
+			result.Checked++
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			result.Unlisted = append(result.Unlisted, name)
+		}
+	}
+	sort.Strings(result.Corrupt)
+	sort.Strings(result.Missing)
+	sort.Strings(result.Unlisted)
+	return result, nil
+}
+
+// printHomeVerifyResult reports a verification, listing at most a few files
+// per category.
+func printHomeVerifyResult(r homeVerifyResult) {
+	if r.ok() {
+		logSuccess(fmt.Sprintf("✅ All %d files of the home archive match their checksums.", r.Checked))
+		return
+	}
+	report := func(label string, names []string) {
+		if len(names) == 0 {
+			return
+		}
+		logError(fmt.Sprintf("%d %s:", len(names), label))
+		for i, name := range names {
+			if i == 10 {
+				fmt.Printf("    ... and %d more\n", len(names)-i)
+				break
+			}
+			fmt.Printf("    %s\n", name)
+		}
+	}
+	report("files are corrupt", r.Corrupt)
+	report("files are missing from the archive", r.Missing)
+	report("files are not in the checksum database", r.Unlisted)
+}
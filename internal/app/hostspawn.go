@@ -0,0 +1,117 @@
+package app
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// On immutable hosts the tool may run inside a Flatpak, or inside a
+// toolbox or distrobox container, where neither distrobox nor the runtime
+// is installed. It then runs every command on the host: through
+// `flatpak-spawn --host`, which works from Flatpaks and from toolbox
+// containers, or else through host-spawn or distrobox-host-exec. Files are
+// still read and written by the tool itself, so the folders it uses must
+// have the same path on both sides, as the home does when the Flatpak may
+// access it.
+
+// hostSpawn is the command prefix that runs a program on the host, or nil
+// when programs run where the tool does.
+var hostSpawn []string
+
+// hostCommands caches which commands exist on the host.
+var (
+	hostCommands   = map[string]bool{}
+	hostCommandsMu sync.Mutex
+)
+
+// detectHostSpawn finds out whether commands have to be run on the host
+// and, if so, routes commandRunner there.
+func detectHostSpawn() {
+	if _, err := exec.LookPath("distrobox"); err == nil {
+		return
+	}
+	inFlatpak := fileExists("/.flatpak-info")
+	inContainer := fileExists("/run/.containerenv") || fileExists("/run/.toolboxenv")
+	if !inFlatpak && !inContainer {
+		return
+	}
+	for _, prefix := range [][]string{{"flatpak-spawn", "--host"}, {"host-spawn"}, {"distrobox-host-exec"}} {
+		if _, err := exec.LookPath(prefix[0]); err != nil || (prefix[0] != "flatpak-spawn" && !inContainer) {
+			continue
+		}
+		base := commandRunner
+		hostSpawn, commandRunner = prefix, hostRunner(base, prefix)
+		if !commandExists("distrobox") {
+			// Not there either; report distrobox as missing as usual.
+			hostSpawn, commandRunner = nil, base
+			return
+		}
+		return
+	}
+}
+
+// hostRunner wraps run so that every command runs on the host through
+// prefix, in the same working directory. flatpak-spawn starts commands in
+// the environment of the session, not in the tool's, so the distrobox and
+// container settings the tool was started with are passed with --env.
+func hostRunner(run backup.Runner, prefix []string) backup.Runner {
+	return func(name string, args ...string) *exec.Cmd {
+		spawn := prefix[1:len(prefix):len(prefix)]
+		if prefix[0] == "flatpak-spawn" {
+			spawn = append(spawn, spawnEnvArgs(forwardedEnv())...)
+		}
+		return run(prefix[0], append(append(spawn, name), args...)...)
+	}
+}
+
+// forwardedEnv returns the variables of the tool's environment that
+// distrobox and the runtimes read: DBX_* and CONTAINER_*.
+func forwardedEnv() []string {
+	var env []string
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, "DBX_") || strings.HasPrefix(e, "CONTAINER_") {
+			env = append(env, e)
+		}
+	}
+	return env
+}
+
+// spawnEnvArgs turns variables into flatpak-spawn options.
+func spawnEnvArgs(env []string) []string {
+	args := make([]string, len(env))
+	for i, e := range env {
+		args[i] = "--env=" + e
+	}
+	return args
+}
+
+// setCommandEnv adds variables to the environment cmd runs in. A command
+// run on the host by flatpak-spawn gets them as --env options, as it would
+// not see the environment of the flatpak-spawn process.
+func setCommandEnv(cmd *exec.Cmd, env ...string) {
+	if len(cmd.Args) >= 2 && cmd.Args[0] == "flatpak-spawn" && cmd.Args[1] == "--host" {
+		cmd.Args = append(cmd.Args[:2], append(spawnEnvArgs(env), cmd.Args[2:]...)...)
+		return
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, env...)
+}
+
+// hostCommandExists reports whether cmd is installed on the host.
+func hostCommandExists(cmd string) bool {
+	hostCommandsMu.Lock()
+	defer hostCommandsMu.Unlock()
+	exists, ok := hostCommands[cmd]
+	if !ok {
+		_, err := commandRunner("sh", "-c", `command -v "$1"`, "sh", cmd).Output()
+		exists = err == nil
+		hostCommands[cmd] = exists
+	}
+	return exists
+}
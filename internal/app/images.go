@@ -0,0 +1,270 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// toolImagePrefixes are the repository name prefixes of images this tool
+// creates. Runtimes may prepend "localhost/" when the image is local.
+var toolImagePrefixes = []string{
+	"distrobox-backup-",
+	"distrobox-clone-",
+	"distrobox-convert-",
+	"distrobox-rename-",
+	"distrobox-restore-",
+	"distrobox-migrate/",
+	snapshotRepository + "/",
+	importRepository + "/",
+	restoredRepository + "/",
+}
+
+// runtimeImage is an image in one runtime's storage that is related to distrobox.
+type runtimeImage struct {
+	Runtime     string
+	ID          string
+	Ref         string // repository:tag, or "<none>" for dangling images
+	Size        string
+	InUseBy     []string
+	ToolCreated bool
+}
+
+func isToolImage(ref string) bool {
+	ref = strings.TrimPrefix(ref, "localhost/")
+	for _, prefix := range toolImagePrefixes {
+		if strings.HasPrefix(ref, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// imageRepository strips the tag (but not a registry port) from an image reference.
+func imageRepository(ref string) string {
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i]
+	}
+	return ref
+}
+
+// listDistroboxImages returns the images of a runtime that were created by this
+// tool, are used by a container, or are older versions of a repository a
+// distrobox is based on (typically left behind after upgrading a base image).
+// An image is only reported unused once every container has been inspected,
+// so a failed ps or inspect is an error.
+func listDistroboxImages(runtimeName string) ([]runtimeImage, error) {
+	out, err := runCommand(runtimeName, "images", "--no-trunc", "--format", "{{.ID}}|{{.Repository}}|{{.Tag}}|{{.Size}}")
+	if err != nil {
+		return nil, err
+	}
+
+	baseRepos := map[string]bool{}
+	dbxOut, err := runCommand(runtimeName, "ps", "-a", "--filter", "label=manager=distrobox", "--format", "{{.Image}}")
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range strings.Fields(dbxOut) {
+		baseRepos[imageRepository(strings.TrimPrefix(ref, "localhost/"))] = true
+	}
+
+	// Any container pins its image, distrobox or not.
+	usedBy := map[string][]string{}
+	idsOut, err := runCommand(runtimeName, "ps", "-a", "-q", "--no-trunc")
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(idsOut) != "" {
+		args := append([]string{"inspect", "--format", "{{.Name}}|{{.Image}}"}, strings.Fields(idsOut)...)
+		inspectOut, err := runCommand(runtimeName, args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(strings.TrimSpace(inspectOut), "\n") {
+			parts := strings.SplitN(line, "|", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			id := strings.TrimPrefix(parts[1], "sha256:")
+			usedBy[id] = append(usedBy[id], strings.TrimPrefix(parts[0], "/"))
+		}
+	}
+
+	var images []runtimeImage
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		parts := strings.Split(line, "|")
+		if len(parts) != 4 {
+			continue
+		}
+		img := runtimeImage{
+			Runtime: runtimeName,
+			ID:      strings.TrimPrefix(parts[0], "sha256:"),
+			Ref:     parts[1] + ":" + parts[2],
+			Size:    parts[3],
+		}
+		if parts[1] == "<none>" {
+			img.Ref = "<none>"
+		}
+		img.InUseBy = usedBy[img.ID]
+		img.ToolCreated = isToolImage(img.Ref)
+		if !img.ToolCreated && len(img.InUseBy) == 0 && !baseRepos[imageRepository(strings.TrimPrefix(img.Ref, "localhost/"))] {
+			continue
+		}
+		images = append(images, img)
+	}
+	sort.SliceStable(images, func(i, j int) bool { return images[i].Ref < images[j].Ref })
+	return images, nil
+}
+
+func handleImages() {
+	clearScreen()
+	printTitle(colorYellow, "🖼️  Image Management")
+
+	runtimes := []string{containerRuntime}
+	for _, rt := range []string{"podman", "podman-launcher", "docker"} {
+		if rt != containerRuntime && commandExists(rt) {
+			runtimes = append(runtimes, rt)
+		}
+	}
+
+	var images []runtimeImage
+	for _, rt := range runtimes {
+		rtImages, err := listDistroboxImages(rt)
+		if err != nil && rt == containerRuntime {
+			// Without the containers, images in use look unused.
+			logError(fmt.Sprintf("Could not list %s images and the containers using them: %v", rt, err))
+			return
+		}
+		if err != nil {
+			logWarning(fmt.Sprintf("Could not list %s images, so none of them are offered: %v", rt, err))
+			continue
+		}
+		images = append(images, rtImages...)
+	}
+	if len(images) == 0 {
+		logInfo("No distrobox-related images found.")
+		return
+	}
+
+	fmt.Printf("%s%sHint:%s Images in use by a container cannot be removed here.\n\n", colorYellow, colorUnderline, colorReset)
+
+	rows := make([]string, len(images))
+	refs := make([]string, len(images))
+	for i, img := range images {
+		status := "unused"
+		if len(img.InUseBy) > 0 {
+			status = "in use by " + strings.Join(img.InUseBy, ", ")
+		}
+		rows[i] = fmt.Sprintf("%-55s %-10s %-5s %-7s %s", img.Ref, img.Size, imageOrigin(img), img.Runtime, status)
+		refs[i] = img.Ref
+	}
+	selected := chooseItems("the images to remove", rows, refs, true, func() {
+		currentRuntime := ""
+		for i, img := range images {
+			if img.Runtime != currentRuntime {
+				currentRuntime = img.Runtime
+				fmt.Printf("%s--- %s ---%s\n", colorBold, currentRuntime, colorReset)
+			}
+			status := fmt.Sprintf("%sunused%s", colorYellow, colorReset)
+			if len(img.InUseBy) > 0 {
+				status = fmt.Sprintf("%sin use by %s%s", colorGreen, strings.Join(img.InUseBy, ", "), colorReset)
+			}
+			fmt.Printf("  %s%2d.%s %-55s %-10s %-5s %s\n", colorBold, i+1, colorReset, img.Ref, img.Size, imageOrigin(img), status)
+		}
+		fmt.Println()
+	})
+	if len(selected) == 0 {
+		return
+	}
+
+	var toRemove []runtimeImage
+	for _, idx := range selected {
+		img := images[idx-1]
+		if len(img.InUseBy) > 0 {
+			logWarning(fmt.Sprintf("Skipping '%s': in use by %s.", img.Ref, strings.Join(img.InUseBy, ", ")))
+			continue
+		}
+		toRemove = append(toRemove, img)
+	}
+	if len(toRemove) == 0 {
+		logInfo("Nothing to remove.")
+		return
+	}
+
+	fmt.Printf("%s> Remove %d image(s)? (y/N): %s", colorRed, len(toRemove), colorReset)
+	if !confirmAction() {
+		logInfo("Image removal cancelled.")
+		return
+	}
+
+	for _, img := range toRemove {
+		target := img.Ref
+		if target == "<none>" {
+			target = img.ID
+		}
+		if _, err := runCommand(img.Runtime, "rmi", target); err != nil {
+			logError(fmt.Sprintf("Failed to remove '%s'.", target))
+			logError(err.Error())
+			continue
+		}
+		logSuccess(fmt.Sprintf("🗑️ Removed %s image '%s' (%s).", img.Runtime, target, img.Size))
+	}
+}
+
+// imageOrigin tells images the tool created from base images.
+func imageOrigin(img runtimeImage) string {
+	if img.ToolCreated {
+		return "tool"
+	}
+	return "base"
+}
+
+// selectItems reads a list of 1-based indices such as "1,3-5 7". An empty
+// answer returns nil.
+func selectItems(prompt string, max int) []int {
+	for {
+		fmt.Printf("%s> %s (1-%d): %s", colorBold, prompt, max, colorReset)
+		input := readUserInput()
+		if input == "" {
+			return nil
+		}
+		indices, err := parseSelection(input, max)
+		if err == nil {
+			return indices
+		}
+		logWarning(err.Error())
+	}
+}
+
+func parseSelection(input string, max int) ([]int, error) {
+	seen := map[int]bool{}
+	var indices []int
+	for _, field := range strings.FieldsFunc(input, func(r rune) bool { return r == ',' || r == ' ' }) {
+		lo, hi := field, field
+		if from, to, ok := strings.Cut(field, "-"); ok {
+			lo, hi = from, to
+		}
+		start, err1 := strconv.Atoi(lo)
+		end, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || start < 1 || end > max || start > end {
+			return nil, fmt.Errorf("invalid selection '%s'. Use numbers between 1 and %d", field, max)
+		}
+		for i := start; i <= end; i++ {
+			if !seen[i] {
+				seen[i] = true
+				indices = append(indices, i)
+			}
+		}
+	}
+	return indices, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
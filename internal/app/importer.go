@@ -0,0 +1,157 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// importRepository is where root filesystem tarballs are imported to.
+const importRepository = "distrobox-import"
+
+// loadArchive brings any supported archive into the runtime's storage:
+// image archives (ours, or foreign docker/oci archives) are loaded, plain
+// root filesystem tarballs are imported. It returns the image reference.
+func loadArchive(file string, progress backup.ProgressFunc) (string, error) {
+	format, err := backup.DetectArchiveFormat(file)
+	if err != nil {
+		logWarning(fmt.Sprintf("Could not inspect archive (%v); trying to load it as an image.", err))
+	}
+	switch format {
+	case backup.FormatRootfs:
+		logInfo("Archive is a plain root filesystem; importing it as a new image.")
+		return client.Import(file, importImageName(file))
+	case backup.FormatDockerArchive, backup.FormatOCIArchive:
+		return client.LoadWithProgress(file, progress)
+	}
+	// Unknown (e.g. xz/zstd compressed): try both before giving up.
+	image, loadErr := client.LoadWithProgress(file, progress)
+	if loadErr == nil {
+		return image, nil
+	}
+	image, importErr := client.Import(file, importImageName(file))
+	if importErr == nil {
+		logInfo("Archive was imported as a root filesystem.")
+		return image, nil
+	}
+	return "", fmt.Errorf("archive is neither a loadable image nor a root filesystem: %v", loadErr)
+}
+
+// loadArchiveForJob loads an archive and immediately moves the result to a
+// tag unique to this job. Backups of the same image carry the same tag, so a
+// concurrent restore could otherwise re-point that tag before this job has
+// created its container. Loads are serialized, across processes too, until
+// the unique tag is in place; the tag is recorded in the job journal.
+func loadArchiveForJob(file string, progress backup.ProgressFunc) (string, error) {
+	return loadForJob(file, func() (string, error) { return loadArchive(file, progress) })
+}
+
+// loadStreamForJob is loadArchiveForJob for a streamed archive, which is
+// checked against its sha256 as it passes. The runtime may stop reading
+// before the end, so the rest is read too for the checksum.
+func loadStreamForJob(src restoreSource, progress backup.ProgressFunc) (string, error) {
+	return loadForJob(src.File, func() (string, error) {
+		r, err := src.Stream()
+		if err != nil {
+			return "", err
+		}
+		h := sha256.New()
+		tee := io.TeeReader(r, h)
+		image, err := client.LoadArchiveStream(tee, progress)
+		if err == nil {
+			_, err = io.Copy(io.Discard, tee)
+		}
+		if closeErr := r.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("transfer of %s failed: %w", filepath.Base(src.File), closeErr)
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); err == nil && src.SHA256 != "" && !strings.EqualFold(got, src.SHA256) {
+			err = fmt.Errorf("%s is corrupt: sha256 %s, expected %s", filepath.Base(src.File), got, src.SHA256)
+		}
+		if err != nil && image != "" {
+			client.RemoveImage(image)
+		}
+		return image, err
+	})
+}
+
+// loadForJob runs load, which brings the archive file into storage, and
+// gives its image the unique tag.
+func loadForJob(file string, load func() (string, error)) (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	unlock, err := lockFile(filepath.Join(dir, "load.lock"))
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	image, err := load()
+	if err != nil {
+		return "", err
+	}
+	ref := journalTempImage(fmt.Sprintf("distrobox-restore-%s:%s", strings.ToLower(containerNameFromFile(file)), newUUID()), "restore", filepath.Base(file))
+	if err := client.Tag(image, ref); err != nil {
+		releaseTempImage(ref)
+		return "", fmt.Errorf("could not give the loaded image a unique tag: %w", err)
+	}
+	if !backup.IsImageID(image) {
+		if err := client.RemoveImage(image); err != nil {
+			logWarning(fmt.Sprintf("Could not drop the archive's own tag '%s': %v", image, err))
+		}
+	}
+	return ref, nil
+}
+
+// restoredRepository is where images of restored containers are tagged.
+const restoredRepository = "distrobox-backup"
+
+// restoredImageName returns the stable tag for a restored container's image.
+func restoredImageName(containerName string) string {
+	return fmt.Sprintf("%s/%s:%s", restoredRepository, strings.ToLower(containerName), time.Now().Format("2006-01-02"))
+}
+
+func importImageName(file string) string {
+	return fmt.Sprintf("%s/%s:latest", importRepository, strings.ToLower(containerNameFromFile(file)))
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// containerNameFromFile derives a container name from an archive file name,
+// dropping archive extensions and the tool's own type suffixes.
+func containerNameFromFile(file string) string {
+	name := filepath.Base(file)
+	for _, ext := range []string{".age", ".gpg", ".gz", ".xz", ".zst", ".tgz", ".tar"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	for _, suffix := range []string{"-standard", "-isolated", "-rootfs"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	name = strings.Trim(invalidNameChars.ReplaceAllString(name, "-"), "-._")
+	if name == "" {
+		name = "imported"
+	}
+	return name
+}
+
+// promptContainerName asks for the new container's name, offering def when set.
+func promptContainerName(def string) string {
+	if def != "" {
+		fmt.Printf("\n%s> Enter a name for the new container (default '%s'): %s", colorBold, def, colorReset)
+	} else {
+		fmt.Printf("\n%s> Enter a name for the new container: %s", colorBold, colorReset)
+	}
+	name := readUserInput()
+	if name == "" {
+		return def
+	}
+	return name
+}
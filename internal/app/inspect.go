@@ -0,0 +1,208 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// containerDetails is the part of 'podman/docker inspect' used to recover how
+// a distrobox was created.
+type containerDetails struct {
+	Name       string
+	Image      string    `json:"Image"`
+	Args       []string  `json:"Args"`
+	Created    time.Time `json:"Created"`
+	HostConfig struct {
+		NetworkMode string `json:"NetworkMode"`
+		IpcMode     string `json:"IpcMode"`
+		PidMode     string `json:"PidMode"`
+	} `json:"HostConfig"`
+	Mounts []struct {
+		Type        string `json:"Type"`
+		Name        string `json:"Name"`
+		Source      string `json:"Source"`
+		Destination string `json:"Destination"`
+		RW          bool   `json:"RW"`
+	} `json:"Mounts"`
+	Config struct {
+		Env    []string          `json:"Env"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+}
+
+// inspectContainer returns the inspect data of a single container.
+func inspectContainer(name string) (*containerDetails, error) {
+	out, err := client.RuntimeOutput("inspect", "--type", "container", name)
+	if err != nil {
+		return nil, err
+	}
+	var details []containerDetails
+	if err := json.Unmarshal([]byte(out), &details); err != nil {
+		return nil, fmt.Errorf("failed to parse inspect data of '%s': %w", name, err)
+	}
+	if len(details) == 0 {
+		return nil, fmt.Errorf("container '%s' not found", name)
+	}
+	return &details[0], nil
+}
+
+func (d *containerDetails) hasMount(destination string) bool {
+	for _, m := range d.Mounts {
+		if m.Destination == destination {
+			return true
+		}
+	}
+	return false
+}
+
+// unshareFlags reports which namespaces the container does not share with
+// the host, as distrobox-create --unshare-<name> flag names.
+func (d *containerDetails) unshareFlags() []string {
+	var flags []string
+	if d.HostConfig.IpcMode != "" && d.HostConfig.IpcMode != "host" {
+		flags = append(flags, "ipc")
+	}
+	if d.HostConfig.NetworkMode != "" && d.HostConfig.NetworkMode != "host" {
+		flags = append(flags, "netns")
+	}
+	if d.HostConfig.PidMode != "" && d.HostConfig.PidMode != "host" {
+		flags = append(flags, "process")
+	}
+	if !d.hasMount("/dev") {
+		flags = append(flags, "devsys")
+	}
+	return flags
+}
+
+// entrypointArg returns the value of a distrobox entrypoint option such as
+// --init from the container's arguments.
+func (d *containerDetails) entrypointArg(option string) string {
+	for i := 0; i+1 < len(d.Args); i++ {
+		if d.Args[i] == option {
+			return d.Args[i+1]
+		}
+	}
+	return ""
+}
+
+// distroboxMounts are the destinations distrobox-create mounts by itself;
+// mounts at or below them are not the user's volumes.
+var distroboxMounts = []string{
+	"/run/host", "/dev", "/sys", "/tmp", "/run/user", "/run/systemd", "/run/udev",
+	"/run/libvirt", "/run/media", "/run/avahi-daemon", "/run/pcscd", "/run/netconfig",
+	"/var/log/journal", "/var/lib/systemd", "/var/lib/libvirt", "/var/lib/flatpak",
+	"/var/home", "/var/mnt", "/media", "/mnt", "/etc/hosts", "/etc/hostname",
+	"/etc/resolv.conf", "/etc/localtime", "/usr/bin/entrypoint", "/usr/bin/distrobox-export",
+	"/usr/bin/distrobox-host-exec", "/usr/bin/distrobox-init",
+}
+
+// distroboxEnv are variables distrobox-create or the runtime set.
+var distroboxEnv = map[string]bool{
+	"HOME": true, "SHELL": true, "container": true, "TERM": true, "HOSTNAME": true,
+	"PATH": true, "TERMINFO_DIRS": true, "DISPLAY": true, "WAYLAND_DISPLAY": true,
+}
+
+// imageConfig is the part of 'image inspect' extra flags are compared with.
+type imageConfig struct {
+	Env    []string          `json:"Env"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// extraFlags recovers the volumes, environment, labels and hooks the
+// container was created with, leaving out what distrobox, the runtime and
+// the image set themselves. home is the container's home directory.
+func (d *containerDetails) extraFlags(image imageConfig, home string) backup.ExtraFlags {
+	var f backup.ExtraFlags
+	hostHome, _ := os.UserHomeDir()
+mounts:
+	for _, m := range d.Mounts {
+		if m.Destination == hostHome || m.Destination == home {
+			continue
+		}
+		for _, dir := range distroboxMounts {
+			if m.Destination == dir || strings.HasPrefix(m.Destination, dir+"/") {
+				continue mounts
+			}
+		}
+		source := m.Source
+		if m.Type == "volume" && m.Name != "" {
+			source = m.Name
+		}
+		spec := source + ":" + m.Destination
+		if !m.RW {
+			spec += ":ro"
+		}
+		f.Volumes = append(f.Volumes, spec)
+	}
+
+	fromImage := map[string]bool{}
+	for _, e := range image.Env {
+		fromImage[e] = true
+	}
+	for _, e := range d.Config.Env {
+		key, _, _ := strings.Cut(e, "=")
+		if !fromImage[e] && !distroboxEnv[key] && !strings.HasPrefix(key, "XDG_") {
+			f.Env = append(f.Env, e)
+		}
+	}
+	for key, value := range d.Config.Labels {
+		if image.Labels[key] == value || key == "manager" || strings.HasPrefix(key, "distrobox.") || strings.HasPrefix(key, "com.github.containers.") {
+			continue
+		}
+		f.Labels = append(f.Labels, key+"="+value)
+	}
+	sort.Strings(f.Labels)
+
+	f.InitHooks = d.entrypointArg("--init-hooks")
+	f.PreInitHooks = d.entrypointArg("--pre-init-hooks")
+	return f
+}
+
+// containerCreateOptions inspects a container for the distrobox-create
+// settings a new container made from it should get again: unshared
+// namespaces, --init, --nvidia and the extra flags. Name, Image and Home
+// are left to the caller. A container that cannot be inspected yields
+// empty options.
+func containerCreateOptions(name string) backup.CreateOptions {
+	d, err := inspectContainer(name)
+	if err != nil {
+		logWarning(fmt.Sprintf("Could not inspect '%s' for its create settings: %v", name, err))
+		return backup.CreateOptions{}
+	}
+	if isToolbox(d.Config.Labels) {
+		return backup.CreateOptions{Toolbox: true}
+	}
+	opts := backup.CreateOptions{
+		Unshare: d.unshareFlags(),
+		Init:    isTrueArg(d.entrypointArg("--init")),
+		Nvidia:  isTrueArg(d.entrypointArg("--nvidia")),
+	}
+	// Without the image's own settings everything would look custom.
+	var image imageConfig
+	out, err := client.RuntimeOutput("image", "inspect", "--format", "{{json .Config}}", d.Image)
+	if err == nil {
+		err = json.Unmarshal([]byte(strings.TrimSpace(out)), &image)
+	}
+	if err != nil {
+		logWarning(fmt.Sprintf("Could not inspect the image of '%s'; its volumes, environment and labels are not carried over.", name))
+		return opts
+	}
+	home := ""
+	for _, e := range d.Config.Env {
+		if strings.HasPrefix(e, "HOME=") {
+			home = strings.TrimPrefix(e, "HOME=")
+		}
+	}
+	opts.Extra = d.extraFlags(image, home)
+	return opts
+}
+
+func isTrueArg(s string) bool {
+	return s == "1" || s == "true"
+}
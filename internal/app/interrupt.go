@@ -0,0 +1,151 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// On Ctrl+C or SIGTERM the tool undoes what the running operation left half
+// done before exiting: registered cleanups run newest first (removing
+// partial files, starting stopped containers, putting a replaced container
+// back), then the temporary images this process recorded in the journal are
+// removed. A second signal exits at once.
+
+type interruptCleanup struct {
+	id int
+	fn func()
+}
+
+var (
+	interruptMu       sync.Mutex
+	interruptCleanups []interruptCleanup
+	interruptNextID   int
+	// interruptKept holds temporary images that are the only copy of a
+	// removed container, mapped to that container's name.
+	interruptKept    = map[string]string{}
+	interruptSignals chan os.Signal
+)
+
+// handleInterrupts installs the signal handler.
+func handleInterrupts() {
+	interruptSignals = make(chan os.Signal, 2)
+	signal.Notify(interruptSignals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-interruptSignals
+		go func() {
+			<-interruptSignals
+			os.Exit(130)
+		}()
+		fmt.Println()
+		logWarning("Interrupted; cleaning up (press Ctrl+C again to exit now)...")
+		cleanUpInterrupted()
+		if sig == syscall.SIGTERM {
+			os.Exit(143)
+		}
+		os.Exit(130)
+	}()
+}
+
+// deferInterrupts stops the handler for code that handles the signals
+// itself, such as the trigger listener letting running backups finish.
+func deferInterrupts() {
+	if interruptSignals != nil {
+		signal.Stop(interruptSignals)
+	}
+}
+
+// onInterrupt registers fn to run if the tool is interrupted and returns the
+// function unregistering it once the work fn undoes is complete.
+func onInterrupt(fn func()) func() {
+	interruptMu.Lock()
+	defer interruptMu.Unlock()
+	interruptNextID++
+	id := interruptNextID
+	interruptCleanups = append(interruptCleanups, interruptCleanup{id: id, fn: fn})
+	return func() {
+		interruptMu.Lock()
+		defer interruptMu.Unlock()
+		for i, c := range interruptCleanups {
+			if c.id == id {
+				interruptCleanups = append(interruptCleanups[:i], interruptCleanups[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// removeOnInterrupt deletes files if the tool is interrupted before the
+// returned function is called.
+func removeOnInterrupt(files func() []string) func() {
+	return onInterrupt(func() {
+		for _, f := range files() {
+			if err := os.Remove(f); err == nil {
+				logInfo(fmt.Sprintf("Removed the partial file %s.", f))
+			}
+		}
+	})
+}
+
+// restartOnInterrupt starts a container that was running before the tool
+// stopped it, if the tool is interrupted before the returned function is
+// called.
+func restartOnInterrupt(c Container) func() {
+	if c.State != "running" {
+		return func() {}
+	}
+	return onInterrupt(func() {
+		if _, err := runCommand(containerRuntime, "start", c.Name); err != nil {
+			logWarning(fmt.Sprintf("Could not start '%s' again: %v", c.Name, err))
+			return
+		}
+		logInfo(fmt.Sprintf("Started '%s' again.", c.Name))
+	})
+}
+
+// keepOnInterrupt marks image as the only copy of a container that has been
+// removed, so an interruption keeps it and says how to recreate the
+// container, until the returned function is called.
+func keepOnInterrupt(image, container string) func() {
+	interruptMu.Lock()
+	interruptKept[image] = container
+	interruptMu.Unlock()
+	return func() {
+		interruptMu.Lock()
+		delete(interruptKept, image)
+		interruptMu.Unlock()
+	}
+}
+
+// cleanUpInterrupted runs the registered cleanups and removes the temporary
+// images of this process that no container depends on.
+func cleanUpInterrupted() {
+	interruptMu.Lock()
+	cleanups := interruptCleanups
+	interruptCleanups = nil
+	kept := make(map[string]string, len(interruptKept))
+	for image, container := range interruptKept {
+		kept[image] = container
+	}
+	interruptMu.Unlock()
+
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i].fn()
+	}
+	for image, container := range kept {
+		logWarning(fmt.Sprintf("'%s' was removed and %s is its only copy, so the image was kept. Recreate the container with 'distrobox create --name %s --image %s'.", container, image, container, image))
+	}
+	entries, err := readJournal()
+	if err != nil {
+		logWarning(fmt.Sprintf("Could not read the job journal: %v", err))
+		return
+	}
+	for _, e := range entries {
+		if _, ok := kept[e.Image]; ok || e.PID != os.Getpid() {
+			continue
+		}
+		removeTempImage(e.Image)
+	}
+}
@@ -0,0 +1,348 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// jobFile is a list of operations run one after another by `run FILE`. It
+// is written in YAML or JSON:
+//
+//	on_failure: stop
+//	steps:
+//	  - action: backup
+//	    containers: [dev, web, db]
+//	    dest: nas
+//	    compress: zstd
+//	  - action: prune
+//	    dest: nas
+//	  - action: verify
+//	  - action: check
+//	    dest: offsite
+type jobFile struct {
+	// OnFailure is "stop" (the default) or "continue" with the next step.
+	OnFailure string    `json:"on_failure"`
+	Steps     []jobStep `json:"steps"`
+	// hours, set for scheduled runs, stops the job between steps once the
+	// schedule's window closes or a blackout begins.
+	hours runHours
+}
+
+// jobStep is one operation of a job file. Which fields apply depends on
+// Action.
+type jobStep struct {
+	Action string `json:"action"` // backup, prune, verify or check
+
+	// backup
+	Containers []string `json:"containers"`
+	Group      string   `json:"group"`
+	All        bool     `json:"all"`
+	Compress   string   `json:"compress"`
+	Level      int      `json:"level"`
+	Encrypt    string   `json:"encrypt"`
+	Recipient  string   `json:"recipient"`
+	Note       string   `json:"note"`
+
+	// backup, prune and check: a configured destination or a folder; prune
+	// and check take every destination when it is empty.
+	Dest string `json:"dest"`
+
+	// prune: only show what would be deleted.
+	DryRun bool `json:"dry_run"`
+
+	// verify: the backups to check; by default those written by earlier
+	// steps of the same run.
+	Files []string `json:"files"`
+}
+
+// jobYAMLKinds are the fields of a job file that are not strings.
+var jobYAMLKinds = map[string]yamlKind{
+	"all":     yamlBool,
+	"dry_run": yamlBool,
+	"level":   yamlInt,
+}
+
+// loadJobFile reads a job file, as JSON if its name ends in .json and as
+// YAML otherwise, and checks its steps.
+func loadJobFile(path string) (*jobFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(filepath.Ext(path), ".json") {
+		doc, err := parseYAML(string(data))
+		if err == nil {
+			doc, err = typeYAML(doc, jobYAMLKinds)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	var jf jobFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&jf); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := jf.check(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &jf, nil
+}
+
+func (jf *jobFile) check() error {
+	switch jf.OnFailure {
+	case "":
+		jf.OnFailure = failureStop
+	case failureStop, failureContinue:
+	default:
+		return fmt.Errorf("on_failure: must be %s or %s", failureStop, failureContinue)
+	}
+	if len(jf.Steps) == 0 {
+		return fmt.Errorf("no steps")
+	}
+	for i, s := range jf.Steps {
+		var err error
+		switch s.Action {
+		case "backup":
+			targets := 0
+			for _, set := range []bool{len(s.Containers) > 0, s.Group != "", s.All} {
+				if set {
+					targets++
+				}
+			}
+			if targets != 1 {
+				err = fmt.Errorf("exactly one of containers, group or all is required")
+			}
+			if err == nil && s.Compress != "" {
+				_, err = backup.ParseCompression(s.Compress)
+			}
+			if err == nil && s.Encrypt != "" {
+				_, err = backup.ParseCipher(s.Encrypt)
+			}
+		case "prune", "verify", "check":
+		case "":
+			err = fmt.Errorf("action is required")
+		default:
+			err = fmt.Errorf("unknown action %q (use backup, prune, verify or check)", s.Action)
+		}
+		if err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// usesNetwork reports whether any step backs up to or prunes a remote
+// destination.
+func (jf *jobFile) usesNetwork() bool {
+	for _, s := range jf.Steps {
+		switch s.Action {
+		case "backup":
+			if _, ok := parseRemote(resolveBackupDest(s.Dest)); ok {
+				return true
+			}
+		case "prune", "check":
+			dests, _ := findPruneDestinations(s.Dest)
+			for _, d := range dests {
+				if d.Remote != nil {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// resolveBackupDest returns the folder or remote target to back up to: the
+// [backup] dir, a configured destination, or one given directly.
+func resolveBackupDest(dest string) string {
+	if dest == "" {
+		return defaultBackupDir()
+	}
+	spec := dest
+	if d, ok := cfg.Destinations[dest]; ok {
+		spec = d.Path
+	}
+	if _, ok := parseRemote(spec); ok {
+		return spec
+	}
+	return expandHome(spec)
+}
+
+// stepEncryption resolves a step's encryption like `backup --encrypt`: the
+// configured recipient applies when the configured method is used.
+func stepEncryption(s jobStep) (backup.Encryption, error) {
+	if s.Encrypt == "" {
+		return configuredEncryption(), nil
+	}
+	enc := backup.Encryption{Recipient: expandHome(s.Recipient)}
+	var err error
+	if enc.Cipher, err = backup.ParseCipher(s.Encrypt); err != nil {
+		return enc, err
+	}
+	if enc.Recipient == "" && enc.Cipher == cfg.Encryption.Method {
+		enc.Recipient = configuredEncryption().Recipient
+	}
+	if enc.Cipher == backup.EncryptNone {
+		enc.Recipient = ""
+	} else if enc.Recipient == "" {
+		return enc, fmt.Errorf("a recipient is required for %s encryption", enc.Cipher)
+	}
+	return enc, checkCipher(enc.Cipher)
+}
+
+// runJobStep runs one step, adding the backups it writes to written.
+func runJobStep(s jobStep, written *[]string) error {
+	switch s.Action {
+	case "backup":
+		return runBackupStep(s, written)
+	case "prune":
+		dests, ok := findPruneDestinations(s.Dest)
+		if !ok {
+			return fmt.Errorf("destination '%s' is not configured", s.Dest)
+		}
+		plans := planPrune(dests)
+		count, size := printPrunePlan(plans)
+		fmt.Println()
+		switch {
+		case count == 0:
+			logInfo("Nothing to prune.")
+		case s.DryRun:
+			logInfo(fmt.Sprintf("Dry run: %d backups (%s) would be deleted.", count, formatBytes(uint64(size))))
+		default:
+			if failed := runPrune(plans); failed > 0 {
+				return fmt.Errorf("%d backups could not be deleted", failed)
+			}
+		}
+		return nil
+	case "verify":
+		files := s.Files
+		if len(files) == 0 {
+			files = *written
+		}
+		if len(files) == 0 {
+			logWarning("No backups to verify; list them under files or back up in an earlier step.")
+			return nil
+		}
+		failed := 0
+		for _, f := range files {
+			if !verifyBackup(expandHome(f)) {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d backups failed verification", failed, len(files))
+		}
+		return nil
+	case "check":
+		dests, ok := findPruneDestinations(s.Dest)
+		if !ok {
+			return fmt.Errorf("destination '%s' is not configured", s.Dest)
+		}
+		failed := 0
+		for _, r := range checkDestinations(dests, false) {
+			if r.failed() {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d destinations failed the check", failed, len(dests))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown action %q", s.Action)
+}
+
+func runBackupStep(s jobStep, written *[]string) error {
+	var members []Container
+	switch {
+	case s.All:
+		containers, err := getContainers()
+		if err != nil {
+			return err
+		}
+		members = containers
+	case s.Group != "":
+		var ok bool
+		if members, ok = lookupGroup(s.Group); !ok {
+			return fmt.Errorf("group '%s' could not be resolved", s.Group)
+		}
+	default:
+		for _, name := range s.Containers {
+			c, ok := lookupContainer(name)
+			if !ok {
+				return fmt.Errorf("container '%s' could not be resolved", name)
+			}
+			members = append(members, c)
+		}
+	}
+
+	comp, level := cfg.Backup.Compression, s.Level
+	if s.Compress != "" {
+		comp, _ = backup.ParseCompression(s.Compress) // checked on load
+	}
+	if err := checkCompressor(comp); err != nil {
+		return err
+	}
+	if level == 0 && comp == cfg.Backup.Compression {
+		level = cfg.Backup.CompressionLevel
+	}
+	enc, err := stepEncryption(s)
+	if err != nil {
+		return err
+	}
+	dest := resolveBackupDest(s.Dest)
+	if err := prepareBackupDest(dest); err != nil {
+		return err
+	}
+
+	results := runBatchBackup(members, dest, cfg.Batch.OnFailure, s.Note, comp, level, enc)
+	for _, r := range results {
+		// Uploads are checked against their sha256 on the remote host, so
+		// only local backups are left to verify.
+		if _, remote := parseRemote(r.File); r.Err == nil && !r.Skipped && !remote {
+			*written = append(*written, r.File)
+		}
+	}
+	if batchExitCode(results) != 0 {
+		return fmt.Errorf("not every container was backed up")
+	}
+	return nil
+}
+
+// runJobFile runs the steps of a job file in order and reports whether all
+// of them succeeded.
+func runJobFile(jf *jobFile) bool {
+	var written []string
+	failed := 0
+	for i, s := range jf.Steps {
+		if reason := jf.hours.blocked(time.Now()); reason != "" {
+			logWarning(fmt.Sprintf("Skipping the remaining %d steps: %s.", len(jf.Steps)-i, reason))
+			return false
+		}
+		fmt.Printf("\n%s%s%s%s\n", colorBold, colorBlue, symbols(fmt.Sprintf("▶ Step %d/%d: %s", i+1, len(jf.Steps), s.Action)), colorReset)
+		start := time.Now()
+		if err := runJobStep(s, &written); err != nil {
+			failed++
+			logError(fmt.Sprintf("Step %d (%s) failed: %v", i+1, s.Action, err))
+			if jf.OnFailure == failureStop && i+1 < len(jf.Steps) {
+				logWarning(fmt.Sprintf("Skipping the remaining %d steps.", len(jf.Steps)-i-1))
+				return false
+			}
+			continue
+		}
+		logSuccess(fmt.Sprintf("✅ Step %d (%s) finished in %s.", i+1, s.Action, time.Since(start).Round(time.Second)))
+	}
+	return failed == 0
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const appName = "distrobox-backup-tool"
+
+// journalEntry records a temporary image owned by a running (or crashed) job.
+type journalEntry struct {
+	Image     string    `json:"image"`
+	Kind      string    `json:"kind"`
+	Container string    `json:"container"`
+	PID       int       `json:"pid"`
+	Started   time.Time `json:"started"`
+}
+
+// stateDir returns the tool's XDG state directory, creating it if needed.
+func stateDir() (string, error) {
+	base := os.Getenv("XDG_STATE_HOME")
+	if base == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(homeDir, ".local", "state")
+	}
+	dir := filepath.Join(base, appName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func journalPath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "journal.json"), nil
+}
+
+// newUUID returns a random RFC 4122 version 4 UUID.
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand never fails on Linux; fall back to the clock just in case.
+		return fmt.Sprintf("%032x", time.Now().UnixNano())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// newTempImageName returns a unique temporary image name for a job of the
+// given kind ("backup", "clone", "convert") and records it in the journal.
+func newTempImageName(kind string, container Container) string {
+	return journalTempImage(fmt.Sprintf("distrobox-%s-%s:%s", kind, container.ID, newUUID()), kind, container.Name)
+}
+
+// journalTempImage records image as owned by a job working on owner.
+func journalTempImage(image, kind, owner string) string {
+	err := updateJournal(func(entries []journalEntry) []journalEntry {
+		return append(entries, journalEntry{
+			Image:     image,
+			Kind:      kind,
+			Container: owner,
+			PID:       os.Getpid(),
+			Started:   time.Now(),
+		})
+	})
+	if err != nil {
+		logWarning(fmt.Sprintf("Could not record temporary image in the job journal: %v", err))
+	}
+	return image
+}
+
+// releaseTempImage drops an image from the journal once it no longer needs
+// cleaning up (removed, or adopted by a container).
+func releaseTempImage(image string) {
+	updateJournal(func(entries []journalEntry) []journalEntry {
+		kept := entries[:0]
+		for _, e := range entries {
+			if e.Image != image {
+				kept = append(kept, e)
+			}
+		}
+		return kept
+	})
+}
+
+// removeTempImage deletes a temporary image and its journal entry.
+func removeTempImage(image string) {
+	logInfo(fmt.Sprintf("Cleaning up temporary image %s...", image))
+	if err := client.RemoveImage(image); err != nil {
+		logWarning(fmt.Sprintf("Failed to clean up temporary image '%s'. You may want to remove it manually with '%s rmi %s'.", image, containerRuntime, image))
+		return
+	}
+	releaseTempImage(image)
+}
+
+func readJournal() ([]journalEntry, error) {
+	path, err := journalPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := readStateFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []journalEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("corrupt job journal %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// updateJournal applies fn to the journal while holding an exclusive lock, so
+// parallel jobs never lose each other's entries.
+func updateJournal(fn func([]journalEntry) []journalEntry) error {
+	path, err := journalPath()
+	if err != nil {
+		return err
+	}
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := readJournal()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(fn(entries), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStateFile(path, data)
+}
+
+// lockFile takes an exclusive flock on path, waiting for other holders in
+// this or other processes, and returns the function releasing it.
+func lockFile(path string) (func(), error) {
+	lock, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+		lock.Close()
+	}, nil
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// Labels consulted, in order, for a container's distribution name and
+// version. Distrobox images (and toolbx images they are often based on)
+// carry the OCI annotations; older images use the label-schema ones.
+var (
+	distroLabelKeys  = []string{"org.opencontainers.image.title", "name", "org.label-schema.name", "io.buildah.name"}
+	versionLabelKeys = []string{"org.opencontainers.image.version", "version", "org.label-schema.version", "VERSION_ID"}
+)
+
+// distroboxManagerLabel is set by distrobox-create on every distrobox.
+const distroboxManagerLabel = "manager"
+
+// toolboxLabels mark toolbx containers; the second one is from older
+// toolbox releases. Images made for toolbx carry them too, so a distrobox
+// created from such an image has them as well.
+var toolboxLabels = []string{"com.github.containers.toolbox", "com.github.debarshiray.toolbox"}
+
+// containerManager returns the Container.Manager for a container's labels.
+func containerManager(labels map[string]string) string {
+	if isToolbox(labels) {
+		return backup.ManagerToolbox
+	}
+	return labels[distroboxManagerLabel]
+}
+
+// isToolbox reports whether labels belong to a toolbx container rather
+// than a distrobox.
+func isToolbox(labels map[string]string) bool {
+	if labels[distroboxManagerLabel] == "distrobox" {
+		return false
+	}
+	for _, l := range toolboxLabels {
+		if labels[l] == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// distroFromLabels derives the distribution name and version of a container
+// from its labels, falling back to the image reference (e.g.
+// "quay.io/toolbx/ubuntu-toolbox:22.04" gives "ubuntu-toolbox" and "22.04").
+func distroFromLabels(labels map[string]string, image string) (distro, version string) {
+	distro = firstLabel(labels, distroLabelKeys)
+	version = firstLabel(labels, versionLabelKeys)
+	if distro != "" && version != "" {
+		return distro, version
+	}
+
+	ref := image
+	if i := strings.Index(ref, "@"); i >= 0 {
+		ref = ref[:i]
+	}
+	repo, tag := ref, ""
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		repo, tag = ref[:i], ref[i+1:]
+	}
+	if distro == "" {
+		distro = repo[strings.LastIndex(repo, "/")+1:]
+	}
+	if version == "" && tag != "latest" {
+		version = tag
+	}
+	return distro, version
+}
+
+func firstLabel(labels map[string]string, keys []string) string {
+	for _, k := range keys {
+		if v := strings.TrimSpace(labels[k]); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// distroString formats a distro and version for display.
+func distroString(distro, version string) string {
+	return strings.TrimSpace(distro + " " + version)
+}
+
+// imageDistro reads the distribution of a loaded image from its labels.
+func imageDistro(image string) (distro, version string) {
+	out, err := client.RuntimeOutput("image", "inspect", "--format", "{{json .Config.Labels}}", image)
+	if err != nil {
+		return "", ""
+	}
+	var labels map[string]string
+	if err := json.Unmarshal([]byte(out), &labels); err != nil {
+		return "", ""
+	}
+	return distroFromLabels(labels, image)
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/syslog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Targets for [log] target: where log messages go.
+const (
+	logStdout  = "stdout"
+	logJournal = "journal" // the systemd journal (syslog without it) only
+	logBoth    = "both"
+)
+
+// journalSocket is where journald accepts its native protocol.
+const journalSocket = "/run/systemd/journal/socket"
+
+// logTargetFlag is the --log global flag; it overrides [log] target.
+var logTargetFlag string
+
+// logCommand is the subcommand being run, recorded with every forwarded
+// message; empty in the menu.
+var logCommand string
+
+// logPriorities maps log levels to syslog priorities.
+var logPriorities = map[string]syslog.Priority{
+	"error":   syslog.LOG_ERR,
+	"warning": syslog.LOG_WARNING,
+	"success": syslog.LOG_NOTICE,
+	"info":    syslog.LOG_INFO,
+}
+
+var (
+	logForwardOnce sync.Once
+	logForwardMu   sync.Mutex
+	journalConn    net.Conn
+	syslogWriter   *syslog.Writer
+)
+
+func logTarget() string {
+	if logTargetFlag != "" {
+		return logTargetFlag
+	}
+	return cfg.Log.Target
+}
+
+// openLogForward connects to journald, or to syslog when there is no
+// journal. Neither being reachable leaves forwarding off.
+func openLogForward() {
+	if conn, err := net.Dial("unixgram", journalSocket); err == nil {
+		journalConn = conn
+		return
+	}
+	if w, err := syslog.New(syslog.LOG_USER|syslog.LOG_INFO, appName); err == nil {
+		syslogWriter = w
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: neither the journal nor syslog is reachable; logging to stdout only\n", appName)
+}
+
+// forwardLog sends a log message to the journal as configured by [log]
+// target and reports whether it should also be printed.
+func forwardLog(level, msg string) bool {
+	target := logTarget()
+	if target == logStdout {
+		return true
+	}
+	logForwardOnce.Do(openLogForward)
+	logForwardMu.Lock()
+	defer logForwardMu.Unlock()
+	switch {
+	case journalConn != nil:
+		fields := [][2]string{
+			{"MESSAGE", msg},
+			{"PRIORITY", fmt.Sprint(int(logPriorities[level]))},
+			{"SYSLOG_IDENTIFIER", appName},
+			{"DBT_LEVEL", level},
+		}
+		if logCommand != "" {
+			fields = append(fields, [2]string{"DBT_COMMAND", logCommand})
+		}
+		if _, err := journalConn.Write(journaldMessage(fields)); err != nil {
+			return true
+		}
+	case syslogWriter != nil:
+		if logCommand != "" {
+			msg = logCommand + ": " + msg
+		}
+		var err error
+		switch logPriorities[level] {
+		case syslog.LOG_ERR:
+			err = syslogWriter.Err(msg)
+		case syslog.LOG_WARNING:
+			err = syslogWriter.Warning(msg)
+		case syslog.LOG_NOTICE:
+			err = syslogWriter.Notice(msg)
+		default:
+			err = syslogWriter.Info(msg)
+		}
+		if err != nil {
+			return true
+		}
+	default:
+		return true
+	}
+	return target == logBoth
+}
+
+// journaldMessage encodes fields in journald's native protocol: KEY=value
+// lines, or for values spanning lines the key, a newline, the value's
+// little-endian 64-bit length and the value.
+func journaldMessage(fields [][2]string) []byte {
+	var b bytes.Buffer
+	for _, f := range fields {
+		if !strings.Contains(f[1], "\n") {
+			fmt.Fprintf(&b, "%s=%s\n", f[0], f[1])
+			continue
+		}
+		b.WriteString(f[0] + "\n")
+		binary.Write(&b, binary.LittleEndian, uint64(len(f[1])))
+		b.WriteString(f[1] + "\n")
+	}
+	return b.Bytes()
+}
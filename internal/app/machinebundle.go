@@ -0,0 +1,421 @@
+package app
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// A machine bundle is a plain tar holding a backup of every container, with
+// isolated homes bundled into their archives, the user's distrobox config
+// files and, last, machineBundleIndex describing all of it.
+const (
+	machineBundleIndex     = "machine-bundle.json"
+	machineBundleArchives  = "containers/"
+	machineBundleConfigDir = "config/"
+)
+
+// machineBundle is the index of a machine bundle.
+type machineBundle struct {
+	Host       string                `json:"host"`
+	CreatedAt  time.Time             `json:"created_at"`
+	Containers []machineBundleMember `json:"containers"`
+	Config     []machineBundleConfig `json:"config,omitempty"`
+	// Failed lists containers whose backup failed; they are not in the
+	// bundle.
+	Failed []string `json:"failed,omitempty"`
+}
+
+// machineBundleMember is one container's archive in a bundle.
+type machineBundleMember struct {
+	Container string `json:"container"`
+	Archive   string `json:"archive"`
+}
+
+// machineBundleConfig is a config file in a bundle. Path is where it goes,
+// relative to the home directory.
+type machineBundleConfig struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// machineBundleName returns the file name of a new bundle of this host.
+func machineBundleName(now time.Time) string {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "host"
+	}
+	return fmt.Sprintf("distrobox-machine-%s-%s.tar", unsafeCatalogChars.ReplaceAllString(host, "_"), now.Format("20060102-150405"))
+}
+
+// userDistroboxConfigFiles returns the distrobox config files of the user
+// that exist; the system-wide ones belong to the distribution.
+func userDistroboxConfigFiles() []string {
+	var files []string
+	for _, f := range distroboxConfigFiles() {
+		if strings.HasPrefix(f, "/usr/") || strings.HasPrefix(f, "/etc/") {
+			continue
+		}
+		if fileExists(f) {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// tarAddFile appends the regular file path to tw as name.
+func tarAddFile(tw *tar.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: int64(info.Mode().Perm()), Size: info.Size(), ModTime: info.ModTime(), Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// exportMachineBundle backs up containers into a single bundle in the local
+// folder dest, together with the user's distrobox config. Each backup is
+// written next to the bundle, appended to it and removed, so only one
+// archive is ever on disk twice. A failed backup is left out and reported;
+// the bundle is still written. It returns the bundle path.
+func exportMachineBundle(containers []Container, dest string, comp backup.Compression, level int) (string, []batchResult, error) {
+	if _, ok := parseRemote(dest); ok {
+		return "", nil, fmt.Errorf("machine bundles are written to a local folder; copy the bundle to %s afterwards", dest)
+	}
+	if err := makeBackupDir(dest); err != nil {
+		return "", nil, fmt.Errorf("could not create the destination folder: %w", err)
+	}
+	now := time.Now()
+	path := filepath.Join(dest, machineBundleName(now))
+	staging, err := os.MkdirTemp(dest, ".machine-bundle-")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.RemoveAll(staging)
+	out, err := createBackupFile(path + ".part")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.Remove(path + ".part")
+	defer removeOnInterrupt(func() []string { return []string{path + ".part", staging} })()
+	defer out.Close()
+	tw := tar.NewWriter(out)
+
+	index := machineBundle{CreatedAt: now.UTC()}
+	index.Host, _ = os.Hostname()
+	var results []batchResult
+	for _, c := range orderContainers(containers) {
+		isIsolated, _ := isContainerIsolated(c)
+		if isIsolated && !hasTar {
+			logWarning(fmt.Sprintf("The 'tar' command was not found, so the home of '%s' is not included.", c.Name))
+		}
+		job := backupJob{Container: c, File: filepath.Join(staging, backupFileName(c.Name, isIsolated, comp, backup.EncryptNone)), BundleHome: isIsolated && hasTar, Compression: comp, Level: level}
+		start := time.Now()
+		_, err := runBackupJob(job)
+		if err == nil {
+			for _, f := range job.outputFiles() {
+				if !fileExists(f) {
+					continue
+				}
+				if err = tarAddFile(tw, f, machineBundleArchives+filepath.Base(f)); err != nil {
+					break
+				}
+				os.Remove(f)
+			}
+			if err != nil {
+				// A half-written entry leaves the tar unusable.
+				return "", results, fmt.Errorf("could not add '%s' to the bundle: %w", c.Name, err)
+			}
+		}
+		results = append(results, batchResult{Container: c.Name, File: path, Err: err, Duration: time.Since(start)})
+		if err != nil {
+			logError(fmt.Sprintf("Backup of '%s' failed and is left out of the bundle: %v", c.Name, err))
+			index.Failed = append(index.Failed, c.Name)
+			continue
+		}
+		index.Containers = append(index.Containers, machineBundleMember{Container: c.Name, Archive: filepath.Base(job.File)})
+	}
+
+	for i, f := range userDistroboxConfigFiles() {
+		name := fmt.Sprintf("%d-%s", i, filepath.Base(f))
+		if err := tarAddFile(tw, f, machineBundleConfigDir+name); err != nil {
+			return "", results, fmt.Errorf("could not add %s to the bundle: %w", f, err)
+		}
+		// Recorded as if below the home directory, where it goes on import
+		// whatever XDG_CONFIG_HOME is.
+		rel := ".distroboxrc"
+		if filepath.Base(f) == "distrobox.conf" {
+			rel = filepath.Join(".config", "distrobox", "distrobox.conf")
+		}
+		index.Config = append(index.Config, machineBundleConfig{Name: name, Path: rel})
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return "", results, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: machineBundleIndex, Mode: 0644, Size: int64(len(data)), ModTime: now, Typeflag: tar.TypeReg}); err != nil {
+		return "", results, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return "", results, err
+	}
+	if err := tw.Close(); err != nil {
+		return "", results, err
+	}
+	if err := out.Close(); err != nil {
+		return "", results, err
+	}
+	if err := os.Rename(path+".part", path); err != nil {
+		return "", results, err
+	}
+	return path, results, nil
+}
+
+// unpackMachineBundle extracts a bundle into dir and returns its index.
+// Only the archives, config files and index are extracted, under their
+// base names, whatever paths the tar claims.
+func unpackMachineBundle(path, dir string) (*machineBundle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, _ := f.Stat()
+	var total int64
+	if info != nil {
+		total = info.Size()
+	}
+	bar := startProgressBar("unpack", "Unpacking bundle...", total)
+	defer bar.finish()
+	counter := &countingReader{r: f, progress: bar.set}
+	tr := tar.NewReader(counter)
+	var index *machineBundle
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a readable machine bundle: %w", path, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if hdr.Name == machineBundleIndex {
+			var b machineBundle
+			if err := json.NewDecoder(tr).Decode(&b); err != nil {
+				return nil, fmt.Errorf("the bundle index is damaged: %w", err)
+			}
+			index = &b
+			continue
+		}
+		var sub string
+		switch {
+		case strings.HasPrefix(hdr.Name, machineBundleArchives):
+			sub = "containers"
+		case strings.HasPrefix(hdr.Name, machineBundleConfigDir):
+			sub = "config"
+		default:
+			continue
+		}
+		target := filepath.Join(dir, sub, filepath.Base(hdr.Name))
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return nil, err
+		}
+		w, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(w, tr)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not extract %s: %w", hdr.Name, err)
+		}
+	}
+	if index == nil {
+		return nil, fmt.Errorf("%s has no %s; it is not a complete machine bundle", path, machineBundleIndex)
+	}
+	return index, nil
+}
+
+// countingReader reports how many bytes were read through it.
+type countingReader struct {
+	r        io.Reader
+	n        int64
+	progress func(int64)
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	c.progress(c.n)
+	return n, err
+}
+
+// bundleConfigTarget returns where the bundled config file recorded at path
+// goes. Only the user's distrobox config files are accepted, relative to
+// the home directory, so a bundle cannot write anywhere else.
+func bundleConfigTarget(path string) (string, error) {
+	if path == "" || filepath.IsAbs(path) || slices.Contains(strings.Split(filepath.ToSlash(path), "/"), "..") {
+		return "", fmt.Errorf("%q is not a path below the home directory", path)
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	switch filepath.Clean(path) {
+	case ".distroboxrc":
+		return filepath.Join(homeDir, ".distroboxrc"), nil
+	case filepath.Join(".config", "distrobox", "distrobox.conf"):
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			configHome = filepath.Join(homeDir, ".config")
+		}
+		return filepath.Join(configHome, "distrobox", "distrobox.conf"), nil
+	}
+	return "", fmt.Errorf("%q is not a distrobox config file", path)
+}
+
+// installBundleConfig puts the bundle's distrobox config files in place. A
+// file that already exists with other contents is kept and the bundled one
+// is written next to it with a .bundled suffix.
+func installBundleConfig(dir string, files []machineBundleConfig) {
+	for _, cf := range files {
+		data, err := os.ReadFile(filepath.Join(dir, "config", filepath.Base(cf.Name)))
+		if err != nil {
+			logWarning(fmt.Sprintf("The bundle lacks %s: %v", cf.Path, err))
+			continue
+		}
+		target, err := bundleConfigTarget(cf.Path)
+		if err != nil {
+			logWarning(fmt.Sprintf("Skipped a config file of the bundle: %v", err))
+			continue
+		}
+		if existing, err := os.ReadFile(target); err == nil {
+			if bytes.Equal(existing, data) {
+				continue
+			}
+			target += ".bundled"
+			logWarning(fmt.Sprintf("%s already exists and differs; the bundled copy is written to %s for you to merge.", strings.TrimSuffix(target, ".bundled"), target))
+		} else if !errors.Is(err, os.ErrNotExist) {
+			logWarning(fmt.Sprintf("Could not read %s: %v", target, err))
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+			err = os.WriteFile(target, data, 0644)
+		}
+		if err != nil {
+			logWarning(fmt.Sprintf("Could not write %s: %v", target, err))
+			continue
+		}
+		logSuccess(fmt.Sprintf("✅ Installed %s.", target))
+	}
+}
+
+// importMachineBundle recreates the containers of a bundle, in the order
+// their restore_after settings ask for, and installs its distrobox config.
+// With replace, containers that already exist here are replaced.
+func importMachineBundle(path string, replace bool) ([]batchResult, error) {
+	dir, err := cacheDir("bundles")
+	if err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(dir, "import-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+	index, err := unpackMachineBundle(path, staging)
+	if err != nil {
+		return nil, err
+	}
+	logInfo(fmt.Sprintf("The bundle was made on %s at %s and holds %d container(s).", index.Host, index.CreatedAt.Local().Format("2006-01-02 15:04"), len(index.Containers)))
+	if len(index.Failed) > 0 {
+		logWarning(fmt.Sprintf("These containers could not be backed up when the bundle was made: %s", strings.Join(index.Failed, ", ")))
+	}
+	installBundleConfig(staging, index.Config)
+	// distrobox-create must see the installed settings.
+	loadDistroboxConfig()
+
+	var files []string
+	for _, m := range index.Containers {
+		files = append(files, filepath.Join(staging, "containers", filepath.Base(m.Archive)))
+	}
+	items, err := planRestore(files)
+	if err != nil {
+		return nil, err
+	}
+	printRestoreOrder(items)
+	return runBatchRestore(items, 1, false, false, replace), nil
+}
+
+func handleExportMachineBundle(containers []Container) {
+	clearScreen()
+	printTitle(colorGreen, "🚚 Export Machine Bundle")
+	printContainerList(orderContainers(containers))
+	fmt.Printf("%s%sHint:%s Every container, its isolated home and your distrobox config go into one file to move to a new machine.\n\n", colorYellow, colorUnderline, colorReset)
+
+	logInfo("Please choose the folder to write the bundle to.")
+	destDir, err := selectDirectory("Select Bundle Folder")
+	if err != nil || destDir == "" {
+		if err != nil {
+			logError(err.Error())
+		}
+		logError("No valid destination directory selected. Aborting.")
+		return
+	}
+	comp, level, ok := promptCompression()
+	if !ok {
+		logInfo("Export cancelled.")
+		return
+	}
+	path, results, err := exportMachineBundle(containers, destDir, comp, level)
+	if len(results) > 0 {
+		printBatchSummary(results)
+	}
+	if err != nil {
+		logError(fmt.Sprintf("The bundle could not be written: %v", err))
+		return
+	}
+	logSuccess(fmt.Sprintf("✅ Bundle written to %s. Use Import Bundle on the new machine.", path))
+}
+
+func handleImportMachineBundle() {
+	clearScreen()
+	printTitle(colorCyan, "🚚 Import Machine Bundle")
+	logInfo("Please choose the machine bundle (distrobox-machine-*.tar).")
+	path, err := selectFile("Select Machine Bundle", "distrobox-machine-*.tar")
+	if err != nil || path == "" {
+		logError("No bundle selected. Aborting.")
+		return
+	}
+	fmt.Printf("%s> Replace containers that already exist here? (y/N): %s", colorBold, colorReset)
+	replace := confirmAction()
+	results, err := importMachineBundle(path, replace)
+	if err != nil {
+		logError(err.Error())
+		return
+	}
+	printBatchSummary(results)
+}
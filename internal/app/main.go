@@ -0,0 +1,1579 @@
+// Filename: distrobox-tool.go
+
+// Package app is the whole tool. distrobox-tool starts it with Run, which
+// falls back to the interactive menu, and the distrobox-backup companion in
+// cmd/distrobox-backup with RunHeadless, which never references the menu so
+// it is not linked in.
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// --- Configuration & Constants ---
+
+// ANSI color codes for beautiful output
+const (
+	colorReset     = "\033[0m"
+	colorRed       = "\033[31m"
+	colorGreen     = "\033[32m"
+	colorYellow    = "\033[33m"
+	colorBlue      = "\033[34m"
+	colorMagenta   = "\033[35m"
+	colorCyan      = "\033[36m"
+	colorWhite     = "\033[37m"
+	colorBold      = "\033[1m"
+	colorUnderline = "\033[4m"
+)
+
+// Container represents a distrobox container with its properties
+type Container struct {
+	Name  string
+	ID    string
+	Image string
+
+	// Distro, DistroVersion and Manager come from the container's labels.
+	Distro        string
+	DistroVersion string
+	Manager       string
+
+	// Home is the HOME distrobox set for the container; it differs from the
+	// host user's home for isolated containers. HomeSource is the host path
+	// mounted there, if any.
+	Home       string
+	HomeSource string
+	// State is the runtime's status, e.g. "running" or "exited".
+	State string
+	// Created is when the container was created; ImageID is the ID of the
+	// image it runs, without the "sha256:" prefix.
+	Created time.Time
+	ImageID string
+	// Rootful is set for containers in the runtime's root storage.
+	Rootful bool
+}
+
+// Minimal struct to unmarshal json output from 'podman/docker inspect'
+type inspectData struct {
+	ID      string `json:"Id"`
+	Name    string
+	Created time.Time
+	Image   string // the image ID
+	Config  struct {
+		Image  string            `json:"Image"`
+		Cmd    []string          `json:"Cmd"`
+		Env    []string          `json:"Env"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	State struct {
+		Status string `json:"Status"`
+	} `json:"State"`
+	Mounts []struct {
+		Source      string `json:"Source"`
+		Destination string `json:"Destination"`
+	} `json:"Mounts"`
+}
+
+var (
+	containerRuntime     string // "podman", "podman-launcher" or "docker"
+	guiFilePicker        string // Will be "zenity" or "kdialog"
+	distroboxVersion     string
+	hostDistroName       string
+	hasTar               bool // Tracks if the 'tar' command is available
+	containerStoragePath string
+
+	// client executes the container primitives from pkg/backup.
+	client *backup.Client
+	// commandRunner builds every host command the tool executes.
+	commandRunner backup.Runner = exec.Command
+	// assumeYes answers every confirmation with yes (CLI --yes).
+	assumeYes bool
+	// headless is set by RunHeadless. The tool then only runs subcommands,
+	// never opens a GUI picker and never reads answers from stdin; questions
+	// get their default answer unless --yes is given.
+	headless bool
+)
+
+// --- Main Application Logic ---
+
+// Run starts distrobox-tool with the version and build date of the release;
+// without a command it runs the interactive menu.
+func Run(release, built string) {
+	version, buildDate = release, built
+	run(runMenu)
+}
+
+// RunHeadless starts the distrobox-backup companion, which has no menu: a
+// command is required.
+func RunHeadless(release, built string) {
+	version, buildDate, headless = release, built, true
+	run(nil)
+}
+
+// run parses the global flags and runs the command, or menu when there is
+// none and menu is not nil.
+func run(menu func()) {
+	flag.StringVar(&progressMode, "progress", progressText, "progress output format: 'text' or 'json' (line-delimited events on stdout)")
+	flag.StringVar(&logTargetFlag, "log", "", "where log messages go: 'stdout', 'journal' or 'both' (default: [log] target)")
+	flag.StringVar(&connectionFlag, "connection", "", "work through this podman system connection (default: [podman] connection)")
+	flag.BoolVar(&rootMode, "root", false, "list rootful containers (distrobox create --root) too, asking for distrobox's sudo program up front, and create new containers rootful")
+	flag.BoolVar(&asciiFlag, "ascii", false, "print ASCII instead of emoji and other symbols (default: when the terminal is not UTF-8)")
+	flag.Usage = func() {
+		usage := cliUsage
+		if headless {
+			usage = strings.Replace(usage, "Without a command the interactive menu is started.", "This build has no interactive menu; a command is required.", 1)
+		}
+		fmt.Fprint(flag.CommandLine.Output(), usage+"\nGlobal flags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if progressMode != progressText && progressMode != progressJSON {
+		fmt.Fprintf(os.Stderr, "invalid --progress value %q: must be 'text' or 'json'\n", progressMode)
+		os.Exit(2)
+	}
+	if jsonProgress() {
+		reserveStdoutForProgress()
+	}
+	switch logTargetFlag {
+	case "", logStdout, logJournal, logBoth:
+	default:
+		fmt.Fprintf(os.Stderr, "invalid --log value %q: must be 'stdout', 'journal' or 'both'\n", logTargetFlag)
+		os.Exit(2)
+	}
+
+	if flag.NArg() == 0 && menu != nil {
+		menu()
+		return
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	for _, arg := range flag.Args() {
+		if strings.HasPrefix(arg, "-") || strings.Count(logCommand, " ") == 2 {
+			break
+		}
+		logCommand = strings.TrimSpace(logCommand + " " + arg)
+	}
+	if flag.Arg(0) == "version" {
+		os.Exit(cmdVersion(flag.Args()[1:]))
+	}
+	loadConfig()
+	checkDependencies()
+	setupOutput()
+	client.Identity = expandHome(cfg.Encryption.Identity)
+	client.FileMode = backupFileMode()
+	if err := unlockState(); err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+	operationLogReady = true
+	handleInterrupts()
+	os.Exit(runSubcommand(flag.Args()))
+}
+
+// runMenu runs the interactive menu until the user quits.
+func runMenu() {
+	clearScreen()
+	loadConfig()
+	checkDependencies()
+	detectFilePicker()
+	setupOutput()
+	client.Identity = expandHome(cfg.Encryption.Identity)
+	client.FileMode = backupFileMode()
+	if err := unlockState(); err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+	operationLogReady = true
+	handleInterrupts()
+	printHeader()
+	offerOrphanCleanup()
+
+	for {
+		containers, err := getContainers()
+		if err != nil {
+			logError("Could not list Distrobox containers. Is distrobox installed and running correctly?")
+			logError(err.Error())
+			os.Exit(1)
+		}
+
+		displayMenu(containers)
+
+		keepLooping, actionWasTaken := handleUserChoice(containers)
+		if !keepLooping {
+			return
+		}
+
+		if actionWasTaken {
+			acknowledge("Press Enter to return to the main menu...")
+		}
+	}
+}
+
+// --- Core Feature Handlers ---
+
+func handleUserChoice(containers []Container) (bool, bool) {
+	var choiceStr string
+	if tuiEnabled() {
+		choiceStr = pickMenuChoice()
+	} else {
+		fmt.Printf("%s> Select an option: %s", colorBold, colorReset)
+		choiceStr = readUserInput()
+	}
+	if choiceStr == "" {
+		return true, false
+	}
+	if key, ok := parseHelpChoice(choiceStr); ok {
+		handleHelp(key)
+		return true, true
+	}
+	choice, err := strconv.Atoi(choiceStr)
+	if err != nil {
+		logWarning("Invalid option. Please enter a number, or 'h' for help.")
+		acknowledge("Press Enter to continue...")
+		return true, false
+	}
+
+	if choice == 0 {
+		if !confirmLeaveQueue() {
+			return true, false
+		}
+		fmt.Printf("\n%s%s%s\n", colorCyan, symbols("👋 Goodbye!"), colorReset)
+		return false, false
+	}
+
+	entry, ok := findMenuEntry(choice)
+	if !ok {
+		logWarning("Invalid option. Please try again.")
+		acknowledge("Press Enter to continue...")
+		return true, false
+	}
+	if entry.NeedsContainers && len(containers) == 0 {
+		logWarning("There are no containers to perform this action on.")
+		acknowledge("Press Enter to continue...")
+		return true, false
+	}
+	entry.Run(containers)
+	return true, true
+}
+
+func handleBackup(containers []Container) {
+	clearScreen()
+	printTitle(colorGreen, "📦 Backup Container")
+
+	selected := selectContainers("the containers to back up", containers)
+	if len(selected) == 0 {
+		return
+	}
+	if len(selected) > 1 {
+		runInteractiveBatch(orderContainers(selected))
+		return
+	}
+	selectedContainer := selected[0]
+
+	fmt.Printf("%s> Show what takes up space in '%s' first? (y/N): %s", colorBold, selectedContainer.Name, colorReset)
+	if confirmAction() {
+		fmt.Println()
+		if showUsage(selectedContainer) {
+			fmt.Printf("%s> Continue with the backup? (Y/n): %s", colorBold, colorReset)
+			if !confirmDefaultYes() {
+				logInfo("Backup cancelled.")
+				return
+			}
+		}
+	}
+
+	logInfo("Please choose a backup destination folder.")
+	destDir, err := selectDirectory("Select Backup Folder")
+	if err != nil || destDir == "" {
+		if err != nil {
+			logError(err.Error())
+		}
+		logError("No valid destination directory selected. Aborting.")
+		return
+	}
+
+	defaultBase := templateBaseName(selectedContainer.Name, time.Now())
+	if defaultBase != "" {
+		fmt.Printf("%s> Enter a base name for the backup file [default: %s]: %s", colorBold, defaultBase, colorReset)
+	} else {
+		fmt.Printf("%s> Enter a base name for the backup file (e.g., 'ubuntu-dev'): %s", colorBold, colorReset)
+	}
+	backupNameBase := readUserInput()
+	if backupNameBase == "" {
+		backupNameBase = defaultBase
+	}
+	if backupNameBase == "" {
+		logWarning("Backup name cannot be empty. Aborting.")
+		return
+	}
+	for warnNameCollisions(backupNameBase, destDir) {
+		fmt.Printf("%s> Enter a different base name, or press Enter to keep '%s': %s", colorBold, backupNameBase, colorReset)
+		name := readUserInput()
+		if name == "" {
+			break
+		}
+		backupNameBase = name
+	}
+
+	comp, level, ok := promptCompression()
+	if !ok {
+		logInfo("Backup cancelled.")
+		return
+	}
+	enc, ok := promptEncryption()
+	if !ok {
+		logInfo("Backup cancelled.")
+		return
+	}
+
+	isIsolated, _ := isContainerIsolated(selectedContainer)
+	backupFile, upload, err := backupPath(destDir, backupFileName(backupNameBase, isIsolated, comp, enc.Cipher))
+	if err != nil {
+		logError(err.Error())
+		return
+	}
+	if upload != nil {
+		logInfo(fmt.Sprintf("The backup is written to %s first and uploaded when it is complete.", filepath.Dir(backupFile)))
+	}
+
+	backupMode := 1
+	if isIsolated {
+		if !hasTar {
+			logWarning("The 'tar' command was not found, so the home directory cannot be backed up; only the image will be saved.")
+		} else if enc.Cipher != backup.EncryptNone {
+			logInfo("The home directory is encrypted together with the image in one file.")
+		} else {
+			clearScreen()
+			printTitle(colorGreen, "📦 Backup Options for Isolated Container")
+			logInfo(fmt.Sprintf("Container '%s' is ISOLATED.", selectedContainer.Name))
+			fmt.Printf("\n  %s1)%s %sCombined Backup%s (Recommended)\n", colorGreen, colorReset, colorBold, colorReset)
+			fmt.Printf("     Creates one file with the image and the home directory: %s%s%s\n\n", colorCyan, filepath.Base(backupFile), colorReset)
+			fmt.Printf("  %s2)%s %sSeparated Backup%s\n", colorBlue, colorReset, colorBold, colorReset)
+			fmt.Printf("     Creates two files, one for the image and one for the home directory.\n\n")
+			backupMode = selectItem("Select backup type", 2)
+			if backupMode == 0 {
+				logInfo("Backup cancelled.")
+				return
+			}
+		}
+	}
+
+	job := backupJob{
+		Container:    selectedContainer,
+		File:         backupFile,
+		SeparateHome: isIsolated && backupMode == 2 && hasTar,
+		BundleHome:   isIsolated && backupMode == 1 && hasTar,
+		Compression:  comp,
+		Level:        level,
+		Encryption:   enc,
+		Upload:       upload,
+	}
+	if job.SeparateHome {
+		job.HomeChecksums = cfg.Backup.HomeChecksums
+		if !job.HomeChecksums {
+			fmt.Printf("%s> Record a checksum of every home file to detect corruption later? (y/N): %s", colorBold, colorReset)
+			job.HomeChecksums = confirmAction()
+		}
+	}
+	job.Note = promptBackupNote()
+	for _, file := range job.existingOutputs() {
+		fmt.Printf("%s%s%s", colorYellow, symbols(fmt.Sprintf("⚠️  File '%s' already exists. Overwrite? (y/N): ", file)), colorReset)
+		if !confirmAction() {
+			logInfo("Backup cancelled by user.")
+			return
+		}
+	}
+
+	if _, err := runBackupJob(job); err != nil {
+		logError(err.Error())
+		return
+	}
+	fmt.Println()
+	logSuccess("Backup process finished.")
+}
+
+func handleRestore() {
+	clearScreen()
+	printTitle(colorCyan, "📦 Restore Container")
+
+	src, cleanupSource, err := selectRestoreSource()
+	if err != nil || src.File == "" {
+		if err != nil {
+			logError(err.Error())
+		}
+		logError("No backup file selected. Aborting.")
+		return
+	}
+	defer cleanupSource()
+
+	job, err := prepareRestore(src)
+	if err != nil {
+		logError(err.Error())
+		return
+	}
+	defer func() {
+		if job.Image != "" {
+			removeTempImage(job.Image)
+		}
+	}()
+
+	fmt.Printf("%s> Is this backup from an untrusted source? Restore it into a locked-down sandbox to inspect it (y/N): %s", colorBold, colorReset)
+	job.Sandbox = confirmAction()
+
+	defaultName := defaultRestoreName(job)
+	if job.Sandbox {
+		defaultName += "-sandbox"
+	}
+	containers, _ := getContainers()
+	if _, taken := findContainer(containers, defaultName); taken {
+		logInfo(fmt.Sprintf("A container named '%s' already exists; enter its name to replace it.", defaultName))
+		defaultName += "-restored"
+	}
+	var replacing *Container
+	for {
+		job.Name = promptContainerName(defaultName)
+		if job.Name == "" {
+			logWarning("Container name cannot be empty. Aborting.")
+			return
+		}
+		existing, taken := findContainer(containers, job.Name)
+		if !taken {
+			break
+		}
+		if job.Sandbox {
+			logWarning(fmt.Sprintf("'%s' already exists; a sandbox never replaces a container.", job.Name))
+			continue
+		}
+		fmt.Printf("%s> '%s' already exists. Replace it? It is kept until the new one passes a smoke test. (y/N): %s", colorRed, job.Name, colorReset)
+		if confirmAction() {
+			replacing = &existing
+			break
+		}
+	}
+
+	if job.Sandbox {
+		job.Isolated = true
+	} else {
+		if job.Isolated {
+			fmt.Printf("%s> Restore as an ISOLATED container with its own home? (Y/n): %s", colorBold, colorReset)
+			job.Isolated = confirmDefaultYes()
+			if !job.Isolated && (job.HomeArchive != "" || job.HomeBundled) {
+				logWarning("The home directory in the backup will not be restored.")
+			}
+		} else {
+			fmt.Printf("%s> Restore as an ISOLATED container with its own home? (y/N): %s", colorBold, colorReset)
+			job.Isolated = confirmAction()
+		}
+
+		// The backed-up container's settings are the defaults.
+		if job.Manifest != nil && job.Manifest.Init {
+			fmt.Printf("\n%s> Enable systemd (init) for this container? The original had it. (Y/n): %s", colorBold, colorReset)
+			job.Init = confirmDefaultYes()
+		} else {
+			fmt.Printf("\n%s> Enable systemd (init) for this container? (y/N): %s", colorBold, colorReset)
+			job.Init = confirmAction()
+		}
+
+		// --- NEW ---
+		if job.Manifest != nil && job.Manifest.Nvidia {
+			fmt.Printf("%s> Attempt NVIDIA GPU integration? The original had it. (Requires host drivers) (Y/n): %s", colorBold, colorReset)
+			job.Nvidia = confirmDefaultYes()
+		} else {
+			fmt.Printf("%s> Attempt NVIDIA GPU integration? (Requires host drivers) (y/N): %s", colorBold, colorReset)
+			job.Nvidia = confirmAction()
+		}
+		// --- END NEW ---
+	}
+
+	if replacing != nil {
+		err = restoreReplacing(job, *replacing)
+		job.Image = ""
+		if err != nil {
+			logError(err.Error())
+		}
+		return
+	}
+
+	err = runRestoreJob(job)
+	// From here on the image belongs to the new container, or is kept on
+	// purpose for recovery.
+	job.Image = ""
+	if err != nil {
+		var recovery *recoveryError
+		if errors.As(err, &recovery) {
+			offerRecovery("Restore", recovery)
+		} else {
+			logError(err.Error())
+		}
+		return
+	}
+	if !job.Sandbox {
+		maybeSmokeTest(job.Name)
+	}
+}
+
+func handleClone(containers []Container) {
+	clearScreen()
+	printTitle(colorCyan, "🧬 Clone Container")
+	fmt.Printf("%s%sHint:%s Cloning creates an exact copy of a container with a new name.\n\n", colorYellow, colorUnderline, colorReset)
+
+	containerIndex := selectContainer("the container to clone", containers)
+	if containerIndex == 0 {
+		return
+	}
+	sourceContainer := containers[containerIndex-1]
+	defer routeTo(sourceContainer)()
+
+	logWarning("Please ensure you have enough free space in your container storage.")
+
+	var cloneName string
+	for {
+		fmt.Printf("%s> Enter a name for the new cloned container: %s", colorBold, colorReset)
+		cloneName = readUserInput()
+		if cloneName == "" {
+			logWarning("Clone name cannot be empty.")
+			continue
+		}
+		if cloneName == sourceContainer.Name {
+			logWarning("The clone's name cannot be the same as the source.")
+			continue
+		}
+		nameExists := false
+		for _, c := range containers {
+			if c.Name == cloneName {
+				nameExists = true
+				break
+			}
+		}
+		if nameExists {
+			logWarning(fmt.Sprintf("A container named '%s' already exists.", cloneName))
+			continue
+		}
+		break
+	}
+
+	isIsolated, sourceHome := isContainerIsolated(sourceContainer)
+	copyHome, cloneHome := false, ""
+	if isIsolated {
+		fmt.Printf("%s> Copy the home directory to the clone? Otherwise it starts with an empty one. (Y/n): %s", colorBold, colorReset)
+		copyHome = confirmDefaultYes()
+		cloneHome = promptIsolatedHome(cloneName)
+	}
+
+	logInfo(fmt.Sprintf("Cloning '%s' to '%s'...", sourceContainer.Name, cloneName))
+	if isIsolated {
+		logInfo("Source is an ISOLATED container. The clone will also be isolated.")
+	} else {
+		logInfo("Source is a STANDARD container. The clone will also be standard.")
+	}
+
+	done := make(chan bool)
+	go showSpinner("clone", "Cloning in progress...", done)
+
+	tempImageName := newTempImageName("clone", sourceContainer)
+	err := client.Commit(sourceContainer.Name, tempImageName)
+	if err != nil {
+		done <- true
+		releaseTempImage(tempImageName)
+		logError("Failed to create temporary image from source container.")
+		logError(err.Error())
+		return
+	}
+
+	defer func() {
+		if tempImageName != "" {
+			removeTempImage(tempImageName)
+		}
+	}()
+
+	done <- true
+
+	createOpts := containerCreateOptions(sourceContainer.Name)
+	createOpts.Name, createOpts.Image = cloneName, tempImageName
+	if isIsolated {
+		createOpts.Home = cloneHome
+		if copyHome && createOpts.Home != "" {
+			if err := copyIsolatedHome(sourceHome, createOpts.Home); err != nil {
+				logError(fmt.Sprintf("Could not copy the home directory: %v", err))
+				return
+			}
+		}
+	}
+	err = client.CreateFromImage(createOpts)
+
+	if err != nil {
+		offerRecovery("Clone", &recoveryError{
+			Err:       fmt.Errorf("failed to create the cloned container '%s': %w", cloneName, err),
+			Image:     tempImageName,
+			Temporary: true,
+			Recreate:  createOpts,
+		})
+		tempImageName = "" // handled by the recovery screen
+		return
+	}
+
+	logSuccess(fmt.Sprintf("✅ Container '%s' successfully cloned to '%s'!", sourceContainer.Name, cloneName))
+	releaseTempImage(tempImageName) // now the clone's image
+	tempImageName = ""
+}
+
+// handleEdit converts a container between the home types or renames it.
+func handleEdit(containers []Container) {
+	clearScreen()
+	printTitle(colorMagenta, "🔧 Edit Container")
+	containerIndex := selectContainer("the container to edit", containers)
+	if containerIndex == 0 {
+		return
+	}
+	selectedContainer := containers[containerIndex-1]
+	defer routeTo(selectedContainer)()
+	isIsolated, isolatedHomePath := isContainerIsolated(selectedContainer)
+
+	clearScreen()
+	printTitle(colorMagenta, fmt.Sprintf("🔧 Editing '%s'", selectedContainer.Name))
+	fmt.Printf("  %sCurrent State:%s\n", colorBold, colorReset)
+	var currentType, targetType string
+	if isIsolated {
+		currentType = "Isolated"
+		targetType = "Standard"
+		fmt.Printf("  - Type: %s%s%s\n", colorBlue, currentType, colorReset)
+		fmt.Printf("  - Home: %s\n\n", isolatedHomePath)
+	} else {
+		currentType = "Standard"
+		targetType = "Isolated"
+		fmt.Printf("  - Type: %s%s%s\n\n", colorGreen, currentType, colorReset)
+	}
+
+	if selectedContainer.Manager == backup.ManagerToolbox {
+		logInfo("toolbx containers always share your home, so they can only be renamed.")
+		fmt.Printf("%s> Rename '%s'? (y/N): %s", colorBold, selectedContainer.Name, colorReset)
+		if confirmAction() {
+			handleRename(selectedContainer)
+		}
+		return
+	}
+	fmt.Printf("  %s1)%s Convert to %s\n", colorGreen, colorReset, targetType)
+	fmt.Printf("  %s2)%s Rename\n\n", colorCyan, colorReset)
+	switch selectItem("Select an action", 2) {
+	case 0:
+		return
+	case 2:
+		handleRename(selectedContainer)
+		return
+	}
+
+	createOpts := containerCreateOptions(selectedContainer.Name)
+	createOpts.Name = selectedContainer.Name
+	if !isIsolated { // Converting to Isolated
+		createOpts.Home = promptIsolatedHome(selectedContainer.Name)
+	}
+	// The real tag is generated (and journaled) only once the plan is accepted.
+	createOpts.Image = fmt.Sprintf("distrobox-convert-%s:<uuid>", selectedContainer.ID)
+	printConversionPlan(selectedContainer, !isIsolated, isolatedHomePath, createOpts)
+
+	if isIsolated {
+		fmt.Printf("%s> Convert '%s' to %s following this plan? Its isolated home will be PERMANENTLY DELETED. (y/N): %s", colorRed, selectedContainer.Name, targetType, colorReset)
+	} else {
+		fmt.Printf("%s> Convert '%s' to %s following this plan? (y/N): %s", colorBold, selectedContainer.Name, targetType, colorReset)
+	}
+	if !confirmAction() {
+		logInfo("Edit cancelled.")
+		return
+	}
+
+	if !safetyBackup(selectedContainer, "conversion") {
+		logInfo("Edit cancelled.")
+		return
+	}
+
+	if err := convertContainer(selectedContainer, createOpts, isolatedHomePath); err != nil {
+		var recovery *recoveryError
+		if errors.As(err, &recovery) {
+			offerRecovery("Conversion", recovery)
+		} else {
+			logError(err.Error())
+		}
+		return
+	}
+	logSuccess(fmt.Sprintf("✅ Container '%s' successfully converted to %s!", selectedContainer.Name, targetType))
+}
+
+func handleRename(container Container) {
+	var newName string
+	for {
+		fmt.Printf("%s> Enter the new name for '%s': %s", colorBold, container.Name, colorReset)
+		newName = readUserInput()
+		if newName == "" {
+			logInfo("Rename cancelled.")
+			return
+		}
+		if err := checkRenameTarget(container, newName); err != nil {
+			logWarning(err.Error())
+			continue
+		}
+		break
+	}
+	if newHome := renamedHome(container, newName); newHome != "" {
+		if _, home := isContainerIsolated(container); newHome != home {
+			logInfo(fmt.Sprintf("The home directory moves from %s to %s.", home, newHome))
+		}
+	}
+	fmt.Printf("%s> Recreate '%s' as '%s'? (y/N): %s", colorBold, container.Name, newName, colorReset)
+	if !confirmAction() {
+		logInfo("Rename cancelled.")
+		return
+	}
+	if !safetyBackup(container, "rename") {
+		logInfo("Rename cancelled.")
+		return
+	}
+	if err := renameContainer(container, newName); err != nil {
+		var recovery *recoveryError
+		if errors.As(err, &recovery) {
+			offerRecovery("Rename", recovery)
+		} else {
+			logError(err.Error())
+		}
+		return
+	}
+	logSuccess(fmt.Sprintf("✅ Container '%s' was renamed to '%s'.", container.Name, newName))
+}
+
+// convertContainer recreates a container from a commit of itself with
+// createOpts, which decide its new home type. oldHome, when set, is the
+// isolated home deleted once the new container exists. If the new container
+// cannot be created, the old one is recreated with its original settings;
+// only if that fails too does a *recoveryError describe how to do it.
+func convertContainer(container Container, createOpts backup.CreateOptions, oldHome string) (err error) {
+	defer func(start time.Time) {
+		target := backup.IsolationStandard
+		if createOpts.Home != "" {
+			target = backup.IsolationIsolated
+		}
+		recordOperationResult("convert", container.Name, "to "+target, start, err)
+	}(time.Now())
+	defer inhibitSleep(fmt.Sprintf("Converting %s", container.Name))()
+	// A new isolated home is only removed on rollback if this made it.
+	_, statErr := os.Stat(createOpts.Home)
+	newHomeCreated := createOpts.Home != "" && os.IsNotExist(statErr)
+	done := make(chan bool)
+	go showSpinner("recreate", "Recreating container...", done)
+	restart := restartOnInterrupt(container)
+	defer restart()
+	runCommand(containerRuntime, "stop", container.Name)
+	tempImageName := newTempImageName("convert", container)
+	createOpts.Image = tempImageName
+
+	err = client.Commit(container.Name, tempImageName)
+	if err != nil {
+		done <- true
+		releaseTempImage(tempImageName)
+		return fmt.Errorf("failed to commit container to a temporary image: %w", err)
+	}
+
+	defer func() {
+		if tempImageName != "" {
+			removeTempImage(tempImageName)
+		}
+	}()
+
+	// distrobox-rm deletes the container's exports; they are made again
+	// from the new container.
+	exports := &backup.Manifest{Exports: containerExports(container.Name)}
+	err = client.RemoveContainer(container.Name)
+	if err != nil {
+		done <- true
+		return fmt.Errorf("failed to remove the old container, you may need to clean up manually: %w", err)
+	}
+	restart()
+	defer keepOnInterrupt(tempImageName, container.Name)()
+
+	err = client.CreateFromImage(createOpts)
+	if err != nil {
+		done <- true
+		// Recreating the old container means getting its old home back.
+		recreate := createOpts
+		recreate.Home = oldHome
+		logWarning(fmt.Sprintf("Creating the converted container failed; rolling back to the original '%s'...", container.Name))
+		rollbackErr := rollBack(container, createOpts.Name, recreate, exports)
+		if rollbackErr == nil {
+			if newHomeCreated {
+				os.RemoveAll(createOpts.Home)
+			}
+			releaseTempImage(tempImageName) // now the original container's image
+			tempImageName = ""
+			return fmt.Errorf("failed to create the new container, so '%s' was recreated unchanged: %w", container.Name, err)
+		}
+		recovery := &recoveryError{
+			Err:       fmt.Errorf("failed to create the new container: %w; rolling back failed: %v", err, rollbackErr),
+			Image:     tempImageName,
+			Temporary: true,
+			Recreate:  recreate,
+			Removed:   true,
+		}
+		tempImageName = ""
+		return recovery
+	}
+
+	if oldHome != "" { // If the original was isolated, delete its old home folder after conversion.
+		os.RemoveAll(oldHome)
+	}
+
+	done <- true
+	releaseTempImage(tempImageName) // now the converted container's image
+	tempImageName = ""
+	reexport(container.Name, exports)
+	return nil
+}
+
+func handleDelete(containers []Container) {
+	clearScreen()
+	printTitle(colorRed, "🗑️ Delete Container")
+	fmt.Printf("%s%sHint:%s This action is irreversible. Be absolutely sure.\n\n", colorYellow, colorUnderline, colorReset)
+	selected := selectContainers("the containers to DELETE", containers)
+	if len(selected) == 0 {
+		return
+	}
+	if len(selected) > 1 {
+		var names []string
+		for _, c := range selected {
+			names = append(names, c.Name)
+		}
+		logWarning(fmt.Sprintf("You are about to permanently delete %d containers: %s.", len(selected), strings.Join(names, ", ")))
+		fmt.Printf("%sThis cannot be undone. Are you sure? (y/N): %s", colorRed, colorReset)
+		if !confirmAction() {
+			logInfo("Deletion cancelled by user.")
+			return
+		}
+		deleteContainers(selected)
+		return
+	}
+	selectedContainer := selected[0]
+	logWarning(fmt.Sprintf("You are about to permanently delete the container '%s'.", selectedContainer.Name))
+	fmt.Printf("%sThis cannot be undone. Are you sure? (y/N): %s", colorRed, colorReset)
+	if !confirmAction() {
+		logInfo("Deletion cancelled by user.")
+		return
+	}
+	done := make(chan bool)
+	go showSpinner("delete", "Deleting...", done)
+	err := deleteContainer(selectedContainer)
+	done <- true
+	if err != nil {
+		logError(fmt.Sprintf("Failed to delete container '%s'.", selectedContainer.Name))
+		logError(err.Error())
+		return
+	}
+	logSuccess(fmt.Sprintf("🗑️ Container '%s' has been deleted.", selectedContainer.Name))
+}
+
+func handleHealthCheck(containers []Container) {
+	clearScreen()
+	printTitle(colorGreen, "🩺 Health Check")
+	fmt.Printf("%s%sHint:%s This tests if a container can be entered to run a simple command.\n\n", colorYellow, colorUnderline, colorReset)
+
+	for _, c := range selectContainers("the containers to check", containers) {
+		checkHealth(c)
+	}
+}
+
+// checkHealth enters a container to run a simple command and reports
+// whether that worked.
+func checkHealth(selectedContainer Container) {
+	defer routeTo(selectedContainer)()
+	logInfo(fmt.Sprintf("Performing health check on '%s'...", selectedContainer.Name))
+	done := make(chan bool)
+	go showSpinner("health-check", "Checking...", done)
+
+	output, err := runCommand("distrobox-enter", selectedContainer.Name, "--", "whoami")
+	done <- true
+
+	if err != nil {
+		logError(fmt.Sprintf("Health check for '%s' FAILED.", selectedContainer.Name))
+		logError("The container might be stopped, corrupted, or have configuration issues.")
+		fmt.Println()
+		logInfo("Full error details:")
+		fmt.Println(output)
+		return
+	}
+
+	logSuccess(fmt.Sprintf("✅ Health check for '%s' PASSED. The container is responsive.", selectedContainer.Name))
+}
+
+// --- UI & Display Functions ---
+
+func printHeader() {
+	fmt.Printf("%s%sDistrobox Management Tool%s\n", colorBold, colorMagenta, colorReset)
+	runtime := containerRuntime
+	if rootMode {
+		runtime += fmt.Sprintf(" %s(rootful by default)%s", colorRed, colorReset)
+	}
+	if podmanConnection != "" {
+		runtime += fmt.Sprintf(" %svia %s%s", colorYellow, podmanConnection, colorReset)
+	}
+	if hostSpawn != nil {
+		runtime += fmt.Sprintf(" (on the host through %s)", hostSpawn[0])
+	}
+	fmt.Printf("Distrobox v%s | Host OS: %s | Runtime: %s\n\n", distroboxVersion, hostDistroName, runtime)
+}
+
+func displayMenu(containers []Container) {
+	clearScreen()
+	printHeader()
+	fmt.Printf("%s=== Your Distrobox Containers ======================================%s\n", colorBlue, colorReset)
+	if len(containers) == 0 {
+		fmt.Printf("  %sNo Distrobox containers found.%s\n", colorYellow, colorReset)
+		if !rootMode {
+			fmt.Printf("  Containers created with --root are shown with -root.\n")
+		}
+	} else {
+		printContainerList(containers)
+	}
+	fmt.Printf("%s====================================================================%s\n", colorBlue, colorReset)
+	if summary := queueSummary(); summary != "" {
+		fmt.Printf("  %s%s%s (menu 22)\n", colorCyan, summary, colorReset)
+	}
+	if !tuiEnabled() {
+		printMenuEntries()
+	}
+	fmt.Println()
+}
+
+func printContainerList(containers []Container) {
+	for i, c := range containers {
+		isIsolated, _ := isContainerIsolated(c)
+		typeColor := colorGreen
+		typeText := "Standard"
+		if isIsolated {
+			typeColor = colorBlue
+			typeText = "Isolated"
+		}
+
+		rootful := ""
+		if c.Manager == backup.ManagerToolbox {
+			rootful = fmt.Sprintf(" %s[toolbx]%s", colorMagenta, colorReset)
+		}
+		if c.Rootful {
+			rootful += fmt.Sprintf(" %s[root]%s", colorRed, colorReset)
+		}
+		fmt.Printf("  %s%d.%s %-25s %s%-10s%s %s%s\n",
+			colorBold, i+1, colorReset,
+			c.Name,
+			typeColor, typeText, colorReset,
+			distroString(c.Distro, c.DistroVersion), rootful,
+		)
+	}
+}
+
+func showSpinner(stage, message string, done chan bool) {
+	if jsonProgress() {
+		emitProgress(progressEvent{Stage: stage, Event: "start", Percent: -1, Message: message})
+		<-done
+		emitProgress(progressEvent{Stage: stage, Event: "done", Percent: 100, Message: message})
+		return
+	}
+	message = symbols(message)
+	spinner := []string{"|", "/", "-", "\\"}
+	i := 0
+	for {
+		select {
+		case <-done:
+			fmt.Printf("\r%s... Done!              \n", message)
+			return
+		default:
+			fmt.Printf("\r%s %s ", message, spinner[i])
+			i = (i + 1) % len(spinner)
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
+
+// --- Helper & Utility Functions ---
+
+func checkDependencies() {
+	detectHostSpawn()
+	if !commandExists("distrobox") {
+		logError("FATAL: 'distrobox' command not found. Please install it first.")
+		os.Exit(1)
+	}
+	loadDistroboxConfig()
+	runtime, err := detectRuntime()
+	if err != nil {
+		logError(fmt.Sprintf("FATAL: %v.", err))
+		os.Exit(1)
+	}
+	containerRuntime = runtime
+	if name := connectionFlag; name != "" || cfg.Podman.Connection != "" {
+		if name == "" {
+			name = cfg.Podman.Connection
+		}
+		if err := enableConnection(name); err != nil {
+			logError(fmt.Sprintf("FATAL: %v.", err))
+			os.Exit(1)
+		}
+	}
+	if err := setUpRootful(); err != nil {
+		logError(fmt.Sprintf("FATAL: %v.", err))
+		os.Exit(1)
+	}
+	client = backup.New(containerRuntime)
+	client.Run = commandRunner
+	client.Trace = logCommandRecord
+	hasTar = commandExists("tar")
+
+	output, err := runCommand("distrobox", "--version")
+	if err == nil {
+		parts := strings.Split(output, ":")
+		if len(parts) > 1 {
+			distroboxVersion = strings.TrimSpace(parts[1])
+		} else {
+			distroboxVersion = strings.TrimSpace(output)
+		}
+	} else {
+		distroboxVersion = "Unknown"
+	}
+
+	content, err := os.ReadFile("/etc/os-release")
+	if err == nil {
+		re := regexp.MustCompile(`(?m)^PRETTY_NAME="?([^"\n]+)"?`)
+		matches := re.FindStringSubmatch(string(content))
+		if len(matches) > 1 {
+			hostDistroName = matches[1]
+		}
+	} else {
+		hostDistroName = "Unknown"
+	}
+
+	if podmanConnection != "" {
+		// The storage is on the other machine; its free space is unknown.
+		containerStoragePath = ""
+		return
+	}
+	path, err := getContainerStoragePath()
+	if err != nil {
+		logError("Could not determine container storage path. Space checking will be disabled.")
+		containerStoragePath = "/"
+	} else {
+		containerStoragePath = path
+	}
+}
+
+// listDistroboxIDs returns the IDs of the runtime's containers labeled as
+// made by distrobox. Podman prints the JSON as one array, docker as one
+// object per line; {{json .}} is used for docker as older versions do not
+// know --format json.
+func listDistroboxIDs(run backup.Runner) ([]string, error) {
+	format := "json"
+	if containerRuntime == "docker" {
+		format = "{{json .}}"
+	}
+	filters := []string{"label=manager=distrobox"}
+	if commandExists("toolbox") {
+		for _, l := range toolboxLabels {
+			filters = append(filters, "label="+l+"=true")
+		}
+	}
+	var ids []string
+	seen := map[string]bool{}
+	for _, filter := range filters {
+		found, err := listContainerIDs(run, filter, format)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range found {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// listContainerIDs returns the IDs of the runtime's containers matching a
+// ps filter, asking for the JSON format.
+func listContainerIDs(run backup.Runner, filter, format string) ([]string, error) {
+	out, err := runCommandWith(run, containerRuntime, "ps", "-a", "--no-trunc", "--filter", filter, "--format", format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	type psEntry struct {
+		ID string `json:"Id"` // "ID" in docker's output
+	}
+	var ids []string
+	dec := json.NewDecoder(strings.NewReader(out))
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse the container list: %w", err)
+		}
+		var entries []psEntry
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			err = json.Unmarshal(raw, &entries)
+		} else {
+			entries = make([]psEntry, 1)
+			err = json.Unmarshal(raw, &entries[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the container list: %w", err)
+		}
+		for _, e := range entries {
+			if e.ID != "" {
+				ids = append(ids, e.ID)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// getContainers lists the distroboxes of the default storage and, with
+// -root, those of the other one after them. A storage other than the
+// default that cannot be listed, as when sudo's cached credentials expired,
+// is left out. The storages are listed through their own runners, so that
+// listing never switches the storage of an operation running at the same
+// time.
+func getContainers() ([]Container, error) {
+	containers, err := inspectContainers(commandRunner, rootfulActive)
+	run, rootful := otherStorage()
+	if err != nil || run == nil {
+		return containers, err
+	}
+	if other, err := inspectContainers(run, rootful); err == nil {
+		containers = append(containers, other...)
+	}
+	return containers, nil
+}
+
+// inspectContainers lists the distroboxes of the storage run goes to,
+// marking them rootful as given.
+func inspectContainers(run backup.Runner, rootful bool) ([]Container, error) {
+	ids, err := listDistroboxIDs(run)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []Container{}, nil
+	}
+
+	args := append([]string{"inspect"}, ids...)
+	inspectOut, err := runCommandWith(run, containerRuntime, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect containers: %w. This can happen if a container is in an error state", err)
+	}
+
+	var inspectResults []inspectData
+	if err := json.Unmarshal([]byte(inspectOut), &inspectResults); err != nil {
+		return nil, fmt.Errorf("failed to parse container inspect data: %w", err)
+	}
+
+	var containers []Container
+	for _, data := range inspectResults {
+		containerName := data.Config.Labels["distrobox.name"]
+		if containerName == "" {
+			containerName = strings.TrimPrefix(data.Name, "/")
+		}
+
+		distro, version := distroFromLabels(data.Config.Labels, data.Config.Image)
+		home := envValue(data.Config.Env, "HOME")
+		homeSource := ""
+		for _, m := range data.Mounts {
+			if home != "" && filepath.Clean(m.Destination) == filepath.Clean(home) {
+				homeSource = m.Source
+			}
+		}
+		containers = append(containers, Container{
+			ID:            data.ID[:12],
+			Name:          containerName,
+			Image:         data.Config.Image,
+			Distro:        distro,
+			DistroVersion: version,
+			Manager:       containerManager(data.Config.Labels),
+			Home:          home,
+			HomeSource:    homeSource,
+			State:         data.State.Status,
+			Created:       data.Created,
+			ImageID:       strings.TrimPrefix(data.Image, "sha256:"),
+			Rootful:       rootful,
+		})
+	}
+	return containers, nil
+}
+
+// getIsolatedHomePath returns where a new isolated home for containerName
+// is created by default, under distroboxHomeRoot.
+func getIsolatedHomePath(containerName string) (string, error) {
+	root, err := distroboxHomeRoot()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, containerName), nil
+}
+
+// promptIsolatedHome asks where a new isolated home for containerName goes.
+// The folder may be anywhere, also on another filesystem, but a folder the
+// user names must be missing or empty.
+func promptIsolatedHome(containerName string) string {
+	home, _ := getIsolatedHomePath(containerName)
+	for {
+		fmt.Printf("%s> Folder for the isolated home (default '%s'): %s", colorBold, home, colorReset)
+		answer := readUserInput()
+		if answer == "" {
+			return home
+		}
+		chosen := filepath.Clean(expandHome(answer))
+		if err := checkHomeTarget(chosen); err != nil {
+			logWarning(err.Error())
+			continue
+		}
+		return chosen
+	}
+}
+
+// isContainerIsolated reports whether a container has its own home and where
+// it is on the host, from the container's inspect data alone: distrobox
+// gives an isolated container a HOME other than the host user's and bind
+// mounts it from the host, so the mount's source is the home's host path,
+// wherever --home put it. A folder in the default location says nothing; it
+// may be left over from an earlier container of the same name.
+func isContainerIsolated(c Container) (bool, string) {
+	hostHome, err := os.UserHomeDir()
+	if c.Home == "" || err != nil || filepath.Clean(c.Home) == filepath.Clean(hostHome) {
+		return false, ""
+	}
+	if c.HomeSource != "" {
+		return true, c.HomeSource
+	}
+	// Without the mount in the inspect data, rely on distrobox mounting
+	// homes at the same path.
+	if _, err := os.Stat(c.Home); err == nil {
+		return true, c.Home
+	}
+	return false, ""
+}
+
+// envValue returns the value of key in a KEY=value environment list.
+func envValue(env []string, key string) string {
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+// selectDirectory asks for a local folder or, for backups, a remote target
+// such as user@host:/path. Configured SSH destinations are offered first;
+// remote targets are tested before they are returned.
+func selectDirectory(title string) (string, error) {
+	if names, targets := remoteDestinations(); len(names) > 0 {
+		fmt.Printf("  %s1)%s Local folder\n", colorGreen, colorReset)
+		for i, name := range names {
+			fmt.Printf("  %s%d)%s %s (%s)\n", colorCyan, i+2, colorReset, name, targets[name])
+		}
+		switch choice := selectItem(title, len(names)+1); choice {
+		case 0:
+			return "", nil
+		case 1:
+		default:
+			t := targets[names[choice-2]]
+			return t.String(), checkRemoteDestination(t)
+		}
+	}
+	if guiFilePicker != "" {
+		var cmd *exec.Cmd
+		if guiFilePicker == "zenity" {
+			cmd = exec.Command("zenity", "--file-selection", "--directory", "--title="+title)
+		} else {
+			cmd = exec.Command("kdialog", "--getexistingdirectory", ".", "--title", title)
+		}
+		if path, ok := runPicker(cmd, "folder"); ok {
+			return path, nil
+		}
+	}
+	fmt.Printf("%s> Enter the full path to the destination directory (or user@host:/path): %s", colorBold, colorReset)
+	path := readUserInput()
+	if path == "" {
+		return "", nil
+	}
+	if t, ok := parseRemote(path); ok && !fileExists(path) {
+		return t.String(), checkRemoteDestination(t)
+	}
+	if strings.HasPrefix(path, "~/") {
+		homeDir, _ := os.UserHomeDir()
+		path = filepath.Join(homeDir, path[2:])
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("invalid or non-existent directory")
+	}
+	return path, nil
+}
+
+func selectFile(title string, filters ...string) (string, error) {
+	if guiFilePicker != "" {
+		var cmd *exec.Cmd
+		if guiFilePicker == "zenity" {
+			filterString := fmt.Sprintf("Distrobox Backups | %s", strings.Join(filters, " "))
+			args := []string{
+				"--file-selection", "--title=" + title, "--file-filter=" + filterString,
+				"--file-filter=All files | *",
+			}
+			cmd = exec.Command("zenity", args...)
+		} else {
+			kdialogFilter := fmt.Sprintf("%s|Distrobox Backups\n*|All files", strings.Join(filters, " "))
+			cmd = exec.Command("kdialog", "--getopenfilename", ".", kdialogFilter, "--title", title)
+		}
+		if path, ok := runPicker(cmd, "file"); ok {
+			return path, nil
+		}
+	}
+	fmt.Printf("%s> Enter the full path to the backup file, or a folder to list its backups: %s", colorBold, colorReset)
+	path := readUserInput()
+	if path == "" {
+		return "", nil
+	}
+	if strings.HasPrefix(path, "~/") {
+		homeDir, _ := os.UserHomeDir()
+		path = filepath.Join(homeDir, path[2:])
+	}
+	info, err := os.Stat(path)
+	if _, _, remote := remoteFile(path); err != nil && remote {
+		return path, nil // fetched by callers that accept remote files
+	}
+	if err != nil {
+		return "", fmt.Errorf("file not found")
+	}
+	if info.IsDir() {
+		return selectFileInDirectory(path, filters)
+	}
+	return path, nil
+}
+
+// selectFileInDirectory lists the files of dir matching filters, newest
+// first, and lets the user pick one.
+func selectFileInDirectory(dir string, filters []string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	type candidate struct {
+		name string
+		info os.FileInfo
+	}
+	var files []candidate
+	for _, e := range entries {
+		if e.IsDir() || !isBackupArchiveName(e.Name()) || (len(filters) > 0 && !matchesFilters(e.Name(), filters)) {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			files = append(files, candidate{e.Name(), info})
+		}
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no backups found in %s", dir)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].info.ModTime().After(files[j].info.ModTime()) })
+	rows := make([]string, len(files))
+	names := make([]string, len(files))
+	for i, f := range files {
+		rows[i] = fmt.Sprintf("%-50s %10s  %s", f.name, formatBytes(uint64(f.info.Size())), f.info.ModTime().Format("2006-01-02 15:04"))
+		names[i] = f.name
+	}
+	choice := chooseItems("the backup", rows, names, false, func() {
+		for i, row := range rows {
+			fmt.Printf("  %s%d.%s %s\n", colorBold, i+1, colorReset, row)
+		}
+	})
+	if len(choice) == 0 {
+		return "", nil
+	}
+	return filepath.Join(dir, files[choice[0]-1].name), nil
+}
+
+func selectItem(prompt string, max int) int {
+	for {
+		fmt.Printf("%s> %s (1-%d): %s", colorBold, prompt, max, colorReset)
+		input := readUserInput()
+		if input == "" {
+			return 0
+		}
+		choice, err := strconv.Atoi(input)
+		if err == nil && choice > 0 && choice <= max {
+			return choice
+		}
+		logWarning("Invalid input. Please enter a valid number.")
+	}
+}
+
+func getContainerStoragePath() (string, error) {
+	var format string
+	if containerRuntime == "docker" {
+		format = "{{.DockerRootDir}}"
+	} else {
+		format = "{{.Store.GraphRoot}}"
+	}
+	out, err := runCommand(containerRuntime, "info", "--format", format)
+	if err != nil {
+		return "", fmt.Errorf("could not get storage path from '%s info': %w", containerRuntime, err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func getFreeDiskSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	for {
+		err := syscall.Statfs(path, &stat)
+		if err == nil {
+			break
+		}
+		if os.IsNotExist(err) {
+			path = filepath.Dir(path)
+			if path == "." || path == "/" {
+				return 0, err
+			}
+			continue
+		}
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
+
+func formatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// --- STANDARD UTILITY FUNCTIONS ---
+
+func runCommand(name string, args ...string) (string, error) {
+	return runCommandWith(commandRunner, name, args...)
+}
+
+// runCommandWith is runCommand with the command built by run.
+func runCommandWith(run backup.Runner, name string, args ...string) (string, error) {
+	cmd := run(name, args...)
+	start := time.Now()
+	output, err := cmd.CombinedOutput()
+	logCommandRecord(name, args, time.Since(start), err)
+	if err != nil {
+		return string(output), fmt.Errorf("command '%s %s' failed: %w", name, strings.Join(args, " "), err)
+	}
+	return string(output), nil
+}
+
+func readUserInput() string {
+	if headless {
+		fmt.Println()
+		return ""
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	return strings.TrimSpace(scanner.Text())
+}
+
+func confirmAction() bool {
+	if assumeYes {
+		fmt.Println("y")
+		return true
+	}
+	return strings.ToLower(readUserInput()) == "y"
+}
+
+func commandExists(cmd string) bool {
+	if hostSpawn != nil {
+		return hostCommandExists(cmd)
+	}
+	_, err := exec.LookPath(cmd)
+	return err == nil
+}
+
+func clearScreen() {
+	if jsonProgress() {
+		return
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/c", "cls")
+	} else {
+		cmd = exec.Command("clear")
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Run()
+}
+
+func logError(msg string) {
+	logMessageRecord("error", msg)
+	if !forwardLog("error", msg) {
+		return
+	}
+	if jsonProgress() {
+		emitLogEvent("error", msg)
+		return
+	}
+	fmt.Printf("%s%s%s%s\n", colorBold, colorRed, symbols("❌ ERROR: "+msg), colorReset)
+}
+
+func logWarning(msg string) {
+	logMessageRecord("warning", msg)
+	if !forwardLog("warning", msg) {
+		return
+	}
+	if jsonProgress() {
+		emitLogEvent("warning", msg)
+		return
+	}
+	fmt.Printf("%s%s%s%s\n", colorBold, colorYellow, symbols("⚠️  WARN: "+msg), colorReset)
+}
+
+func logInfo(msg string) {
+	logMessageRecord("info", msg)
+	if !forwardLog("info", msg) {
+		return
+	}
+	if jsonProgress() {
+		emitLogEvent("info", msg)
+		return
+	}
+	fmt.Printf("%s%s%s%s\n", colorBold, colorCyan, symbols("ℹ️  INFO: "+msg), colorReset)
+}
+
+func logSuccess(msg string) {
+	logMessageRecord("success", msg)
+	if !forwardLog("success", msg) {
+		return
+	}
+	if jsonProgress() {
+		emitLogEvent("success", msg)
+		return
+	}
+	fmt.Printf("%s%s%s%s\n", colorBold, colorGreen, strings.TrimSpace(symbols(msg)), colorReset)
+}
@@ -0,0 +1,136 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// newManifest describes a backup of container taken now.
+func newManifest(container Container, isolated bool, homePath string) *backup.Manifest {
+	m := &backup.Manifest{
+		Version:          backup.ManifestVersion,
+		ContainerName:    container.Name,
+		Image:            container.Image,
+		Distro:           container.Distro,
+		DistroVersion:    container.DistroVersion,
+		DistroboxVersion: distroboxVersion,
+		Runtime:          containerRuntime,
+		Isolation:        backup.IsolationStandard,
+		HostDistro:       hostDistroName,
+		CreatedAt:        time.Now().UTC(),
+	}
+	if container.Manager == backup.ManagerToolbox {
+		// toolbx sets everything up by itself and has no exports.
+		m.Manager = backup.ManagerToolbox
+	} else {
+		opts := containerCreateOptions(container.Name)
+		m.Unshare, m.Init, m.Nvidia = opts.Unshare, opts.Init, opts.Nvidia
+		if !opts.Extra.IsZero() {
+			m.Extra = &opts.Extra
+		}
+		m.Exports = containerExports(container.Name)
+	}
+	if container.ImageID != "" {
+		if p, err := client.ImageProvenance(container.Image, container.ImageID); err == nil {
+			m.BaseImage = p
+		}
+	}
+	m.StorageDriver = hostStorageDriver()
+	m.RestoreAfter = cfg.Containers[container.Name].RestoreAfter
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		m.HostHome = homeDir
+	}
+	if isolated {
+		m.Isolation = backup.IsolationIsolated
+		m.Home = homePath
+	}
+	return m
+}
+
+// manifestPath returns the sidecar manifest path for a backup archive.
+func manifestPath(backupFile string) string {
+	return backupFile + ".json"
+}
+
+// writeBackupSidecar records the size and sha256 of a finished backup archive
+// in m and writes m as the archive's sidecar manifest.
+func writeBackupSidecar(backupFile string, m *backup.Manifest) error {
+	if err := recordArchiveSum(backupFile, m); err != nil {
+		return err
+	}
+	return backup.WriteManifestMode(manifestPath(backupFile), m, backupFileMode())
+}
+
+// finishBackupArchive records the size and sha256 of an archive written to
+// part in m, writes the sidecar manifest and checksum file of backupFile
+// and then renames the archive to backupFile, so an archive under its
+// final name always has its sidecars.
+func finishBackupArchive(part, backupFile string, m *backup.Manifest) error {
+	if err := recordArchiveSum(part, m); err != nil {
+		return err
+	}
+	if err := writeSidecars(backupFile, m); err != nil {
+		return err
+	}
+	if err := os.Rename(part, backupFile); err != nil {
+		os.Remove(manifestPath(backupFile))
+		os.Remove(checksumPath(backupFile))
+		return err
+	}
+	return nil
+}
+
+// writeSidecars writes the manifest and checksum files of backupFile.
+func writeSidecars(backupFile string, m *backup.Manifest) error {
+	if err := backup.WriteManifestMode(manifestPath(backupFile), m, backupFileMode()); err != nil {
+		return err
+	}
+	return writeChecksumFile(backupFile, m.SHA256)
+}
+
+func recordArchiveSum(file string, m *backup.Manifest) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	sum, err := fileSHA256(file, -1)
+	if err != nil {
+		return err
+	}
+	m.Size = info.Size()
+	m.SHA256 = sum
+	return nil
+}
+
+// readBackupManifest loads a backup's manifest from its sidecar, falling back
+// to the copy embedded at the start of the archive. It returns nil if the
+// backup has neither.
+func readBackupManifest(backupFile string) *backup.Manifest {
+	m, err := backup.ReadManifest(manifestPath(backupFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logWarning(fmt.Sprintf("Ignoring unreadable manifest: %v", err))
+		}
+		if m, err = backup.ReadArchiveManifest(backupFile); err != nil {
+			return nil
+		}
+	}
+	if d := distroString(m.Distro, m.DistroVersion); d != "" {
+		logInfo(fmt.Sprintf("Found backup manifest for container '%s' (%s).", m.ContainerName, d))
+	} else {
+		logInfo(fmt.Sprintf("Found backup manifest for container '%s'.", m.ContainerName))
+	}
+	if m.Note != "" {
+		logInfo(fmt.Sprintf("Note: %s", m.Note))
+	}
+	return m
+}
+
+// promptBackupNote asks for an optional free-form note for a new backup.
+func promptBackupNote() string {
+	fmt.Printf("%s> Optional note for this backup (e.g. 'before upgrade to F41'): %s", colorBold, colorReset)
+	return readUserInput()
+}
@@ -0,0 +1,163 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+func handleEditManifest() {
+	clearScreen()
+	printTitle(colorBlue, "📝 Edit Backup Info")
+
+	logInfo("Please choose the backup file (.tar) to edit.")
+	backupFile, err := selectFile("Select Backup File", backupFileFilters...)
+	if err != nil || backupFile == "" {
+		logError("No backup file selected. Aborting.")
+		return
+	}
+
+	m := readBackupManifest(backupFile)
+	if m == nil {
+		logWarning("This backup has no manifest yet; a new one will be created.")
+		m = &backup.Manifest{
+			Version:       backup.ManifestVersion,
+			ContainerName: containerNameFromFile(backupFile),
+			Isolation:     backup.IsolationStandard,
+		}
+		if isIsolatedArchive(backupFile) {
+			m.Isolation = backup.IsolationIsolated
+		}
+	}
+
+	changed := false
+	for {
+		clearScreen()
+		fmt.Printf("%s%s%s%s %s\n\n", colorBold, colorBlue, strings.TrimSpace(symbols("📝 Edit Backup Info")), colorReset, symbols("— "+backupFile))
+		printManifest(m)
+		fmt.Printf("\n  %s1)%s Container name   %s2)%s Tags   %s3)%s Note\n", colorCyan, colorReset, colorCyan, colorReset, colorCyan, colorReset)
+		fmt.Printf("  %ss)%s Save             %sq)%s Quit without saving\n\n", colorGreen, colorReset, colorRed, colorReset)
+		fmt.Printf("%s> Select an option: %s", colorBold, colorReset)
+		switch strings.ToLower(readUserInput()) {
+		case "1":
+			fmt.Printf("%s> New container name (current '%s'): %s", colorBold, m.ContainerName, colorReset)
+			if name := readUserInput(); name != "" {
+				m.ContainerName = name
+				changed = true
+			}
+		case "2":
+			fmt.Printf("%s> Tags, comma separated (current '%s', '-' to clear): %s", colorBold, strings.Join(m.Tags, ", "), colorReset)
+			if input := readUserInput(); input != "" {
+				m.Tags = parseTags(input)
+				changed = true
+			}
+		case "3":
+			fmt.Printf("%s> Note (current '%s', '-' to clear): %s", colorBold, m.Note, colorReset)
+			if note := readUserInput(); note != "" {
+				if note == "-" {
+					note = ""
+				}
+				m.Note = note
+				changed = true
+			}
+		case "s":
+			saveEditedManifest(backupFile, m)
+			return
+		case "q", "":
+			if changed {
+				fmt.Printf("%s> Discard your changes? (y/N): %s", colorYellow, colorReset)
+				if !confirmAction() {
+					continue
+				}
+			}
+			logInfo("No changes saved.")
+			return
+		}
+	}
+}
+
+// parseTags splits a comma separated tag list; "-" clears the tags.
+func parseTags(input string) []string {
+	if strings.TrimSpace(input) == "-" {
+		return nil
+	}
+	var tags []string
+	for _, t := range strings.Split(input, ",") {
+		if t = strings.TrimSpace(t); t != "" && !containsString(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+func printManifest(m *backup.Manifest) {
+	row := func(label, value string) {
+		if value == "" {
+			value = "-"
+		}
+		fmt.Printf("  %s%-16s%s %s\n", colorBold, label+":", colorReset, value)
+	}
+	row("Container", m.ContainerName)
+	row("Type", m.Isolation)
+	row("Image", m.Image)
+	row("Distro", distroString(m.Distro, m.DistroVersion))
+	if !m.CreatedAt.IsZero() {
+		row("Created", m.CreatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	row("Host", m.HostDistro)
+	if p := m.BaseImage; p != nil {
+		base := p.Ref
+		if p.Digest != "" {
+			base += " @ " + p.Digest
+		}
+		if !p.Created.IsZero() {
+			base += fmt.Sprintf(" (built %s)", p.Created.Local().Format("2006-01-02"))
+		}
+		row("Base image", base)
+	}
+	if m.Size > 0 {
+		row("Size", formatBytes(uint64(m.Size)))
+	}
+	if ratio := compressionRatio(m.Size, m.DataSize); ratio != "" {
+		row("Uncompressed", fmt.Sprintf("%s (ratio %s)", formatBytes(uint64(m.DataSize)), ratio))
+	}
+	if len(m.HomeExcluded) > 0 {
+		row("Left out", strings.Join(m.HomeExcluded, ", "))
+	}
+	row("Tags", strings.Join(m.Tags, ", "))
+	row("Note", m.Note)
+}
+
+// saveEditedManifest writes the sidecar and optionally the embedded copy.
+func saveEditedManifest(backupFile string, m *backup.Manifest) {
+	if err := backup.WriteManifestMode(manifestPath(backupFile), m, backupFileMode()); err != nil {
+		logError(fmt.Sprintf("Failed to write the manifest: %v", err))
+		return
+	}
+	logSuccess(fmt.Sprintf("✅ Saved %s", manifestPath(backupFile)))
+	if cipher, _ := backup.FileCipher(backupFile); cipher != backup.EncryptNone {
+		logInfo(fmt.Sprintf("The archive is encrypted with %s, so its embedded copy is left unchanged.", cipher))
+		return
+	}
+
+	fmt.Printf("%s> Also update the copy embedded in the archive? This rewrites the whole file. (y/N): %s", colorBold, colorReset)
+	if confirmAction() {
+		done := make(chan bool)
+		go showSpinner("rewrite", "Rewriting archive...", done)
+		// The size and hash describe the archive itself, so they are only
+		// kept in the sidecar, which is refreshed once the file is rewritten.
+		embedded := *m
+		embedded.Size, embedded.SHA256 = 0, ""
+		err := client.ReplaceEmbeddedManifest(backupFile, &embedded)
+		if err == nil {
+			err = writeBackupSidecar(backupFile, m)
+		}
+		done <- true
+		if err != nil {
+			logError(fmt.Sprintf("Failed to update the archive: %v", err))
+			return
+		}
+		logSuccess("✅ Archive updated.")
+	}
+}
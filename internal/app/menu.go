@@ -0,0 +1,99 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// menuEntry is one numbered action of the main menu.
+type menuEntry struct {
+	Key             int
+	Label           string
+	Color           string
+	NeedsContainers bool
+	Run             func(containers []Container)
+}
+
+// menuColumns is how many entries are printed per menu row.
+const menuColumns = 3
+
+var menuEntries = []menuEntry{
+	{1, "Backup", colorGreen, true, handleBackup},
+	{2, "Restore", colorCyan, false, func([]Container) { handleRestore() }},
+	{3, "Clone", colorCyan, true, handleClone},
+	{4, "Edit", colorMagenta, true, handleEdit},
+	{5, "Delete", colorRed, true, handleDelete},
+	{6, "Health Check", colorGreen, true, handleHealthCheck},
+	{7, "Images", colorYellow, false, func([]Container) { handleImages() }},
+	{8, "Upgrade", colorBlue, true, handleUpgrade},
+	{9, "Batch Backup", colorGreen, true, handleBatchBackup},
+	{10, "Export", colorYellow, true, handleExport},
+	{11, "Backup Info", colorBlue, false, func([]Container) { handleEditManifest() }},
+	{12, "Groups", colorBlue, false, handleGroups},
+	{13, "Backup All", colorGreen, true, handleBackupAll},
+	{14, "Verify Backup", colorBlue, false, func([]Container) { handleVerify() }},
+	{15, "Prune Backups", colorYellow, false, func([]Container) { handlePrune() }},
+	{16, "Settings", colorWhite, false, func([]Container) { handleSettings() }},
+	{17, "Export Bundle", colorGreen, true, handleExportMachineBundle},
+	{18, "Import Bundle", colorCyan, false, func([]Container) { handleImportMachineBundle() }},
+	{19, "System Files", colorMagenta, false, handleSystemFiles},
+	{20, "Snapshots", colorBlue, true, handleSnapshots},
+	{21, "History", colorWhite, false, func([]Container) { handleHistory() }},
+	{22, "Job Queue", colorCyan, false, handleQueue},
+}
+
+func findMenuEntry(key int) (menuEntry, bool) {
+	for _, e := range menuEntries {
+		if e.Key == key {
+			return e, true
+		}
+	}
+	return menuEntry{}, false
+}
+
+func printMenuEntries() {
+	var row []string
+	for _, e := range menuEntries {
+		row = append(row, fmt.Sprintf("%s%2d)%s %-13s", e.Color, e.Key, colorReset, e.Label))
+		if len(row) == menuColumns {
+			fmt.Println(strings.TrimRight(strings.Join(row, ""), " "))
+			row = nil
+		}
+	}
+	row = append(row, fmt.Sprintf("%s%2d)%s %-13s", colorWhite, 0, colorReset, "Exit"))
+	if len(row) == menuColumns {
+		fmt.Println(strings.TrimRight(strings.Join(row, ""), " "))
+		row = nil
+	}
+	row = append(row, fmt.Sprintf("%s%2s)%s %s", colorWhite, "h", colorReset, "Help"))
+	fmt.Println(strings.Join(row, ""))
+}
+
+// pickMenuChoice shows the menu as a picker and returns the choice as it
+// would have been typed at the numbered prompt: the number of an entry, "0"
+// to exit, "h" or "h N" for help, or "" when the user backed out.
+func pickMenuChoice() string {
+	var rows, names []string
+	for _, e := range menuEntries {
+		rows = append(rows, fmt.Sprintf("%2d) %-13s %s", e.Key, e.Label, menuHelp[e.Key].Summary))
+		names = append(names, e.Label)
+	}
+	actions := len(rows)
+	rows = append(rows, fmt.Sprintf("%2s) %-13s %s", "h", "Help", "What each action does, the commands it runs and its risks."), fmt.Sprintf("%2d) %s", 0, "Exit"))
+	names = append(names, "Help", "Exit")
+	chosen := pickList("Select an option", rows, names, false)
+	switch {
+	case len(chosen) == 0:
+		return ""
+	case chosen[0] == actions:
+		action := pickList("Select the action to explain", rows[:actions], names[:actions], false)
+		if len(action) == 0 {
+			return "h"
+		}
+		return fmt.Sprintf("h %d", menuEntries[action[0]].Key)
+	case chosen[0] == actions+1:
+		return "0"
+	}
+	return strconv.Itoa(menuEntries[chosen[0]].Key)
+}
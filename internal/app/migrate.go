@@ -0,0 +1,159 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// imageTransports are the containers-image transports a migration can copy
+// to with skopeo; anything else is taken as a host reachable over ssh.
+var imageTransports = []string{"docker://", "oci:", "oci-archive:", "docker-archive:", "dir:", "containers-storage:"}
+
+func isImageReference(to string) bool {
+	for _, prefix := range imageTransports {
+		if strings.HasPrefix(to, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// migrationHost resolves the host of a migration: a named destination on an
+// SSH host, "[user@]host", or any spec parseRemote accepts (its path is not
+// used).
+func migrationHost(to string) (remoteTarget, error) {
+	if _, targets := remoteDestinations(); targets[to].Host != "" {
+		to = targets[to].String()
+	}
+	t, ok := parseRemote(to)
+	if !ok {
+		if to == "" || strings.ContainsAny(to, "/ ") {
+			return remoteTarget{}, fmt.Errorf("%q is neither an image reference nor an SSH host", to)
+		}
+		t = remoteTarget{Host: to}
+	}
+	if t.Rclone {
+		return remoteTarget{}, fmt.Errorf("images cannot be migrated to rclone remotes; use a backup instead")
+	}
+	return t, nil
+}
+
+// migrationImageName returns the image name a migrated container is
+// published under, which is the same on both sides.
+func migrationImageName(name string) string {
+	return fmt.Sprintf("distrobox-migrate/%s:%s", strings.ToLower(name), time.Now().Format("20060102-150405"))
+}
+
+// migrateContainer commits a container and copies the image straight to
+// to, without writing an archive: to a registry or other image reference
+// with skopeo, or into the container storage of an SSH host by streaming
+// `save` into the remote runtime's `load`. With create, the distrobox is
+// created on the SSH host as newName.
+func migrateContainer(c Container, to, newName string, create bool) error {
+	var host remoteTarget
+	if !isImageReference(to) {
+		var err error
+		if host, err = migrationHost(to); err != nil {
+			return err
+		}
+	} else if create {
+		return fmt.Errorf("--create needs an SSH host, not an image reference")
+	}
+	if isolated, home := isContainerIsolated(c); isolated {
+		logWarning(fmt.Sprintf("Only the image is migrated; the isolated home %s is not copied.", home))
+	}
+
+	image := journalTempImage(migrationImageName(newName), "migrate", c.Name)
+	defer removeTempImage(image)
+	logInfo(fmt.Sprintf("Committing '%s'...", c.Name))
+	done := make(chan bool)
+	go showSpinner("commit", "Committing container...", done)
+	err := client.Commit(c.Name, image)
+	done <- true
+	if err != nil {
+		return fmt.Errorf("failed to commit the container: %w", err)
+	}
+
+	if host.Host == "" {
+		logInfo(fmt.Sprintf("Copying %s to %s...", image, to))
+		done := make(chan bool)
+		go showSpinner("copy", "Copying image...", done)
+		err := client.CopyImage(image, to)
+		done <- true
+		if err != nil {
+			return err
+		}
+		logSuccess(fmt.Sprintf("✅ '%s' was copied to %s.", c.Name, to))
+		return nil
+	}
+
+	runtime, err := host.run("command -v podman >/dev/null 2>&1 && echo podman || echo docker")
+	if err != nil {
+		return fmt.Errorf("%s is not reachable: %w", host.Host, err)
+	}
+	runtime = strings.TrimSpace(runtime)
+	logInfo(fmt.Sprintf("Streaming %s into %s storage on %s...", image, runtime, host.Host))
+	if err := streamImage(image, host, runtime); err != nil {
+		return err
+	}
+	logSuccess(fmt.Sprintf("✅ Image %s is now on %s.", image, host.Host))
+	if !create {
+		logInfo(fmt.Sprintf("Create the container there with: distrobox-create --name %s --image %s", newName, image))
+		return nil
+	}
+
+	opts := containerCreateOptions(c.Name)
+	opts.Name, opts.Image = newName, image
+	args := []string{"distrobox-create", "--yes"}
+	for _, a := range opts.Args() {
+		args = append(args, shellQuote(a))
+	}
+	done = make(chan bool)
+	go showSpinner("create", "Creating container on "+host.Host+"...", done)
+	_, err = host.run(strings.Join(args, " "))
+	done <- true
+	if err != nil {
+		return fmt.Errorf("the image is on %s, but creating the container failed: %w", host.Host, err)
+	}
+	logSuccess(fmt.Sprintf("✅ Container '%s' was created on %s.", newName, host.Host))
+	return nil
+}
+
+// streamImage pipes `save` of image into `load` on the host, with a
+// progress bar over the image size.
+func streamImage(image string, host remoteTarget, runtime string) error {
+	var total int64
+	if size, err := client.ImageSize(image); err == nil {
+		total = size
+	}
+	pr, pw := io.Pipe()
+	var stderr bytes.Buffer
+	cmd := commandRunner("ssh", append([]string{"-C"}, append(host.sshArgs(), runtime+" load")...)...)
+	cmd.Stdin = pr
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// If ssh exits early, closing the reader stops `save` from blocking.
+	waited := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		pr.CloseWithError(io.ErrClosedPipe)
+		waited <- err
+	}()
+	bar := startProgressBar("transfer", "Transferring image...", total)
+	saveErr := client.SaveStreamWithProgress(image, pw, bar.set)
+	pw.CloseWithError(saveErr)
+	loadErr := <-waited
+	bar.finish()
+	if saveErr != nil {
+		return saveErr
+	}
+	if loadErr != nil {
+		return fmt.Errorf("loading on %s failed: %w: %s", host.Host, loadErr, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
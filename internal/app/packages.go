@@ -0,0 +1,121 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// packageListScript prints the names of the packages installed on purpose
+// in a container, one per line, using whichever package manager it has.
+// Where the manager does not track that, every installed package is listed.
+// The gpg-pubkey entries rpm keeps for imported signing keys are not
+// packages and are left out.
+const packageListScript = `{ if command -v apt-mark >/dev/null 2>&1; then apt-mark showmanual
+elif command -v pacman >/dev/null 2>&1; then pacman -Qqe
+elif [ -f /etc/apk/world ]; then sed 's/[<>=~].*//' /etc/apk/world
+elif command -v dnf >/dev/null 2>&1; then dnf -q repoquery --userinstalled --qf '%{name}\n'
+elif command -v rpm >/dev/null 2>&1; then rpm -qa --qf '%{NAME}\n'
+fi; } 2>/dev/null | grep -vx 'gpg-pubkey' | sort -u`
+
+// packageCheckScript refreshes the package repositories of a container and
+// prints "missing NAME" for each package given as an argument that none of
+// them offers anymore, and "refresh-failed" if the refresh failed. It fails
+// when it does not know the container's package manager. pacman is not
+// refreshed, as syncing its database without upgrading leaves an Arch
+// container partially upgraded; it prints "refresh-skipped" instead.
+const packageCheckScript = `if command -v apt-get >/dev/null 2>&1; then
+  apt-get update -qq >/dev/null 2>&1 || echo "refresh-failed"
+  for p; do apt-cache show "$p" >/dev/null 2>&1 || echo "missing $p"; done
+elif command -v dnf >/dev/null 2>&1; then
+  dnf -q makecache >/dev/null 2>&1 || echo "refresh-failed"
+  for p; do dnf -q repoquery "$p" 2>/dev/null | grep -q . || echo "missing $p"; done
+elif command -v pacman >/dev/null 2>&1; then
+  echo "refresh-skipped"
+  for p; do pacman -Si "$p" >/dev/null 2>&1 || echo "missing $p"; done
+elif command -v apk >/dev/null 2>&1; then
+  apk update -q >/dev/null 2>&1 || echo "refresh-failed"
+  for p; do [ -n "$(apk search -qx "$p" 2>/dev/null)" ] || echo "missing $p"; done
+elif command -v zypper >/dev/null 2>&1; then
+  zypper -q refresh >/dev/null 2>&1 || echo "refresh-failed"
+  for p; do zypper -q info "$p" 2>/dev/null | grep -q "^Name" || echo "missing $p"; done
+else
+  echo "no package manager"; exit 1
+fi`
+
+// installedPackages lists the packages installed on purpose in a running
+// container.
+func installedPackages(c Container) ([]string, error) {
+	out, err := runCommand(containerRuntime, "exec", "--user", "root", c.Name, "sh", "-c", packageListScript)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(out), nil
+}
+
+// missingPackages refreshes the repositories of a container and returns the
+// packages they no longer offer, and whether they were refreshed.
+func missingPackages(c Container, packages []string) (missing []string, refreshed bool, err error) {
+	stop, err := startForExec(c)
+	if err != nil {
+		return nil, false, err
+	}
+	defer stop()
+	args := append([]string{"exec", "--user", "root", c.Name, "sh", "-c", packageCheckScript, "sh"}, packages...)
+	out, err := runCommand(containerRuntime, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not check the packages in '%s': %s", c.Name, strings.TrimSpace(out))
+	}
+	refreshed = true
+	for _, line := range strings.Split(out, "\n") {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(line), "missing "); ok {
+			missing = append(missing, name)
+		} else if l := strings.TrimSpace(line); l == "refresh-failed" || l == "refresh-skipped" {
+			refreshed = false
+		}
+	}
+	return missing, refreshed, nil
+}
+
+// maybeCheckPackages offers to check that the packages recorded in a system
+// files backup can still be installed in the container it was restored to,
+// as [restore] check_packages says. It reports false if some cannot.
+func maybeCheckPackages(c Container, packages []string) bool {
+	if len(packages) == 0 {
+		return true
+	}
+	switch cfg.Restore.CheckPackages {
+	case smokeNever:
+		return true
+	case smokeAsk:
+		fmt.Printf("%s> Refresh the package repositories in '%s' and check that the %d recorded packages are still available? (y/N): %s", colorBold, c.Name, len(packages), colorReset)
+		if !confirmAction() {
+			return true
+		}
+	}
+	return checkPackages(c, packages)
+}
+
+// checkPackages reports the recorded packages that the repositories of the
+// container no longer offer, so they can be replaced before reinstalling.
+func checkPackages(c Container, packages []string) bool {
+	done := make(chan bool)
+	go showSpinner("packages", fmt.Sprintf("Refreshing repositories and checking %d packages...", len(packages)), done)
+	missing, refreshed, err := missingPackages(c, packages)
+	done <- true
+	if err != nil {
+		logError(err.Error())
+		return false
+	}
+	if !refreshed {
+		logWarning("The package repositories could not be refreshed; the results may be out of date.")
+	}
+	if len(missing) == 0 {
+		logSuccess(fmt.Sprintf("✅ All %d recorded packages are available in '%s'.", len(packages), c.Name))
+		return true
+	}
+	logWarning(fmt.Sprintf("%d of %d recorded packages are no longer available upstream; find replacements before reinstalling:", len(missing), len(packages)))
+	for _, p := range missing {
+		fmt.Printf("  - %s\n", p)
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"os"
+	"syscall"
+)
+
+// Backups hold whole home directories, so archives, manifests, checksum
+// files and catalogs are created with [backup] file_mode and their folders
+// with [backup] dir_mode rather than world-readable defaults. The umask
+// can only narrow these further.
+
+// umask is the file mode creation mask the tool was started with.
+var umask = readUmask()
+
+func readUmask() os.FileMode {
+	m := syscall.Umask(0)
+	syscall.Umask(m)
+	return os.FileMode(m)
+}
+
+// selinuxEnabled reports whether the host runs SELinux, whose file labels
+// home archives then keep by default.
+func selinuxEnabled() bool {
+	_, err := os.Stat("/sys/fs/selinux/enforce")
+	return err == nil
+}
+
+// backupFileMode returns the permissions of new backup files.
+func backupFileMode() os.FileMode {
+	return cfg.Backup.FileMode &^ umask
+}
+
+// makeBackupDir creates a backup folder and its missing parents. Existing
+// folders keep their permissions.
+func makeBackupDir(dir string) error {
+	return os.MkdirAll(dir, cfg.Backup.DirMode)
+}
+
+// createBackupFile creates or truncates a backup file, setting its
+// permissions even if it already existed.
+func createBackupFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, backupFileMode())
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(backupFileMode()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// writeBackupFile writes data to a backup file such as a checksum list.
+func writeBackupFile(path string, data []byte) error {
+	f, err := createBackupFile(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
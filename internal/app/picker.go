@@ -0,0 +1,102 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// When this tool or the picker runs in a Flatpak or Snap sandbox, the
+// picker goes through the desktop portal: what the user picks comes back as
+// a document portal path under /run/user/<uid>/doc rather than the real one,
+// and a picker that cannot reach the portal fails outright. Portal paths are
+// mapped back to the host path where the portal tells it, and a failing
+// sandboxed picker is explained once and then left alone.
+
+// pickerSandbox names the sandbox the picker runs in, or is empty.
+var pickerSandbox string
+
+// portalHostPathAttr is the extended attribute in which the document portal
+// (xdg-desktop-portal 1.18 and later) gives the host path of a file.
+const portalHostPathAttr = "user.document-portal.host-path"
+
+// detectFilePicker chooses zenity or kdialog and finds out whether it is
+// sandboxed. Only the menu uses a picker.
+func detectFilePicker() {
+	// Pickers run where the tool does, never through hostSpawn.
+	for _, picker := range []string{"zenity", "kdialog"} {
+		if _, err := exec.LookPath(picker); err == nil {
+			guiFilePicker = picker
+			break
+		}
+	}
+	if guiFilePicker == "" {
+		return
+	}
+	switch {
+	case os.Getenv("FLATPAK_ID") != "" || fileExists("/.flatpak-info"):
+		pickerSandbox = "this tool's Flatpak"
+	case os.Getenv("SNAP") != "":
+		pickerSandbox = "this tool's Snap"
+	default:
+		path, _ := exec.LookPath(guiFilePicker)
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+		if strings.Contains(path, "/flatpak/exports/bin/") {
+			pickerSandbox = "a Flatpak"
+		} else if strings.HasPrefix(path, "/snap/") {
+			pickerSandbox = "a Snap"
+		} else if script, err := os.ReadFile(path); err == nil && len(script) < 4096 && strings.Contains(string(script), "flatpak run") {
+			pickerSandbox = "a Flatpak"
+		}
+	}
+}
+
+// runPicker runs a GUI picker and returns the host path of what was picked.
+// It returns false to fall back to typing the path.
+func runPicker(cmd *exec.Cmd, what string) (string, bool) {
+	out, err := cmd.Output()
+	if err != nil {
+		if pickerSandbox == "" {
+			logWarning(fmt.Sprintf("GUI %s picker failed. Falling back to terminal.", what))
+			return "", false
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && len(strings.TrimSpace(string(exitErr.Stderr))) == 0 {
+			return "", false // cancelled
+		}
+		logWarning(fmt.Sprintf("The %s picker (%s) runs in %s and could not open, which usually means the desktop portal is missing or the sandbox cannot reach the display. Type the path instead; the picker is not used again this session.", what, guiFilePicker, pickerSandbox))
+		guiFilePicker = ""
+		return "", false
+	}
+	return hostPath(strings.TrimSpace(string(out))), true
+}
+
+// hostPath maps a document portal path back to the file it stands for. A
+// portal path without that information is used as is, with a warning, as
+// its folder is not the real one.
+func hostPath(path string) string {
+	if !isPortalPath(path) {
+		return path
+	}
+	buf := make([]byte, 4096)
+	if n, err := syscall.Getxattr(path, portalHostPathAttr, buf); err == nil && n > 0 {
+		host := strings.TrimRight(string(buf[:n]), "\x00")
+		if _, err := os.Stat(host); err == nil {
+			return host
+		}
+	}
+	logWarning(fmt.Sprintf("The picker in %s returned the document portal path %s, and the portal does not say where it really is. It can be read, but other files in its folder (such as a backup's sidecar or home archive) are not visible there; type the real path if something is missing.", pickerSandbox, path))
+	return path
+}
+
+// isPortalPath reports whether path is inside a document portal mount.
+func isPortalPath(path string) bool {
+	portal := fmt.Sprintf("/run/user/%d/doc/", os.Getuid())
+	return strings.HasPrefix(path, portal) || strings.HasPrefix(path, "/run/flatpak/doc/")
+}
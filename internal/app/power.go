@@ -0,0 +1,202 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	powerDefer = "defer"
+	powerSkip  = "skip"
+)
+
+// powerCheckInterval is how often a deferred run checks again.
+const powerCheckInterval = time.Minute
+
+// batteryState is read from /sys/class/power_supply.
+type batteryState struct {
+	Present     bool
+	Discharging bool
+	Percent     int // average over all batteries
+}
+
+func readBattery() batteryState {
+	var st batteryState
+	dirs, _ := filepath.Glob("/sys/class/power_supply/*")
+	total, count := 0, 0
+	for _, dir := range dirs {
+		if readSysValue(dir, "type") != "Battery" {
+			continue
+		}
+		// Peripheral batteries (mice, headsets) do not power the machine.
+		if scope := readSysValue(dir, "scope"); scope == "Device" {
+			continue
+		}
+		st.Present = true
+		if readSysValue(dir, "status") == "Discharging" {
+			st.Discharging = true
+		}
+		if n, err := strconv.Atoi(readSysValue(dir, "capacity")); err == nil {
+			total += n
+			count++
+		}
+	}
+	if count > 0 {
+		st.Percent = total / count
+	}
+	return st
+}
+
+func readSysValue(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// networkMetered asks NetworkManager whether the primary connection is
+// metered, including its guess. Without NetworkManager it returns false.
+func networkMetered() bool {
+	if !commandExists("busctl") {
+		return false
+	}
+	out, err := runCommand("busctl", "get-property", "org.freedesktop.NetworkManager", "/org/freedesktop/NetworkManager", "org.freedesktop.NetworkManager", "Metered")
+	if err != nil {
+		return false
+	}
+	// "u 1": NM_METERED_YES; 3 is NM_METERED_GUESS_YES.
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return false
+	}
+	return fields[1] == "1" || fields[1] == "3"
+}
+
+// powerBlocker returns why a scheduled run should not start now, or "" if
+// nothing is in the way. The metered check only matters when the run uses
+// the network.
+func powerBlocker(usesNetwork bool) string {
+	if cfg.Power.MinBattery > 0 {
+		if b := readBattery(); b.Present && b.Discharging && b.Percent < cfg.Power.MinBattery {
+			return fmt.Sprintf("on battery at %d%% (below %d%%)", b.Percent, cfg.Power.MinBattery)
+		}
+	}
+	if cfg.Power.SkipMetered && usesNetwork && networkMetered() {
+		return "the network connection is metered"
+	}
+	return ""
+}
+
+// waitForPower applies the [power] policy before a scheduled run. It
+// reports whether the run may start: immediately if nothing blocks it, after
+// waiting up to MaxDefer when deferring, or not at all.
+func waitForPower(usesNetwork bool) bool {
+	reason := powerBlocker(usesNetwork)
+	if reason == "" {
+		return true
+	}
+	if cfg.Power.OnBlock == powerSkip {
+		logWarning(fmt.Sprintf("Skipping the run: %s.", reason))
+		return false
+	}
+	logWarning(fmt.Sprintf("Deferring the run for up to %s: %s.", cfg.Power.MaxDefer, reason))
+	deadline := time.Now().Add(cfg.Power.MaxDefer)
+	for time.Now().Before(deadline) {
+		time.Sleep(min(powerCheckInterval, time.Until(deadline)))
+		if reason = powerBlocker(usesNetwork); reason == "" {
+			logInfo("Conditions are fine now; starting the run.")
+			return true
+		}
+	}
+	logWarning(fmt.Sprintf("Skipping the run after waiting %s: %s.", cfg.Power.MaxDefer, reason))
+	return false
+}
+
+// inhibitorGrace is how long systemd-inhibit is given to be refused before
+// its lock counts as taken.
+const inhibitorGrace = 500 * time.Millisecond
+
+// inhibitSleep takes a systemd inhibitor lock against idle, suspend and
+// shutdown while a long operation runs, as [power] inhibit says, and returns
+// the function releasing it. The lock is held by systemd-inhibit running cat
+// on a pipe from this process, so it also goes away if the tool dies.
+// polkit usually refuses block locks to sessions that are not active, such
+// as timer runs; a delay lock is taken then, which lets the operation see
+// suspend coming but not stop it, and the warning comes before the
+// operation starts. Without systemd-inhibit it does nothing.
+func inhibitSleep(why string) func() {
+	if !cfg.Power.Inhibit || !commandExists("systemd-inhibit") {
+		return func() {}
+	}
+	w, exited, err := startInhibitor(why, "idle:sleep:shutdown", "block")
+	if err != nil {
+		logWarning(fmt.Sprintf("The machine may suspend during the operation: a block inhibitor lock was refused (%v); holding a delay lock instead.", err))
+		// Delay locks do not cover idle.
+		if w, exited, err = startInhibitor(why, "sleep:shutdown", "delay"); err != nil {
+			logWarning(fmt.Sprintf("Could not take a delay inhibitor lock either: %v", err))
+			return func() {}
+		}
+	}
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			w.Close()
+			if err := <-exited; err != nil {
+				logWarning(fmt.Sprintf("The inhibitor lock could not be held; the machine may have suspended during the operation: %v", err))
+			}
+		})
+	}
+	// Exiting closes the pipe; the signal may have ended systemd-inhibit
+	// already, which is no reason to warn.
+	forget := onInterrupt(func() { w.Close() })
+	return func() {
+		forget()
+		release()
+	}
+}
+
+// startInhibitor starts systemd-inhibit holding a lock of the given kinds
+// and mode until w is closed. It fails when the lock is refused within
+// inhibitorGrace; a later failure is sent on exited, which receives the
+// result of the command once it ends.
+func startInhibitor(why, what, mode string) (w *os.File, exited <-chan error, err error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	var stderr bytes.Buffer
+	cmd := commandRunner("systemd-inhibit", "--what="+what, "--who="+appName, "--why="+why, "--mode="+mode, "cat")
+	cmd.Stdin = r
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return nil, nil, err
+	}
+	r.Close()
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		if err != nil {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		w.Close()
+		if err == nil {
+			err = fmt.Errorf("systemd-inhibit exited")
+		}
+		return nil, nil, err
+	case <-time.After(inhibitorGrace):
+		return w, done, nil
+	}
+}
@@ -0,0 +1,176 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Progress output formats selectable with --progress.
+const (
+	progressText = "text"
+	progressJSON = "json"
+)
+
+var (
+	progressMode = progressText
+	progressMu   sync.Mutex
+	// progressOut receives the JSON events. With --progress=json it is the
+	// real stdout, and os.Stdout is pointed at stderr so that what is printed
+	// for people, by the tool or by the commands it runs, does not mix with
+	// them.
+	progressOut = os.Stdout
+	// dataOut receives output meant for programs, such as list --json. It
+	// stays the real stdout with --progress=json.
+	dataOut io.Writer = os.Stdout
+)
+
+// progressEvent is one line of the --progress=json protocol. Percent is -1
+// while the total amount of work is unknown.
+type progressEvent struct {
+	Time    time.Time `json:"time"`
+	Stage   string    `json:"stage"`
+	Event   string    `json:"event"` // "start", "progress", "done" or "log"
+	Percent float64   `json:"percent"`
+	Bytes   int64     `json:"bytes"`
+	Level   string    `json:"level,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+func jsonProgress() bool {
+	return progressMode == progressJSON
+}
+
+// reserveStdoutForProgress keeps stdout for the JSON events and dataOut, as
+// described at progressOut.
+func reserveStdoutForProgress() {
+	progressOut, dataOut, os.Stdout = os.Stdout, os.Stdout, os.Stderr
+}
+
+// emitProgress writes a single JSON event line to stdout.
+func emitProgress(ev progressEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	fmt.Fprintln(progressOut, string(data))
+}
+
+func emitLogEvent(level, msg string) {
+	emitProgress(progressEvent{Stage: "log", Event: "log", Percent: -1, Level: level, Message: msg})
+}
+
+// progressBar renders a byte count against an expected total as a bar with
+// throughput and ETA, replacing the spinner where the amount of work is
+// known. With --progress=json it emits progress events instead.
+type progressBar struct {
+	stage   string
+	message string
+	total   int64 // 0 when unknown
+	start   time.Time
+	done    atomic.Int64
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// progressInterval is how often the bar is redrawn.
+const progressInterval = 200 * time.Millisecond
+
+func startProgressBar(stage, message string, total int64) *progressBar {
+	p := &progressBar{stage: stage, message: symbols(message), total: total, start: time.Now(), stop: make(chan struct{}), stopped: make(chan struct{})}
+	if jsonProgress() {
+		emitProgress(progressEvent{Stage: stage, Event: "start", Percent: p.percent(0), Message: message})
+	}
+	go p.run()
+	return p
+}
+
+// set records how many bytes are done; it has the signature of a
+// backup.ProgressFunc.
+func (p *progressBar) set(done int64) {
+	p.done.Store(done)
+}
+
+func (p *progressBar) run() {
+	defer close(p.stopped)
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	lastJSON := time.Time{}
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			done := p.done.Load()
+			if jsonProgress() {
+				if now.Sub(lastJSON) >= time.Second {
+					emitProgress(progressEvent{Stage: p.stage, Event: "progress", Percent: p.percent(done), Bytes: done, Message: p.message})
+					lastJSON = now
+				}
+				continue
+			}
+			fmt.Printf("\r\033[K%s %s", p.message, p.line(done, now))
+		}
+	}
+}
+
+// percent is done as a share of total, held below 100 until finish since
+// the total is an estimate; -1 when the total is unknown.
+func (p *progressBar) percent(done int64) float64 {
+	if p.total <= 0 {
+		return -1
+	}
+	return min(99, float64(done)*100/float64(p.total))
+}
+
+func (p *progressBar) line(done int64, now time.Time) string {
+	elapsed := now.Sub(p.start).Seconds()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(done) / elapsed
+	}
+	speed := formatBytes(uint64(rate)) + "/s"
+	pct := p.percent(done)
+	if pct < 0 {
+		return fmt.Sprintf("%s  %s", formatBytes(uint64(done)), speed)
+	}
+	const width = 24
+	filled := int(pct * width / 100)
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", width-filled)
+	eta := "--:--"
+	if rate > 0 && done < p.total {
+		eta = formatETA(time.Duration(float64(p.total-done) / rate * float64(time.Second)))
+	}
+	return fmt.Sprintf("[%s] %3.0f%%  %s / %s  %s  ETA %s", bar, pct, formatBytes(uint64(done)), formatBytes(uint64(p.total)), speed, eta)
+}
+
+func formatETA(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d >= time.Hour {
+		return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%02d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// finish stops the bar and prints the outcome line.
+func (p *progressBar) finish() {
+	close(p.stop)
+	<-p.stopped
+	done := p.done.Load()
+	if jsonProgress() {
+		emitProgress(progressEvent{Stage: p.stage, Event: "done", Percent: 100, Bytes: done, Message: p.message})
+		return
+	}
+	elapsed := time.Since(p.start).Round(time.Second)
+	fmt.Printf("\r\033[K%s... Done! %s in %s\n", p.message, formatBytes(uint64(done)), elapsed)
+}
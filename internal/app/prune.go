@@ -0,0 +1,346 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// enabled reports whether the policy has any rule; without one nothing is
+// ever pruned.
+func (p RetentionPolicy) enabled() bool {
+	return p.KeepLast > 0 || p.KeepDaily > 0 || p.KeepWeekly > 0 || p.KeepMonthly > 0
+}
+
+func (p RetentionPolicy) String() string {
+	var rules []string
+	for _, r := range []struct {
+		n     int
+		label string
+	}{{p.KeepLast, "last"}, {p.KeepDaily, "daily"}, {p.KeepWeekly, "weekly"}, {p.KeepMonthly, "monthly"}} {
+		if r.n > 0 {
+			rules = append(rules, fmt.Sprintf("%d %s", r.n, r.label))
+		}
+	}
+	if len(rules) == 0 {
+		return "keep everything"
+	}
+	return "keep " + strings.Join(rules, ", ")
+}
+
+// apply returns, for backups created at times (newest first), the rules
+// that keep each one. Backups without a rule are to be pruned.
+func (p RetentionPolicy) apply(times []time.Time) [][]string {
+	keep := make([][]string, len(times))
+	if !p.enabled() {
+		for i := range keep {
+			keep[i] = []string{"no policy"}
+		}
+		return keep
+	}
+	buckets := []struct {
+		label string
+		n     int
+		key   func(time.Time) string
+	}{
+		{"daily", p.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{"weekly", p.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%02d", year, week)
+		}},
+		{"monthly", p.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for i := 0; i < len(times) && i < p.KeepLast; i++ {
+		keep[i] = append(keep[i], "last")
+	}
+	for _, b := range buckets {
+		seen := map[string]bool{}
+		for i, t := range times {
+			if len(seen) == b.n {
+				break
+			}
+			key := b.key(t.Local())
+			if !seen[key] {
+				seen[key] = true
+				keep[i] = append(keep[i], b.label)
+			}
+		}
+	}
+	return keep
+}
+
+// retentionFor returns the policy of a container.
+func retentionFor(container string) RetentionPolicy {
+	if cc, ok := cfg.Containers[container]; ok && cc.HasRetention {
+		return cc.Retention
+	}
+	return cfg.Retention
+}
+
+// pruneDestination is a place backups are pruned in: a local directory or a
+// remote target.
+type pruneDestination struct {
+	Label  string
+	Dir    string
+	Remote *remoteTarget
+}
+
+// pruneDestinations lists the default backup folder and every configured
+// destination, local or remote.
+func pruneDestinations() []pruneDestination {
+	dests := []pruneDestination{{Label: "[backup] dir", Dir: defaultBackupDir()}}
+	seen := map[string]bool{dests[0].Dir: true}
+	var names []string
+	for name := range cfg.Destinations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		spec := cfg.Destinations[name].Path
+		if t, ok := parseRemote(spec); ok {
+			dests = append(dests, pruneDestination{Label: name, Remote: &t})
+			continue
+		}
+		dir := expandHome(spec)
+		if !seen[dir] {
+			seen[dir] = true
+			dests = append(dests, pruneDestination{Label: name, Dir: dir})
+		}
+	}
+	return dests
+}
+
+// findPruneDestinations returns the destination labelled name, or all of
+// them when name is empty. A name that is no label is taken as a folder or
+// remote target, as `backup --dest` takes it.
+func findPruneDestinations(name string) ([]pruneDestination, bool) {
+	dests := pruneDestinations()
+	if name == "" {
+		return dests, true
+	}
+	for _, d := range dests {
+		if d.Label == name {
+			return []pruneDestination{d}, true
+		}
+	}
+	spec := resolveBackupDest(name)
+	if t, ok := parseRemote(spec); ok {
+		return []pruneDestination{{Label: name, Remote: &t}}, true
+	}
+	for _, d := range dests {
+		if d.Dir == spec {
+			return []pruneDestination{d}, true
+		}
+	}
+	if info, err := os.Stat(spec); err == nil && info.IsDir() {
+		return []pruneDestination{{Label: name, Dir: spec}}, true
+	}
+	return nil, false
+}
+
+func (d pruneDestination) String() string {
+	if d.Remote != nil {
+		return fmt.Sprintf("%s (%s)", d.Label, d.Remote)
+	}
+	return fmt.Sprintf("%s (%s)", d.Label, d.Dir)
+}
+
+// storedBackup is an archive found in a destination, with the rules that
+// keep it.
+type storedBackup struct {
+	Name      string // file name inside the destination
+	Container string
+	Created   time.Time
+	Size      int64
+	DataSize  int64 // bytes archived before compression; 0 if not recorded
+	Keep      []string
+}
+
+// scan lists the backups of a destination that have a manifest naming their
+// container and creation time; other archives are never pruned.
+func (d pruneDestination) scan() ([]storedBackup, error) {
+	var found []storedBackup
+	add := func(name string, size int64, m *backup.Manifest) {
+		if m != nil && m.ContainerName != "" && !m.CreatedAt.IsZero() {
+			found = append(found, storedBackup{Name: name, Container: m.ContainerName, Created: m.CreatedAt, Size: size, DataSize: m.DataSize})
+		}
+	}
+	if d.Remote != nil {
+		archives, err := d.Remote.listArchives()
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range archives {
+			add(a.Name, a.Size, a.Manifest)
+		}
+		return found, nil
+	}
+
+	entries, err := os.ReadDir(d.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !isBackupArchiveName(e.Name()) || !matchesFilters(e.Name(), backupFileFilters) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		file := filepath.Join(d.Dir, e.Name())
+		m, err := backup.ReadManifest(manifestPath(file))
+		if err != nil {
+			m, _ = backup.ReadArchiveManifest(file)
+		}
+		add(e.Name(), info.Size(), m)
+	}
+	return found, nil
+}
+
+// backupFiles lists an archive together with every sidecar it may have.
+func backupFiles(name string) []string {
+	home := homeArchivePath(name)
+	return []string{name, manifestPath(name), checksumPath(name), home, checksumPath(home), homeChecksumPath(name)}
+}
+
+// remove deletes a backup and its sidecars from the destination.
+func (d pruneDestination) remove(name string) error {
+	if d.Remote != nil {
+		return d.Remote.remove(backupFiles(name)...)
+	}
+	for _, f := range backupFiles(name) {
+		if err := os.Remove(filepath.Join(d.Dir, f)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// prunePlan is the retention decision for the backups of one destination.
+type prunePlan struct {
+	Dest    pruneDestination
+	Backups []storedBackup // grouped by container, newest first
+	Err     error
+}
+
+// planPrune applies each container's policy to the backups of every
+// destination, separately per destination.
+func planPrune(dests []pruneDestination) []prunePlan {
+	var plans []prunePlan
+	for _, d := range dests {
+		backups, err := d.scan()
+		if err != nil {
+			plans = append(plans, prunePlan{Dest: d, Err: err})
+			continue
+		}
+		sort.Slice(backups, func(i, j int) bool {
+			if backups[i].Container != backups[j].Container {
+				return backups[i].Container < backups[j].Container
+			}
+			return backups[i].Created.After(backups[j].Created)
+		})
+		for start := 0; start < len(backups); {
+			end := start
+			var times []time.Time
+			for end < len(backups) && backups[end].Container == backups[start].Container {
+				times = append(times, backups[end].Created)
+				end++
+			}
+			for i, keep := range retentionFor(backups[start].Container).apply(times) {
+				backups[start+i].Keep = keep
+			}
+			start = end
+		}
+		plans = append(plans, prunePlan{Dest: d, Backups: backups})
+	}
+	return plans
+}
+
+// printPrunePlan shows what would be kept and deleted and returns the
+// number of backups and bytes to delete.
+func printPrunePlan(plans []prunePlan) (int, int64) {
+	count, size := 0, int64(0)
+	for _, p := range plans {
+		fmt.Printf("\n%s%s%s\n", colorBold, p.Dest, colorReset)
+		if p.Err != nil {
+			logWarning(fmt.Sprintf("Could not list backups: %v", p.Err))
+			continue
+		}
+		if len(p.Backups) == 0 {
+			fmt.Println("  No backups with a manifest.")
+			continue
+		}
+		container := ""
+		for _, b := range p.Backups {
+			if b.Container != container {
+				container = b.Container
+				fmt.Printf("  %s%s%s (%s)\n", colorCyan, container, colorReset, retentionFor(container))
+			}
+			status := fmt.Sprintf("%sKEEP%s   %s", colorGreen, colorReset, strings.Join(b.Keep, ", "))
+			if len(b.Keep) == 0 {
+				status = fmt.Sprintf("%sDELETE%s", colorRed, colorReset)
+				count++
+				size += b.Size
+			}
+			fmt.Printf("    %s  %10s  %-50s %s\n", b.Created.Local().Format("2006-01-02 15:04"), formatBytes(uint64(b.Size)), b.Name, status)
+		}
+	}
+	return count, size
+}
+
+// runPrune deletes the backups the plans do not keep and returns how many
+// deletions failed.
+func runPrune(plans []prunePlan) int {
+	failed := 0
+	for _, p := range plans {
+		for _, b := range p.Backups {
+			if len(b.Keep) > 0 {
+				continue
+			}
+			if err := p.Dest.remove(b.Name); err != nil {
+				logError(fmt.Sprintf("Failed to delete %s from %s: %v", b.Name, p.Dest.Label, err))
+				failed++
+				continue
+			}
+			logInfo(fmt.Sprintf("Deleted %s from %s.", b.Name, p.Dest.Label))
+		}
+	}
+	return failed
+}
+
+func handlePrune() {
+	clearScreen()
+	printTitle(colorYellow, "🧹 Prune Old Backups")
+	fmt.Printf("%s%sHint:%s Policies come from [retention] and [containers.<name>] keep_* in the config. Only backups with a manifest are considered.\n", colorYellow, colorUnderline, colorReset)
+
+	done := make(chan bool)
+	go showSpinner("scan", "Scanning destinations...", done)
+	plans := planPrune(pruneDestinations())
+	done <- true
+
+	count, size := printPrunePlan(plans)
+	fmt.Println()
+	if count == 0 {
+		logInfo("Nothing to prune.")
+		return
+	}
+	fmt.Printf("%s> Delete %d backups (%s) with their sidecars? This cannot be undone. (y/N): %s", colorRed, count, formatBytes(uint64(size)), colorReset)
+	if !confirmAction() {
+		logInfo("Prune cancelled.")
+		return
+	}
+	if failed := runPrune(plans); failed > 0 {
+		logError(fmt.Sprintf("%d backups could not be deleted.", failed))
+		return
+	}
+	logSuccess(fmt.Sprintf("✅ Pruned %d backups, freeing %s.", count, formatBytes(uint64(size))))
+}
@@ -0,0 +1,398 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The job queue runs backups and verifications in the background while the
+// menu stays usable. Every job is a child process of the tool running the
+// matching command with --progress=json, so its output does not end up
+// between the menu's: the events it prints feed the status screen instead,
+// and it records its operations in the history like any other run. Jobs
+// run one at a time, or up to [queue] parallel at once. Ctrl+C stops the
+// menu and the jobs together, and each cleans up after itself as usual.
+
+// States of a queued job.
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// queuedJob is an operation waiting in or run by the queue.
+type queuedJob struct {
+	Title string
+	// Args are the command and flags the child process runs.
+	Args  []string
+	State string
+	// Stage, Percent and Message are the latest progress of a running job;
+	// Percent is -1 while unknown.
+	Stage    string
+	Percent  float64
+	Message  string
+	Started  time.Time
+	Finished time.Time
+	Err      error
+
+	cmd *exec.Cmd
+}
+
+var (
+	queueMu   sync.Mutex
+	queueJobs []*queuedJob
+)
+
+// enqueueJob adds a job running the tool with args and starts it as soon
+// as a slot is free.
+func enqueueJob(title string, args ...string) {
+	queueMu.Lock()
+	queueJobs = append(queueJobs, &queuedJob{Title: title, Args: args, State: jobQueued, Percent: -1})
+	queueMu.Unlock()
+	dispatchJobs()
+}
+
+// dispatchJobs starts queued jobs, oldest first, while fewer than [queue]
+// parallel are running.
+func dispatchJobs() {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	running := 0
+	for _, j := range queueJobs {
+		if j.State == jobRunning {
+			running++
+		}
+	}
+	for _, j := range queueJobs {
+		if running >= cfg.Queue.Parallel {
+			break
+		}
+		if j.State != jobQueued {
+			continue
+		}
+		j.State, j.Started = jobRunning, time.Now()
+		running++
+		go runQueuedJob(j)
+	}
+}
+
+// childArgs returns the global flags that make a child process work on the
+// same containers as this session.
+func childArgs() []string {
+	args := []string{"--progress=" + progressJSON}
+	if rootMode {
+		args = append(args, "-root")
+	}
+	if podmanConnection != "" {
+		args = append(args, "-connection", podmanConnection)
+	}
+	if logTargetFlag != "" {
+		args = append(args, "-log", logTargetFlag)
+	}
+	return args
+}
+
+// runQueuedJob runs j in a child process, following its progress events,
+// and starts the next job when it ends.
+func runQueuedJob(j *queuedJob) {
+	err := func() error {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		cmd := exec.Command(exe, append(childArgs(), j.Args...)...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		queueMu.Lock()
+		j.cmd = cmd
+		queueMu.Unlock()
+
+		lastError := ""
+		scanner := bufio.NewScanner(out)
+		for scanner.Scan() {
+			var ev progressEvent
+			if json.Unmarshal(scanner.Bytes(), &ev) != nil {
+				continue
+			}
+			queueMu.Lock()
+			if ev.Event == "log" {
+				j.Message = ev.Message
+				if ev.Level == "error" {
+					lastError = ev.Message
+				}
+			} else {
+				j.Stage, j.Percent = ev.Stage, ev.Percent
+				if ev.Message != "" {
+					j.Message = ev.Message
+				}
+			}
+			queueMu.Unlock()
+		}
+		if err := cmd.Wait(); err != nil {
+			if lastError != "" {
+				return errors.New(lastError)
+			}
+			if lines := strings.Split(strings.TrimSpace(stderr.String()), "\n"); lines[0] != "" {
+				return fmt.Errorf("%v: %s", err, lines[len(lines)-1])
+			}
+			return err
+		}
+		return nil
+	}()
+
+	queueMu.Lock()
+	j.Finished, j.Err, j.cmd = time.Now(), err, nil
+	j.State = jobDone
+	if err != nil {
+		j.State = jobFailed
+	}
+	queueMu.Unlock()
+	dispatchJobs()
+}
+
+// queueCounts returns how many jobs wait, run and have finished.
+func queueCounts() (queued, running, finished int) {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	for _, j := range queueJobs {
+		switch j.State {
+		case jobQueued:
+			queued++
+		case jobRunning:
+			running++
+		default:
+			finished++
+		}
+	}
+	return queued, running, finished
+}
+
+// queueSummary returns a line about the queue for the main menu, or "" when
+// it is empty.
+func queueSummary() string {
+	queued, running, finished := queueCounts()
+	if queued+running+finished == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Job queue: %d running, %d waiting, %d finished", running, queued, finished)
+}
+
+// printQueue lists the jobs with their state and latest progress.
+func printQueue() {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	if len(queueJobs) == 0 {
+		fmt.Printf("  %sNo jobs queued.%s\n", colorYellow, colorReset)
+		return
+	}
+	fmt.Printf("  %s%-3s %-30s %-8s %8s %8s  %s%s\n", colorBold, "#", "Job", "State", "Progress", "Time", "Details", colorReset)
+	for i, j := range queueJobs {
+		stateColor, progress, elapsed, details := colorWhite, "", "", j.Message
+		switch j.State {
+		case jobRunning:
+			stateColor = colorCyan
+			progress = "..."
+			if j.Percent >= 0 {
+				progress = fmt.Sprintf("%.0f%%", j.Percent)
+			}
+			elapsed = time.Since(j.Started).Round(time.Second).String()
+		case jobDone:
+			stateColor, progress, details = colorGreen, "100%", ""
+			elapsed = j.Finished.Sub(j.Started).Round(time.Second).String()
+		case jobFailed:
+			stateColor = colorRed
+			if j.Err != nil {
+				details = j.Err.Error()
+			}
+			if !j.Started.IsZero() {
+				elapsed = j.Finished.Sub(j.Started).Round(time.Second).String()
+			}
+		}
+		fmt.Printf("  %-3d %-30s %s%-8s%s %8s %8s  %s\n", i+1, truncate(j.Title, 30), stateColor, j.State, colorReset, progress, elapsed, truncate(details, 60))
+	}
+}
+
+// clearFinishedJobs drops the jobs that are done or failed from the list.
+func clearFinishedJobs() {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	var kept []*queuedJob
+	for _, j := range queueJobs {
+		if j.State == jobQueued || j.State == jobRunning {
+			kept = append(kept, j)
+		}
+	}
+	queueJobs = kept
+}
+
+// stopQueue drops the waiting jobs, interrupts the running ones so they
+// clean up, and waits for them to exit.
+func stopQueue() {
+	queueMu.Lock()
+	for _, j := range queueJobs {
+		switch {
+		case j.State == jobQueued:
+			j.State, j.Err, j.Finished = jobFailed, errors.New("not run (queue stopped)"), time.Now()
+		case j.State == jobRunning && j.cmd != nil:
+			j.cmd.Process.Signal(os.Interrupt)
+		}
+	}
+	queueMu.Unlock()
+	done := make(chan bool)
+	go showSpinner("queue", "Stopping the running jobs...", done)
+	for {
+		if _, running, _ := queueCounts(); running == 0 {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	done <- true
+}
+
+// confirmLeaveQueue asks whether to stop unfinished jobs before the tool
+// exits, and reports whether it may exit.
+func confirmLeaveQueue() bool {
+	queued, running, _ := queueCounts()
+	if queued+running == 0 {
+		return true
+	}
+	fmt.Printf("%s> %d job(s) of the queue are not finished. Stop them and exit? (y/N): %s", colorYellow, queued+running, colorReset)
+	if !confirmAction() {
+		return false
+	}
+	stopQueue()
+	return true
+}
+
+// queueAvailable reports whether child processes can run jobs: they cannot
+// ask for the passphrase of an encrypted state.
+func queueAvailable() bool {
+	if cfg.Security.EncryptState && cfg.Security.Unlock != unlockKeyring {
+		logWarning("The job queue needs [security] unlock = \"keyring\": background jobs cannot ask for the passphrase of the encrypted state.")
+		return false
+	}
+	return true
+}
+
+// handleQueue shows the job queue, refreshing it while it waits for a key,
+// and queues new jobs.
+func handleQueue(containers []Container) {
+	if !queueAvailable() {
+		return
+	}
+	for {
+		draw := func() {
+			fmt.Print("\033[H\033[2J")
+			printTitle(colorCyan, "🧾 Job Queue")
+			printQueue()
+			fmt.Printf("\n  %sb)%s Queue backups   %sv)%s Queue a verify   %sc)%s Clear finished   %sr)%s Refresh   %sEnter)%s Back\n",
+				colorGreen, colorReset, colorBlue, colorReset, colorYellow, colorReset, colorWhite, colorReset, colorWhite, colorReset)
+			fmt.Printf("  Up to %d job(s) run at once ([queue] parallel).\n\n", cfg.Queue.Parallel)
+		}
+		var choice string
+		if tuiEnabled() {
+			choice = waitForKey(draw)
+		} else {
+			draw()
+			fmt.Printf("%s> Choose an option: %s", colorBold, colorReset)
+			choice = readUserInput()
+		}
+		switch strings.ToLower(choice) {
+		case "b":
+			queueBackups(containers)
+		case "v":
+			queueVerify()
+		case "c":
+			clearFinishedJobs()
+		case "r":
+		case "":
+			return
+		}
+	}
+}
+
+// waitForKey redraws the screen with draw every second until a key is
+// pressed, and returns it; Enter and Esc return "".
+func waitForKey(draw func()) string {
+	saved, err := stty("-g")
+	if err != nil {
+		draw()
+		return readUserInput()
+	}
+	stty("-icanon", "-echo", "min", "0", "time", "10")
+	cancel := onInterrupt(func() { stty(saved) })
+	defer func() {
+		stty(saved)
+		cancel()
+	}()
+	for {
+		draw()
+		key, text, err := readKey()
+		if err != nil {
+			continue // no key within the second
+		}
+		switch {
+		case key == keyEnter || key == keyEscape:
+			return ""
+		case text != "":
+			return text[:1]
+		}
+	}
+}
+
+// queueBackups queues a backup of each chosen container into one folder.
+func queueBackups(containers []Container) {
+	if len(containers) == 0 {
+		logWarning("There are no containers to back up.")
+		acknowledge("Press Enter to continue...")
+		return
+	}
+	fmt.Println()
+	chosen := selectContainers("the containers to back up", containers)
+	if len(chosen) == 0 {
+		return
+	}
+	logInfo("Please choose a backup destination folder.")
+	destDir, err := selectDirectory("Select Backup Folder")
+	if err != nil || destDir == "" {
+		if err != nil {
+			logError(err.Error())
+		}
+		logError("No valid destination directory selected.")
+		acknowledge("Press Enter to continue...")
+		return
+	}
+	for _, c := range orderContainers(chosen) {
+		enqueueJob("backup "+c.Name, "backup", "--container", c.Name, "--dest", destDir)
+	}
+}
+
+// queueVerify queues a check of a backup archive.
+func queueVerify() {
+	file, err := selectFile("Select Backup File", backupFileFilters...)
+	if err != nil || file == "" {
+		if err != nil {
+			logError(err.Error())
+			acknowledge("Press Enter to continue...")
+		}
+		return
+	}
+	enqueueJob("verify "+filepath.Base(file), "verify", "--file", file)
+}
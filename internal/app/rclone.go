@@ -0,0 +1,193 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// rclone remotes are addressed as "<remote>:<path>", like the scp-style SSH
+// targets. A spec whose host part names a remote from `rclone listremotes`
+// is an rclone target; "rclone:<remote>:<path>" forces one, and
+// "ssh://host/path" forces SSH.
+
+var (
+	rcloneRemotesOnce sync.Once
+	rcloneRemoteNames map[string]bool
+)
+
+// rcloneRemotes returns the names of the configured rclone remotes.
+func rcloneRemotes() map[string]bool {
+	rcloneRemotesOnce.Do(func() {
+		rcloneRemoteNames = map[string]bool{}
+		if !commandExists("rclone") {
+			return
+		}
+		out, err := runCommand("rclone", "listremotes")
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Fields(out) {
+			rcloneRemoteNames[strings.TrimSuffix(line, ":")] = true
+		}
+	})
+	return rcloneRemoteNames
+}
+
+// parseRclone recognises "rclone:remote:path" and "remote:path" for a
+// configured rclone remote.
+func parseRclone(spec string) (remoteTarget, bool) {
+	explicit := false
+	if rest, ok := strings.CutPrefix(spec, "rclone:"); ok {
+		spec, explicit = rest, true
+	}
+	name, p, ok := strings.Cut(spec, ":")
+	if !ok || name == "" || strings.ContainsAny(name, "/@") {
+		return remoteTarget{}, false
+	}
+	if !explicit && !rcloneRemotes()[name] {
+		return remoteTarget{}, false
+	}
+	return remoteTarget{Host: name, Path: p, Rclone: true}, true
+}
+
+// rcloneFile returns the rclone path of a file inside the target directory.
+func (t remoteTarget) rcloneFile(name string) string {
+	return t.Host + ":" + path.Join(t.Path, name)
+}
+
+// rcloneFlags returns the transfer options from [transfer].
+func rcloneFlags() []string {
+	flags := []string{"--retries", strconv.Itoa(cfg.Transfer.Retries + 1)}
+	if cfg.Transfer.BandwidthLimit > 0 {
+		flags = append(flags, "--bwlimit", strconv.FormatInt(cfg.Transfer.BandwidthLimit, 10)+"B")
+	}
+	return flags
+}
+
+func (t remoteTarget) rclonePrepare() (uint64, error) {
+	if !commandExists("rclone") {
+		return 0, fmt.Errorf("'rclone' is not installed")
+	}
+	if _, err := runCommand("rclone", "mkdir", t.Host+":"+t.Path); err != nil {
+		return 0, fmt.Errorf("%s is not reachable or not writable: %w", t, err)
+	}
+	// Many backends cannot report their free space; 0 means unknown.
+	out, err := runCommand("rclone", "about", "--json", t.Host+":")
+	if err != nil {
+		return 0, nil
+	}
+	var about struct {
+		Free *uint64 `json:"free"`
+	}
+	if json.Unmarshal([]byte(out), &about) != nil || about.Free == nil {
+		return 0, nil
+	}
+	return *about.Free, nil
+}
+
+// rcloneUpload copies localPath into place with `rclone copyto`, which
+// retries failed transfers and compares checksums where the backend
+// supports them.
+func (t remoteTarget) rcloneUpload(localPath, name string) error {
+	args := append([]string{"copyto"}, rcloneFlags()...)
+	if _, err := runCommand("rclone", append(args, localPath, t.rcloneFile(name))...); err != nil {
+		return fmt.Errorf("upload of %s failed: %w", name, err)
+	}
+	return nil
+}
+
+// rcloneDownload fetches a file with `rclone copyto` into localPath.part,
+// verifies it against wantSHA256 when given, and renames it.
+func (t remoteTarget) rcloneDownload(name, localPath, wantSHA256 string) error {
+	partPath := localPath + ".part"
+	args := append([]string{"copyto"}, rcloneFlags()...)
+	if _, err := runCommand("rclone", append(args, t.rcloneFile(name), partPath)...); err != nil {
+		return fmt.Errorf("download of %s failed: %w", name, err)
+	}
+	if wantSHA256 != "" {
+		got, err := fileSHA256(partPath, -1)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(got, wantSHA256) {
+			os.Remove(partPath)
+			return fmt.Errorf("downloaded %s is corrupt: sha256 %s, expected %s", name, got, wantSHA256)
+		}
+	}
+	return os.Rename(partPath, localPath)
+}
+
+// rcloneOpen streams a file of the target with `rclone cat`.
+func (t remoteTarget) rcloneOpen(name string) (io.ReadCloser, error) {
+	args := append([]string{"cat"}, rcloneFlags()...)
+	return startReader(commandRunner("rclone", append(args, t.rcloneFile(name))...))
+}
+
+// rcloneEntry is an entry of `rclone lsjson`.
+type rcloneEntry struct {
+	Name string `json:"Name"`
+	Size int64  `json:"Size"`
+}
+
+// rcloneList lists the files of the target directory.
+func (t remoteTarget) rcloneList() ([]rcloneEntry, error) {
+	out, err := runCommand("rclone", "lsjson", "--files-only", t.Host+":"+t.Path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []rcloneEntry
+	if err := json.Unmarshal([]byte(out), &entries); err != nil {
+		return nil, fmt.Errorf("unexpected rclone output: %w", err)
+	}
+	return entries, nil
+}
+
+func (t remoteTarget) rcloneListArchives() ([]remoteArchive, error) {
+	entries, err := t.rcloneList()
+	if err != nil {
+		return nil, err
+	}
+	present := map[string]bool{}
+	for _, e := range entries {
+		present[e.Name] = true
+	}
+	var archives []remoteArchive
+	for _, e := range entries {
+		if !isBackupArchiveName(e.Name) {
+			continue
+		}
+		a := remoteArchive{Name: e.Name, Size: e.Size}
+		if present[manifestPath(e.Name)] {
+			a.Manifest, _ = t.readManifest(e.Name)
+		}
+		archives = append(archives, a)
+	}
+	return archives, nil
+}
+
+// rcloneRemove deletes those of the named files that exist.
+func (t remoteTarget) rcloneRemove(names []string) error {
+	entries, err := t.rcloneList()
+	if err != nil {
+		return err
+	}
+	present := map[string]bool{}
+	for _, e := range entries {
+		present[e.Name] = true
+	}
+	for _, name := range names {
+		if !present[name] {
+			continue
+		}
+		if _, err := runCommand("rclone", "deletefile", t.rcloneFile(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
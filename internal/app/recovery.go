@@ -0,0 +1,116 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// recoveryError is returned by operations that failed after leaving an image
+// behind from which the container can still be recreated. Interactive
+// handlers pass it to offerRecovery; the CLI just reports it.
+type recoveryError struct {
+	Err error
+	// Image is the kept image; Temporary marks a journaled temp image.
+	Image     string
+	Temporary bool
+	// Recreate recreates the container from Image; Removed tells that the
+	// original container is already gone.
+	Recreate backup.CreateOptions
+	Removed  bool
+}
+
+func (e *recoveryError) Error() string {
+	return fmt.Sprintf("%v (the image '%s' was kept for recovery)", e.Err, e.Image)
+}
+
+func (e *recoveryError) Unwrap() error {
+	return e.Err
+}
+
+// rollBack recreates a container that an operation removed, from the image
+// it committed first, after the operation failed to create the replacement
+// named failed. Whatever distrobox-create left of that is removed first; the
+// container is started again if it was running and its exports are made
+// again. The image becomes the container's, so the caller releases it.
+func rollBack(original Container, failed string, recreate backup.CreateOptions, exports *backup.Manifest) error {
+	if _, err := inspectContainer(failed); err == nil {
+		if err := client.RemoveContainer(failed); err != nil {
+			return fmt.Errorf("could not remove the half-created '%s': %w", failed, err)
+		}
+	}
+	done := make(chan bool)
+	go showSpinner("rollback", fmt.Sprintf("Recreating '%s' as it was...", original.Name), done)
+	err := client.CreateFromImage(recreate)
+	done <- true
+	if err != nil {
+		return err
+	}
+	if original.State == "running" {
+		if _, err := runCommand(containerRuntime, "start", original.Name); err != nil {
+			logWarning(fmt.Sprintf("Could not start '%s' again: %v", original.Name, err))
+		}
+	}
+	reexport(original.Name, exports)
+	return nil
+}
+
+// offerRecovery shows what a failed operation left behind and lets the user
+// recreate the container from the kept image or remove the image.
+func offerRecovery(operation string, r *recoveryError) {
+	for {
+		fmt.Println()
+		printTitle(colorYellow, fmt.Sprintf("🛟 Recovery: %s of '%s' failed", operation, r.Recreate.Name))
+		logError(r.Err.Error())
+		fmt.Printf("\n  %sLeft behind:%s\n", colorBold, colorReset)
+		fmt.Printf("  - Image %s%s%s (kept)\n", colorCyan, r.Image, colorReset)
+		if r.Removed {
+			fmt.Printf("  - Container '%s': %sremoved%s\n", r.Recreate.Name, colorRed, colorReset)
+		} else {
+			fmt.Printf("  - Container '%s': not created\n", r.Recreate.Name)
+		}
+		if r.Recreate.Home != "" {
+			fmt.Printf("  - Home directory %s (untouched)\n", r.Recreate.Home)
+		}
+		fmt.Printf("\n  %sr)%s Recreate container '%s' from the image\n", colorGreen, colorReset, r.Recreate.Name)
+		fmt.Printf("  %sd)%s Delete the image\n", colorRed, colorReset)
+		fmt.Printf("  %sk)%s Keep everything and recover later\n", colorWhite, colorReset)
+		fmt.Printf("%s> Choose an action [k]: %s", colorBold, colorReset)
+
+		switch strings.ToLower(readUserInput()) {
+		case "r":
+			done := make(chan bool)
+			go showSpinner("recover", "Recreating container...", done)
+			err := client.CreateFromImage(r.Recreate)
+			done <- true
+			if err != nil {
+				r.Err = fmt.Errorf("recreating the container failed: %w", err)
+				continue
+			}
+			if r.Temporary {
+				releaseTempImage(r.Image) // now the container's image
+			}
+			logSuccess(fmt.Sprintf("✅ Container '%s' was recreated from '%s'.", r.Recreate.Name, r.Image))
+			return
+		case "d":
+			if r.Removed {
+				fmt.Printf("%s> The image is the only copy of '%s'. Delete it anyway? (y/N): %s", colorRed, r.Recreate.Name, colorReset)
+			} else {
+				fmt.Printf("%s> Delete the image '%s'? (y/N): %s", colorBold, r.Image, colorReset)
+			}
+			if !confirmAction() {
+				continue
+			}
+			if r.Temporary {
+				removeTempImage(r.Image)
+			} else if err := client.RemoveImage(r.Image); err != nil {
+				logWarning(fmt.Sprintf("Failed to remove '%s': %v", r.Image, err))
+			}
+			return
+		default:
+			logInfo(fmt.Sprintf("Kept '%s'. Recreate the container later with: distrobox-create %s", r.Image, strings.Join(r.Recreate.Args(), " ")))
+			return
+		}
+	}
+}
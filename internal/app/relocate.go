@@ -0,0 +1,133 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// homeConfigFiles are files inside a home that commonly embed absolute paths.
+var homeConfigFiles = []string{
+	".bashrc",
+	".bash_profile",
+	".profile",
+	".zshrc",
+	".zprofile",
+	".config/fish/config.fish",
+	".gitconfig",
+	".config/user-dirs.dirs",
+	".pam_environment",
+}
+
+// restoreHomePath picks the isolated home for a restored container. Homes in
+// the home root (the tool's default or distrobox's container_home_prefix)
+// follow the new container name under the current root; custom homes
+// recorded in the manifest are reused, and if they lived under another user's
+// home the user is offered the equivalent path under their own.
+func restoreHomePath(m *backup.Manifest, containerName string) (string, error) {
+	defaultHome, err := getIsolatedHomePath(containerName)
+	if m == nil || m.Home == "" || m.HostHome == "" {
+		return defaultHome, err
+	}
+	if m.Home == filepath.Join(m.HostHome, ".local", "share", "distrobox", "homes", m.ContainerName) {
+		return defaultHome, err
+	}
+	if root, rootErr := distroboxHomeRoot(); rootErr == nil && m.Home == filepath.Join(root, m.ContainerName) {
+		return defaultHome, err
+	}
+
+	currentHome, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if m.HostHome == currentHome || !strings.HasPrefix(m.Home, m.HostHome+string(os.PathSeparator)) {
+		logInfo(fmt.Sprintf("Using the home directory recorded in the backup: %s", m.Home))
+		return m.Home, nil
+	}
+
+	relocated := filepath.Join(currentHome, strings.TrimPrefix(m.Home, m.HostHome))
+	logInfo(fmt.Sprintf("The backup's home was '%s' (under %s).", m.Home, m.HostHome))
+	fmt.Printf("%s> Relocate it to '%s'? (y/N): %s", colorBold, relocated, colorReset)
+	if confirmAction() {
+		return relocated, nil
+	}
+	return m.Home, nil
+}
+
+// checkHomeTarget refuses a folder for a restored home that already holds
+// files: the backup's home would be mixed into it, or, were it emptied
+// first, a folder named by a manifest or by mistake would be lost.
+func checkHomeTarget(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%s already exists and is not empty; restore the home into a new or empty folder", dir)
+	}
+	return nil
+}
+
+// offerHomePathRewrite asks to replace the original user's home path with the
+// current one in well-known config files of a restored home.
+func offerHomePathRewrite(m *backup.Manifest, homeDir string) {
+	if m == nil || m.HostHome == "" {
+		return
+	}
+	currentHome, err := os.UserHomeDir()
+	if err != nil || currentHome == m.HostHome {
+		return
+	}
+	fmt.Printf("%s> Rewrite references to '%s' with '%s' in shell and config files? (y/N): %s", colorBold, m.HostHome, currentHome, colorReset)
+	if !confirmAction() {
+		return
+	}
+	changed, err := rewriteHomePaths(homeDir, m.HostHome, currentHome)
+	if err != nil {
+		logWarning(fmt.Sprintf("Could not rewrite all files: %v", err))
+	}
+	if len(changed) == 0 {
+		logInfo("No config files referenced the old home path.")
+		return
+	}
+	for _, f := range changed {
+		logSuccess(fmt.Sprintf("✏️  Updated %s", f))
+	}
+}
+
+// rewriteHomePaths replaces oldPrefix with newPrefix in the known config
+// files under homeDir and returns the files that changed.
+func rewriteHomePaths(homeDir, oldPrefix, newPrefix string) ([]string, error) {
+	// Only match whole path components so /home/al does not rewrite /home/alice.
+	pattern := regexp.MustCompile(regexp.QuoteMeta(oldPrefix) + `([^A-Za-z0-9._-]|$)`)
+	replacement := []byte(strings.ReplaceAll(newPrefix, "$", "$$") + "${1}")
+	var changed []string
+	for _, rel := range homeConfigFiles {
+		path := filepath.Join(homeDir, rel)
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return changed, err
+		}
+		updated := pattern.ReplaceAll(data, replacement)
+		if bytes.Equal(updated, data) {
+			continue
+		}
+		if err := os.WriteFile(path, updated, info.Mode().Perm()); err != nil {
+			return changed, err
+		}
+		changed = append(changed, rel)
+	}
+	return changed, nil
+}
@@ -0,0 +1,66 @@
+package app
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+func TestRestoreHomePath(t *testing.T) {
+	home := t.TempDir()
+	root := filepath.Join(home, "homes")
+	t.Setenv("HOME", home)
+	saved := *cfg
+	t.Cleanup(func() { *cfg = saved })
+	cfg.Homes.Root = root
+	savedYes := assumeYes
+	t.Cleanup(func() { assumeYes = savedYes })
+
+	tests := []struct {
+		name string
+		m    *backup.Manifest
+		yes  bool
+		want string
+	}{
+		{"no manifest", nil, false, filepath.Join(root, "new")},
+		{"no recorded home", &backup.Manifest{ContainerName: "old"}, false, filepath.Join(root, "new")},
+		{
+			"distrobox default of another user",
+			&backup.Manifest{ContainerName: "old", HostHome: "/home/alice", Home: "/home/alice/.local/share/distrobox/homes/old"},
+			false, filepath.Join(root, "new"),
+		},
+		{
+			"home root",
+			&backup.Manifest{ContainerName: "old", HostHome: home, Home: filepath.Join(root, "old")},
+			false, filepath.Join(root, "new"),
+		},
+		{
+			"custom home of the same user",
+			&backup.Manifest{ContainerName: "old", HostHome: home, Home: filepath.Join(home, "boxes", "old")},
+			false, filepath.Join(home, "boxes", "old"),
+		},
+		{
+			"custom home outside the user's home",
+			&backup.Manifest{ContainerName: "old", HostHome: "/home/alice", Home: "/srv/homes/old"},
+			false, "/srv/homes/old",
+		},
+		{
+			"custom home of another user, relocated",
+			&backup.Manifest{ContainerName: "old", HostHome: "/home/alice", Home: "/home/alice/boxes/old"},
+			true, filepath.Join(home, "boxes", "old"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assumeYes = tt.yes
+			got, err := restoreHomePath(tt.m, "new")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("restoreHomePath = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,892 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// remoteTarget is a directory on a host reachable over SSH, or in an rclone
+// remote when Rclone is set.
+type remoteTarget struct {
+	Host string // [user@]host, as passed to ssh, or the rclone remote name
+	Port string
+	Path string
+	// Rclone transfers with the rclone command instead of ssh.
+	Rclone bool
+}
+
+// String returns the target in a form parseRemote accepts.
+func (t remoteTarget) String() string {
+	if t.Rclone {
+		return "rclone:" + t.Host + ":" + t.Path
+	}
+	if t.Port != "" {
+		return "ssh://" + t.Host + ":" + t.Port + path.Join("/", t.Path)
+	}
+	return t.Host + ":" + t.Path
+}
+
+// parseRemote recognises "user@host:/path" and "ssh://user@host:port/path",
+// and rclone targets (see parseRclone). Local paths (including ones
+// containing ':' after a '/') are rejected.
+func parseRemote(spec string) (remoteTarget, bool) {
+	if t, ok := parseRclone(spec); ok {
+		return t, true
+	}
+	if strings.HasPrefix(spec, "ssh://") || strings.HasPrefix(spec, "sftp://") {
+		u, err := url.Parse(spec)
+		if err != nil || u.Hostname() == "" {
+			return remoteTarget{}, false
+		}
+		host := u.Hostname()
+		if u.User != nil {
+			host = u.User.Username() + "@" + host
+		}
+		p := u.Path
+		if p == "" {
+			p = "."
+		}
+		return remoteTarget{Host: host, Port: u.Port(), Path: p}, true
+	}
+	host, p, ok := strings.Cut(spec, ":")
+	if !ok || host == "" || strings.Contains(host, "/") {
+		return remoteTarget{}, false
+	}
+	if p == "" {
+		p = "."
+	}
+	return remoteTarget{Host: host, Path: p}, true
+}
+
+// sshControl holds the folder for ssh's control sockets, made once.
+var sshControl struct {
+	once sync.Once
+	dir  string
+}
+
+// sshControlDir returns a folder only the user can enter for ssh's control
+// sockets: $XDG_RUNTIME_DIR, or else a new private folder in the temporary
+// directory, as a predictable name there could be taken by another user.
+// It returns "" when neither is available.
+func sshControlDir() string {
+	sshControl.once.Do(func() {
+		if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+			sshControl.dir = dir
+			return
+		}
+		if dir, err := os.MkdirTemp("", "dbt-ssh-"); err == nil {
+			sshControl.dir = dir
+		}
+	})
+	return sshControl.dir
+}
+
+// sshArgs returns the ssh options shared by every call. Connection sharing
+// keeps a browse-then-download session to a single authentication.
+func (t remoteTarget) sshArgs() []string {
+	args := []string{"-o", "ControlMaster=no"}
+	if dir := sshControlDir(); dir != "" {
+		args = []string{
+			"-o", "ControlMaster=auto",
+			"-o", "ControlPath=" + filepath.Join(dir, "dbt-ssh-%C"),
+			"-o", "ControlPersist=60",
+		}
+	}
+	if t.Port != "" {
+		args = append(args, "-p", t.Port)
+	}
+	return append(args, "--", t.Host)
+}
+
+// run executes a shell script on the remote host.
+func (t remoteTarget) run(script string) (string, error) {
+	return runCommand("ssh", append(t.sshArgs(), script)...)
+}
+
+// join returns the spec of a file inside the target directory, for messages.
+func (t remoteTarget) join(name string) string {
+	return strings.TrimSuffix(t.String(), "/") + "/" + name
+}
+
+// file returns the quoted remote path of a file inside the target directory.
+func (t remoteTarget) file(name string) string {
+	return shellQuote(path.Join(t.Path, name))
+}
+
+// download copies a remote file in the target directory to localPath. The
+// data goes to localPath.part first; interrupted transfers are resumed from
+// the bytes already received after checking that they still match the
+// remote file, and the finished file is verified against the remote sha256
+// (or wantSHA256 when the manifest records it) before it is renamed.
+func (t remoteTarget) download(name, localPath, wantSHA256 string) error {
+	if t.Rclone {
+		return t.rcloneDownload(name, localPath, wantSHA256)
+	}
+	partPath := localPath + ".part"
+	var lastErr error
+	for attempt := 0; attempt <= cfg.Transfer.Retries; attempt++ {
+		if attempt > 0 {
+			logWarning(fmt.Sprintf("Transfer of %s interrupted (%v); resuming (attempt %d of %d)...", name, lastErr, attempt, cfg.Transfer.Retries))
+			time.Sleep(time.Duration(attempt) * 2 * time.Second)
+		}
+		if lastErr = t.downloadPart(name, partPath); lastErr == nil {
+			break
+		}
+	}
+	if lastErr != nil {
+		return fmt.Errorf("download of %s failed: %w", name, lastErr)
+	}
+
+	if wantSHA256 == "" {
+		out, err := t.run("sha256sum " + t.file(name))
+		if err != nil {
+			logWarning(fmt.Sprintf("Could not checksum %s on the remote host; skipping verification.", name))
+		} else {
+			wantSHA256, _, _ = strings.Cut(strings.TrimSpace(out), " ")
+		}
+	}
+	if wantSHA256 != "" {
+		got, err := fileSHA256(partPath, -1)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(got, wantSHA256) {
+			os.Remove(partPath)
+			return fmt.Errorf("downloaded %s is corrupt: sha256 %s, expected %s", name, got, wantSHA256)
+		}
+	}
+	return os.Rename(partPath, localPath)
+}
+
+// commandReader is the output of a running command. Close waits for the
+// command and reports its failure with what it printed on stderr.
+type commandReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *strings.Builder
+}
+
+// startReader starts cmd and returns its output.
+func startReader(cmd *exec.Cmd) (io.ReadCloser, error) {
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &strings.Builder{}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandReader{ReadCloser: out, cmd: cmd, stderr: stderr}, nil
+}
+
+func (r *commandReader) Close() error {
+	r.ReadCloser.Close()
+	if err := r.cmd.Wait(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(r.stderr.String()))
+	}
+	return nil
+}
+
+// open streams a file of the target directory, at the configured
+// bandwidth limit.
+func (t remoteTarget) open(name string) (io.ReadCloser, error) {
+	if t.Rclone {
+		return t.rcloneOpen(name)
+	}
+	r, err := startReader(commandRunner("ssh", append(t.sshArgs(), "cat "+t.file(name))...))
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{newRateLimitedReader(r, cfg.Transfer.BandwidthLimit), r}, nil
+}
+
+// downloadPart appends the missing tail of a remote file to partPath.
+func (t remoteTarget) downloadPart(name, partPath string) error {
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+	if offset > 0 {
+		// Only resume if the bytes we have are still a prefix of the remote file.
+		remoteSum, err := t.run(fmt.Sprintf("head -c %d %s | sha256sum", offset, t.file(name)))
+		localSum, lerr := fileSHA256(partPath, offset)
+		remoteSum, _, _ = strings.Cut(strings.TrimSpace(remoteSum), " ")
+		if err != nil || lerr != nil || remoteSum != localSum {
+			logWarning(fmt.Sprintf("Partial download of %s does not match the remote file; starting over.", name))
+			offset = 0
+		} else {
+			logInfo(fmt.Sprintf("Resuming %s at %s.", name, formatBytes(uint64(offset))))
+		}
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	out, err := os.OpenFile(partPath, flags, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	cmd := commandRunner("ssh", append(t.sshArgs(), fmt.Sprintf("tail -c +%d %s", offset+1, t.file(name)))...)
+	cmd.Stdout = newRateLimitedWriter(out, cfg.Transfer.BandwidthLimit)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// prepare tests the connection, creates the target directory if needed and
+// checks that it is writable. It returns the free space in the directory.
+func (t remoteTarget) prepare() (uint64, error) {
+	if t.Rclone {
+		return t.rclonePrepare()
+	}
+	out, err := t.run(fmt.Sprintf("mkdir -p %[1]s && test -w %[1]s && df -Pk %[1]s | awk 'NR==2 {print $4}'", shellQuote(t.Path)))
+	if err != nil {
+		return 0, fmt.Errorf("%s is not reachable or not writable: %w", t, err)
+	}
+	kb, err := strconv.ParseUint(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not read the free space of %s", t)
+	}
+	return kb * 1024, nil
+}
+
+// upload copies localPath to name in the target directory. The data goes to
+// name.part first; interrupted transfers are resumed from the bytes already
+// on the remote host after checking that they still match the local file,
+// and the finished file is compared with the local sha256 before it is
+// renamed into place.
+func (t remoteTarget) upload(localPath, name string) error {
+	if t.Rclone {
+		return t.rcloneUpload(localPath, name)
+	}
+	partName := name + ".part"
+	var lastErr error
+	for attempt := 0; attempt <= cfg.Transfer.Retries; attempt++ {
+		if attempt > 0 {
+			logWarning(fmt.Sprintf("Upload of %s interrupted (%v); resuming (attempt %d of %d)...", name, lastErr, attempt, cfg.Transfer.Retries))
+			time.Sleep(time.Duration(attempt) * 2 * time.Second)
+		}
+		if lastErr = t.uploadPart(localPath, partName); lastErr == nil {
+			break
+		}
+	}
+	if lastErr != nil {
+		return fmt.Errorf("upload of %s failed: %w", name, lastErr)
+	}
+
+	want, err := fileSHA256(localPath, -1)
+	if err != nil {
+		return err
+	}
+	out, err := t.run("sha256sum " + t.file(partName))
+	if err != nil {
+		return fmt.Errorf("could not checksum the uploaded %s: %w", name, err)
+	}
+	if got, _, _ := strings.Cut(strings.TrimSpace(out), " "); !strings.EqualFold(got, want) {
+		t.run("rm -f " + t.file(partName))
+		return fmt.Errorf("uploaded %s is corrupt: sha256 %s, expected %s", name, got, want)
+	}
+	_, err = t.run(fmt.Sprintf("mv -f %s %s", t.file(partName), t.file(name)))
+	return err
+}
+
+// uploadPart appends the part of localPath missing on the remote host to
+// partName.
+func (t remoteTarget) uploadPart(localPath, partName string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	out, err := t.run(fmt.Sprintf("if [ -f %[1]s ]; then wc -c < %[1]s; else echo 0; fi", t.file(partName)))
+	if err == nil {
+		offset, _ = strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	}
+	if offset > info.Size() {
+		offset = 0
+	}
+	if offset > 0 {
+		// Only resume if the bytes on the remote host are still a prefix of
+		// the local file.
+		remoteSum, err := t.run("sha256sum " + t.file(partName))
+		localSum, lerr := fileSHA256(localPath, offset)
+		remoteSum, _, _ = strings.Cut(strings.TrimSpace(remoteSum), " ")
+		if err != nil || lerr != nil || remoteSum != localSum {
+			logWarning(fmt.Sprintf("Partial upload of %s does not match the local file; starting over.", filepath.Base(localPath)))
+			offset = 0
+		} else {
+			logInfo(fmt.Sprintf("Resuming %s at %s.", filepath.Base(localPath), formatBytes(uint64(offset))))
+		}
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	redirect := ">"
+	if offset > 0 {
+		redirect = ">>"
+	}
+	cmd := commandRunner("ssh", append(t.sshArgs(), fmt.Sprintf("cat %s %s", redirect, t.file(partName)))...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	_, copyErr := io.Copy(newRateLimitedWriter(stdin, cfg.Transfer.BandwidthLimit), f)
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return copyErr
+}
+
+// streamUpload runs save with a writer to name.part in the target
+// directory, so an archive goes to the remote host as it is written
+// instead of being staged locally. A stream cannot be resumed: when the
+// transfer fails the part is removed. The size and sha256 of what was sent
+// are recorded in m, and the part is compared with them; commit renames it
+// into place.
+func (t remoteTarget) streamUpload(name string, m *backup.Manifest, save func(io.Writer) error) error {
+	partName := name + partialSuffix
+	cmd := commandRunner("ssh", append(t.sshArgs(), "cat > "+t.file(partName))...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	h := sha256.New()
+	counter := &countingWriter{}
+	err = save(io.MultiWriter(newRateLimitedWriter(stdin, cfg.Transfer.BandwidthLimit), h, counter))
+	stdin.Close()
+	if waitErr := cmd.Wait(); waitErr != nil && err == nil {
+		err = fmt.Errorf("upload of %s failed: %w: %s", name, waitErr, strings.TrimSpace(stderr.String()))
+	}
+	if err == nil {
+		m.Size, m.SHA256 = counter.n, hex.EncodeToString(h.Sum(nil))
+		out, sumErr := t.run("sha256sum " + t.file(partName))
+		if got, _, _ := strings.Cut(strings.TrimSpace(out), " "); sumErr != nil {
+			err = fmt.Errorf("could not checksum the uploaded %s: %w", name, sumErr)
+		} else if !strings.EqualFold(got, m.SHA256) {
+			err = fmt.Errorf("uploaded %s is corrupt: sha256 %s, expected %s", name, got, m.SHA256)
+		}
+	}
+	if err != nil {
+		t.remove(partName)
+	}
+	return err
+}
+
+// commit renames a part written by streamUpload into place.
+func (t remoteTarget) commit(name string) error {
+	_, err := t.run(fmt.Sprintf("mv -f %s %s", t.file(name+partialSuffix), t.file(name)))
+	return err
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct{ n int64 }
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// exists reports whether a file exists in the remote directory.
+func (t remoteTarget) exists(name string) bool {
+	if t.Rclone {
+		out, err := runCommand("rclone", "lsf", t.rcloneFile(name))
+		return err == nil && strings.TrimSpace(out) != ""
+	}
+	_, err := t.run("test -f " + t.file(name))
+	return err == nil
+}
+
+// size returns the size of a file in the remote directory.
+func (t remoteTarget) size(name string) (int64, error) {
+	var out string
+	var err error
+	if t.Rclone {
+		out, err = runCommand("rclone", "size", "--json", t.rcloneFile(name))
+		var s struct {
+			Count int   `json:"count"`
+			Bytes int64 `json:"bytes"`
+		}
+		if err == nil {
+			if err = json.Unmarshal([]byte(out), &s); err == nil && s.Count == 0 {
+				err = fmt.Errorf("%s does not exist", t.join(name))
+			}
+		}
+		return s.Bytes, err
+	}
+	if out, err = t.run("wc -c < " + t.file(name)); err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+}
+
+// readManifest reads the sidecar manifest of an archive in the remote
+// directory.
+func (t remoteTarget) readManifest(name string) (*backup.Manifest, error) {
+	var text string
+	var err error
+	if t.Rclone {
+		text, err = runCommand("rclone", "cat", t.rcloneFile(manifestPath(name)))
+	} else {
+		text, err = t.run("cat " + t.file(manifestPath(name)))
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m backup.Manifest
+	if err := json.Unmarshal([]byte(text), &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// remove deletes the named files from the remote directory; missing ones
+// are ignored.
+func (t remoteTarget) remove(names ...string) error {
+	if t.Rclone {
+		return t.rcloneRemove(names)
+	}
+	var quoted []string
+	for _, name := range names {
+		quoted = append(quoted, t.file(name))
+	}
+	_, err := t.run("rm -f " + strings.Join(quoted, " "))
+	return err
+}
+
+// remoteArchive is a backup archive found on a remote target.
+type remoteArchive struct {
+	Name     string
+	Size     int64
+	Manifest *backup.Manifest
+}
+
+// isBackupArchiveName reports whether a file name looks like a restorable
+// archive rather than a sidecar or a separated home archive.
+func isBackupArchiveName(name string) bool {
+	if strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".part") || strings.HasSuffix(name, ".sha256") || strings.HasSuffix(name, ".sha256sums") || strings.HasSuffix(name, "-home.tar.gz") || strings.HasSuffix(name, systemArchiveSuffix) {
+		return false
+	}
+	return strings.HasSuffix(name, ".tar") || strings.Contains(name, ".tar.")
+}
+
+// listArchives lists the archives in the remote directory together with their
+// sidecar manifests, in one round trip that only transfers the manifests.
+func (t remoteTarget) listArchives() ([]remoteArchive, error) {
+	if t.Rclone {
+		archives, err := t.rcloneListArchives()
+		if err != nil {
+			return nil, err
+		}
+		return t.withEmbeddedManifests(archives), nil
+	}
+	script := fmt.Sprintf(`cd %s || exit 1
+for f in *.tar *.tar.*; do
+  [ -f "$f" ] || continue
+  printf '==> %%s\t%%s\n' "$(wc -c < "$f" | tr -d ' ')" "$f"
+  [ -f "$f.json" ] && cat "$f.json" && echo
+done`, shellQuote(t.Path))
+	out, err := t.run(script)
+	if err != nil {
+		return nil, err
+	}
+
+	var archives []remoteArchive
+	var current *remoteArchive
+	var manifestText strings.Builder
+	flush := func() {
+		if current == nil {
+			return
+		}
+		if text := strings.TrimSpace(manifestText.String()); text != "" {
+			var m backup.Manifest
+			if json.Unmarshal([]byte(text), &m) == nil {
+				current.Manifest = &m
+			}
+		}
+		if isBackupArchiveName(current.Name) {
+			archives = append(archives, *current)
+		}
+		manifestText.Reset()
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if rest, ok := strings.CutPrefix(line, "==> "); ok {
+			flush()
+			sizeStr, name, _ := strings.Cut(rest, "\t")
+			size, _ := strconv.ParseInt(sizeStr, 10, 64)
+			current = &remoteArchive{Name: name, Size: size}
+			continue
+		}
+		manifestText.WriteString(line + "\n")
+	}
+	flush()
+	return t.withEmbeddedManifests(archives), nil
+}
+
+// withEmbeddedManifests sorts archives by name and fills in the manifests
+// of those without a sidecar.
+func (t remoteTarget) withEmbeddedManifests(archives []remoteArchive) []remoteArchive {
+	sort.Slice(archives, func(i, j int) bool { return archives[i].Name < archives[j].Name })
+
+	// Without a sidecar, the manifest may still be embedded at the start of
+	// the archive; fetching the first few KB is enough to read it.
+	for i := range archives {
+		if archives[i].Manifest != nil {
+			continue
+		}
+		if head, err := t.head(archives[i].Name, backup.ManifestProbeSize); err == nil {
+			archives[i].Manifest, _ = backup.ReadEmbeddedManifest(bytes.NewReader(head))
+		}
+	}
+	return archives
+}
+
+// head returns the first n bytes of a remote file.
+func (t remoteTarget) head(name string, n int) ([]byte, error) {
+	if t.Rclone {
+		return commandRunner("rclone", "cat", "--count", strconv.Itoa(n), t.rcloneFile(name)).Output()
+	}
+	cmd := commandRunner("ssh", append(t.sshArgs(), fmt.Sprintf("head -c %d %s", n, t.file(name)))...)
+	return cmd.Output()
+}
+
+// shellQuote quotes s for use in a POSIX shell command line.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// remoteDestinations returns the configured destinations reachable over SSH.
+func remoteDestinations() (names []string, targets map[string]remoteTarget) {
+	targets = map[string]remoteTarget{}
+	for name, d := range cfg.Destinations {
+		if t, ok := parseRemote(d.Path); ok {
+			names = append(names, name)
+			targets[name] = t
+		}
+	}
+	sort.Strings(names)
+	return names, targets
+}
+
+// cacheDir returns a directory below $XDG_CACHE_HOME/distrobox-backup-tool.
+func cacheDir(name string) (string, error) {
+	base := os.Getenv("XDG_CACHE_HOME")
+	if base == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(homeDir, ".cache")
+	}
+	dir := filepath.Join(base, appName, name)
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// downloadDir returns the cache directory remote archives are fetched into.
+func downloadDir() (string, error) {
+	return cacheDir("downloads")
+}
+
+// uploadDir returns the cache directory backups for remote destinations are
+// written to before they are uploaded.
+func uploadDir() (string, error) {
+	return cacheDir("uploads")
+}
+
+// checkRemoteDestination tests the connection to a remote backup
+// destination and reports its free space.
+func checkRemoteDestination(t remoteTarget) error {
+	done := make(chan bool)
+	go showSpinner("connect", fmt.Sprintf("Connecting to %s...", t.Host), done)
+	free, err := t.prepare()
+	done <- true
+	if err != nil {
+		return err
+	}
+	if free == 0 {
+		logSuccess(fmt.Sprintf("✅ Connected to %s.", t.Host))
+		return nil
+	}
+	logSuccess(fmt.Sprintf("✅ Connected to %s; %s free in %s.", t.Host, formatBytes(free), t.Path))
+	return nil
+}
+
+// prepareBackupDest makes a backup destination ready: a local folder is
+// created, a remote one is tested.
+func prepareBackupDest(dest string) error {
+	if t, ok := parseRemote(dest); ok {
+		return checkRemoteDestination(t)
+	}
+	if err := makeBackupDir(dest); err != nil {
+		return fmt.Errorf("could not create the destination folder: %w", err)
+	}
+	return nil
+}
+
+// backupPath returns where a backup named name for dest is written: inside
+// dest, or for a remote dest in the upload cache, together with the target
+// it is then uploaded to.
+func backupPath(dest, name string) (string, *remoteTarget, error) {
+	t, ok := parseRemote(dest)
+	if !ok {
+		return filepath.Join(dest, name), nil, nil
+	}
+	dir, err := uploadDir()
+	if err != nil {
+		return "", nil, err
+	}
+	return filepath.Join(dir, name), &t, nil
+}
+
+// uploadBackup sends the files of a finished job to its remote target and
+// removes the local copies. When an upload fails, the files stay in the
+// upload cache so nothing is lost. The archive of a job that streamed it is
+// renamed into place once its sidecars are there.
+func uploadBackup(job backupJob) error {
+	t := *job.Upload
+	for _, f := range job.outputFiles() {
+		if !fileExists(f) {
+			continue
+		}
+		done := make(chan bool)
+		go showSpinner("upload", fmt.Sprintf("Uploading %s to %s...", filepath.Base(f), t.Host), done)
+		err := t.upload(f, filepath.Base(f))
+		done <- true
+		if err != nil && job.streams() {
+			return err
+		} else if err != nil {
+			return fmt.Errorf("%w; the backup was kept in %s", err, filepath.Dir(f))
+		}
+	}
+	if job.streams() {
+		if err := t.commit(filepath.Base(job.File)); err != nil {
+			return fmt.Errorf("could not move the uploaded %s into place: %w", filepath.Base(job.File), err)
+		}
+	}
+	for _, f := range job.outputFiles() {
+		os.Remove(f)
+	}
+	logSuccess(fmt.Sprintf("✅ Uploaded the backup to %s.", t))
+	return nil
+}
+
+// remoteFile splits a remote file spec such as user@host:/backups/a.tar
+// into its directory target and file name.
+func remoteFile(spec string) (remoteTarget, string, bool) {
+	t, ok := parseRemote(spec)
+	if !ok || t.Path == "." || strings.HasSuffix(t.Path, "/") {
+		return remoteTarget{}, "", false
+	}
+	name := path.Base(t.Path)
+	t.Path = path.Dir(t.Path)
+	return t, name, true
+}
+
+// restoreSource is a backup chosen for a restore.
+type restoreSource struct {
+	// File is the archive on disk. For a streamed archive it is where the
+	// archive would be: its sidecars are downloaded next to it.
+	File string
+	// Stream opens a remote archive that is loaded as it arrives instead of
+	// being downloaded; nil for a file on disk.
+	Stream func() (io.ReadCloser, error)
+	// Size and SHA256 are those of a streamed archive; SHA256 is "" when
+	// its manifest does not record it.
+	Size   int64
+	SHA256 string
+}
+
+// streamable reports whether an archive with manifest m can be restored
+// while it streams in: the runtime reads it once, so a home inside it,
+// which is extracted in a second pass, needs a local copy.
+func streamable(m *backup.Manifest) bool {
+	return m != nil && !m.HomeBundled && len(m.SystemPaths) == 0
+}
+
+// fetchRemoteFile fetches a backup given as a remote file spec, reading its
+// size and sidecar manifest first. The returned cleanup removes the
+// downloaded copies.
+func fetchRemoteFile(spec string) (restoreSource, func(), error) {
+	t, name, ok := remoteFile(spec)
+	if !ok {
+		return restoreSource{}, func() {}, fmt.Errorf("%s is not a remote file", spec)
+	}
+	size, err := t.size(name)
+	if err != nil {
+		return restoreSource{}, func() {}, fmt.Errorf("%s was not found: %w", spec, err)
+	}
+	a := remoteArchive{Name: name, Size: size}
+	a.Manifest, _ = t.readManifest(name)
+	return t.fetch(a)
+}
+
+// selectRestoreSource lets the user pick a local backup file or browse a
+// remote destination. The returned cleanup removes what was downloaded of
+// a remote archive.
+func selectRestoreSource() (restoreSource, func(), error) {
+	noop := func() {}
+	names, targets := remoteDestinations()
+	if len(names) == 0 {
+		return selectBackupFile()
+	}
+
+	fmt.Printf("  %s1)%s Local file\n", colorGreen, colorReset)
+	for i, name := range names {
+		fmt.Printf("  %s%d)%s %s (%s)\n", colorCyan, i+2, colorReset, name, targets[name])
+	}
+	choice := selectItem("Restore from", len(names)+1)
+	switch choice {
+	case 0:
+		return restoreSource{}, noop, nil
+	case 1:
+		return selectBackupFile()
+	}
+	return browseRemote(targets[names[choice-2]])
+}
+
+// selectBackupFile asks for a backup file, which may also be given as a
+// remote path such as user@host:/backups/dev-standard.tar; that one is
+// fetched first.
+func selectBackupFile() (restoreSource, func(), error) {
+	logInfo("Please choose a backup file (.tar) to restore, or enter user@host:/path/to/backup.tar.")
+	file, err := selectFile("Select Backup File", backupFileFilters...)
+	if _, _, remote := remoteFile(file); err == nil && remote && !fileExists(file) {
+		return fetchRemoteFile(file)
+	}
+	return restoreSource{File: file}, func() {}, err
+}
+
+// browseRemote lists the archives of a remote target with their manifest
+// metadata and fetches the chosen one (with its sidecars).
+func browseRemote(t remoteTarget) (restoreSource, func(), error) {
+	noop := func() {}
+	logInfo(fmt.Sprintf("Listing backups on %s...", t))
+	archives, err := t.listArchives()
+	if err != nil {
+		return restoreSource{}, noop, err
+	}
+	if len(archives) == 0 {
+		return restoreSource{}, noop, fmt.Errorf("no backups found on %s", t)
+	}
+
+	rows := make([]string, len(archives))
+	names := make([]string, len(archives))
+	for i, a := range archives {
+		info := "(no manifest)"
+		if m := a.Manifest; m != nil {
+			info = fmt.Sprintf("%s, %s, %s", m.ContainerName, m.Isolation, m.CreatedAt.Local().Format("2006-01-02 15:04"))
+			if m.Note != "" {
+				info += fmt.Sprintf(" %s \"%s\"", symbols("—"), m.Note)
+			}
+		}
+		rows[i] = fmt.Sprintf("%-45s %10s  %s", a.Name, formatBytes(uint64(a.Size)), info)
+		names[i] = a.Name
+	}
+	fmt.Println()
+	idx := chooseItems("the backup to restore", rows, names, false, func() {
+		for i, row := range rows {
+			fmt.Printf("  %s%d.%s %s\n", colorBold, i+1, colorReset, row)
+		}
+		fmt.Println()
+	})
+	if len(idx) == 0 {
+		return restoreSource{}, noop, nil
+	}
+	return t.fetch(archives[idx[0]-1])
+}
+
+// fetch gets an archive of the target ready for a restore, with its
+// sidecars in the download cache. The archive is streamed into the runtime
+// when its manifest allows it, and downloaded otherwise.
+// The returned cleanup removes the downloaded copies.
+func (t remoteTarget) fetch(chosen remoteArchive) (restoreSource, func(), error) {
+	noop := func() {}
+	dir, err := downloadDir()
+	if err != nil {
+		return restoreSource{}, noop, err
+	}
+	local := filepath.Join(dir, chosen.Name)
+	src := restoreSource{File: local}
+	files := []string{local}
+	cleanup := func() {
+		for _, f := range files {
+			os.Remove(f)
+		}
+	}
+
+	if streamable(chosen.Manifest) {
+		src.Stream = func() (io.ReadCloser, error) { return t.open(chosen.Name) }
+		src.Size, src.SHA256 = chosen.Size, chosen.Manifest.SHA256
+	} else {
+		if free, err := getFreeDiskSpace(dir); err == nil && free < uint64(chosen.Size) {
+			return restoreSource{}, noop, fmt.Errorf("not enough space in %s to download %s (need %s, have %s)", dir, chosen.Name, formatBytes(uint64(chosen.Size)), formatBytes(free))
+		}
+		done := make(chan bool)
+		go showSpinner("download", fmt.Sprintf("Downloading %s...", chosen.Name), done)
+		wantSHA256 := ""
+		if chosen.Manifest != nil {
+			wantSHA256 = chosen.Manifest.SHA256
+		}
+		err = t.download(chosen.Name, local, wantSHA256)
+		done <- true
+		if err != nil {
+			// The .part file is kept so restoring the same backup again resumes.
+			return restoreSource{}, noop, err
+		}
+	}
+	for _, sidecar := range []string{manifestPath(chosen.Name), checksumPath(chosen.Name), homeArchivePath(chosen.Name), checksumPath(homeArchivePath(chosen.Name)), homeChecksumPath(chosen.Name)} {
+		if !t.exists(sidecar) {
+			continue
+		}
+		localSidecar := filepath.Join(dir, sidecar)
+		if err := t.download(sidecar, localSidecar, ""); err != nil {
+			logWarning(err.Error())
+			continue
+		}
+		files = append(files, localSidecar)
+	}
+	return src, cleanup, nil
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// renamedHome returns where the isolated home of a container renamed to
+// newName goes: an isolated home in the default location follows the name,
+// a custom --home location stays where it is.
+func renamedHome(container Container, newName string) string {
+	isolated, home := isContainerIsolated(container)
+	if !isolated {
+		return ""
+	}
+	if defaultHome, err := getIsolatedHomePath(container.Name); err == nil && filepath.Clean(home) == filepath.Clean(defaultHome) {
+		if newHome, err := getIsolatedHomePath(newName); err == nil {
+			return newHome
+		}
+	}
+	return home
+}
+
+// checkRenameTarget reports why a container cannot be renamed to newName.
+func checkRenameTarget(container Container, newName string) error {
+	if newName == "" || newName == container.Name {
+		return fmt.Errorf("the new name must differ from '%s'", container.Name)
+	}
+	containers, err := getContainers()
+	if err != nil {
+		return err
+	}
+	if _, taken := findContainer(containers, newName); taken {
+		return fmt.Errorf("a container named '%s' already exists", newName)
+	}
+	if _, home := isContainerIsolated(container); home != "" {
+		if newHome := renamedHome(container, newName); newHome != home && fileExists(newHome) {
+			return fmt.Errorf("%s already exists", newHome)
+		}
+	}
+	return nil
+}
+
+// renameContainer recreates a container under newName from a commit of
+// itself with the same create settings. Its isolated home is moved along
+// when it is in the default location, with paths to the old home updated
+// in well-known config files, and its exported apps and binaries are
+// exported again under the new name. If the new container cannot be
+// created, the home is moved back and the old container is recreated as it
+// was; only if that fails too does a *recoveryError describe how to do it.
+func renameContainer(container Container, newName string) (err error) {
+	defer func(start time.Time) {
+		recordOperationResult("rename", container.Name, "to "+newName, start, err)
+	}(time.Now())
+	defer inhibitSleep(fmt.Sprintf("Renaming %s", container.Name))()
+	_, oldHome := isContainerIsolated(container)
+	newHome := renamedHome(container, newName)
+	createOpts := containerCreateOptions(container.Name)
+	createOpts.Name, createOpts.Home = newName, newHome
+
+	done := make(chan bool)
+	go showSpinner("rename", fmt.Sprintf("Renaming '%s' to '%s'...", container.Name, newName), done)
+	restart := restartOnInterrupt(container)
+	defer restart()
+	runCommand(containerRuntime, "stop", container.Name)
+	tempImageName := newTempImageName("rename", container)
+	createOpts.Image = tempImageName
+	if err := client.Commit(container.Name, tempImageName); err != nil {
+		done <- true
+		releaseTempImage(tempImageName)
+		return fmt.Errorf("failed to commit container to a temporary image: %w", err)
+	}
+	defer func() {
+		if tempImageName != "" {
+			removeTempImage(tempImageName)
+		}
+	}()
+
+	exports := &backup.Manifest{Exports: containerExports(container.Name)}
+	if err := removeBox(container); err != nil {
+		done <- true
+		return fmt.Errorf("failed to remove the old container, you may need to clean up manually: %w", err)
+	}
+	restart()
+	defer keepOnInterrupt(tempImageName, container.Name)()
+	// fail rolls back to the old container once it has been removed.
+	fail := func(cause error) error {
+		recreate := createOpts
+		recreate.Name, recreate.Home = container.Name, oldHome
+		logWarning(fmt.Sprintf("Renaming failed; rolling back to the original '%s'...", container.Name))
+		rollbackErr := rollBack(container, newName, recreate, exports)
+		if rollbackErr == nil {
+			releaseTempImage(tempImageName) // now the original container's image
+			tempImageName = ""
+			return fmt.Errorf("%w; '%s' was recreated unchanged", cause, container.Name)
+		}
+		recovery := &recoveryError{
+			Err:       fmt.Errorf("%w; rolling back failed: %v", cause, rollbackErr),
+			Image:     tempImageName,
+			Temporary: true,
+			Recreate:  recreate,
+			Removed:   true,
+		}
+		tempImageName = ""
+		return recovery
+	}
+	moved := oldHome != "" && newHome != oldHome
+	if moved {
+		if err := os.Rename(oldHome, newHome); err != nil {
+			done <- true
+			return fail(fmt.Errorf("failed to move the home directory to %s: %w", newHome, err))
+		}
+	}
+
+	if err := client.CreateFromImage(createOpts); err != nil {
+		done <- true
+		if moved {
+			os.Rename(newHome, oldHome)
+		}
+		return fail(fmt.Errorf("failed to create the renamed container: %w", err))
+	}
+	done <- true
+	releaseTempImage(tempImageName) // now the renamed container's image
+	tempImageName = ""
+
+	if moved {
+		logInfo(fmt.Sprintf("The home directory was moved to %s.", newHome))
+		if changed, err := rewriteHomePaths(newHome, oldHome, newHome); err != nil {
+			logWarning(fmt.Sprintf("Could not update all paths to the old home: %v", err))
+		} else if len(changed) > 0 {
+			logInfo(fmt.Sprintf("Updated the home path in %d config file(s).", len(changed)))
+		}
+	}
+	reexport(newName, exports)
+	warnRenamedInConfig(container.Name, newName)
+	return nil
+}
+
+// warnRenamedInConfig points out settings that still name the container by
+// its old name.
+func warnRenamedInConfig(oldName, newName string) {
+	if _, ok := cfg.Containers[oldName]; ok {
+		logWarning(fmt.Sprintf("[containers.%s] in the config still uses the old name; rename it to [containers.%s].", oldName, newName))
+	}
+	for group, members := range cfg.Groups {
+		for _, m := range members {
+			if m == oldName {
+				logWarning(fmt.Sprintf("Group '%s' still lists '%s'; replace it with '%s'.", group, oldName, newName))
+			}
+		}
+	}
+}
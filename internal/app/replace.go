@@ -0,0 +1,176 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// replacement is an existing container moved aside so that a restore can
+// take its name. Its isolated home is moved aside too, as the new
+// container may be created with the same home path.
+type replacement struct {
+	Name      string
+	Aside     string // the old container's temporary name
+	Home      string
+	HomeAside string
+}
+
+// moveAside stops the container and renames it (and its isolated home) out
+// of the way.
+func moveAside(c Container) (*replacement, error) {
+	stamp := time.Now().Format("20060102-150405")
+	r := &replacement{Name: c.Name, Aside: c.Name + "-replaced-" + stamp}
+	runCommand(containerRuntime, "stop", c.Name)
+	if err := client.RenameContainer(c.Name, r.Aside); err != nil {
+		return nil, fmt.Errorf("could not rename '%s' out of the way: %w", c.Name, err)
+	}
+	if isolated, home := isContainerIsolated(c); isolated {
+		r.Home, r.HomeAside = home, home+".replaced-"+stamp
+		if err := os.Rename(r.Home, r.HomeAside); err != nil {
+			client.RenameContainer(r.Aside, c.Name)
+			return nil, fmt.Errorf("could not move the home of '%s' out of the way: %w", c.Name, err)
+		}
+	}
+	logInfo(fmt.Sprintf("The current '%s' is kept as '%s' until the new one works.", c.Name, r.Aside))
+	return r, nil
+}
+
+// putBack removes the new container, if any, and gives the old one its name
+// and home back.
+func (r *replacement) putBack() error {
+	if containers, err := getContainers(); err == nil {
+		if _, ok := findContainer(containers, r.Name); ok {
+			if err := client.RemoveContainer(r.Name); err != nil {
+				return fmt.Errorf("could not remove the new '%s': %w", r.Name, err)
+			}
+		}
+	}
+	if r.Home != "" {
+		if err := os.RemoveAll(r.Home); err != nil {
+			return err
+		}
+		if err := os.Rename(r.HomeAside, r.Home); err != nil {
+			return err
+		}
+	}
+	if err := client.RenameContainer(r.Aside, r.Name); err != nil {
+		return err
+	}
+	logInfo(fmt.Sprintf("The previous '%s' was put back.", r.Name))
+	return nil
+}
+
+// keepExcluded copies the paths m says were left out of the restored home,
+// such as SSH keys kept off a cloud destination, from the previous home
+// into the new one, so replacing a container does not lose them.
+func (r *replacement) keepExcluded(m *backup.Manifest) {
+	if r.HomeAside == "" || m == nil || len(m.HomeExcluded) == 0 {
+		return
+	}
+	containers, err := getContainers()
+	if err != nil {
+		return
+	}
+	c, ok := findContainer(containers, r.Name)
+	if !ok {
+		return
+	}
+	isolated, home := isContainerIsolated(c)
+	if !isolated {
+		return
+	}
+	var kept []string
+	for _, p := range m.HomeExcluded {
+		if !filepath.IsLocal(p) {
+			continue
+		}
+		src, dst := filepath.Join(r.HomeAside, p), filepath.Join(home, p)
+		if _, err := os.Lstat(src); err != nil {
+			continue
+		}
+		if _, err := os.Lstat(dst); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err == nil {
+			_, err = runCommand("cp", "-a", "--reflink=auto", src, dst)
+		}
+		if err != nil {
+			logWarning(fmt.Sprintf("Could not keep %s from the previous home: %v", p, err))
+			continue
+		}
+		kept = append(kept, p)
+	}
+	if len(kept) > 0 {
+		logInfo(fmt.Sprintf("Kept %s from the previous home, as the backup left them out.", strings.Join(kept, ", ")))
+	}
+}
+
+// discard deletes the old container and its home for good.
+func (r *replacement) discard() {
+	if err := client.RemoveContainer(r.Aside); err != nil {
+		logWarning(fmt.Sprintf("Could not remove the previous container '%s': %v", r.Aside, err))
+		return
+	}
+	if r.HomeAside != "" {
+		if err := os.RemoveAll(r.HomeAside); err != nil {
+			logWarning(fmt.Sprintf("Could not remove the previous home %s: %v", r.HomeAside, err))
+		}
+	}
+	logSuccess(fmt.Sprintf("✅ The previous '%s' was removed.", r.Name))
+}
+
+// restoreReplacing restores job under the name of the existing container
+// old. The old container is backed up first (per [edit] pre_backup) and
+// moved aside; it is only deleted once the new one passes the smoke test,
+// and put back if the restore or the smoke test fails.
+func restoreReplacing(job *restoreJob, old Container) error {
+	if old.Rootful != rootfulActive {
+		if old.Rootful {
+			return fmt.Errorf("'%s' is rootful and the backup was loaded into your own storage; run the tool with -root to replace it", old.Name)
+		}
+		return fmt.Errorf("'%s' is rootless and the backup was loaded into the root storage; run the tool without -root to replace it", old.Name)
+	}
+	if !safetyBackup(old, "replacement") {
+		return fmt.Errorf("replacement of '%s' cancelled", old.Name)
+	}
+	r, err := moveAside(old)
+	if err != nil {
+		return err
+	}
+	defer onInterrupt(func() { r.putBack() })()
+	err = runRestoreJob(job)
+	if err == nil && !runSmokeTest(job.Name) {
+		err = fmt.Errorf("the new '%s' failed its smoke test", job.Name)
+		if !assumeYes {
+			fmt.Printf("%s> Keep the new container anyway and delete the previous one? (y/N): %s", colorRed, colorReset)
+			if confirmAction() {
+				err = nil
+			}
+		}
+	}
+	if err == nil {
+		r.keepExcluded(job.Manifest)
+		r.discard()
+		return nil
+	}
+	// The name is taken again once the old container is back, so an image
+	// kept for recovery could not be recreated under it. The image of a
+	// discarded new container goes once the container is removed.
+	var recovery *recoveryError
+	if errors.As(err, &recovery) {
+		removeTempImage(recovery.Image)
+		err = recovery.Err
+	} else {
+		defer client.RemoveImage(job.Image)
+	}
+	if putErr := r.putBack(); putErr != nil {
+		return fmt.Errorf("%w; putting back the previous container failed too (%v): it is '%s'", err, putErr, r.Aside)
+	}
+	return err
+}
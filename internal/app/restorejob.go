@@ -0,0 +1,371 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// restoreJob describes how a loaded backup becomes a new container.
+type restoreJob struct {
+	File        string
+	Manifest    *backup.Manifest
+	Image       string // reference of the loaded image
+	HomeArchive string // separated home archive to extract, if any
+	HomeBundled bool   // the home is stored inside File
+	Isolated    bool
+
+	Name string
+	// Home is the folder for an isolated home; empty lets restoreHomePath
+	// choose.
+	Home   string
+	Init   bool
+	Nvidia bool
+	// Sandbox restores an untrusted backup for inspection: see
+	// sandboxCreateOptions.
+	Sandbox bool
+}
+
+// sandboxUnshare are the namespaces a sandboxed restore does not share
+// with the host.
+var sandboxUnshare = []string{"ipc", "netns", "process", "devsys"}
+
+// sandboxCreateOptions locks down the container of a sandboxed restore.
+// Nothing the backup asks for is applied: no init, GPU, volumes,
+// environment, labels or init hooks, and no exported apps afterwards. Every
+// namespace distrobox can unshare is unshared, and the home is a new folder
+// of its own.
+func sandboxCreateOptions(job *restoreJob, home string) backup.CreateOptions {
+	return backup.CreateOptions{Name: job.Name, Image: job.Image, Home: home, Unshare: sandboxUnshare}
+}
+
+// prepareRestore checks that a backup fits into container storage, reads its
+// manifest and loads its image under a tag unique to the job. The caller owns
+// the loaded image until it is handed to runRestoreJob.
+func prepareRestore(src restoreSource) (*restoreJob, error) {
+	backupFile := src.File
+	requiredSpace := uint64(src.Size)
+	if src.Stream == nil {
+		if err := checkNotPartial(backupFile); err != nil {
+			return nil, err
+		}
+		backupFileInfo, err := os.Stat(backupFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read backup file info: %w", err)
+		}
+		requiredSpace = uint64(backupFileInfo.Size())
+	}
+	// Over a podman connection the storage is on the other machine.
+	if containerStoragePath != "" {
+		freeSpace, err := getFreeDiskSpace(containerStoragePath)
+		if err != nil {
+			logWarning(fmt.Sprintf("Could not determine free disk space in %s. Continuing at your own risk.", containerStoragePath))
+		} else if freeSpace < requiredSpace {
+			return nil, fmt.Errorf("not enough disk space in container storage: required ~%s, available %s", formatBytes(requiredSpace), formatBytes(freeSpace))
+		}
+	}
+
+	job := &restoreJob{File: backupFile, Manifest: readBackupManifest(backupFile)}
+	if src.Stream == nil {
+		if err := checkDecryption(backupFile); err != nil {
+			return nil, err
+		}
+	} else {
+		if job.Manifest == nil {
+			return nil, fmt.Errorf("the manifest of %s could not be downloaded", filepath.Base(backupFile))
+		}
+		cipher, err := backup.ParseCipher(job.Manifest.Encryption)
+		if err == nil {
+			err = checkCipherDecryption(cipher)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if homeBackupFile := homeArchivePath(backupFile); fileExists(homeBackupFile) {
+		job.HomeArchive = homeBackupFile
+		logInfo("Separated home directory backup found! This will be restored as an ISOLATED container.")
+		if sumsFile := homeChecksumPath(backupFile); fileExists(sumsFile) {
+			logInfo("Verifying the home archive against its checksums...")
+			result, err := verifyHomeArchive(homeBackupFile, sumsFile)
+			if err != nil {
+				return nil, fmt.Errorf("could not verify the home archive: %w", err)
+			}
+			printHomeVerifyResult(result)
+			if !result.ok() {
+				fmt.Printf("%s> The home archive does not match its checksums. Restore it anyway? (y/N): %s", colorRed, colorReset)
+				if !confirmAction() {
+					return nil, fmt.Errorf("home archive failed verification")
+				}
+			}
+		}
+	}
+	if job.Manifest != nil && job.Manifest.HomeBundled {
+		job.HomeBundled = true
+		logInfo("The backup contains the home directory; it will be restored as an ISOLATED container.")
+	}
+	if job.Manifest != nil && job.Manifest.Isolation != "" {
+		job.Isolated = job.Manifest.Isolation == backup.IsolationIsolated || job.HomeArchive != "" || job.HomeBundled
+		logInfo(fmt.Sprintf("Backup manifest indicates this was a %s container.", strings.ToUpper(job.Manifest.Isolation)))
+	} else if isIsolatedArchive(backupFile) {
+		logInfo("Backup file indicates this should be an ISOLATED container.")
+		job.Isolated = true
+	} else if job.HomeArchive != "" || job.HomeBundled {
+		job.Isolated = true
+	} else {
+		logInfo("Backup file indicates this should be a STANDARD container.")
+	}
+
+	var err error
+	if src.Stream != nil {
+		logInfo(fmt.Sprintf("Streaming the image of '%s' into the runtime without a local copy...", filepath.Base(backupFile)))
+		bar := startProgressBar("load", "Loading image...", src.Size)
+		job.Image, err = loadStreamForJob(src, bar.set)
+		bar.finish()
+	} else {
+		logInfo(fmt.Sprintf("Loading image from '%s'...", backupFile))
+		bar := startProgressBar("load", "Loading image...", int64(requiredSpace))
+		job.Image, err = loadArchiveForJob(backupFile, bar.set)
+		bar.finish()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load image from backup file: %w", err)
+	}
+	logSuccess(fmt.Sprintf("Image '%s' loaded successfully.", job.Image))
+	adaptToStorage(job)
+	return job, nil
+}
+
+// defaultRestoreName suggests a container name for a backup: the original
+// container's name from the manifest, or else one derived from its file name
+// or the image's distribution labels.
+func defaultRestoreName(job *restoreJob) string {
+	if job.Manifest != nil && job.Manifest.ContainerName != "" {
+		return job.Manifest.ContainerName
+	}
+	name := containerNameFromFile(job.File)
+	// Without a manifest the image labels are the best hint of what was
+	// backed up; a generic file name is replaced by the distro.
+	if distro, version := imageDistro(job.Image); distro != "" {
+		logInfo(fmt.Sprintf("Image distribution: %s", distroString(distro, version)))
+		if name == "imported" {
+			name = strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(distro), "-"), "-._")
+		}
+	}
+	return name
+}
+
+// runRestoreJob creates the container of a prepared restore and extracts its
+// home. If creation fails the loaded image is kept and a *recoveryError is
+// returned.
+func runRestoreJob(job *restoreJob) (err error) {
+	defer func(start time.Time) {
+		recordOperationResult("restore", job.Name, job.File, start, err)
+	}(time.Now())
+	toolbox := job.Manifest != nil && job.Manifest.Manager == backup.ManagerToolbox && !job.Sandbox
+	if toolbox && !commandExists("toolbox") {
+		return fmt.Errorf("'%s' was a toolbx container, and 'toolbox' is not installed", job.Manifest.ContainerName)
+	}
+	createOpts := backup.CreateOptions{Name: job.Name, Image: job.Image, Init: job.Init, Nvidia: job.Nvidia}
+	if job.Manifest != nil && len(job.Manifest.Unshare) > 0 && !job.Sandbox {
+		createOpts.Unshare = job.Manifest.Unshare
+		logInfo(fmt.Sprintf("Re-applying unshared namespaces from the backup: %s", strings.Join(job.Manifest.Unshare, ", ")))
+	}
+	if job.Manifest != nil && job.Manifest.Extra != nil && !job.Sandbox {
+		createOpts.Extra = restorableFlags(*job.Manifest.Extra)
+	}
+
+	if toolbox {
+		if job.Isolated || job.Init || job.Nvidia {
+			logWarning("toolbx containers always share your home and have no init or NVIDIA options; restoring it as a plain toolbx container.")
+		}
+		job.Isolated = false
+		createOpts = backup.CreateOptions{Name: job.Name, Image: job.Image, Toolbox: true}
+	}
+
+	isolatedHomePath := ""
+	if job.Sandbox {
+		// The manifest's home could be any folder, such as the host home.
+		isolatedHomePath = job.Home
+		if isolatedHomePath == "" {
+			if isolatedHomePath, err = getIsolatedHomePath(job.Name); err != nil {
+				return fmt.Errorf("could not determine user home directory: %w", err)
+			}
+		}
+		if fileExists(isolatedHomePath) {
+			removeTempImage(job.Image)
+			return fmt.Errorf("%s already exists; a sandbox gets a new home", isolatedHomePath)
+		}
+		createOpts = sandboxCreateOptions(job, isolatedHomePath)
+		logInfo(fmt.Sprintf("Creating %sSANDBOXED%s container '%s' (unshared %s, nothing from the backup's settings applied)...", colorBold, colorReset, job.Name, strings.Join(sandboxUnshare, ", ")))
+	} else if job.Isolated {
+		var err error
+		isolatedHomePath = job.Home
+		if isolatedHomePath == "" {
+			isolatedHomePath, err = restoreHomePath(job.Manifest, job.Name)
+			if err != nil {
+				removeTempImage(job.Image)
+				return fmt.Errorf("could not determine user home directory: %w", err)
+			}
+		}
+		// The home is extracted into the folder, which may be any folder
+		// the manifest or the user named; its files are never touched.
+		if (job.HomeArchive != "" || job.HomeBundled) && podmanConnection == "" {
+			if err := checkHomeTarget(isolatedHomePath); err != nil {
+				removeTempImage(job.Image)
+				return err
+			}
+		}
+		createOpts.Home = isolatedHomePath
+		logInfo(fmt.Sprintf("Creating new %sISOLATED%s container '%s'...", colorBold, colorReset, job.Name))
+	} else if createOpts.Toolbox {
+		logInfo(fmt.Sprintf("Creating new %stoolbx%s container '%s'...", colorBold, colorReset, job.Name))
+	} else {
+		logInfo(fmt.Sprintf("Creating new %sSTANDARD%s container '%s'...", colorBold, colorReset, job.Name))
+	}
+
+	// Give the image a meaningful, stable name instead of the job's temporary tag.
+	tempRef := job.Image
+	stableRef := restoredImageName(job.Name)
+	if err := client.Retag(job.Image, stableRef); err != nil {
+		logWarning(fmt.Sprintf("Could not retag the image as '%s'; keeping '%s'.", stableRef, job.Image))
+	} else {
+		job.Image = stableRef
+		releaseTempImage(tempRef)
+	}
+	createOpts.Image = job.Image
+
+	done := make(chan bool)
+	go showSpinner("create", "Creating container...", done)
+	err = client.CreateFromImage(createOpts)
+	done <- true
+	if err != nil {
+		return &recoveryError{
+			Err:       fmt.Errorf("failed to create container '%s': %w", job.Name, err),
+			Image:     job.Image,
+			Temporary: job.Image == tempRef,
+			Recreate:  createOpts,
+		}
+	}
+	releaseTempImage(job.Image) // adopted by the container if the retag failed
+
+	if podmanConnection != "" && job.Isolated && (job.HomeArchive != "" || job.HomeBundled) {
+		logWarning(fmt.Sprintf("The home is not restored: it belongs in %s on the machine behind connection '%s'. Extract it there by hand.", isolatedHomePath, podmanConnection))
+		job.HomeArchive, job.HomeBundled = "", false
+	}
+	if job.Isolated && (job.HomeArchive != "" || job.HomeBundled) {
+		homeSource := job.HomeArchive
+		if job.HomeBundled {
+			homeSource = job.File
+		}
+		if !hasTar {
+			logError("The 'tar' command is required but was not found.")
+			logWarning(fmt.Sprintf("Container created, but home must be restored manually from: %s", homeSource))
+		} else {
+			logInfo("Restoring home directory...")
+			os.MkdirAll(isolatedHomePath, 0755)
+
+			doneHome := make(chan bool)
+			go showSpinner("extract-home", "Extracting home directory...", doneHome)
+			var homeOpts backup.HomeOptions
+			if job.Sandbox {
+				// Files become yours and keep no security attributes.
+				homeOpts.Owner = backup.OwnerUser
+			} else if job.Manifest != nil {
+				homeOpts = job.Manifest.HomeOptions()
+			}
+			if job.HomeBundled {
+				err = client.ExtractBundledHome(job.File, isolatedHomePath, homeOpts)
+			} else {
+				_, err = runCommand("tar", append([]string{"-xzf", job.HomeArchive, "-C", isolatedHomePath}, homeOpts.ExtractArgs()...)...)
+			}
+			doneHome <- true
+
+			if err != nil {
+				logError("Failed to restore home directory.")
+				logError(err.Error())
+			} else {
+				logSuccess("✅ Home directory restored successfully!")
+				relabelHome(isolatedHomePath, homeOpts)
+				if !job.Sandbox {
+					offerHomePathRewrite(job.Manifest, isolatedHomePath)
+				}
+			}
+		}
+	}
+
+	if job.Sandbox {
+		logSuccess(fmt.Sprintf("✅ Backup restored into the sandbox '%s'.", job.Name))
+		logWarning(fmt.Sprintf("It is still a distrobox: it runs as you and sees the host filesystem under /run/host, so it keeps the backup's settings and hooks away from your system but is no defense against a hostile image. Remove it with 'distrobox rm %s' when done.", job.Name))
+		return nil
+	}
+	reexport(job.Name, job.Manifest)
+	logSuccess(fmt.Sprintf("✅ Container '%s' restored successfully!", job.Name))
+	return nil
+}
+
+// relabelHome gives a restored home the SELinux labels of its location
+// when its archive carried none, so host programs and the container can
+// still use the files on an SELinux host.
+func relabelHome(home string, opts backup.HomeOptions) {
+	if opts.Xattrs || !selinuxEnabled() {
+		return
+	}
+	if !commandExists("restorecon") {
+		logWarning(fmt.Sprintf("The home archive has no SELinux labels and 'restorecon' was not found; relabel %s by hand if files are not accessible.", home))
+		return
+	}
+	if out, err := runCommand("restorecon", "-R", home); err != nil {
+		logWarning(fmt.Sprintf("Could not relabel %s: %s", home, strings.TrimSpace(out)))
+		return
+	}
+	logInfo(fmt.Sprintf("Restored the SELinux labels of %s.", home))
+}
+
+// restorableFlags returns the extra create flags of a backup that can be
+// applied on this host: bind mounts whose source is missing are dropped,
+// as distrobox-create would fail on them.
+func restorableFlags(f backup.ExtraFlags) backup.ExtraFlags {
+	var volumes []string
+	for _, v := range f.Volumes {
+		source, _, _ := strings.Cut(v, ":")
+		if strings.HasPrefix(source, "/") && !fileExists(source) {
+			logWarning(fmt.Sprintf("Not mounting %s: %s does not exist on this host.", v, source))
+			continue
+		}
+		volumes = append(volumes, v)
+	}
+	f.Volumes = volumes
+	if !f.IsZero() {
+		logInfo(fmt.Sprintf("Re-applying create settings from the backup: %s", describeExtraFlags(f)))
+	}
+	return f
+}
+
+// describeExtraFlags summarizes extra create flags for messages.
+func describeExtraFlags(f backup.ExtraFlags) string {
+	var parts []string
+	if len(f.Volumes) > 0 {
+		parts = append(parts, fmt.Sprintf("volumes %s", strings.Join(f.Volumes, ", ")))
+	}
+	if len(f.Env) > 0 {
+		parts = append(parts, fmt.Sprintf("%d environment variable(s)", len(f.Env)))
+	}
+	if len(f.Labels) > 0 {
+		parts = append(parts, fmt.Sprintf("%d label(s)", len(f.Labels)))
+	}
+	if f.InitHooks != "" || f.PreInitHooks != "" {
+		parts = append(parts, "init hooks")
+	}
+	return strings.Join(parts, "; ")
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// restoreItem is one archive of a batch restore with the containers it has
+// to wait for.
+type restoreItem struct {
+	File      string
+	Container string
+	After     []string
+}
+
+// quietManifest reads the manifest of a local or remote archive without
+// logging, or returns nil.
+func quietManifest(file string) *backup.Manifest {
+	if t, name, remote := remoteFile(file); remote && !fileExists(file) {
+		m, _ := t.readManifest(name)
+		return m
+	}
+	m, err := backup.ReadManifest(manifestPath(file))
+	if err != nil {
+		if m, err = backup.ReadArchiveManifest(file); err != nil {
+			return nil
+		}
+	}
+	return m
+}
+
+// planRestore returns the archives of a batch restore in an order that
+// restores every container after those it depends on, keeping the given
+// order otherwise. Dependencies come from the manifest (restore_after at
+// backup time) and from [containers.<name>] restore_after now; those on
+// containers outside the batch are ignored. A cycle is an error.
+func planRestore(files []string) ([]restoreItem, error) {
+	items := make([]restoreItem, len(files))
+	inBatch := map[string]bool{}
+	for i, file := range files {
+		items[i] = restoreItem{File: file, Container: containerNameFromFile(file)}
+		if m := quietManifest(file); m != nil {
+			if m.ContainerName != "" {
+				items[i].Container = m.ContainerName
+			}
+			items[i].After = m.RestoreAfter
+		}
+		inBatch[items[i].Container] = true
+	}
+	for i := range items {
+		var after []string
+		seen := map[string]bool{}
+		for _, dep := range append(append([]string{}, items[i].After...), cfg.Containers[items[i].Container].RestoreAfter...) {
+			if inBatch[dep] && dep != items[i].Container && !seen[dep] {
+				seen[dep] = true
+				after = append(after, dep)
+			}
+		}
+		items[i].After = after
+	}
+
+	var ordered []restoreItem
+	placed := map[string]int{} // archives of each container placed so far
+	total := map[string]int{}
+	for _, it := range items {
+		total[it.Container]++
+	}
+	done := make([]bool, len(items))
+	for len(ordered) < len(items) {
+		progress := false
+		for i, it := range items {
+			if done[i] {
+				continue
+			}
+			ready := true
+			for _, dep := range it.After {
+				if placed[dep] < total[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				ordered = append(ordered, it)
+				placed[it.Container]++
+				done[i] = true
+				progress = true
+				break
+			}
+		}
+		if !progress {
+			var stuck []string
+			for i, it := range items {
+				if !done[i] {
+					stuck = append(stuck, it.Container)
+				}
+			}
+			return nil, fmt.Errorf("restore_after forms a cycle between %s", strings.Join(stuck, ", "))
+		}
+	}
+	return ordered, nil
+}
+
+// printRestoreOrder shows the order of a batch restore when any archive
+// waits for another.
+func printRestoreOrder(items []restoreItem) {
+	hasDeps := false
+	for _, it := range items {
+		hasDeps = hasDeps || len(it.After) > 0
+	}
+	if !hasDeps {
+		return
+	}
+	logInfo("Restore order:")
+	for i, it := range items {
+		line := fmt.Sprintf("  %d. %s (%s)", i+1, it.Container, filepath.Base(it.File))
+		if len(it.After) > 0 {
+			line += " after " + strings.Join(it.After, ", ")
+		}
+		fmt.Println(line)
+	}
+}
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// Rootful distroboxes (distrobox create --root) live in the runtime's root
+// storage, which a user cannot see. With the global -root flag they are
+// listed next to the rootless ones and marked as rootful, and the commands
+// of an operation go to the storage of the container it works on: runtime
+// commands run through distrobox's sudo program and distrobox commands get
+// --root, which escalates by itself. The root storage is then the default
+// for new containers. Without -root the tool never runs sudo, so only
+// rootless containers are seen. docker keeps every container in one
+// storage, so there -root only changes how its commands run.
+
+// rootMode is set by the global -root flag.
+var rootMode bool
+
+var (
+	// userRunner and rootfulRunner build the commands for the rootless and
+	// the root storage; rootfulRunner is nil when rootful containers cannot
+	// be reached.
+	userRunner, rootfulRunner backup.Runner
+	// rootfulActive is set while commandRunner goes to the root storage.
+	rootfulActive bool
+	// storagePaths caches containerStoragePath per storage, keyed by
+	// rootfulActive.
+	storagePaths = map[bool]string{}
+	// storageMu is held while commands go to the storage other than the
+	// default one, so that two operations cannot switch it under each
+	// other. Operations that run at the same time, as the restores of
+	// batch restore, work in the default storage.
+	storageMu sync.Mutex
+)
+
+// rootfulDistroboxCommands are the distrobox commands the tool runs that
+// take --root.
+var rootfulDistroboxCommands = map[string]bool{
+	"distrobox-create":  true,
+	"distrobox-enter":   true,
+	"distrobox-rm":      true,
+	"distrobox-upgrade": true,
+}
+
+// sudoProgram returns the program distrobox escalates with: its
+// distrobox_sudo_program setting, or sudo.
+func sudoProgram() string {
+	if p := distroboxSetting("distrobox_sudo_program", "DBX_SUDO_PROGRAM"); p != "" {
+		return p
+	}
+	return "sudo"
+}
+
+// rootRunner wraps run so that runtime commands are run through sudo, the
+// program and its arguments, and distrobox commands act on rootful
+// containers.
+func rootRunner(run backup.Runner, sudo []string) backup.Runner {
+	return func(name string, args ...string) *exec.Cmd {
+		switch {
+		case name == containerRuntime:
+			return run(sudo[0], append(append(sudo[1:len(sudo):len(sudo)], name), args...)...)
+		case rootfulDistroboxCommands[name]:
+			return run(name, append([]string{"--root"}, args...)...)
+		}
+		return run(name, args...)
+	}
+}
+
+// setUpRootful builds the runners for both storages when -root is set. The
+// password of sudo is asked once up front, so later prompts do not end up
+// under a spinner; without a terminal to ask on, as in the jobs of the
+// queue, its cached credentials are relied on.
+func setUpRootful() error {
+	userRunner = commandRunner
+	if !rootMode {
+		return nil
+	}
+	sudo := strings.Fields(sudoProgram())
+	if len(sudo) == 0 || !commandExists(sudo[0]) {
+		return fmt.Errorf("rootful containers need '%s' to run %s as root, and it was not found", sudoProgram(), containerRuntime)
+	}
+	if containerRuntime == "docker" {
+		logWarning("docker keeps all containers in one storage; -root only changes how its commands are run.")
+	}
+	if sudo[0] == "sudo" && !headless && isTerminal(os.Stdin) {
+		cmd := exec.Command("sudo", "-v")
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("could not get root privileges with sudo: %w", err)
+		}
+	}
+	rootfulRunner = rootRunner(userRunner, sudo)
+	commandRunner, rootfulActive = rootfulRunner, true
+	return nil
+}
+
+// otherStorage returns the runner of the storage that is not the default
+// one and whether it is the root storage, or a nil runner when rootful
+// containers are not reached.
+func otherStorage() (backup.Runner, bool) {
+	if rootfulRunner == nil || containerRuntime == "docker" {
+		return nil, false
+	}
+	if rootfulActive {
+		return userRunner, false
+	}
+	return rootfulRunner, true
+}
+
+// useStorage sends the commands that follow to the root storage, or to the
+// rootless one, and returns the function that switches back. storageMu is
+// held until then.
+func useStorage(rootful bool) func() {
+	if rootful == rootfulActive || rootful && rootfulRunner == nil {
+		return func() {}
+	}
+	storageMu.Lock()
+	prev, prevActive, prevPath := commandRunner, rootfulActive, containerStoragePath
+	storagePaths[prevActive] = prevPath
+	commandRunner, rootfulActive = userRunner, false
+	if rootful {
+		commandRunner, rootfulActive = rootfulRunner, true
+	}
+	client.Run = commandRunner
+	if path, ok := storagePaths[rootful]; ok {
+		containerStoragePath = path
+	} else if path, err := getContainerStoragePath(); err == nil {
+		containerStoragePath, storagePaths[rootful] = path, path
+	}
+	return func() {
+		commandRunner, rootfulActive, containerStoragePath = prev, prevActive, prevPath
+		client.Run = commandRunner
+		storageMu.Unlock()
+	}
+}
+
+// routeTo sends the commands that follow to the storage of c, and returns
+// the function that switches back.
+func routeTo(c Container) func() {
+	return useStorage(c.Rootful)
+}
+
+// reclaimFile gives a file the runtime wrote as root back to the user.
+func reclaimFile(path string) error {
+	if !rootfulActive {
+		return nil
+	}
+	sudo := strings.Fields(sudoProgram())
+	_, err := runCommand(sudo[0], append(sudo[1:len(sudo):len(sudo)], "chown", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()), path)...)
+	return err
+}
@@ -0,0 +1,91 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Modes for [edit] pre_backup.
+const (
+	preBackupAsk    = "ask"
+	preBackupAlways = "always"
+	preBackupNever  = "never"
+)
+
+// defaultBackupDir returns the configured default destination, expanded.
+func defaultBackupDir() string {
+	return expandHome(cfg.Backup.Dir)
+}
+
+// safetyBackupDir returns the folder safety backups go to: [edit]
+// safety_dir, or the default destination.
+func safetyBackupDir() string {
+	if cfg.Edit.SafetyDir != "" {
+		return expandHome(cfg.Edit.SafetyDir)
+	}
+	return defaultBackupDir()
+}
+
+// safetyBackup backs up a container (image and isolated home) into the
+// safety folder before a destructive operation. It returns false if
+// the caller should not proceed.
+func safetyBackup(container Container, operation string) bool {
+	switch cfg.Edit.PreBackup {
+	case preBackupNever:
+		return true
+	case preBackupAsk:
+		fmt.Printf("%s> Back up '%s' to %s before the %s? Strongly recommended. (Y/n): %s", colorBold, container.Name, safetyBackupDir(), operation, colorReset)
+		if !confirmDefaultYes() {
+			logWarning("Continuing without a safety backup.")
+			return true
+		}
+	}
+
+	dir := safetyBackupDir()
+	if _, remote := parseRemote(dir); remote {
+		logError(fmt.Sprintf("Safety backups can only be written to a local folder, not %s.", dir))
+		return confirmContinueWithoutBackup()
+	}
+	if err := makeBackupDir(dir); err != nil {
+		logError(fmt.Sprintf("Could not create the backup folder %s: %v", dir, err))
+		return confirmContinueWithoutBackup()
+	}
+	isIsolated, _ := isContainerIsolated(container)
+	base := fmt.Sprintf("%s-pre-%s-%s", container.Name, strings.ReplaceAll(operation, " ", "-"), time.Now().Format("20060102-150405"))
+	job := backupJob{
+		Container:     container,
+		File:          filepath.Join(dir, backupFileName(base, isIsolated, cfg.Backup.Compression, cfg.Encryption.Method)),
+		SeparateHome:  isIsolated && hasTar,
+		HomeChecksums: cfg.Backup.HomeChecksums,
+		Note:          fmt.Sprintf("Automatic safety backup before %s", operation),
+		Compression:   cfg.Backup.Compression,
+		Level:         cfg.Backup.CompressionLevel,
+	}
+	if _, err := runBackupJob(job.withEncryption(configuredEncryption())); err != nil {
+		logError(fmt.Sprintf("Safety backup failed: %v", err))
+		return confirmContinueWithoutBackup()
+	}
+	logSuccess(fmt.Sprintf("✅ Safety backup written to %s", job.File))
+	return true
+}
+
+func confirmContinueWithoutBackup() bool {
+	if assumeYes {
+		logError("Not continuing without a backup; --yes does not cover this.")
+		return false
+	}
+	fmt.Printf("%s> Continue WITHOUT a backup? (y/N): %s", colorRed, colorReset)
+	return confirmAction()
+}
+
+// confirmDefaultYes reads a yes/no answer where an empty answer means yes.
+func confirmDefaultYes() bool {
+	if assumeYes {
+		fmt.Println("y")
+		return true
+	}
+	answer := strings.ToLower(readUserInput())
+	return answer == "" || answer == "y" || answer == "yes"
+}
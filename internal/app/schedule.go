@@ -0,0 +1,279 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// validScheduleName keeps schedule names usable in systemd unit names.
+var validScheduleName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// systemdUserDir returns ~/.config/systemd/user, where user units live.
+func systemdUserDir() (string, error) {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(base, "systemd", "user"), nil
+}
+
+// systemdQuote quotes s for an Exec line of a unit: spaces and quotes are
+// kept inside double quotes, and specifiers and variables are escaped.
+func systemdQuote(s string) string {
+	s = strings.NewReplacer("%", "%%", "$", "$$").Replace(s)
+	if !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// unattendedUnlock reports why runs without a terminal, such as those of
+// timers and of the shutdown unit, could not unlock an encrypted state.
+func unattendedUnlock() error {
+	if cfg.Security.EncryptState && cfg.Security.Unlock != unlockKeyring {
+		return fmt.Errorf("the state is encrypted and unattended runs cannot ask for its passphrase; set [security] unlock = \"keyring\"")
+	}
+	return nil
+}
+
+// check validates a schedule read from the config.
+func (s ScheduleConfig) check(name string) error {
+	if !validScheduleName.MatchString(name) {
+		return fmt.Errorf("names may only contain letters, digits, '-' and '_'")
+	}
+	if s.Calendar == "" {
+		return fmt.Errorf("calendar must not be empty")
+	}
+	targets := 0
+	for _, set := range []bool{len(s.Containers) > 0, s.Group != "", s.All, s.Job != ""} {
+		if set {
+			targets++
+		}
+	}
+	if targets > 1 || targets == 0 && !s.Check {
+		return fmt.Errorf("set exactly one of containers, group, all or job, or check alone")
+	}
+	if s.Job != "" && (s.Dest != "" || s.Note != "" || s.Check || s.Prune || s.Verify) {
+		return fmt.Errorf("dest, note, check, prune and verify belong in the job file when job is set")
+	}
+	if s.Hours.isSet() {
+		if _, ok := s.Hours.next(time.Now()); !ok {
+			return fmt.Errorf("window and blackout leave no time to run in")
+		}
+	}
+	return nil
+}
+
+// scheduleUnitName returns the unit name of a schedule without its suffix.
+func scheduleUnitName(name string) string {
+	return appName + "-schedule-" + name
+}
+
+// scheduleJob turns a schedule into the job file it runs: its own job file,
+// or a backup optionally preceded by a check of the destination and
+// followed by prune and verify steps.
+func scheduleJob(s ScheduleConfig) (*jobFile, error) {
+	if s.Job != "" {
+		return loadJobFile(expandHome(s.Job))
+	}
+	dest := s.Dest
+	if dest == "" {
+		dest = "[backup] dir"
+	}
+	var steps []jobStep
+	if s.Check {
+		steps = append(steps, jobStep{Action: "check", Dest: dest})
+	}
+	if len(s.Containers) > 0 || s.Group != "" || s.All {
+		steps = append(steps, jobStep{Action: "backup", Containers: s.Containers, Group: s.Group, All: s.All, Dest: s.Dest, Note: s.Note})
+	}
+	if s.Prune {
+		steps = append(steps, jobStep{Action: "prune", Dest: dest})
+	}
+	if s.Verify {
+		steps = append(steps, jobStep{Action: "verify"})
+	}
+	jf := &jobFile{Steps: steps}
+	return jf, jf.check()
+}
+
+// scheduleUnits returns the service and timer units of a schedule.
+func scheduleUnits(name string, s ScheduleConfig, exe string) (service, timer string) {
+	// No network-online.target: the user manager does not have one, so a
+	// dependency on it would never be met.
+	service = fmt.Sprintf(`[Unit]
+Description=Distrobox backup schedule '%[1]s'
+
+[Service]
+Type=oneshot
+ExecStart=%[2]s schedule run %[1]s
+`, name, systemdQuote(exe))
+	timer = fmt.Sprintf(`[Unit]
+Description=Run the distrobox backup schedule '%s'
+
+[Timer]
+OnCalendar=%s
+Persistent=true
+RandomizedDelaySec=5min
+
+[Install]
+WantedBy=timers.target
+`, name, s.Calendar)
+	return service, timer
+}
+
+// enableSchedule writes the units of a schedule and starts its timer.
+func enableSchedule(name string, s ScheduleConfig) error {
+	if err := unattendedUnlock(); err != nil {
+		return err
+	}
+	if commandExists("systemd-analyze") {
+		if _, err := runCommand("systemd-analyze", "calendar", s.Calendar); err != nil {
+			return fmt.Errorf("calendar %q is not a valid systemd OnCalendar expression", s.Calendar)
+		}
+	}
+	if _, err := scheduleJob(s); err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dir, err := systemdUserDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	service, timer := scheduleUnits(name, s, exe)
+	unit := filepath.Join(dir, scheduleUnitName(name))
+	if err := os.WriteFile(unit+".service", []byte(service), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(unit+".timer", []byte(timer), 0644); err != nil {
+		return err
+	}
+	if _, err := runCommand("systemctl", "--user", "daemon-reload"); err != nil {
+		return err
+	}
+	_, err = runCommand("systemctl", "--user", "enable", "--now", scheduleUnitName(name)+".timer")
+	return err
+}
+
+// disableSchedule stops the timer of a schedule and removes its units.
+func disableSchedule(name string) error {
+	if !validScheduleName.MatchString(name) {
+		return fmt.Errorf("invalid schedule name")
+	}
+	dir, err := systemdUserDir()
+	if err != nil {
+		return err
+	}
+	unit := filepath.Join(dir, scheduleUnitName(name))
+	if !fileExists(unit + ".timer") {
+		return fmt.Errorf("schedule '%s' is not enabled", name)
+	}
+	if _, err := runCommand("systemctl", "--user", "disable", "--now", scheduleUnitName(name)+".timer"); err != nil {
+		logWarning(fmt.Sprintf("Could not stop the timer: %v", err))
+	}
+	for _, f := range []string{unit + ".timer", unit + ".service"} {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	_, err = runCommand("systemctl", "--user", "daemon-reload")
+	return err
+}
+
+// scheduleStatus describes the timer of a schedule: whether it is enabled
+// and when it runs next and ran last.
+func scheduleStatus(name string) string {
+	timer := scheduleUnitName(name) + ".timer"
+	dir, err := systemdUserDir()
+	if err != nil || !fileExists(filepath.Join(dir, timer)) {
+		return "disabled"
+	}
+	out, err := runCommand("systemctl", "--user", "show", timer, "--property=NextElapseUSecRealtime,LastTriggerUSec", "--value")
+	if err != nil {
+		return "enabled"
+	}
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	status := "enabled"
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) != "" {
+		status += ", next " + strings.TrimSpace(lines[0])
+	}
+	if len(lines) > 1 && strings.TrimSpace(lines[1]) != "" && strings.TrimSpace(lines[1]) != "n/a" {
+		status += ", last " + strings.TrimSpace(lines[1])
+	}
+	return status
+}
+
+// describeSchedule summarizes what a schedule backs up.
+func describeSchedule(s ScheduleConfig) string {
+	var what string
+	switch {
+	case s.All:
+		what = "all containers"
+	case s.Group != "":
+		what = "group " + s.Group
+	default:
+		what = strings.Join(s.Containers, ", ")
+	}
+	dest := s.Dest
+	if dest == "" {
+		dest = "[backup] dir"
+	}
+	desc := fmt.Sprintf("%s to %s", what, dest)
+	switch {
+	case s.Job != "":
+		desc = "job file " + s.Job
+	case what == "":
+		desc = "check " + dest
+	case s.Check:
+		desc = fmt.Sprintf("check %s, back up %s", dest, what)
+	}
+	if s.Prune {
+		desc += ", prune"
+	}
+	if s.Verify {
+		desc += ", verify"
+	}
+	if s.Hours.isSet() {
+		desc += "; " + s.Hours.String()
+	}
+	return desc
+}
+
+// scheduleNames returns the configured schedules in name order.
+func scheduleNames() []string {
+	var names []string
+	for name := range cfg.Schedules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func printSchedules() {
+	names := scheduleNames()
+	if len(names) == 0 {
+		logInfo("No schedules are configured; add a [schedules.<name>] table to the config file.")
+		return
+	}
+	for _, name := range names {
+		s := cfg.Schedules[name]
+		fmt.Printf("%s%s%s  (%s)\n", colorBold, name, colorReset, s.Calendar)
+		fmt.Printf("  %s\n", describeSchedule(s))
+		fmt.Printf("  %s\n", scheduleStatus(name))
+	}
+}
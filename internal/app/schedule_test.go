@@ -0,0 +1,55 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScheduleCheck(t *testing.T) {
+	window := func(s string) runHours {
+		r, err := parseClockRange(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return runHours{Window: &r}
+	}
+	daily, err := parseBlackout("daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		schedule string
+		s        ScheduleConfig
+		err      string // a substring of the error, or "" for none
+	}{
+		{"containers", "nightly", ScheduleConfig{Calendar: "daily", Containers: []string{"dev-box"}}, ""},
+		{"group", "work_hours", ScheduleConfig{Calendar: "Mon..Fri 02:00", Group: "work"}, ""},
+		{"all with steps", "weekly-all", ScheduleConfig{Calendar: "weekly", All: true, Check: true, Prune: true, Verify: true}, ""},
+		{"check alone", "check", ScheduleConfig{Calendar: "hourly", Check: true}, ""},
+		{"job", "job", ScheduleConfig{Calendar: "daily", Job: "~/jobs/nightly.yaml"}, ""},
+		{"window", "night", ScheduleConfig{Calendar: "hourly", All: true, Hours: window("01:00-06:00")}, ""},
+		{"bad name", "night ly", ScheduleConfig{Calendar: "daily", All: true}, "names may only contain"},
+		{"empty name", "", ScheduleConfig{Calendar: "daily", All: true}, "names may only contain"},
+		{"no calendar", "nightly", ScheduleConfig{All: true}, "calendar must not be empty"},
+		{"no target", "nightly", ScheduleConfig{Calendar: "daily"}, "exactly one"},
+		{"two targets", "nightly", ScheduleConfig{Calendar: "daily", All: true, Group: "work"}, "exactly one"},
+		{"job and containers", "nightly", ScheduleConfig{Calendar: "daily", Job: "a.yaml", Containers: []string{"x"}}, "exactly one"},
+		{"job with dest", "nightly", ScheduleConfig{Calendar: "daily", Job: "a.yaml", Dest: "nas"}, "belong in the job file"},
+		{"job with prune", "nightly", ScheduleConfig{Calendar: "daily", Job: "a.yaml", Prune: true}, "belong in the job file"},
+		{"no time left", "nightly", ScheduleConfig{Calendar: "daily", All: true, Hours: runHours{Blackouts: []blackout{daily}}}, "no time to run in"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.s.check(tt.schedule)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("check(%q) = %v, want no error", tt.schedule, err)
+			case tt.err != "" && err == nil:
+				t.Errorf("check(%q) = nil, want an error containing %q", tt.schedule, tt.err)
+			case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+				t.Errorf("check(%q) = %v, want an error containing %q", tt.schedule, err, tt.err)
+			}
+		})
+	}
+}
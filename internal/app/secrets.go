@@ -0,0 +1,300 @@
+package app
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Unlock methods for encrypted state.
+const (
+	unlockPassphrase = "passphrase"
+	unlockKeyring    = "keyring"
+)
+
+const (
+	stateMagic       = "DBTENC1\n"
+	stateKeyIters    = 600000
+	keyringService   = appName
+	keyringStateName = "state-key"
+	// stateCheckText is sealed into key.check to detect a wrong passphrase.
+	stateCheckText = "distrobox-backup-tool state key"
+)
+
+// stateKey encrypts files in the state directory; nil when encryption is off.
+var stateKey []byte
+
+// unlockState derives the state key when [security] encrypt_state is set,
+// asking for the passphrase or fetching it from the desktop keyring.
+func unlockState() error {
+	if !cfg.Security.EncryptState {
+		return nil
+	}
+	dir, err := stateDir()
+	if err != nil {
+		return err
+	}
+	salt, err := readOrCreateSalt(filepath.Join(dir, "key.salt"))
+	if err != nil {
+		return err
+	}
+
+	var passphrase string
+	if cfg.Security.Unlock == unlockKeyring {
+		passphrase, err = keyringLookup(keyringStateName)
+		if err != nil {
+			logWarning(fmt.Sprintf("Could not read the state passphrase from the keyring: %v", err))
+		}
+	}
+	if passphrase == "" {
+		passphrase, err = readPassphrase("Passphrase to unlock the encrypted catalog and history")
+		if err != nil {
+			return err
+		}
+		if passphrase == "" {
+			return errors.New("a passphrase is required because encrypt_state is enabled")
+		}
+		if cfg.Security.Unlock == unlockKeyring {
+			if err := keyringStore(keyringStateName, passphrase); err != nil {
+				logWarning(fmt.Sprintf("Could not store the passphrase in the keyring: %v", err))
+			}
+		}
+	}
+	key := pbkdf2SHA256([]byte(passphrase), salt, stateKeyIters, 32)
+
+	checkPath := filepath.Join(dir, "key.check")
+	if data, err := os.ReadFile(checkPath); err == nil {
+		plain, err := openSealed(key, data)
+		if err != nil || string(plain) != stateCheckText {
+			return errors.New("wrong passphrase for the encrypted state")
+		}
+	} else if os.IsNotExist(err) {
+		sealed, err := seal(key, []byte(stateCheckText))
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(checkPath, sealed, 0600); err != nil {
+			return err
+		}
+	} else {
+		return err
+	}
+	stateKey = key
+	return nil
+}
+
+func readOrCreateSalt(path string) ([]byte, error) {
+	salt, err := os.ReadFile(path)
+	if err == nil && len(salt) == 16 {
+		return salt, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	salt = make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, os.WriteFile(path, salt, 0600)
+}
+
+// readStateFile reads a file from the state directory, decrypting it if it
+// was written encrypted. Plaintext files from before encryption was enabled
+// are still readable and get encrypted on their next write.
+func readStateFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(stateMagic)) {
+		return data, nil
+	}
+	if stateKey == nil {
+		return nil, fmt.Errorf("%s is encrypted; enable encrypt_state in the config to read it", filepath.Base(path))
+	}
+	return openSealed(stateKey, data)
+}
+
+// writeStateFile atomically writes a file in the state directory, encrypting
+// it when state encryption is enabled.
+func writeStateFile(path string, data []byte) error {
+	if stateKey != nil {
+		sealed, err := seal(stateKey, data)
+		if err != nil {
+			return err
+		}
+		data = sealed
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// seal encrypts data with AES-256-GCM: magic || nonce || ciphertext.
+func seal(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte(stateMagic), nonce...)
+	return gcm.Seal(out, nonce, data, []byte(stateMagic)), nil
+}
+
+func openSealed(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte(stateMagic))
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted state file is truncated")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(stateMagic))
+	if err != nil {
+		return nil, errors.New("could not decrypt state file (wrong passphrase or corrupted file)")
+	}
+	return plain, nil
+}
+
+// pbkdf2SHA256 implements PBKDF2 (RFC 8018) with HMAC-SHA256.
+func pbkdf2SHA256(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iter; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// readPassphrase prompts for a secret without echoing it.
+func readPassphrase(prompt string) (string, error) {
+	fmt.Printf("%s> %s: %s", colorBold, prompt, colorReset)
+	if err := setEcho(false); err == nil {
+		defer func() {
+			setEcho(true)
+			fmt.Println()
+		}()
+	}
+	return readUserInput(), nil
+}
+
+func setEcho(on bool) error {
+	arg := "-echo"
+	if on {
+		arg = "echo"
+	}
+	cmd := commandRunner("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+// --- Credential references ---
+
+// resolveSecret turns a credential reference from the config into its value.
+// Plaintext credentials are refused so they never sit in config.toml:
+//
+//	keyring:<name>  looked up with secret-tool in the desktop keyring
+//	env:<VAR>       read from an environment variable
+//	file:<path>     first line of a file (e.g. a systemd credential)
+func resolveSecret(ref string) (string, error) {
+	kind, name, ok := strings.Cut(ref, ":")
+	if !ok || name == "" {
+		return "", errors.New("plaintext credentials are not allowed; use keyring:<name>, env:<VAR> or file:<path>")
+	}
+	switch kind {
+	case "keyring":
+		return keyringLookup(name)
+	case "env":
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v, nil
+	case "file":
+		data, err := os.ReadFile(expandHome(name))
+		if err != nil {
+			return "", err
+		}
+		line, _, _ := strings.Cut(string(data), "\n")
+		return strings.TrimSpace(line), nil
+	}
+	return "", fmt.Errorf("unknown credential source %q; use keyring:, env: or file:", kind)
+}
+
+// validSecretRef reports whether ref is a credential reference rather than a
+// plaintext secret.
+func validSecretRef(ref string) bool {
+	kind, name, ok := strings.Cut(ref, ":")
+	return ok && name != "" && (kind == "keyring" || kind == "env" || kind == "file")
+}
+
+func keyringLookup(name string) (string, error) {
+	if !commandExists("secret-tool") {
+		return "", errors.New("'secret-tool' (libsecret) is not installed")
+	}
+	cmd := commandRunner("secret-tool", "lookup", "service", keyringService, "account", name)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("no keyring entry for %q", name)
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+func keyringStore(name, secret string) error {
+	if !commandExists("secret-tool") {
+		return errors.New("'secret-tool' (libsecret) is not installed")
+	}
+	cmd := commandRunner("secret-tool", "store", "--label="+appName+" "+name, "service", keyringService, "account", name)
+	cmd.Stdin = strings.NewReader(secret)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// expandHome expands a leading "~/" to the user's home directory.
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(homeDir, path[2:])
+		}
+	}
+	return path
+}
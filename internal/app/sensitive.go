@@ -0,0 +1,180 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// A backup uploaded unencrypted to a cloud destination is readable by
+// whoever runs the storage. Before such a backup the tool looks for
+// credentials in well-known places and warns about them, or with
+// [backup] secrets = "exclude" leaves them out of the home archive. The
+// image itself cannot be filtered, so credentials inside it are only
+// reported.
+//
+// Independently of that check, destinations can leave a preset of
+// sensitive paths out of every home archive written to them: by default
+// cloud destinations do, others do not, and exclude_sensitive in a
+// [destinations.<name>] table overrides it.
+
+// Modes for [backup] secrets.
+const (
+	secretsWarn    = "warn"
+	secretsExclude = "exclude"
+	secretsIgnore  = "ignore"
+)
+
+// secretPaths are where credentials are commonly kept, relative to a home.
+var secretPaths = []string{".ssh", ".aws", ".netrc", ".docker/config.json"}
+
+// sensitivePreset is the default [backup] sensitive_paths: keys, keyrings,
+// browser profiles and credential stores, relative to a home.
+var sensitivePreset = []string{
+	".ssh", ".gnupg", ".aws", ".azure", ".config/gcloud", ".kube/config",
+	".netrc", ".git-credentials", ".docker/config.json", ".config/gh/hosts.yml",
+	".password-store", ".local/share/keyrings", ".local/share/kwalletd",
+	".mozilla", ".thunderbird", ".config/google-chrome", ".config/chromium",
+	".config/BraveSoftware", ".config/microsoft-edge", ".config/vivaldi",
+}
+
+// secretScanScript prints the secretPaths present in the homes of the
+// container's own filesystem, skipping the home given as $1: it is mounted
+// from the host and not part of the image.
+var secretScanScript = fmt.Sprintf(`for d in /root /home/*; do [ "$d" = "$1" ] && continue; for p in %s; do [ -e "$d/$p" ] && echo "$d/$p"; done; done; true`, strings.Join(secretPaths, " "))
+
+// secretFindings are the credentials found for a backup: paths relative to
+// the isolated home, and paths inside the container.
+type secretFindings struct {
+	Home  []string
+	Image []string
+}
+
+// findSecrets looks for secretPaths in home (if set) and, when the container
+// is running, in the homes inside its filesystem. A stopped container is
+// not started for it.
+func findSecrets(c Container, home string) secretFindings {
+	var f secretFindings
+	if home != "" {
+		for _, p := range secretPaths {
+			if _, err := os.Lstat(filepath.Join(home, p)); err == nil {
+				f.Home = append(f.Home, p)
+			}
+		}
+	}
+	if c.State == "running" {
+		if out, err := runCommand(containerRuntime, "exec", "--user", "root", c.Name, "sh", "-c", secretScanScript, "sh", c.Home); err == nil {
+			f.Image = strings.Fields(out)
+		}
+	}
+	return f
+}
+
+// exposedBackup reports whether job goes to a cloud destination without
+// encryption.
+func exposedBackup(job backupJob) bool {
+	return job.Upload != nil && job.Upload.Rclone && job.Encryption.Cipher == backup.EncryptNone
+}
+
+// jobDestination returns the configured destination job writes to.
+func jobDestination(job backupJob) (DestinationConfig, bool) {
+	for _, name := range sortedDestinationNames() {
+		d := cfg.Destinations[name]
+		if t, ok := parseRemote(d.Path); ok {
+			if job.Upload != nil && t.String() == job.Upload.String() {
+				return d, true
+			}
+		} else if job.Upload == nil && filepath.Clean(expandHome(d.Path)) == filepath.Dir(job.File) {
+			return d, true
+		}
+	}
+	return DestinationConfig{}, false
+}
+
+// sortedDestinationNames returns the names of the configured destinations
+// in order, so a folder configured twice always resolves the same way.
+func sortedDestinationNames() []string {
+	names := make([]string, 0, len(cfg.Destinations))
+	for name := range cfg.Destinations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// excludesSensitive reports whether home archives of job leave out the
+// sensitive paths. Encrypted archives keep them: only whoever has the key
+// can read them, and a restore should not lose them.
+func excludesSensitive(job backupJob) bool {
+	if job.Encryption.Cipher != backup.EncryptNone {
+		return false
+	}
+	if d, ok := jobDestination(job); ok && d.HasExcludeSensitive {
+		return d.ExcludeSensitive
+	}
+	return job.Upload != nil && job.Upload.Rclone
+}
+
+// sensitiveExcludes returns the sensitive paths present in home, the
+// isolated home archived by job (empty if none), if its destination leaves
+// them out.
+func sensitiveExcludes(job backupJob, home string) []string {
+	if home == "" || !excludesSensitive(job) {
+		return nil
+	}
+	var found []string
+	for _, p := range cfg.Backup.SensitivePaths {
+		p = filepath.Clean(p)
+		if _, err := os.Lstat(filepath.Join(home, p)); err == nil {
+			found = append(found, p)
+		}
+	}
+	if len(found) > 0 {
+		logInfo(fmt.Sprintf("Leaving sensitive paths out of the home archive: %s", strings.Join(found, ", ")))
+	}
+	return found
+}
+
+// checkSecrets warns about credentials in an exposed backup of job, whose
+// isolated home (empty if none is archived) is home, and returns the home
+// paths to leave out of the archive besides excluded, which are left out
+// already.
+func checkSecrets(job backupJob, home string, excluded []string) []string {
+	if cfg.Backup.Secrets == secretsIgnore || !exposedBackup(job) {
+		return nil
+	}
+	f := findSecrets(job.Container, home)
+	f.Home = withoutExcluded(f.Home, excluded)
+	if len(f.Home) == 0 && len(f.Image) == 0 {
+		return nil
+	}
+	var exclude []string
+	if len(f.Home) > 0 {
+		if cfg.Backup.Secrets == secretsExclude {
+			exclude = f.Home
+			logWarning(fmt.Sprintf("Leaving %s out of the home archive of '%s', as it goes unencrypted to %s.", strings.Join(f.Home, ", "), job.Container.Name, job.Upload))
+		} else {
+			logWarning(fmt.Sprintf("The home of '%s' holds credentials (%s) and goes unencrypted to %s. Configure [encryption], or set [backup] secrets = \"exclude\" to leave them out.", job.Container.Name, strings.Join(f.Home, ", "), job.Upload))
+		}
+	}
+	if len(f.Image) > 0 {
+		logWarning(fmt.Sprintf("The image of '%s' holds credentials (%s) and goes unencrypted to %s; they cannot be left out of the image. Configure [encryption] to protect them.", job.Container.Name, strings.Join(f.Image, ", "), job.Upload))
+	}
+	return exclude
+}
+
+// withoutExcluded drops the paths in excluded, or below them, from paths.
+func withoutExcluded(paths, excluded []string) []string {
+	var kept []string
+	for _, p := range paths {
+		if !slices.ContainsFunc(excluded, func(e string) bool { return p == e || strings.HasPrefix(p, e+"/") }) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,278 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// setting is a config value offered by the `config` command and the
+// Settings menu. Tables such as [groups] or [schedules.*] are edited in the
+// file itself.
+type setting struct {
+	Key   string
+	Help  string
+	Value func(c *Config) string
+}
+
+var settings = []setting{
+	{"backup.dir", "default destination folder", func(c *Config) string { return c.Backup.Dir }},
+	{"backup.compression", "gzip, zstd, xz or none", func(c *Config) string { return c.Backup.Compression.String() }},
+	{"backup.compression_level", "0 for the format's default", func(c *Config) string { return strconv.Itoa(c.Backup.CompressionLevel) }},
+	{"backup.name_template", "e.g. {container}-{date}; also {time} and {host}", func(c *Config) string { return c.Backup.NameTemplate }},
+	{"backup.home_owner", "names, numeric or user", func(c *Config) string { return c.Backup.HomeOwner }},
+	{"backup.home_xattrs", "keep extended attributes in home archives", func(c *Config) string { return strconv.FormatBool(c.Backup.HomeXattrs) }},
+	{"backup.secrets", "warn, exclude or ignore credentials in unencrypted cloud backups", func(c *Config) string { return c.Backup.Secrets }},
+	{"backup.file_mode", "permissions of new backup files", func(c *Config) string { return fmt.Sprintf("%04o", uint32(c.Backup.FileMode)) }},
+	{"backup.dir_mode", "permissions of new backup folders", func(c *Config) string { return fmt.Sprintf("%04o", uint32(c.Backup.DirMode)) }},
+	{"backup.home_checksums", "record per-file hashes of separate home archives", func(c *Config) string { return strconv.FormatBool(c.Backup.HomeChecksums) }},
+	{"batch.on_failure", "continue, stop or retry", func(c *Config) string { return c.Batch.OnFailure }},
+	{"batch.retries", "extra runs of a failed container with retry", func(c *Config) string { return strconv.Itoa(c.Batch.Retries) }},
+	{"queue.parallel", "queued jobs of the menu run at once", func(c *Config) string { return strconv.Itoa(c.Queue.Parallel) }},
+	{"snapshot.keep", "manual snapshots kept per container (0 = all)", func(c *Config) string { return strconv.Itoa(c.Snapshot.Keep) }},
+	{"encryption.method", "age, gpg or none", func(c *Config) string { return c.Encryption.Method.String() }},
+	{"encryption.recipient", "age recipient or gpg key", func(c *Config) string { return c.Encryption.Recipient }},
+	{"retention.keep_last", "newest backups kept per container", func(c *Config) string { return strconv.Itoa(c.Retention.KeepLast) }},
+	{"retention.keep_daily", "daily backups kept", func(c *Config) string { return strconv.Itoa(c.Retention.KeepDaily) }},
+	{"retention.keep_weekly", "weekly backups kept", func(c *Config) string { return strconv.Itoa(c.Retention.KeepWeekly) }},
+	{"retention.keep_monthly", "monthly backups kept", func(c *Config) string { return strconv.Itoa(c.Retention.KeepMonthly) }},
+	{"transfer.bandwidth_limit", "e.g. \"20M\" per second; empty for none", func(c *Config) string {
+		if c.Transfer.BandwidthLimit == 0 {
+			return ""
+		}
+		return formatBytes(uint64(c.Transfer.BandwidthLimit)) + "/s"
+	}},
+	{"transfer.retries", "retries of failed transfers", func(c *Config) string { return strconv.Itoa(c.Transfer.Retries) }},
+	{"restore.smoke_test", "ask, always or never", func(c *Config) string { return c.Restore.SmokeTest }},
+	{"restore.check_packages", "ask, always or never", func(c *Config) string { return c.Restore.CheckPackages }},
+	{"edit.pre_backup", "ask, always or never", func(c *Config) string { return c.Edit.PreBackup }},
+	{"edit.safety_dir", "folder for safety backups (default: backup.dir)", func(c *Config) string { return c.Edit.SafetyDir }},
+	{"ui.messages", "enter, timed or none", func(c *Config) string { return c.UI.Messages }},
+	{"ui.symbols", "auto, unicode or ascii", func(c *Config) string { return c.UI.Symbols }},
+	{"ui.tui", "pick from lists with the arrow keys instead of numbers", func(c *Config) string { return strconv.FormatBool(c.UI.TUI) }},
+	{"log.target", "stdout, journal or both", func(c *Config) string { return c.Log.Target }},
+	{"log.file", "keep the operation log and history", func(c *Config) string { return strconv.FormatBool(c.Log.File) }},
+	{"power.min_battery", "percent; 0 disables the check", func(c *Config) string { return strconv.Itoa(c.Power.MinBattery) }},
+	{"power.skip_metered", "hold back remote runs on metered connections", func(c *Config) string { return strconv.FormatBool(c.Power.SkipMetered) }},
+	{"power.inhibit", "block suspend and shutdown during backups and conversions", func(c *Config) string { return strconv.FormatBool(c.Power.Inhibit) }},
+	{"homes.root", "folder for new isolated homes (default: distrobox's)", func(c *Config) string { return c.Homes.Root }},
+	{"fleet.dir", "shared folder for fleet catalogs", func(c *Config) string { return c.Fleet.Dir }},
+}
+
+func findSetting(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// printSettings lists the effective value of every setting.
+func printSettings(numbered bool) {
+	for i, s := range settings {
+		value := s.Value(cfg)
+		if value == "" {
+			value = colorYellow + "(not set)" + colorReset
+		}
+		if numbered {
+			fmt.Printf("  %s%2d.%s %-26s %s\n", colorBold, i+1, colorReset, s.Key, value)
+		} else {
+			fmt.Printf("%-26s %s\n", s.Key, value)
+		}
+	}
+}
+
+// settingLiteral turns what the user typed into a TOML value: booleans,
+// integers, arrays and quoted strings are kept, anything else is quoted.
+func settingLiteral(input string) string {
+	input = strings.TrimSpace(input)
+	if input == "true" || input == "false" || strings.HasPrefix(input, "[") || strings.HasPrefix(input, `"`) || strings.HasPrefix(input, "'") {
+		return input
+	}
+	if _, err := strconv.Atoi(input); err == nil {
+		return input
+	}
+	return strconv.Quote(input)
+}
+
+var bareTOMLKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// setTOMLValue returns text with the key at path set to raw, or removed
+// when raw is "". An existing assignment is replaced in place; a new one
+// goes at the end of its table, which is created if needed.
+func setTOMLValue(text string, path []string, raw string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if text == "" {
+		lines = nil
+	}
+	want := strings.Join(path, "\x00")
+	tableWant := strings.Join(path[:len(path)-1], "\x00")
+	var table []string
+	tableEnd := -1 // index after the last line of the wanted table
+	if tableWant == "" {
+		tableEnd = 0
+	}
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(stripComment(line))
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			table = splitKeyPath(strings.TrimSpace(trimmed[1 : len(trimmed)-1]))
+			if strings.Join(table, "\x00") == tableWant {
+				tableEnd = i + 1
+			}
+			continue
+		}
+		key, _, ok := strings.Cut(trimmed, "=")
+		if !ok {
+			continue
+		}
+		full := append(append([]string{}, table...), splitKeyPath(strings.TrimSpace(key))...)
+		if strings.Join(full, "\x00") == want {
+			if raw == "" {
+				return strings.Join(append(lines[:i:i], lines[i+1:]...), "\n") + "\n"
+			}
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			lines[i] = indent + strings.TrimSpace(key) + " = " + raw
+			return strings.Join(lines, "\n") + "\n"
+		}
+		if strings.Join(table, "\x00") == tableWant {
+			tableEnd = i + 1
+		}
+	}
+	if raw == "" {
+		return text
+	}
+	assignment := tomlKey(path[len(path)-1:]) + " = " + raw
+	if tableEnd < 0 {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "["+tomlKey(path[:len(path)-1])+"]", assignment)
+		return strings.Join(lines, "\n") + "\n"
+	}
+	lines = append(lines[:tableEnd], append([]string{assignment}, lines[tableEnd:]...)...)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// tomlKey joins key segments, quoting those that are not bare keys.
+func tomlKey(path []string) string {
+	parts := make([]string, len(path))
+	for i, p := range path {
+		if bareTOMLKey.MatchString(p) {
+			parts[i] = p
+		} else {
+			parts[i] = strconv.Quote(p)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// saveSetting sets key to the TOML literal raw in the config file, or
+// removes it when raw is "", after checking that the result is a valid
+// config. It returns the new config.
+func saveSetting(key, raw string) (*Config, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	if isYAMLConfig(path) {
+		return nil, fmt.Errorf("%s is a YAML file; change it with 'distrobox-tool config edit'", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	text := setTOMLValue(string(data), splitKeyPath(key), raw)
+	c, err := parseConfig(text, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(text), 0644); err != nil {
+		return nil, err
+	}
+	return c, os.Rename(tmp, path)
+}
+
+// editConfigFile opens the config file in $VISUAL or $EDITOR (vi by
+// default) and checks it afterwards. An invalid file can be edited again
+// or is put back the way it was.
+func editConfigFile() (*Config, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	original, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	for {
+		cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("editor failed: %w", err)
+		}
+		c, err := readConfigFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return defaultConfig(), nil
+		}
+		if err == nil {
+			return c, nil
+		}
+		logError(fmt.Sprintf("The config file is not valid: %v", err))
+		fmt.Printf("%s> Edit it again? Otherwise your changes are discarded. (Y/n): %s", colorBold, colorReset)
+		if confirmDefaultYes() {
+			continue
+		}
+		if original == nil {
+			return cfg, os.Remove(path)
+		}
+		return cfg, os.WriteFile(path, original, 0644)
+	}
+}
+
+func handleSettings() {
+	clearScreen()
+	printTitle(colorWhite, "⚙️ Settings")
+	path, _ := configPath()
+	fmt.Printf("%s%sHint:%s Values are saved to %s. Groups, destinations and schedules are edited in the file.\n\n", colorYellow, colorUnderline, colorReset, path)
+	printSettings(true)
+	fmt.Println()
+	choice := selectItem("Select a setting to change, or press Enter to go back", len(settings))
+	if choice == 0 {
+		return
+	}
+	s := settings[choice-1]
+	fmt.Printf("%s (%s), currently: %s\n", s.Key, s.Help, s.Value(cfg))
+	fmt.Printf("%s> New value (empty restores the default): %s", colorBold, colorReset)
+	input := readUserInput()
+	raw := ""
+	if input != "" {
+		raw = settingLiteral(input)
+	}
+	c, err := saveSetting(s.Key, raw)
+	if err != nil {
+		logError(fmt.Sprintf("Not saved: %v", err))
+		return
+	}
+	cfg = c
+	logSuccess(fmt.Sprintf("✅ %s is now %s.", s.Key, s.Value(cfg)))
+}
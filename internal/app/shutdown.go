@@ -0,0 +1,127 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// shutdownSnapshotLabel tags the snapshots taken on shutdown or logout; only
+// the newest one per container is kept.
+const shutdownSnapshotLabel = "shutdown"
+
+// shutdownUnitName is the systemd user unit written by
+// `shutdown-snapshot --install`.
+const shutdownUnitName = appName + "-shutdown.service"
+
+// shutdownContainers resolves the containers configured in [shutdown].
+func shutdownContainers() ([]Container, error) {
+	if len(cfg.Shutdown.Containers) == 0 && cfg.Shutdown.Group == "" {
+		return nil, fmt.Errorf("no containers are configured; set containers or group in [shutdown]")
+	}
+	containers, err := getContainers()
+	if err != nil {
+		return nil, err
+	}
+	var members []Container
+	if cfg.Shutdown.Group != "" {
+		if _, ok := cfg.Groups[cfg.Shutdown.Group]; !ok {
+			return nil, fmt.Errorf("group '%s' is not configured", cfg.Shutdown.Group)
+		}
+		var missing []string
+		members, missing = groupMembers(cfg.Shutdown.Group, containers)
+		for _, name := range missing {
+			logWarning(fmt.Sprintf("Container '%s' of group '%s' does not exist.", name, cfg.Shutdown.Group))
+		}
+	}
+	for _, name := range cfg.Shutdown.Containers {
+		c, ok := findContainer(containers, name)
+		if !ok {
+			logWarning(fmt.Sprintf("Container '%s' does not exist.", name))
+			continue
+		}
+		if _, dup := findContainer(members, name); !dup {
+			members = append(members, c)
+		}
+	}
+	return members, nil
+}
+
+// runShutdownSnapshots commits each container to a local snapshot image,
+// replacing its previous shutdown snapshot. A commit only records the
+// container's changes, so it is much quicker than a backup. Containers not
+// started before the budget runs out are skipped. It returns the number of
+// containers that were not snapshotted.
+func runShutdownSnapshots(containers []Container, budget time.Duration) int {
+	deadline := time.Now().Add(budget)
+	missed := 0
+	for i, c := range orderContainers(containers) {
+		if time.Now().After(deadline) {
+			missed = len(containers) - i
+			logWarning(fmt.Sprintf("The time budget of %s is used up; skipping %d containers.", budget, missed))
+			break
+		}
+		old := listSnapshots(c.Name, shutdownSnapshotLabel)
+		image := snapshotImageName(c.Name, shutdownSnapshotLabel)
+		start := time.Now()
+		if err := client.Commit(c.Name, image); err != nil {
+			logError(fmt.Sprintf("Failed to snapshot '%s': %v", c.Name, err))
+			missed++
+			continue
+		}
+		logSuccess(fmt.Sprintf("✅ Snapshot of '%s' saved as '%s' in %s.", c.Name, image, time.Since(start).Round(time.Second)))
+		for _, s := range old {
+			if err := client.RemoveImage(s.Ref); err != nil {
+				logWarning(fmt.Sprintf("Failed to remove the previous snapshot '%s': %v", s.Ref, err))
+			}
+		}
+	}
+	return missed
+}
+
+// shutdownUnit returns a systemd user unit that runs exe's shutdown-snapshot
+// command when the user session ends, i.e. on logout and before shutdown.
+func shutdownUnit(exe string, budget time.Duration) string {
+	return fmt.Sprintf(`[Unit]
+Description=Snapshot distrobox containers on logout and shutdown
+DefaultDependencies=no
+Before=shutdown.target
+Conflicts=shutdown.target
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=/bin/true
+ExecStop=%s shutdown-snapshot --budget %s
+TimeoutStopSec=%d
+
+[Install]
+WantedBy=default.target
+`, systemdQuote(exe), budget, int((budget + 30*time.Second).Seconds()))
+}
+
+// shutdownUnitPath returns where the unit is installed for the user.
+func shutdownUnitPath() (string, error) {
+	dir, err := systemdUserDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, shutdownUnitName), nil
+}
+
+// installShutdownUnit writes the unit for the running executable.
+func installShutdownUnit(budget time.Duration) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	path, err := shutdownUnitPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, []byte(shutdownUnit(exe, budget)), 0644)
+}
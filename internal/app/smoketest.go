@@ -0,0 +1,67 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Smoke test modes for [restore] smoke_test.
+const (
+	smokeAsk    = "ask"
+	smokeAlways = "always"
+	smokeNever  = "never"
+)
+
+// defaultSmokeTestCommand checks that a shell runs and that a known package
+// manager is present and executable.
+const defaultSmokeTestCommand = `true && for pm in apt-get dnf yum pacman zypper apk xbps-install emerge; do
+  if command -v "$pm" >/dev/null 2>&1; then "$pm" --version >/dev/null 2>&1 && echo "package manager: $pm OK" && exit 0; echo "package manager: $pm FAILED"; exit 1; fi
+done; echo "no known package manager found"; exit 1`
+
+// maybeSmokeTest runs the configured smoke test in a freshly restored
+// container, asking first when the mode is "ask".
+func maybeSmokeTest(containerName string) {
+	switch cfg.Restore.SmokeTest {
+	case smokeNever:
+		return
+	case smokeAsk:
+		fmt.Printf("%s> Run a smoke test inside '%s' to check it is usable? (y/N): %s", colorBold, containerName, colorReset)
+		if !confirmAction() {
+			return
+		}
+	}
+	runSmokeTest(containerName)
+}
+
+// runSmokeTest executes the smoke test command via distrobox-enter and
+// reports whether the container is healthy.
+func runSmokeTest(containerName string) bool {
+	command := cfg.Restore.SmokeTestCommand
+	if command == "" {
+		command = defaultSmokeTestCommand
+	}
+	logInfo(fmt.Sprintf("Running smoke test in '%s' (the first start may take a while)...", containerName))
+	done := make(chan bool)
+	go showSpinner("smoke-test", "Testing container...", done)
+	enter := []string{"distrobox-enter", containerName, "--"}
+	if d, err := inspectContainer(containerName); err == nil && isToolbox(d.Config.Labels) {
+		enter = []string{"toolbox", "run", "--container", containerName}
+	}
+	output, err := runCommand(enter[0], append(enter[1:], "sh", "-c", command)...)
+	done <- true
+
+	output = strings.TrimSpace(output)
+	if err != nil {
+		logError(fmt.Sprintf("Smoke test for '%s' FAILED. The restored container may not be usable.", containerName))
+		if output != "" {
+			fmt.Println(output)
+		}
+		return false
+	}
+	logSuccess(fmt.Sprintf("✅ Smoke test for '%s' PASSED.", containerName))
+	if output != "" {
+		lines := strings.Split(output, "\n")
+		logInfo(lines[len(lines)-1])
+	}
+	return true
+}
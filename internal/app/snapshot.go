@@ -0,0 +1,198 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// manualSnapshotLabel tags snapshots taken with Snapshots or `snapshot
+// create`; [snapshot] keep bounds how many of them a container keeps.
+const manualSnapshotLabel = "manual"
+
+// rollbackSnapshotLabel tags the snapshot of the state a rollback replaced,
+// so a rollback can be undone. Only the newest one per container is kept.
+const rollbackSnapshotLabel = "pre-rollback"
+
+// snapshotRef is a local snapshot image of a container.
+type snapshotRef struct {
+	Ref   string
+	Label string
+	Taken time.Time
+}
+
+// listSnapshots lists the snapshot images of a container, newest first. An
+// empty label lists the snapshots of every label.
+func listSnapshots(container, label string) []snapshotRef {
+	out, err := client.RuntimeOutput("images", "--format", "{{.Repository}}:{{.Tag}}")
+	if err != nil {
+		return nil
+	}
+	prefix := snapshotRepository + "/" + strings.ToLower(container) + ":"
+	var snaps []snapshotRef
+	for _, ref := range strings.Fields(out) {
+		tag, ok := strings.CutPrefix(strings.TrimPrefix(ref, "localhost/"), prefix)
+		if !ok {
+			continue
+		}
+		i := strings.LastIndex(tag, "-")
+		if i < 0 {
+			continue
+		}
+		unix, err := strconv.ParseInt(tag[i+1:], 10, 64)
+		if err != nil || (label != "" && tag[:i] != label) {
+			continue
+		}
+		snaps = append(snaps, snapshotRef{Ref: ref, Label: tag[:i], Taken: time.Unix(unix, 0)})
+	}
+	sort.SliceStable(snaps, func(i, j int) bool { return snaps[i].Taken.After(snaps[j].Taken) })
+	return snaps
+}
+
+// latestSnapshot returns the newest snapshot to roll back to. Pre-rollback
+// snapshots are skipped so that rolling back twice does not undo the first
+// rollback.
+func latestSnapshot(snaps []snapshotRef) (snapshotRef, bool) {
+	for _, s := range snaps {
+		if s.Label != rollbackSnapshotLabel {
+			return s, true
+		}
+	}
+	return snapshotRef{}, false
+}
+
+// findSnapshot looks a snapshot up by its full reference or its tag.
+func findSnapshot(snaps []snapshotRef, name string) (snapshotRef, bool) {
+	for _, s := range snaps {
+		if s.Ref == name || strings.TrimPrefix(s.Ref, "localhost/") == name || s.Ref[strings.LastIndex(s.Ref, ":")+1:] == name {
+			return s, true
+		}
+	}
+	return snapshotRef{}, false
+}
+
+// pruneSnapshots removes all but the newest keep snapshots of a container
+// with the given label; keep 0 keeps them all. A snapshot still used by the
+// container after a rollback cannot be removed and is left for later.
+func pruneSnapshots(container, label string, keep int) {
+	if keep <= 0 {
+		return
+	}
+	snaps := listSnapshots(container, label)
+	if len(snaps) <= keep {
+		return
+	}
+	for _, s := range snaps[keep:] {
+		if err := client.RemoveImage(s.Ref); err != nil {
+			logWarning(fmt.Sprintf("Could not remove the old snapshot '%s' (the container may still use it): %v", s.Ref, err))
+		} else {
+			logInfo(fmt.Sprintf("Removed the old snapshot '%s'.", s.Ref))
+		}
+	}
+}
+
+// takeSnapshot commits a container to a new local snapshot image with label
+// and returns its reference. No archive is written, so this takes seconds.
+func takeSnapshot(container Container, label string) (string, error) {
+	image := snapshotImageName(container.Name, label)
+	done := make(chan bool)
+	go showSpinner("snapshot", fmt.Sprintf("Snapshotting '%s'...", container.Name), done)
+	err := client.Commit(container.Name, image)
+	done <- true
+	if err != nil {
+		return "", fmt.Errorf("failed to snapshot '%s': %w", container.Name, err)
+	}
+	return image, nil
+}
+
+// snapshotContainer takes a manual snapshot and drops the ones beyond
+// [snapshot] keep.
+func snapshotContainer(container Container) (string, error) {
+	image, err := takeSnapshot(container, manualSnapshotLabel)
+	if err != nil {
+		return "", err
+	}
+	pruneSnapshots(container.Name, manualSnapshotLabel, cfg.Snapshot.Keep)
+	return image, nil
+}
+
+// rollbackToSnapshot snapshots the current state of a container and then
+// recreates it from snap, so the rollback itself can be undone by rolling
+// back to the pre-rollback snapshot.
+func rollbackToSnapshot(container Container, snap snapshotRef) bool {
+	current, err := takeSnapshot(container, rollbackSnapshotLabel)
+	if err != nil {
+		logError(err.Error())
+		logError("The rollback was not started.")
+		return false
+	}
+	if !rollbackToImage(container, snap.Ref) {
+		return false
+	}
+	logInfo(fmt.Sprintf("The state before the rollback was saved as '%s'.", current))
+	pruneSnapshots(container.Name, rollbackSnapshotLabel, 1)
+	return true
+}
+
+// printSnapshots lists snapshots numbered from 1.
+func printSnapshots(snaps []snapshotRef) {
+	for i, s := range snaps {
+		fmt.Printf("  %s%2d)%s %s  %-12s %s\n", colorCyan, i+1, colorReset, s.Taken.Local().Format("2006-01-02 15:04:05"), s.Label, s.Ref)
+	}
+}
+
+func handleSnapshots(containers []Container) {
+	clearScreen()
+	printTitle(colorBlue, "📸 Snapshots")
+	fmt.Printf("%s%sHint:%s Snapshots are local images; they are quick to take but are not backups and stay on this machine.\n\n", colorYellow, colorUnderline, colorReset)
+
+	containerIndex := selectContainer("the container", containers)
+	if containerIndex == 0 {
+		return
+	}
+	container := containers[containerIndex-1]
+	defer routeTo(container)()
+	snaps := listSnapshots(container.Name, "")
+	fmt.Println()
+	if len(snaps) == 0 {
+		logInfo(fmt.Sprintf("'%s' has no snapshots yet.", container.Name))
+	} else {
+		printSnapshots(snaps)
+	}
+
+	fmt.Printf("\n  %ss)%s     Take a snapshot now\n", colorGreen, colorReset)
+	if _, ok := latestSnapshot(snaps); ok {
+		fmt.Printf("  %sr)%s     Roll back to the newest snapshot\n", colorRed, colorReset)
+	}
+	if len(snaps) > 0 {
+		fmt.Printf("  %s1-%d)%s  Roll back to that snapshot\n", colorRed, len(snaps), colorReset)
+	}
+	fmt.Printf("  %sEnter)%s Back to the menu\n", colorWhite, colorReset)
+	fmt.Printf("%s> Choose an option: %s", colorBold, colorReset)
+	choice := strings.ToLower(readUserInput())
+	switch choice {
+	case "":
+		return
+	case "s":
+		image, err := snapshotContainer(container)
+		if err != nil {
+			logError(err.Error())
+			return
+		}
+		logSuccess(fmt.Sprintf("✅ Snapshot saved as '%s'.", image))
+		return
+	case "r":
+		if snap, ok := latestSnapshot(snaps); ok {
+			rollbackToSnapshot(container, snap)
+			return
+		}
+	default:
+		if n, err := strconv.Atoi(choice); err == nil && n >= 1 && n <= len(snaps) {
+			rollbackToSnapshot(container, snaps[n-1])
+			return
+		}
+	}
+	logWarning("Invalid option.")
+}
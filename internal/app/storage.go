@@ -0,0 +1,67 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Image archives do not depend on the storage driver, but drivers store
+// layers very differently: overlay shares them, btrfs snapshots them and
+// vfs keeps a full copy of every layer.
+
+// storageDriverNotes explains what loading onto a driver costs compared to
+// overlay.
+var storageDriverNotes = map[string]string{
+	"vfs":   "vfs copies every layer in full, so loading is slower and takes more space",
+	"btrfs": "btrfs snapshots every layer, so loading is slower than on overlay",
+	"zfs":   "zfs clones every layer, so loading is slower than on overlay",
+}
+
+// hostStorageDriver returns the runtime's storage driver, or "" when it
+// cannot be determined.
+func hostStorageDriver() string {
+	driver, err := client.StorageDriver()
+	if err != nil {
+		return ""
+	}
+	return driver
+}
+
+// adaptToStorage compares the storage driver a backup was made on with
+// this host's. When they differ it says what that costs, and on vfs it
+// flattens the loaded image into a single layer so the container does not
+// sit on a full copy of every layer; job.Image is then the flattened image.
+func adaptToStorage(job *restoreJob) {
+	if job.Manifest == nil || job.Manifest.StorageDriver == "" {
+		return
+	}
+	from, to := job.Manifest.StorageDriver, hostStorageDriver()
+	if to == "" || from == to {
+		return
+	}
+	logWarning(fmt.Sprintf("The backup was made on %s storage; this host uses %s.", from, to))
+	if note, ok := storageDriverNotes[to]; ok {
+		logWarning(strings.ToUpper(note[:1]) + note[1:] + ".")
+	}
+	if to != "vfs" {
+		return
+	}
+	layers, err := client.LayerCount(job.Image)
+	if err != nil || layers < 2 {
+		return
+	}
+	ref := journalTempImage(fmt.Sprintf("distrobox-restore-%s:%s", strings.ToLower(containerNameFromFile(job.File)), newUUID()), "restore", filepath.Base(job.File))
+	done := make(chan bool)
+	go showSpinner("flatten", fmt.Sprintf("Flattening %d layers for vfs storage...", layers), done)
+	err = client.Flatten(job.Image, ref)
+	done <- true
+	if err != nil {
+		releaseTempImage(ref)
+		logWarning(fmt.Sprintf("Could not flatten the image, keeping its %d layers: %v", layers, err))
+		return
+	}
+	removeTempImage(job.Image)
+	job.Image = ref
+	logInfo("The image was flattened into a single layer.")
+}
@@ -0,0 +1,277 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// A system files backup is a gzipped tarball of selected paths inside a
+// container, such as /etc, /opt and /usr/local, taken apart from the image
+// so customizations can be laid over a fresh base image later.
+const systemArchiveSuffix = "-system.tar.gz"
+
+// systemArchivePath names a new system files backup of a container in dir.
+func systemArchivePath(dir, name string) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-%s%s", name, time.Now().Format("20060102-150405"), systemArchiveSuffix))
+}
+
+// hostManagedFiles are written by distrobox or podman for every container
+// from the host's settings. They are neither backed up nor restored, so a
+// restore does not put a stale hostname or DNS server into a container.
+var hostManagedFiles = []string{"etc/hosts", "etc/resolv.conf", "etc/hostname"}
+
+// hostManagedExcludes returns the tar options leaving out hostManagedFiles,
+// with or without the leading ./ an archive may hold them under.
+func hostManagedExcludes() []string {
+	var args []string
+	for _, f := range hostManagedFiles {
+		args = append(args, "--exclude="+f, "--exclude=./"+f)
+	}
+	return args
+}
+
+// existingSystemPaths keeps the paths that exist in the container, relative
+// to / as tar wants them.
+func existingSystemPaths(c Container, paths []string) ([]string, error) {
+	args := []string{"exec", "--user", "root", c.Name, "sh", "-c", `for p; do [ -e "/$p" ] && printf '%s\n' "$p"; done; true`, "sh"}
+	for _, p := range paths {
+		args = append(args, strings.TrimPrefix(filepath.Clean(p), "/"))
+	}
+	out, err := runCommand(containerRuntime, args...)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(out), nil
+}
+
+// backupSystemFiles archives paths of the container into file with a
+// manifest next to it recording the paths and the container's image. tar
+// runs as root inside the container, keeping owners and modes; a stopped
+// container is started for it.
+func backupSystemFiles(c Container, file string, paths []string) error {
+	stop, err := startForExec(c)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	present, err := existingSystemPaths(c, paths)
+	if err != nil {
+		return fmt.Errorf("could not look for the paths in '%s': %w", c.Name, err)
+	}
+	if len(present) == 0 {
+		return fmt.Errorf("none of %s exists in '%s'", strings.Join(paths, ", "), c.Name)
+	}
+
+	part := file + partialSuffix
+	out, err := createBackupFile(part)
+	if err != nil {
+		return err
+	}
+	defer removeOnInterrupt(func() []string { return []string{part} })()
+	zw := gzip.NewWriter(out)
+	var stderr bytes.Buffer
+	args := append([]string{"exec", "--user", "root", c.Name, "tar", "-cpf", "-", "-C", "/"}, hostManagedExcludes()...)
+	cmd := commandRunner(containerRuntime, append(args, present...)...)
+	cmd.Stdout = zw
+	cmd.Stderr = &stderr
+	done := make(chan bool)
+	go showSpinner("system-files", fmt.Sprintf("Archiving /%s...", strings.Join(present, ", /")), done)
+	err = cmd.Run()
+	done <- true
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(part)
+		return fmt.Errorf("tar in '%s' failed: %w: %s", c.Name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	m := newManifest(c, false, "")
+	for _, p := range present {
+		m.SystemPaths = append(m.SystemPaths, "/"+p)
+	}
+	if m.Packages, err = installedPackages(c); err != nil {
+		logWarning(fmt.Sprintf("Could not list the packages of '%s'; they are not recorded: %v", c.Name, err))
+	}
+	if err := finishBackupArchive(part, file, m); err != nil {
+		os.Remove(part)
+		return fmt.Errorf("failed to write the backup manifest: %w", err)
+	}
+	return nil
+}
+
+// restoreSystemFiles extracts a system files archive over the root of the
+// container, as root. Files in the container that the archive also has are
+// overwritten; others are left alone.
+func restoreSystemFiles(file string, c Container) error {
+	if err := checkNotPartial(file); err != nil {
+		return err
+	}
+	stop, err := startForExec(c)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("%s is not a system files backup: %w", file, err)
+	}
+	var stderr bytes.Buffer
+	cmd := commandRunner(containerRuntime, append([]string{"exec", "-i", "--user", "root", c.Name, "tar", "-xpf", "-", "-C", "/"}, hostManagedExcludes()...)...)
+	cmd.Stdin = zr
+	cmd.Stderr = &stderr
+	done := make(chan bool)
+	go showSpinner("system-files", fmt.Sprintf("Extracting into '%s'...", c.Name), done)
+	err = cmd.Run()
+	done <- true
+	if err != nil {
+		return fmt.Errorf("tar in '%s' failed: %w: %s", c.Name, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// createFromBaseImage creates name from the image a system files backup was
+// taken from, with the settings recorded in its manifest, and returns it.
+func createFromBaseImage(m *backup.Manifest, name string) (Container, error) {
+	opts := backup.CreateOptions{Name: name, Image: m.Image, Init: m.Init, Nvidia: m.Nvidia, Unshare: m.Unshare}
+	if m.Extra != nil {
+		opts.Extra = restorableFlags(*m.Extra)
+	}
+	done := make(chan bool)
+	go showSpinner("create", fmt.Sprintf("Creating '%s' from %s...", name, m.Image), done)
+	err := client.CreateFromImage(opts)
+	done <- true
+	if err != nil {
+		return Container{}, fmt.Errorf("could not create '%s' from %s: %w", name, m.Image, err)
+	}
+	containers, err := getContainers()
+	if err != nil {
+		return Container{}, err
+	}
+	c, ok := findContainer(containers, name)
+	if !ok {
+		return Container{}, fmt.Errorf("'%s' was created but cannot be found", name)
+	}
+	return c, nil
+}
+
+func handleSystemFiles(containers []Container) {
+	clearScreen()
+	printTitle(colorMagenta, "🗄️ System Files")
+	fmt.Printf("%s%sHint:%s Saves what you changed in %s inside a container, to lay it over a fresh base image later.\n\n", colorYellow, colorUnderline, colorReset, strings.Join(cfg.Backup.SystemPaths, ", "))
+	fmt.Printf("  %s1)%s Back up system files\n", colorGreen, colorReset)
+	fmt.Printf("  %s2)%s Restore system files\n\n", colorCyan, colorReset)
+	switch selectItem("Select an action", 2) {
+	case 1:
+		handleSystemFilesBackup(containers)
+	case 2:
+		handleSystemFilesRestore(containers)
+	}
+}
+
+func handleSystemFilesBackup(containers []Container) {
+	if len(containers) == 0 {
+		logWarning("There are no containers to perform this action on.")
+		return
+	}
+	containerIndex := selectContainer("the container", containers)
+	if containerIndex == 0 {
+		return
+	}
+	c := containers[containerIndex-1]
+	defer routeTo(c)()
+	logInfo("Please choose a backup destination folder.")
+	destDir, err := selectDirectory("Select Backup Folder")
+	if err != nil || destDir == "" {
+		logError("No valid destination directory selected. Aborting.")
+		return
+	}
+	if _, ok := parseRemote(destDir); ok {
+		logError("System files are backed up to a local folder.")
+		return
+	}
+	if err := makeBackupDir(destDir); err != nil {
+		logError(fmt.Sprintf("could not create the destination folder: %v", err))
+		return
+	}
+	file := systemArchivePath(destDir, c.Name)
+	if err := backupSystemFiles(c, file, cfg.Backup.SystemPaths); err != nil {
+		logError(err.Error())
+		return
+	}
+	logSuccess(fmt.Sprintf("✅ System files of '%s' saved to %s.", c.Name, file))
+}
+
+func handleSystemFilesRestore(containers []Container) {
+	logInfo("Please choose the system files backup (*-system.tar.gz).")
+	file, err := selectFile("Select System Files Backup", "*"+systemArchiveSuffix)
+	if err != nil || file == "" {
+		logError("No file selected. Aborting.")
+		return
+	}
+	m := quietManifest(file)
+	if m == nil || len(m.SystemPaths) == 0 {
+		logError(fmt.Sprintf("%s has no system files manifest.", file))
+		return
+	}
+	logInfo(fmt.Sprintf("Backup of %s from '%s', taken on %s.", strings.Join(m.SystemPaths, ", "), m.ContainerName, m.CreatedAt.Local().Format("2006-01-02 15:04")))
+
+	fmt.Printf("\n  %s1)%s Create a new container from the base image %s\n", colorGreen, colorReset, m.Image)
+	fmt.Printf("  %s2)%s Apply to an existing container\n\n", colorCyan, colorReset)
+	var target Container
+	switch selectItem("Select a target", 2) {
+	case 0:
+		return
+	case 1:
+		fmt.Printf("%s> Enter the new container's name [default: %s]: %s", colorBold, m.ContainerName, colorReset)
+		name := readUserInput()
+		if name == "" {
+			name = m.ContainerName
+		}
+		if _, taken := findContainer(containers, name); taken {
+			logError(fmt.Sprintf("A container named '%s' already exists.", name))
+			return
+		}
+		if target, err = createFromBaseImage(m, name); err != nil {
+			logError(err.Error())
+			return
+		}
+	case 2:
+		if len(containers) == 0 {
+			logWarning("There are no containers to perform this action on.")
+			return
+		}
+		containerIndex := selectContainer("the container", containers)
+		if containerIndex == 0 {
+			return
+		}
+		target = containers[containerIndex-1]
+		defer routeTo(target)()
+		fmt.Printf("%s> Overwrite the files in %s of '%s' with the backup? (y/N): %s", colorRed, strings.Join(m.SystemPaths, ", "), target.Name, colorReset)
+		if !confirmAction() {
+			logInfo("Restore cancelled.")
+			return
+		}
+	}
+	if err := restoreSystemFiles(file, target); err != nil {
+		logError(err.Error())
+		return
+	}
+	logSuccess(fmt.Sprintf("✅ System files restored into '%s'.", target.Name))
+	maybeCheckPackages(target, m.Packages)
+}
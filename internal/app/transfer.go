@@ -0,0 +1,127 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rateLimitedWriter caps the throughput of writes to bytesPerSec.
+type rateLimitedWriter struct {
+	w           io.Writer
+	bytesPerSec int64
+	start       time.Time
+	written     int64
+}
+
+func newRateLimitedWriter(w io.Writer, bytesPerSec int64) io.Writer {
+	if bytesPerSec <= 0 {
+		return w
+	}
+	return &rateLimitedWriter{w: w, bytesPerSec: bytesPerSec, start: time.Now()}
+}
+
+func (r *rateLimitedWriter) Write(p []byte) (int, error) {
+	// Write in slices of at most a tenth of a second's budget so the
+	// sleeps stay short and the rate stays smooth.
+	chunk := int(r.bytesPerSec / 10)
+	if chunk < 1 {
+		chunk = 1
+	}
+	total := 0
+	for len(p) > 0 {
+		n := min(chunk, len(p))
+		written, err := r.w.Write(p[:n])
+		total += written
+		r.written += int64(written)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+		expected := time.Duration(float64(r.written) / float64(r.bytesPerSec) * float64(time.Second))
+		if ahead := expected - time.Since(r.start); ahead > 0 {
+			time.Sleep(ahead)
+		}
+	}
+	return total, nil
+}
+
+// rateLimitedReader caps the throughput of reads to bytesPerSec.
+type rateLimitedReader struct {
+	r           io.Reader
+	bytesPerSec int64
+	start       time.Time
+	read        int64
+}
+
+func newRateLimitedReader(r io.Reader, bytesPerSec int64) io.Reader {
+	if bytesPerSec <= 0 {
+		return r
+	}
+	return &rateLimitedReader{r: r, bytesPerSec: bytesPerSec, start: time.Now()}
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if chunk := int(max(r.bytesPerSec/10, 1)); len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := r.r.Read(p)
+	r.read += int64(n)
+	expected := time.Duration(float64(r.read) / float64(r.bytesPerSec) * float64(time.Second))
+	if ahead := expected - time.Since(r.start); ahead > 0 {
+		time.Sleep(ahead)
+	}
+	return n, err
+}
+
+// parseSize parses sizes like "512K", "20M", "1.5G" or a plain byte count.
+// Units are binary (1K = 1024 bytes); a trailing "B" or "iB" is accepted.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(strings.ToUpper(s))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "IB"), "B")
+	multiplier := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (examples: 512K, 20M, 1.5G)", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// fileSHA256 returns the hex sha256 of the first limit bytes of a file
+// (the whole file if limit < 0).
+func fileSHA256(path string, limit int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if limit >= 0 {
+		r = io.LimitReader(f, limit)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
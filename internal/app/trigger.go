@@ -0,0 +1,268 @@
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultTriggerSocket returns $XDG_RUNTIME_DIR/distrobox-backup-tool.sock.
+// Without XDG_RUNTIME_DIR there is no folder only the user can enter to
+// put it in, so the socket must be given.
+func defaultTriggerSocket() (string, error) {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		return "", fmt.Errorf("XDG_RUNTIME_DIR is not set; give the socket with --socket or [trigger] socket, in a folder only you can enter")
+	}
+	return filepath.Join(dir, appName+".sock"), nil
+}
+
+// triggerResult is the JSON answer to a backup request, one entry per
+// container.
+type triggerResult struct {
+	OK      bool                 `json:"ok"`
+	Error   string               `json:"error,omitempty"`
+	Results []triggerBackupEntry `json:"results,omitempty"`
+}
+
+type triggerBackupEntry struct {
+	Container  string `json:"container"`
+	File       string `json:"file,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Skipped    bool   `json:"skipped,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// triggerServer answers backup requests. Backups run one at a time; a
+// request waits for the ones before it and gets its result when done.
+type triggerServer struct {
+	token string
+	// tcp is set for the loopback HTTP listener, which any program on the
+	// machine, including web pages in a browser, can reach.
+	tcp bool
+	mu  sync.Mutex
+}
+
+func (s *triggerServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		writeTriggerResult(w, http.StatusOK, triggerResult{OK: true})
+	})
+	mux.HandleFunc("/backup", s.handleBackup)
+	return s.authorize(mux)
+}
+
+func (s *triggerServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A web page can send requests to loopback ports; its requests
+		// carry its Origin, and DNS rebinding shows in the Host.
+		if s.tcp && (!loopbackHost(r.Host) || !sameOrigin(r)) {
+			writeTriggerResult(w, http.StatusForbidden, triggerResult{Error: "requests from other origins are refused"})
+			return
+		}
+		if s.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.token)) != 1 {
+			writeTriggerResult(w, http.StatusUnauthorized, triggerResult{Error: "missing or wrong token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleBackup serves POST /backup?container=NAME[&container=...]
+// [&group=GROUP][&dest=DEST][&note=TEXT].
+func (s *triggerServer) handleBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeTriggerResult(w, http.StatusMethodNotAllowed, triggerResult{Error: "use POST"})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeTriggerResult(w, http.StatusBadRequest, triggerResult{Error: err.Error()})
+		return
+	}
+	names, group := r.Form["container"], r.Form.Get("group")
+	if (len(names) == 0) == (group == "") {
+		writeTriggerResult(w, http.StatusBadRequest, triggerResult{Error: "give either container or group"})
+		return
+	}
+	// Only configured destinations: a request must not choose a folder.
+	dest := r.Form.Get("dest")
+	if _, ok := cfg.Destinations[dest]; dest != "" && !ok {
+		writeTriggerResult(w, http.StatusBadRequest, triggerResult{Error: fmt.Sprintf("destination '%s' is not configured", dest)})
+		return
+	}
+	dest = resolveBackupDest(dest)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	containers, err := getContainers()
+	if err != nil {
+		writeTriggerResult(w, http.StatusInternalServerError, triggerResult{Error: err.Error()})
+		return
+	}
+	var members []Container
+	if group != "" {
+		if _, ok := cfg.Groups[group]; !ok {
+			writeTriggerResult(w, http.StatusNotFound, triggerResult{Error: fmt.Sprintf("group '%s' is not configured", group)})
+			return
+		}
+		members, _ = groupMembers(group, containers)
+	}
+	for _, name := range names {
+		found := false
+		for _, c := range containers {
+			if c.Name == name {
+				members = append(members, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			writeTriggerResult(w, http.StatusNotFound, triggerResult{Error: fmt.Sprintf("container '%s' does not exist", name)})
+			return
+		}
+	}
+	if err := checkCompressor(cfg.Backup.Compression); err != nil {
+		writeTriggerResult(w, http.StatusInternalServerError, triggerResult{Error: err.Error()})
+		return
+	}
+	if err := prepareBackupDest(dest); err != nil {
+		writeTriggerResult(w, http.StatusInternalServerError, triggerResult{Error: err.Error()})
+		return
+	}
+
+	logInfo(fmt.Sprintf("Backup requested for %d containers into %s.", len(members), dest))
+	results := runBatchBackup(members, dest, cfg.Batch.OnFailure, r.Form.Get("note"), cfg.Backup.Compression, cfg.Backup.CompressionLevel, configuredEncryption())
+	answer := triggerResult{OK: true}
+	for _, res := range results {
+		entry := triggerBackupEntry{Container: res.Container, Skipped: res.Skipped, DurationMS: res.Duration.Milliseconds()}
+		if res.Err != nil {
+			entry.Error = res.Err.Error()
+		} else if !res.Skipped {
+			entry.File = res.File
+		}
+		if res.Err != nil || res.Skipped {
+			answer.OK = false
+		}
+		answer.Results = append(answer.Results, entry)
+	}
+	status := http.StatusOK
+	if !answer.OK {
+		status = http.StatusInternalServerError
+	}
+	writeTriggerResult(w, status, answer)
+}
+
+// loopbackHost reports whether the Host of a request names this machine.
+func loopbackHost(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// sameOrigin reports whether a request has no Origin, as from curl and
+// scripts, or one naming the listener itself.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+func writeTriggerResult(w http.ResponseWriter, status int, res triggerResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+// listenTrigger opens the unix socket, or the TCP address if one is given.
+// TCP is limited to loopback addresses since requests run backups.
+func listenTrigger(socket, addr string) (net.Listener, error) {
+	if addr != "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return nil, fmt.Errorf("%s is not a loopback address; the trigger listener only accepts local connections", addr)
+		}
+		return net.Listen("tcp", addr)
+	}
+	// A socket left behind by a previous run blocks Listen; one that still
+	// answers belongs to a running listener.
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a trigger listener is already running on %s", socket)
+	}
+	os.Remove(socket)
+	// The socket is created without permissions for others, so no one
+	// can connect before the chmod below.
+	umask := syscall.Umask(0o177)
+	l, err := net.Listen("unix", socket)
+	syscall.Umask(umask)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// serveTrigger answers backup requests until SIGINT or SIGTERM.
+func serveTrigger(socket, addr, token string) error {
+	if addr != "" && token == "" {
+		return fmt.Errorf("--listen needs a token: any local program can reach a TCP port, so set [trigger] token")
+	}
+	l, err := listenTrigger(socket, addr)
+	if err != nil {
+		return err
+	}
+	ts := &triggerServer{token: token, tcp: addr != ""}
+	srv := &http.Server{Handler: ts.handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	deferInterrupts()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		<-ctx.Done()
+		// Let running backups finish and answer before exiting.
+		shutdown, cancel := context.WithTimeout(context.Background(), time.Hour)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	if addr != "" {
+		logInfo(fmt.Sprintf("Listening for backup requests on http://%s", addr))
+	} else {
+		logInfo(fmt.Sprintf("Listening for backup requests on %s", socket))
+	}
+	if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-closed
+	logInfo("Trigger listener stopped.")
+	return nil
+}
@@ -0,0 +1,452 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode"
+	"unicode/utf8"
+	"unsafe"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// In a terminal the menu and its lists are pickers instead of numbered
+// prompts: the arrow keys move, typing filters the list by fuzzy match,
+// Space marks entries where several can be chosen and Enter acts on them.
+// Filtering looks at the names of the entries, such as container names,
+// not at the other columns.
+// The picker switches the terminal to non-canonical mode with stty, as
+// readPassphrase does for echo, and draws below the text printed before
+// it, redrawing in place. Without stty, with JSON progress or with
+// [ui] tui = false the numbered prompts are used.
+
+// Keys the picker reacts to besides printable characters.
+const (
+	keyNone = iota
+	keyUp
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyEnter
+	keySpace
+	keyBackspace
+	keyEscape
+	keyClear
+	keyToggleAll
+)
+
+// tuiEnabled reports whether lists are shown as pickers.
+func tuiEnabled() bool {
+	if jsonProgress() || !cfg.UI.TUI || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	for _, f := range []*os.File{os.Stdin, os.Stdout} {
+		if info, err := f.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			return false
+		}
+	}
+	_, err := exec.LookPath("stty")
+	return err == nil
+}
+
+// isTerminal reports whether f is a terminal. Unlike a character device
+// check, it is false for /dev/null, which background jobs get as stdin.
+func isTerminal(f *os.File) bool {
+	var t syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&t)))
+	return errno == 0
+}
+
+// stty runs stty on the terminal. It runs where the tool does, not through
+// commandRunner: the terminal is the tool's own even when commands run on
+// the host.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// terminalSize returns the rows and columns of the terminal, 24x80 if
+// unknown.
+func terminalSize() (rows, cols int) {
+	rows, cols = 24, 80
+	if out, err := stty("size"); err == nil {
+		if f := strings.Fields(out); len(f) == 2 {
+			if r, err := strconv.Atoi(f[0]); err == nil && r > 0 {
+				rows = r
+			}
+			if c, err := strconv.Atoi(f[1]); err == nil && c > 0 {
+				cols = c
+			}
+		}
+	}
+	return rows, cols
+}
+
+// readKey reads one key press, or the characters of a paste, from the
+// terminal in non-canonical mode.
+func readKey() (key int, text string, err error) {
+	buf := make([]byte, 64)
+	n, err := os.Stdin.Read(buf)
+	if err != nil {
+		return keyNone, "", err
+	}
+	s := string(buf[:n])
+	switch s {
+	case "\x1b[A", "\x1bOA", "\x10":
+		return keyUp, "", nil
+	case "\x1b[B", "\x1bOB", "\x0e":
+		return keyDown, "", nil
+	case "\x1b[5~":
+		return keyPageUp, "", nil
+	case "\x1b[6~":
+		return keyPageDown, "", nil
+	case "\x1b[H", "\x1bOH", "\x1b[1~":
+		return keyHome, "", nil
+	case "\x1b[F", "\x1bOF", "\x1b[4~":
+		return keyEnd, "", nil
+	case "\r", "\n":
+		return keyEnter, "", nil
+	case " ":
+		return keySpace, "", nil
+	case "\x7f", "\b":
+		return keyBackspace, "", nil
+	case "\x1b":
+		return keyEscape, "", nil
+	case "\x15":
+		return keyClear, "", nil
+	case "\x01":
+		return keyToggleAll, "", nil
+	}
+	if strings.HasPrefix(s, "\x1b") {
+		// Another escape sequence, such as left and right.
+		return keyNone, "", nil
+	}
+	return keyNone, strings.Map(func(r rune) rune {
+		if unicode.IsPrint(r) {
+			return r
+		}
+		return -1
+	}, s), nil
+}
+
+// fuzzyMatch reports whether the runes of query appear in name in order,
+// ignoring case, and scores the best such match: higher is better. Runes
+// matched at the start of a word or right after the previous match score
+// more, gaps and a late start score less, so "hc" ranks Health Check above
+// Batch Backup.
+func fuzzyMatch(name, query string) (score int, ok bool) {
+	if query == "" {
+		return 0, true
+	}
+	n := []rune(strings.ToLower(name))
+	q := []rune(strings.ToLower(query))
+	const none = -1 << 30
+	// best[i] is the best score of the query so far with its last rune
+	// matched at n[i].
+	best := make([]int, len(n))
+	for j := range q {
+		next := make([]int, len(n))
+		for i := range n {
+			next[i] = none
+			if n[i] != q[j] {
+				continue
+			}
+			bonus := 0
+			if i == 0 || strings.ContainsRune(" -_./:", n[i-1]) {
+				bonus = 8
+			}
+			if j == 0 {
+				next[i] = bonus - min(i, 5)
+				continue
+			}
+			for p := 0; p < i; p++ {
+				if best[p] == none {
+					continue
+				}
+				s := best[p] + bonus - min(i-p-1, 3)
+				if p == i-1 {
+					s += 5
+				}
+				next[i] = max(next[i], s)
+			}
+		}
+		best = next
+	}
+	score = none
+	for _, s := range best {
+		score = max(score, s)
+	}
+	return score, score != none
+}
+
+// fuzzyFilter returns the indices of the names matching query, best match
+// first and otherwise in list order.
+func fuzzyFilter(names []string, query string) []int {
+	type match struct{ index, score int }
+	var matches []match
+	for i, name := range names {
+		if score, ok := fuzzyMatch(name, query); ok {
+			matches = append(matches, match{i, score})
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].score > matches[b].score })
+	indices := make([]int, len(matches))
+	for i, m := range matches {
+		indices[i] = m.index
+	}
+	return indices
+}
+
+// truncate shortens s to width runes.
+func truncate(s string, width int) string {
+	if width < 1 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:width-1]) + "~"
+}
+
+// pickList shows labels as a picker under prompt and returns the 0-based
+// indices of the chosen entries in list order: the marked ones, or the one
+// under the cursor. It returns nil when the user backs out with Esc. names
+// are the short names of the entries, which typing filters on; the picker
+// is replaced by a line listing the names of the chosen entries.
+func pickList(prompt string, labels, names []string, multi bool) []int {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil
+	}
+	if _, err := stty("-icanon", "-echo", "min", "1", "time", "0"); err != nil {
+		return nil
+	}
+	drawn := 0
+	restore := func() {
+		if drawn > 0 {
+			fmt.Printf("\033[%dA", drawn)
+		}
+		fmt.Print("\r\033[J\033[?25h")
+		stty(saved)
+	}
+	cancel := onInterrupt(restore)
+	fmt.Print("\033[?25l")
+
+	query, cursor, top := "", 0, 0
+	marked := map[int]bool{}
+	var chosen []int
+	for {
+		visible := fuzzyFilter(names, query)
+		rows, cols := terminalSize()
+		height := max(3, min(rows-4, 15))
+		cursor = max(0, min(cursor, len(visible)-1))
+		if cursor < top {
+			top = cursor
+		}
+		if cursor >= top+height {
+			top = cursor - height + 1
+		}
+		top = max(0, min(top, len(visible)-height))
+
+		var lines []string
+		search := truncate(query, cols-utf8.RuneCountInString(prompt)-6)
+		if search == "" {
+			search = colorWhite + "type to filter" + colorReset
+		}
+		lines = append(lines, fmt.Sprintf("%s> %s:%s %s", colorBold, prompt, colorReset, search))
+		for i := top; i < len(visible) && i < top+height; i++ {
+			box := ""
+			if multi {
+				box = "[ ] "
+				if marked[visible[i]] {
+					box = "[x] "
+				}
+			}
+			line := truncate(box+labels[visible[i]], cols-5)
+			if i == cursor {
+				lines = append(lines, fmt.Sprintf("  %s> %s%s", colorCyan+"\033[7m", line, colorReset))
+			} else {
+				lines = append(lines, "    "+line)
+			}
+		}
+		if len(visible) == 0 {
+			lines = append(lines, fmt.Sprintf("    %sNothing matches '%s'.%s", colorYellow, truncate(query, cols-25), colorReset))
+		}
+		status := fmt.Sprintf("%d of %d", len(visible), len(labels))
+		keys := "Up/Down move, type to filter, Enter select, Esc back"
+		if multi {
+			status += fmt.Sprintf(", %d marked", len(marked))
+			keys = "Up/Down move, type to filter, Space mark, Ctrl+A mark all, Enter select, Esc back"
+		}
+		lines = append(lines, truncate(fmt.Sprintf("  %s (%s)", status, keys), cols-1))
+
+		if drawn > 0 {
+			fmt.Printf("\033[%dA", drawn)
+		}
+		fmt.Print("\r\033[J" + strings.Join(lines, "\n") + "\n")
+		drawn = len(lines)
+
+		key, text, err := readKey()
+		if err != nil {
+			break
+		}
+		switch key {
+		case keyUp:
+			cursor--
+		case keyDown:
+			cursor++
+		case keyPageUp:
+			cursor -= height
+		case keyPageDown:
+			cursor += height
+		case keyHome:
+			cursor = 0
+		case keyEnd:
+			cursor = len(visible) - 1
+		case keyBackspace:
+			if r := []rune(query); len(r) > 0 {
+				query, cursor = string(r[:len(r)-1]), 0
+			}
+		case keyClear:
+			query, cursor = "", 0
+		case keySpace:
+			if multi && len(visible) > 0 {
+				marked[visible[cursor]] = !marked[visible[cursor]]
+				if !marked[visible[cursor]] {
+					delete(marked, visible[cursor])
+				}
+				cursor++
+			}
+		case keyToggleAll:
+			if multi {
+				all := true
+				for _, i := range visible {
+					all = all && marked[i]
+				}
+				for _, i := range visible {
+					if all {
+						delete(marked, i)
+					} else {
+						marked[i] = true
+					}
+				}
+			}
+		case keyEscape:
+			if query != "" {
+				query, cursor = "", 0
+				continue
+			}
+		case keyEnter:
+			if len(marked) > 0 {
+				for i := range labels {
+					if marked[i] {
+						chosen = append(chosen, i)
+					}
+				}
+			} else if len(visible) > 0 {
+				chosen = []int{visible[cursor]}
+			} else {
+				continue
+			}
+		default:
+			if text != "" {
+				query, cursor = query+text, 0
+			}
+			continue
+		}
+		if key == keyEscape || key == keyEnter {
+			break
+		}
+	}
+
+	restore()
+	cancel()
+	var picked []string
+	for _, i := range chosen {
+		picked = append(picked, names[i])
+	}
+	if len(picked) > 0 {
+		fmt.Printf("%s> %s:%s %s\n", colorBold, prompt, colorReset, strings.Join(picked, ", "))
+	}
+	return chosen
+}
+
+// chooseItems asks for entries of a list, what naming them as in "the
+// container to upgrade" (or "the containers to back up" when multi allows
+// several). The TUI picks from rows, names being the short names of the
+// entries; otherwise printList prints the numbered list and the numbers
+// are read. It returns 1-based numbers, nil when nothing was chosen.
+func chooseItems(what string, rows, names []string, multi bool, printList func()) []int {
+	if len(rows) == 0 {
+		return nil
+	}
+	if !tuiEnabled() {
+		printList()
+		if multi {
+			return selectItems(fmt.Sprintf("Enter the numbers of %s (e.g. 1,3-5)", what), len(rows))
+		}
+		if n := selectItem("Enter the number of "+what, len(rows)); n > 0 {
+			return []int{n}
+		}
+		return nil
+	}
+	chosen := pickList("Select "+what, rows, names, multi)
+	for i := range chosen {
+		chosen[i]++
+	}
+	return chosen
+}
+
+// containerRows returns a picker row and the name of each container, with
+// the columns of printContainerList.
+func containerRows(containers []Container) (rows, names []string) {
+	rows = make([]string, len(containers))
+	names = make([]string, len(containers))
+	for i, c := range containers {
+		names[i] = c.Name
+		typeText := "Standard"
+		if isIsolated, _ := isContainerIsolated(c); isIsolated {
+			typeText = "Isolated"
+		}
+		tags := ""
+		if c.Manager == backup.ManagerToolbox {
+			tags += " [toolbx]"
+		}
+		if c.Rootful {
+			tags += " [root]"
+		}
+		rows[i] = fmt.Sprintf("%-25s %-10s %s%s", c.Name, typeText, distroString(c.Distro, c.DistroVersion), tags)
+	}
+	return rows, names
+}
+
+// selectContainer asks for one of containers and returns its 1-based
+// number, or 0, like selectItem.
+func selectContainer(what string, containers []Container) int {
+	rows, names := containerRows(containers)
+	chosen := chooseItems(what, rows, names, false, func() { printContainerList(containers) })
+	if len(chosen) == 0 {
+		return 0
+	}
+	return chosen[0]
+}
+
+// selectContainers asks for any number of containers.
+func selectContainers(what string, containers []Container) []Container {
+	rows, names := containerRows(containers)
+	var selected []Container
+	for _, n := range chooseItems(what, rows, names, true, func() { printContainerList(containers) }) {
+		selected = append(selected, containers[n-1])
+	}
+	return selected
+}
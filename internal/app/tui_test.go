@@ -0,0 +1,53 @@
+package app
+
+import "testing"
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		name, query string
+		ok          bool
+	}{
+		{"Health Check", "", true},
+		{"Health Check", "hc", true},
+		{"Health Check", "HEALTH", true},
+		{"Health Check", "check", true},
+		{"Health Check", "ch", true},
+		{"Health Check", "kc", false},
+		{"Health Check", "healthz", false},
+		{"Batch Backup", "bb", true},
+		{"dev-box", "db", true},
+		{"", "a", false},
+	}
+	for _, tt := range tests {
+		if _, ok := fuzzyMatch(tt.name, tt.query); ok != tt.ok {
+			t.Errorf("fuzzyMatch(%q, %q) ok = %v, want %v", tt.name, tt.query, ok, tt.ok)
+		}
+	}
+}
+
+func TestFuzzyMatchRanking(t *testing.T) {
+	tests := []struct {
+		query, better, worse string
+	}{
+		{"hc", "Health Check", "Batch Backup"},
+		{"back", "Backup", "Batch Backup"},
+		{"res", "Restore", "Prune Restores"},
+		{"db", "dev-box", "dumb"},
+		{"box", "box-dev", "dev-box"},
+	}
+	for _, tt := range tests {
+		better, ok := fuzzyMatch(tt.better, tt.query)
+		if !ok {
+			t.Errorf("fuzzyMatch(%q, %q) did not match", tt.better, tt.query)
+			continue
+		}
+		worse, ok := fuzzyMatch(tt.worse, tt.query)
+		if !ok {
+			t.Errorf("fuzzyMatch(%q, %q) did not match", tt.worse, tt.query)
+			continue
+		}
+		if better <= worse {
+			t.Errorf("query %q: %q scores %d, not above %q with %d", tt.query, tt.better, better, tt.worse, worse)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Modes for [ui] messages: how messages are kept on screen before it is
+// redrawn.
+const (
+	messagesEnter = "enter" // until Enter is pressed
+	messagesTimed = "timed" // for a short, fixed time
+	messagesNone  = "none"  // not at all
+)
+
+// Modes for [ui] symbols: whether output uses emoji and other non-ASCII
+// symbols.
+const (
+	symbolsAuto    = "auto"    // ASCII unless the locale is UTF-8
+	symbolsUnicode = "unicode" // always
+	symbolsASCII   = "ascii"   // never
+)
+
+// asciiOutput replaces symbols with ASCII in everything printed; set by
+// setupOutput.
+var asciiOutput bool
+
+// asciiFlag is the --ascii global flag.
+var asciiFlag bool
+
+// setupOutput decides between symbols and ASCII from --ascii and [ui]
+// symbols. In "auto" mode the Linux console and terminals whose locale is
+// not UTF-8 (including a missing one, common over ssh) get ASCII, as they
+// render emoji as garbage.
+func setupOutput() {
+	switch {
+	case asciiFlag || cfg.UI.Symbols == symbolsASCII:
+		asciiOutput = true
+	case cfg.UI.Symbols == symbolsUnicode:
+		asciiOutput = false
+	default:
+		asciiOutput = !terminalSupportsUnicode()
+	}
+}
+
+func terminalSupportsUnicode() bool {
+	if term := os.Getenv("TERM"); term == "linux" || term == "dumb" {
+		return false
+	}
+	locale := ""
+	for _, env := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if locale = os.Getenv(env); locale != "" {
+			break
+		}
+	}
+	locale = strings.ToLower(locale)
+	return strings.Contains(locale, "utf-8") || strings.Contains(locale, "utf8")
+}
+
+// asciiSymbols are the ASCII stand-ins for symbols that carry meaning;
+// other emoji are dropped.
+var asciiSymbols = strings.NewReplacer(
+	"✅", "[OK]",
+	"❌", "[X]",
+	"⚠️", "[!]",
+	"ℹ️", "[i]",
+	"▶", ">",
+	"—", "-",
+)
+
+// symbols returns s as it should be printed: unchanged, or in ASCII mode
+// with its symbols replaced.
+func symbols(s string) string {
+	if !asciiOutput {
+		return s
+	}
+	s = asciiSymbols.Replace(s)
+	return strings.Map(func(r rune) rune {
+		if r == '\ufe0f' || (r >= 0x2190 && r <= 0x2bff) || r >= 0x1f000 {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// printTitle prints the heading of a screen, such as "📦 Backup Container".
+func printTitle(color, title string) {
+	fmt.Printf("%s%s%s%s\n\n", colorBold, color, strings.TrimSpace(symbols(title)), colorReset)
+}
+
+// timedMessageDelay is how long messages stay in the "timed" mode.
+const timedMessageDelay = 2 * time.Second
+
+// acknowledge keeps the messages printed so far visible before the screen is
+// cleared, as configured by [ui] messages. In "enter" mode prompt is shown.
+func acknowledge(prompt string) {
+	if jsonProgress() {
+		return
+	}
+	switch cfg.UI.Messages {
+	case messagesEnter:
+		fmt.Printf("\n%s%s%s", colorCyan, prompt, colorReset)
+		readUserInput()
+	case messagesTimed:
+		time.Sleep(timedMessageDelay)
+	}
+}
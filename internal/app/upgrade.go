@@ -0,0 +1,137 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// snapshotRepository is the repository local snapshot images are committed to.
+const snapshotRepository = "distrobox-snapshot"
+
+// snapshotImageName returns a new snapshot reference for a container. Image
+// repositories must be lowercase, so the name is lowercased.
+func snapshotImageName(containerName, label string) string {
+	return fmt.Sprintf("%s/%s:%s-%d", snapshotRepository, strings.ToLower(containerName), label, time.Now().Unix())
+}
+
+func handleUpgrade(containers []Container) {
+	clearScreen()
+	printTitle(colorBlue, "⬆️  Upgrade Container")
+	fmt.Printf("%s%sHint:%s A snapshot is taken first so a broken upgrade can be rolled back.\n\n", colorYellow, colorUnderline, colorReset)
+
+	containerIndex := selectContainer("the container to upgrade", containers)
+	if containerIndex == 0 {
+		return
+	}
+	upgradeWithSnapshot(containers[containerIndex-1])
+}
+
+// upgradeWithSnapshot commits the container to a local snapshot image, runs
+// distrobox-upgrade, and lets the user roll back to the snapshot afterwards.
+func upgradeWithSnapshot(container Container) bool {
+	defer routeTo(container)()
+	if container.Manager == backup.ManagerToolbox {
+		logError(fmt.Sprintf("'%s' is a toolbx container; distrobox-upgrade only upgrades distroboxes. Run 'toolbox run -c %s' and update it with its package manager.", container.Name, container.Name))
+		return false
+	}
+	snapshotImage := snapshotImageName(container.Name, "pre-upgrade")
+	logInfo(fmt.Sprintf("Creating pre-upgrade snapshot '%s'...", snapshotImage))
+	done := make(chan bool)
+	go showSpinner("snapshot", "Creating snapshot...", done)
+	err := client.Commit(container.Name, snapshotImage)
+	done <- true
+	if err != nil {
+		logError("Failed to snapshot the container. The upgrade was not started.")
+		logError(err.Error())
+		return false
+	}
+	logSuccess("✅ Snapshot created.")
+
+	logInfo(fmt.Sprintf("Upgrading '%s'...", container.Name))
+	cmd := commandRunner("distrobox-upgrade", container.Name)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	upgradeErr := cmd.Run()
+	fmt.Println()
+	if upgradeErr != nil {
+		logError(fmt.Sprintf("distrobox-upgrade failed: %v", upgradeErr))
+	} else {
+		logSuccess(fmt.Sprintf("✅ Upgrade of '%s' finished.", container.Name))
+	}
+
+	fmt.Printf("\n  %sEnter)%s Keep the upgrade and delete the snapshot\n", colorGreen, colorReset)
+	fmt.Printf("  %sk)%s     Keep the upgrade and the snapshot\n", colorBlue, colorReset)
+	fmt.Printf("  %sr)%s     Roll back to the pre-upgrade snapshot\n", colorRed, colorReset)
+	fmt.Printf("%s> Is the container working? Choose an option: %s", colorBold, colorReset)
+	switch strings.ToLower(readUserInput()) {
+	case "r":
+		return rollbackToImage(container, snapshotImage)
+	case "k":
+		logInfo(fmt.Sprintf("Snapshot kept as '%s'.", snapshotImage))
+	default:
+		if err := client.RemoveImage(snapshotImage); err != nil {
+			logWarning(fmt.Sprintf("Failed to remove snapshot '%s'. You may want to remove it manually with '%s rmi %s'.", snapshotImage, containerRuntime, snapshotImage))
+		}
+	}
+	return upgradeErr == nil
+}
+
+// rollbackToImage replaces a container with a new one created from image,
+// keeping the container's name and home type.
+func rollbackToImage(container Container, image string) bool {
+	isIsolated, homePath := isContainerIsolated(container)
+	createOpts := containerCreateOptions(container.Name)
+	createOpts.Name, createOpts.Image = container.Name, image
+	if isIsolated {
+		createOpts.Home = homePath
+	}
+
+	start := time.Now()
+	done := make(chan bool)
+	go showSpinner("rollback", "Rolling back...", done)
+	restart := restartOnInterrupt(container)
+	defer restart()
+	runCommand(containerRuntime, "stop", container.Name)
+	exports := &backup.Manifest{Exports: containerExports(container.Name)}
+	err := client.RemoveContainer(container.Name)
+	if err != nil {
+		done <- true
+		recordOperationResult("rollback", container.Name, "to "+image, start, err)
+		logError(fmt.Sprintf("Rollback of '%s' failed.", container.Name))
+		logError(err.Error())
+		return false
+	}
+	restart()
+	defer keepOnInterrupt(image, container.Name)()
+	err = client.CreateFromImage(createOpts)
+	done <- true
+	recordOperationResult("rollback", container.Name, "to "+image, start, err)
+	if err != nil {
+		offerRecovery("Rollback", &recoveryError{
+			Err:      fmt.Errorf("rollback of '%s' failed: %w", container.Name, err),
+			Image:    image,
+			Recreate: createOpts,
+			Removed:  true,
+		})
+		return false
+	}
+	reexport(container.Name, exports)
+	logSuccess(fmt.Sprintf("✅ Container '%s' rolled back to '%s'.", container.Name, image))
+	logInfo("The snapshot image is now used by the container and was kept.")
+	return true
+}
+
+// findContainer looks a container up by name.
+func findContainer(containers []Container, name string) (Container, bool) {
+	for _, c := range containers {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Container{}, false
+}
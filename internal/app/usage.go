@@ -0,0 +1,154 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// usageTop is how many of the largest directories a breakdown lists.
+const usageTop = 10
+
+// usageEntry is a top-level directory and the space below it.
+type usageEntry struct {
+	Path string
+	Size uint64
+}
+
+// containerUsageScript sizes every top-level directory of the container's
+// root filesystem in KiB. -x keeps du off the host directories distrobox
+// mounts into the container.
+const containerUsageScript = `for d in /* /.[!.]*; do [ -d "$d" ] && [ ! -L "$d" ] && du -xsk "$d" 2>/dev/null; done; true`
+
+// startForExec starts a stopped container so commands can be run in it with
+// exec. The returned function stops it again if it was stopped before.
+func startForExec(c Container) (func(), error) {
+	if c.State == "running" {
+		return func() {}, nil
+	}
+	if _, err := runCommand(containerRuntime, "start", c.Name); err != nil {
+		return nil, fmt.Errorf("could not start '%s': %w", c.Name, err)
+	}
+	stop := func() { runCommand(containerRuntime, "stop", c.Name) }
+	forget := onInterrupt(stop)
+	return func() {
+		forget()
+		stop()
+	}, nil
+}
+
+// containerUsage returns the top-level directories of a container's root
+// filesystem by size, largest first. du runs as root so that no directory
+// is undercounted; a stopped container is started for it and stopped again.
+func containerUsage(c Container) ([]usageEntry, error) {
+	stop, err := startForExec(c)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+	out, err := runCommand(containerRuntime, "exec", "--user", "root", c.Name, "sh", "-c", containerUsageScript)
+	if err != nil {
+		return nil, fmt.Errorf("du failed in '%s': %w", c.Name, err)
+	}
+	var entries []usageEntry
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), "\t", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		kib, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, usageEntry{Path: fields[1], Size: kib * 1024})
+	}
+	sortUsage(entries)
+	return entries, nil
+}
+
+// homeUsage returns the entries of an isolated home by size, largest first.
+func homeUsage(home string) ([]usageEntry, error) {
+	dirEntries, err := os.ReadDir(home)
+	if err != nil {
+		return nil, err
+	}
+	var entries []usageEntry
+	for _, e := range dirEntries {
+		path := filepath.Join(home, e.Name())
+		var size uint64
+		if e.IsDir() {
+			size, _ = dirSize(path)
+		} else if info, err := e.Info(); err == nil && info.Mode().IsRegular() {
+			size = uint64(info.Size())
+		}
+		entries = append(entries, usageEntry{Path: path, Size: size})
+	}
+	sortUsage(entries)
+	return entries, nil
+}
+
+func sortUsage(entries []usageEntry) {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Size > entries[j].Size })
+}
+
+// printUsage lists the largest entries with their share of the total and
+// sums up the rest.
+func printUsage(title string, entries []usageEntry) {
+	var total uint64
+	for _, e := range entries {
+		total += e.Size
+	}
+	fmt.Printf("%s%s%s (%s)\n", colorBold, title, colorReset, formatBytes(total))
+	for i, e := range entries {
+		if i == usageTop {
+			var rest uint64
+			for _, r := range entries[i:] {
+				rest += r.Size
+			}
+			fmt.Printf("  %10s        %d more\n", formatBytes(rest), len(entries)-i)
+			break
+		}
+		share := 0.0
+		if total > 0 {
+			share = float64(e.Size) / float64(total) * 100
+		}
+		fmt.Printf("  %10s  %4.0f%%  %s\n", formatBytes(e.Size), share, e.Path)
+	}
+	fmt.Println()
+}
+
+// showUsage prints where the space of a container and its isolated home
+// goes, so large caches can be cleaned up before they end up in a backup.
+// It returns false if neither could be measured.
+func showUsage(c Container) bool {
+	measured := false
+	done := make(chan bool)
+	go showSpinner("usage", fmt.Sprintf("Measuring '%s'...", c.Name), done)
+	entries, err := containerUsage(c)
+	done <- true
+	if err != nil {
+		logWarning(fmt.Sprintf("Could not measure the container: %v", err))
+	} else {
+		printUsage(fmt.Sprintf("Container '%s'", c.Name), entries)
+		measured = true
+	}
+	if isolated, home := isContainerIsolated(c); isolated {
+		done := make(chan bool)
+		go showSpinner("usage", "Measuring the home directory...", done)
+		entries, err := homeUsage(home)
+		done <- true
+		if err != nil {
+			logWarning(fmt.Sprintf("Could not measure %s: %v", home, err))
+		} else {
+			printUsage("Home "+home, entries)
+			measured = true
+		}
+	}
+	if measured {
+		logInfo("Package caches (/var/cache, ~/.cache) and build directories are usually safe to clean up before a backup.")
+	}
+	return measured
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/noyzen/distrobox-backup-tool/pkg/backup"
+)
+
+// checksumPath returns the checksum file of an archive. Like the home
+// checksum database it uses the `sha256sum` format, so `sha256sum -c` can
+// check the archive by hand from its directory.
+func checksumPath(file string) string {
+	return file + ".sha256"
+}
+
+// writeChecksumFile records sum as the sha256 of file.
+func writeChecksumFile(file, sum string) error {
+	return writeBackupFile(checksumPath(file), []byte(fmt.Sprintf("%s  %s\n", sum, filepath.Base(file))))
+}
+
+// readChecksumFile returns the sha256 recorded for file.
+func readChecksumFile(file string) (string, error) {
+	data, err := os.ReadFile(checksumPath(file))
+	if err != nil {
+		return "", err
+	}
+	sum, _, _ := strings.Cut(strings.TrimSpace(string(data)), " ")
+	if len(sum) != sha256.Size*2 {
+		return "", fmt.Errorf("%s: malformed checksum file", checksumPath(file))
+	}
+	return sum, nil
+}
+
+// archiveCheck is the result of verifying one archive file.
+type archiveCheck struct {
+	Expected string // recorded sha256; empty if none was recorded
+	Actual   string
+	Members  int
+	Format   backup.ArchiveFormat
+	Err      error // the archive could not be hashed or read to the end
+}
+
+func (c archiveCheck) ok() bool {
+	return c.Err == nil && (c.Expected == "" || strings.EqualFold(c.Expected, c.Actual))
+}
+
+// checkArchiveFile hashes an archive, compares it with expected, and reads
+// every member to make sure it can be unpacked.
+func checkArchiveFile(file, expected string) archiveCheck {
+	check := archiveCheck{Expected: expected}
+	done := make(chan bool)
+	go showSpinner("verify", fmt.Sprintf("Checking %s...", filepath.Base(file)), done)
+	check.Actual, check.Err = fileSHA256(file, -1)
+	if check.Err == nil {
+		check.Members, check.Format, check.Err = client.CheckArchive(file)
+	}
+	done <- true
+	return check
+}
+
+// printArchiveCheck reports a check of the archive file, labelled as kind.
+func printArchiveCheck(kind, file string, c archiveCheck) {
+	fmt.Printf("\n%s%s:%s %s\n", colorBold, kind, colorReset, file)
+	switch {
+	case c.Actual == "":
+	case c.Expected == "":
+		logWarning(fmt.Sprintf("No checksum recorded; sha256 is %s.", c.Actual))
+	case strings.EqualFold(c.Expected, c.Actual):
+		logSuccess("✅ sha256 matches the recorded checksum.")
+	default:
+		logError(fmt.Sprintf("sha256 is %s, but %s was recorded. The file is corrupt or was modified.", c.Actual, c.Expected))
+	}
+	if c.Err != nil {
+		logError(fmt.Sprintf("The archive cannot be read: %v", c.Err))
+		return
+	}
+	logSuccess(fmt.Sprintf("✅ The archive is readable: %d members (%s).", c.Members, c.Format))
+}
+
+// verifyBackup checks a backup and its separated home archive against their
+// recorded checksums, reads both to the end, and checks the home's files
+// against their checksum database if there is one. It reports whether
+// everything is fine.
+func verifyBackup(file string) bool {
+	if err := checkDecryption(file); err != nil {
+		logError(err.Error())
+		return false
+	}
+	expected, err := readChecksumFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		logWarning(err.Error())
+	}
+	if expected == "" {
+		if m, err := backup.ReadManifest(manifestPath(file)); err == nil {
+			expected = m.SHA256
+		}
+	}
+	check := checkArchiveFile(file, expected)
+	printArchiveCheck("Backup", file, check)
+	ok := check.ok()
+	if check.Err == nil && check.Format != backup.FormatDockerArchive && check.Format != backup.FormatOCIArchive {
+		logWarning("The archive does not look like an image archive; it can only be restored as a root filesystem.")
+	}
+
+	homeFile := homeArchivePath(file)
+	if !fileExists(homeFile) {
+		return ok
+	}
+	expected, err = readChecksumFile(homeFile)
+	if err != nil && !os.IsNotExist(err) {
+		logWarning(err.Error())
+	}
+	homeCheck := checkArchiveFile(homeFile, expected)
+	printArchiveCheck("Home archive", homeFile, homeCheck)
+	ok = ok && homeCheck.ok()
+	if sumsFile := homeChecksumPath(file); homeCheck.Err == nil && fileExists(sumsFile) {
+		result, err := verifyHomeArchive(homeFile, sumsFile)
+		if err != nil {
+			logError(err.Error())
+			return false
+		}
+		printHomeVerifyResult(result)
+		ok = ok && result.ok()
+	}
+	return ok
+}
+
+func handleVerify() {
+	clearScreen()
+	printTitle(colorBlue, "🔍 Verify Backup")
+	fmt.Printf("%s%sHint:%s The backup is re-hashed and read to the end, so a corrupt archive is found before you need it.\n\n", colorYellow, colorUnderline, colorReset)
+
+	logInfo("Please choose the backup file (.tar) to verify.")
+	backupFile, err := selectFile("Select Backup File", backupFileFilters...)
+	if err != nil || backupFile == "" {
+		logError("No backup file selected. Aborting.")
+		return
+	}
+	if verifyBackup(backupFile) {
+		fmt.Println()
+		logSuccess("✅ The backup is intact.")
+		return
+	}
+	fmt.Println()
+	logError("The backup failed verification. Do not rely on it.")
+}
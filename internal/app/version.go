@@ -0,0 +1,121 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// version is the release the binary was built from, passed to Run or
+// RunHeadless by the main package.
+var version = "dev"
+
+// buildDate is when the binary was built, passed like version.
+var buildDate = "unknown"
+
+// cmdVersion prints the version; with --verbose it also prints how the
+// binary was built and what it finds on this machine, as a Markdown code
+// block to paste into bug reports. It runs before the dependency check, so
+// it also works when distrobox or the runtime is missing.
+func cmdVersion(args []string) int {
+	fs := newCommandFlags("version")
+	verbose := fs.Bool("verbose", false, "also print build details, runtimes and the distrobox version for bug reports")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if !*verbose {
+		fmt.Printf("distrobox-tool %s\n", version)
+		return 0
+	}
+
+	commit, modified := "unknown", false
+	var tags string
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				commit = s.Value
+			case "vcs.modified":
+				modified = s.Value == "true"
+			case "-tags":
+				tags = s.Value
+			}
+		}
+	}
+	if modified {
+		commit += " (modified)"
+	}
+
+	detectHostSpawn()
+	loadDistroboxConfig()
+	used, err := detectRuntime()
+	if err != nil {
+		used = ""
+	}
+
+	rows := [][2]string{
+		{"go", fmt.Sprintf("%s %s/%s", runtime.Version(), runtime.GOOS, runtime.GOARCH)},
+		{"commit", commit},
+		{"build date", buildDate},
+	}
+	if tags != "" {
+		rows = append(rows, [2]string{"build tags", tags})
+	}
+	rows = append(rows, [2]string{"host", hostDescription()})
+	if hostSpawn != nil {
+		rows = append(rows, [2]string{"host spawn", strings.Join(hostSpawn, " ")})
+	}
+	rows = append(rows, [2]string{"distrobox", toolVersion("distrobox")})
+	for _, name := range runtimeOrder {
+		v := toolVersion(name)
+		if name == used {
+			v += " (used by distrobox)"
+		}
+		rows = append(rows, [2]string{name, v})
+	}
+	if err != nil {
+		rows = append(rows, [2]string{"runtime", err.Error()})
+	}
+	rows = append(rows, [2]string{"toolbox", toolVersion("toolbox")})
+
+	fmt.Println("```")
+	fmt.Printf("distrobox-tool %s\n", version)
+	for _, r := range rows {
+		fmt.Printf("  %-16s %s\n", r[0]+":", r[1])
+	}
+	fmt.Println("```")
+	return 0
+}
+
+// toolVersion returns the first line `name --version` prints, or why there
+// is none.
+func toolVersion(name string) string {
+	if !commandExists(name) {
+		return "not found"
+	}
+	out, err := runCommand(name, "--version")
+	if err != nil {
+		return err.Error()
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(out), "\n")
+	return line
+}
+
+// hostDescription returns the PRETTY_NAME from /etc/os-release and the
+// kernel release.
+func hostDescription() string {
+	name := "unknown"
+	if content, err := os.ReadFile("/etc/os-release"); err == nil {
+		for _, line := range strings.Split(string(content), "\n") {
+			if v, ok := strings.CutPrefix(line, "PRETTY_NAME="); ok {
+				name = strings.Trim(v, `"`)
+			}
+		}
+	}
+	if kernel, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		name += ", kernel " + strings.TrimSpace(string(kernel))
+	}
+	return name
+}
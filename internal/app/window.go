@@ -0,0 +1,225 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedules can be kept out of working hours: a window ("01:00-06:00")
+// limits when runs may happen, and blackouts ("weekdays 09:00-17:00",
+// "Sun") forbid times inside the window.
+
+const (
+	outsideWait = "wait"
+	outsideSkip = "skip"
+)
+
+// clockRange is a daily time span in minutes after midnight. A range whose
+// end is not after its start wraps past midnight.
+type clockRange struct {
+	Start, End int
+}
+
+// parseClockRange parses "HH:MM-HH:MM".
+func parseClockRange(s string) (clockRange, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return clockRange{}, fmt.Errorf("%q is not a HH:MM-HH:MM range", s)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return clockRange{}, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return clockRange{}, err
+	}
+	if start == end {
+		return clockRange{}, fmt.Errorf("%q is empty", s)
+	}
+	return clockRange{Start: start, End: end}, nil
+}
+
+// parseClock parses "HH:MM", allowing "24:00" as the end of the day.
+func parseClock(s string) (int, error) {
+	var h, m int
+	if n, err := fmt.Sscanf(strings.TrimSpace(s), "%d:%d", &h, &m); err != nil || n != 2 || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("%q is not a HH:MM time", strings.TrimSpace(s))
+	}
+	return h*60 + m, nil
+}
+
+func (r clockRange) contains(minute int) bool {
+	if r.Start < r.End {
+		return minute >= r.Start && minute < r.End
+	}
+	return minute >= r.Start || minute < r.End
+}
+
+func (r clockRange) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", r.Start/60, r.Start%60, r.End/60, r.End%60)
+}
+
+// blackout is a span of time on some weekdays in which runs may not happen.
+// Without Hours it covers the whole day.
+type blackout struct {
+	Days  [7]bool // indexed by time.Weekday
+	Hours *clockRange
+	Text  string
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseBlackout parses "[DAYS] [HH:MM-HH:MM]", where DAYS is a comma list
+// of weekdays or day ranges ("Mon-Fri", "Sat,Sun") or one of "daily",
+// "weekdays" and "weekends". At least one part is required.
+func parseBlackout(s string) (blackout, error) {
+	b := blackout{Text: s}
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return b, fmt.Errorf("%q is not \"[DAYS] [HH:MM-HH:MM]\"", s)
+	}
+	if strings.Contains(fields[len(fields)-1], ":") {
+		r, err := parseClockRange(fields[len(fields)-1])
+		if err != nil {
+			return b, err
+		}
+		b.Hours = &r
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 0 {
+		b.Days = [7]bool{true, true, true, true, true, true, true}
+		return b, nil
+	}
+	days, err := parseDays(fields[0])
+	if err != nil {
+		return b, err
+	}
+	b.Days = days
+	return b, nil
+}
+
+func parseDays(s string) ([7]bool, error) {
+	var days [7]bool
+	switch strings.ToLower(s) {
+	case "daily":
+		return [7]bool{true, true, true, true, true, true, true}, nil
+	case "weekdays":
+		return [7]bool{false, true, true, true, true, true, false}, nil
+	case "weekends":
+		return [7]bool{true, false, false, false, false, false, true}, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(strings.ToLower(part), "-")
+		first, ok := weekdayNames[strings.TrimSpace(from)]
+		if !ok {
+			return days, fmt.Errorf("unknown day %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdayNames[strings.TrimSpace(to)]; !ok {
+				return days, fmt.Errorf("unknown day %q", to)
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func (b blackout) covers(t time.Time) bool {
+	if b.Hours == nil {
+		return b.Days[t.Weekday()]
+	}
+	minute := t.Hour()*60 + t.Minute()
+	if !b.Hours.contains(minute) {
+		return false
+	}
+	// The part of a wrapping range after midnight belongs to the day it
+	// started on: "Fri 22:00-02:00" covers early Saturday.
+	if b.Hours.Start >= b.Hours.End && minute < b.Hours.End {
+		return b.Days[t.AddDate(0, 0, -1).Weekday()]
+	}
+	return b.Days[t.Weekday()]
+}
+
+// runHours combines the window and blackouts of a schedule.
+type runHours struct {
+	Window    *clockRange
+	Blackouts []blackout
+}
+
+func (h runHours) isSet() bool {
+	return h.Window != nil || len(h.Blackouts) > 0
+}
+
+// blocked returns why a run may not happen at t, or "" if it may.
+func (h runHours) blocked(t time.Time) string {
+	if h.Window != nil && !h.Window.contains(t.Hour()*60+t.Minute()) {
+		return fmt.Sprintf("outside the window %s", h.Window)
+	}
+	for _, b := range h.Blackouts {
+		if b.covers(t) {
+			return fmt.Sprintf("inside the blackout %q", b.Text)
+		}
+	}
+	return ""
+}
+
+// next returns the first minute from t on at which a run may happen, or
+// false if there is none within a week.
+func (h runHours) next(t time.Time) (time.Time, bool) {
+	t = t.Truncate(time.Minute)
+	for i := 0; i <= 7*24*60; i++ {
+		if h.blocked(t) == "" {
+			return t, true
+		}
+		t = t.Add(time.Minute)
+	}
+	return time.Time{}, false
+}
+
+func (h runHours) String() string {
+	var parts []string
+	if h.Window != nil {
+		parts = append(parts, "only "+h.Window.String())
+	}
+	for _, b := range h.Blackouts {
+		parts = append(parts, "not "+b.Text)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// waitForHours holds a scheduled run until its hours allow it. With
+// outside set to outsideSkip it does not wait. It reports whether the run
+// may start.
+func waitForHours(h runHours, outside string) bool {
+	reason := h.blocked(time.Now())
+	if reason == "" {
+		return true
+	}
+	if outside == outsideSkip {
+		logWarning(fmt.Sprintf("Skipping the run: %s.", reason))
+		return false
+	}
+	at, ok := h.next(time.Now())
+	if !ok {
+		logWarning(fmt.Sprintf("Skipping the run: %s, and no allowed time in the coming week.", reason))
+		return false
+	}
+	logInfo(fmt.Sprintf("Waiting until %s: %s.", at.Format("Mon 15:04"), reason))
+	// Sleep in steps against the wall clock, which keeps going while the
+	// machine is suspended.
+	for time.Now().Before(at) {
+		time.Sleep(min(powerCheckInterval, time.Until(at)))
+	}
+	return true
+}
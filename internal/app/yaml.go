@@ -0,0 +1,318 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// --- Minimal YAML reader ---
+//
+// Supports the subset job files need: block mappings and sequences (a
+// sequence item may start a mapping, "- action: backup"), flow sequences of
+// scalars ([a, b]), quoted and plain scalars, null and # comments. Anchors,
+// multi-line strings and flow mappings are not supported. Mappings become
+// map[string]any, sequences []any, quoted scalars string and plain ones
+// yamlPlain, which the reader turns into booleans and integers where its
+// schema expects them (see typeYAML).
+
+type yamlLine struct {
+	Indent int
+	Text   string
+	Line   int
+}
+
+func parseYAML(text string) (any, error) {
+	doc, _, err := parseYAMLLines(text)
+	return doc, err
+}
+
+// parseYAMLLines is parseYAML that also returns the line each key of the
+// nested top-level mappings is on, by dotted path ("backup.dir"), so that
+// errors can point at the setting. Keys inside sequences are not recorded.
+func parseYAMLLines(text string) (any, map[string]int, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(text, "\n") {
+		if strings.Contains(raw, "\t") && strings.TrimSpace(raw) != "" && strings.HasPrefix(strings.TrimLeft(raw, " "), "\t") {
+			return nil, nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		content := strings.TrimRight(stripYAMLComment(raw), " \t\r")
+		trimmed := strings.TrimLeft(content, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		lines = append(lines, yamlLine{Indent: len(content) - len(trimmed), Text: trimmed, Line: i + 1})
+	}
+	if len(lines) == 0 {
+		return nil, nil, nil
+	}
+	keys := map[string]int{}
+	value, next, err := parseYAMLBlock(lines, 0, lines[0].Indent, "", keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	if next < len(lines) {
+		return nil, nil, fmt.Errorf("line %d: unexpected indentation", lines[next].Line)
+	}
+	return value, keys, nil
+}
+
+// parseYAMLBlock parses the mapping or sequence starting at lines[i], whose
+// lines are indented by indent, and returns the index after it. Mapping
+// keys are recorded in keys under path when keys is not nil.
+func parseYAMLBlock(lines []yamlLine, i, indent int, path string, keys map[string]int) (any, int, error) {
+	if isYAMLSeqItem(lines[i].Text) {
+		return parseYAMLSeq(lines, i, indent)
+	}
+	return parseYAMLMap(lines, i, indent, path, keys)
+}
+
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func parseYAMLSeq(lines []yamlLine, i, indent int) (any, int, error) {
+	var seq []any
+	for i < len(lines) && lines[i].Indent == indent && isYAMLSeqItem(lines[i].Text) {
+		content := strings.TrimLeft(strings.TrimPrefix(lines[i].Text, "-"), " ")
+		switch {
+		case content == "":
+			if i+1 >= len(lines) || lines[i+1].Indent <= indent {
+				seq = append(seq, nil)
+				i++
+				continue
+			}
+			value, next, err := parseYAMLBlock(lines, i+1, lines[i+1].Indent, "", nil)
+			if err != nil {
+				return nil, 0, err
+			}
+			seq = append(seq, value)
+			i = next
+		case isYAMLSeqItem(content) || yamlKeyValue(content):
+			// The item is a block of its own that starts on the dash line;
+			// re-read that line at the column the content starts at.
+			lines[i] = yamlLine{Indent: lines[i].Indent + len(lines[i].Text) - len(content), Text: content, Line: lines[i].Line}
+			value, next, err := parseYAMLBlock(lines, i, lines[i].Indent, "", nil)
+			if err != nil {
+				return nil, 0, err
+			}
+			seq = append(seq, value)
+			i = next
+		default:
+			value, err := parseYAMLScalar(content, lines[i].Line)
+			if err != nil {
+				return nil, 0, err
+			}
+			seq = append(seq, value)
+			i++
+		}
+	}
+	return seq, i, nil
+}
+
+func parseYAMLMap(lines []yamlLine, i, indent int, path string, keys map[string]int) (any, int, error) {
+	m := map[string]any{}
+	for i < len(lines) && lines[i].Indent == indent && !isYAMLSeqItem(lines[i].Text) {
+		l := lines[i]
+		key, value, ok := cutYAMLKey(l.Text)
+		if !ok {
+			return nil, 0, fmt.Errorf("line %d: expected 'key: value'", l.Line)
+		}
+		if _, dup := m[key]; dup {
+			return nil, 0, fmt.Errorf("line %d: duplicate key %s", l.Line, key)
+		}
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+		if keys != nil {
+			keys[keyPath] = l.Line
+		}
+		i++
+		if value != "" {
+			v, err := parseYAMLScalar(value, l.Line)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			continue
+		}
+		// A nested block is indented further, except that a sequence may
+		// sit at the key's own indentation.
+		if i < len(lines) && (lines[i].Indent > indent || (lines[i].Indent == indent && isYAMLSeqItem(lines[i].Text))) {
+			v, next, err := parseYAMLBlock(lines, i, lines[i].Indent, keyPath, keys)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			i = next
+			continue
+		}
+		m[key] = nil
+	}
+	if i < len(lines) && lines[i].Indent > indent {
+		return nil, 0, fmt.Errorf("line %d: unexpected indentation", lines[i].Line)
+	}
+	return m, i, nil
+}
+
+// yamlKeyValue reports whether text starts a mapping entry.
+func yamlKeyValue(text string) bool {
+	_, _, ok := cutYAMLKey(text)
+	return ok
+}
+
+// cutYAMLKey splits "key: value" (or "key:") into its parts. Keys may be
+// quoted.
+func cutYAMLKey(text string) (key, value string, ok bool) {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return "", "", false
+		}
+		key, rest := text[1:end+1], text[end+2:]
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(rest[1:]), true
+	}
+	if k, ok := strings.CutSuffix(text, ":"); ok && !strings.Contains(k, ": ") {
+		return strings.TrimSpace(k), "", true
+	}
+	k, v, ok := strings.Cut(text, ": ")
+	if !ok || strings.ContainsAny(k, "[]{}") {
+		return "", "", false
+	}
+	return strings.TrimSpace(k), strings.TrimSpace(v), true
+}
+
+func parseYAMLScalar(s string, line int) (any, error) {
+	switch {
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("line %d: unterminated flow sequence", line)
+		}
+		list := []any{}
+		for _, item := range splitTopLevel(s[1:len(s)-1], ',') {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			v, err := parseYAMLScalar(item, line)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case strings.HasPrefix(s, "{"):
+		return nil, fmt.Errorf("line %d: flow mappings are not supported", line)
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid string %s", line, s)
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("line %d: invalid string %s", line, s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	if s == "null" || s == "~" {
+		return nil, nil
+	}
+	return yamlPlain(s), nil
+}
+
+// yamlPlain is an unquoted scalar. It stays text until the reader knows
+// the field takes a boolean or an integer, so that names and notes such as
+// "no" or "0755" are not read as YAML 1.1 would.
+type yamlPlain string
+
+func (p yamlPlain) bool() (bool, error) {
+	switch p {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected true or false, got %s", p)
+}
+
+func (p yamlPlain) int() (int64, error) {
+	n, err := strconv.ParseInt(strings.ReplaceAll(string(p), "_", ""), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("expected an integer, got %s", p)
+	}
+	return n, nil
+}
+
+// yamlKind is the type a field of a YAML document is read as.
+type yamlKind int
+
+const (
+	yamlBool yamlKind = iota + 1
+	yamlInt
+)
+
+// typeYAML converts the plain scalars of the fields named in kinds, in
+// every mapping of doc, to booleans and integers. Other plain scalars stay
+// yamlPlain, which encodes as a JSON string.
+func typeYAML(doc any, kinds map[string]yamlKind) (any, error) {
+	switch v := doc.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if p, ok := item.(yamlPlain); ok && kinds[key] != 0 {
+				var typed any
+				var err error
+				if kinds[key] == yamlBool {
+					typed, err = p.bool()
+				} else {
+					typed, err = p.int()
+				}
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", key, err)
+				}
+				v[key] = typed
+				continue
+			}
+			typed, err := typeYAML(item, kinds)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = typed
+		}
+	case []any:
+		for i, item := range v {
+			typed, err := typeYAML(item, kinds)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = typed
+		}
+	}
+	return doc, nil
+}
+
+// stripYAMLComment removes a # comment, which in YAML starts a line or
+// follows whitespace, unless it is inside a quoted string.
+func stripYAMLComment(line string) string {
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,53 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYAMLScalar(t *testing.T) {
+	tests := []struct {
+		in   string
+		want any
+	}{
+		{"hello", yamlPlain("hello")},
+		{"true", yamlPlain("true")},
+		{"no", yamlPlain("no")},
+		{"0755", yamlPlain("0755")},
+		{"null", nil},
+		{"~", nil},
+		{`"quoted # not a comment"`, "quoted # not a comment"},
+		{`"tab\there"`, "tab\there"},
+		{`'it''s'`, "it's"},
+		{`''`, ""},
+		{"[]", []any{}},
+		{"[a, 2, ~]", []any{yamlPlain("a"), yamlPlain("2"), nil}},
+		{`["a, b", 'c']`, []any{"a, b", "c"}},
+	}
+	for _, tt := range tests {
+		got, err := parseYAMLScalar(tt.in, 1)
+		if err != nil {
+			t.Errorf("parseYAMLScalar(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseYAMLScalar(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseYAMLScalarErrors(t *testing.T) {
+	for _, in := range []string{
+		"[a, b",
+		"{a: b}",
+		`"unterminated`,
+		`"bad \q escape"`,
+		"'unterminated",
+		"'",
+		`[a, "b]`,
+	} {
+		if v, err := parseYAMLScalar(in, 3); err == nil {
+			t.Errorf("parseYAMLScalar(%q) = %#v, want an error", in, v)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ArchiveFormat identifies what kind of tarball a file contains.
+type ArchiveFormat int
+
+const (
+	FormatUnknown       ArchiveFormat = iota
+	FormatDockerArchive               // 'podman/docker save' output (manifest.json + layers)
+	FormatOCIArchive                  // OCI image layout (oci-layout + index.json)
+	FormatRootfs                      // a plain root filesystem (export, debootstrap, LXC)
+	FormatEncrypted                   // age or gpg encrypted; only known once decrypted
+)
+
+func (f ArchiveFormat) String() string {
+	switch f {
+	case FormatDockerArchive:
+		return "docker-archive"
+	case FormatOCIArchive:
+		return "oci-archive"
+	case FormatRootfs:
+		return "rootfs"
+	case FormatEncrypted:
+		return "encrypted"
+	}
+	return "unknown"
+}
+
+// maxProbeEntries bounds how many tar headers DetectArchiveFormat reads.
+const maxProbeEntries = 200
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// DetectArchiveFormat inspects the first entries of a (possibly gzip, zstd
+// or xz compressed) tarball to tell image archives apart from root
+// filesystems. Encrypted files are reported as FormatEncrypted without
+// being decrypted.
+func DetectArchiveFormat(file string) (ArchiveFormat, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return FormatUnknown, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	if head, _ := br.Peek(cipherProbeSize); DetectCipher(head) != EncryptNone {
+		return FormatEncrypted, nil
+	}
+	r, _, err := New("").Decompress(br)
+	if err != nil {
+		return FormatUnknown, err
+	}
+	defer r.Close()
+	return detectTarFormat(tar.NewReader(r))
+}
+
+func detectTarFormat(tr *tar.Reader) (ArchiveFormat, error) {
+	rootfsMarkers := 0
+	for i := 0; i < maxProbeEntries; i++ {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return FormatUnknown, err
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		switch name {
+		case EmbeddedManifestName, "manifest.json", "repositories":
+			return FormatDockerArchive, nil
+		case "oci-layout", "index.json":
+			return FormatOCIArchive, nil
+		case "etc", "usr", "bin", "etc/os-release", "usr/lib/os-release":
+			rootfsMarkers++
+		}
+		if rootfsMarkers >= 2 {
+			return FormatRootfs, nil
+		}
+	}
+	if rootfsMarkers > 0 {
+		return FormatRootfs, nil
+	}
+	return FormatUnknown, nil
+}
+
+// Import creates an image named ref from a root filesystem tarball, which
+// may be encrypted and gzip, zstd or xz compressed.
+func (c *Client) Import(file, ref string) (string, error) {
+	r, plain, err := c.OpenArchive(file)
+	if err != nil {
+		return "", err
+	}
+	if plain {
+		r.Close()
+		if _, err := c.RuntimeOutput("import", file, ref); err != nil {
+			return "", err
+		}
+		return ref, nil
+	}
+
+	var out bytes.Buffer
+	cmd := c.Run(c.Runtime, "import", "-", ref)
+	cmd.Stdin = r
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		r.Close()
+		return "", fmt.Errorf("command '%s import - %s' failed: %w: %s", c.Runtime, ref, err, strings.TrimSpace(out.String()))
+	}
+	if err := r.Close(); err != nil {
+		return "", err
+	}
+	return ref, nil
+}
+
+// CheckArchive reads every member of an archive file to the end, decrypting
+// and decompressing it on the way, so truncated files, damaged tar headers
+// and broken compression streams are all reported. It returns the number of
+// members and the kind of archive found.
+func (c *Client) CheckArchive(file string) (int, ArchiveFormat, error) {
+	r, _, err := c.OpenArchive(file)
+	if err != nil {
+		return 0, FormatUnknown, err
+	}
+
+	members, format, rootfsMarkers := 0, FormatUnknown, 0
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			r.Close()
+			return members, format, fmt.Errorf("member %d: %w", members+1, err)
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			r.Close()
+			return members, format, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		members++
+		switch path.Clean(strings.TrimPrefix(hdr.Name, "./")) {
+		case "manifest.json", "repositories":
+			format = FormatDockerArchive
+		case "oci-layout", "index.json":
+			if format == FormatUnknown {
+				format = FormatOCIArchive
+			}
+		case "etc", "usr", "bin", "etc/os-release", "usr/lib/os-release":
+			rootfsMarkers++
+		}
+	}
+	if format == FormatUnknown && rootfsMarkers > 0 {
+		format = FormatRootfs
+	}
+	// Reading past the tar trailer lets the decompressor verify its own
+	// end-of-stream checksum.
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		r.Close()
+		return members, format, err
+	}
+	if err := r.Close(); err != nil {
+		return members, format, err
+	}
+	return members, format, nil
+}
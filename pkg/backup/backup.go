@@ -0,0 +1,242 @@
+// Package backup contains the container primitives used by distrobox-tool:
+// committing a distrobox to an image, streaming that image to and from a tar
+// archive, and recreating a distrobox from a loaded image.
+//
+// It shells out to the container runtime (podman or docker) and to the
+// distrobox scripts, exactly like the interactive tool does, so other
+// frontends can reuse the same logic without driving the TUI.
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Runner builds the command used to execute a host program. Frontends can
+// replace it to wrap every invocation (for example with sudo or flatpak-spawn).
+type Runner func(name string, args ...string) *exec.Cmd
+
+// Client executes backup primitives against a single container runtime.
+type Client struct {
+	Runtime string // "podman" or "docker"
+	Run     Runner
+	// Identity is the age identity file used to decrypt age encrypted
+	// archives.
+	Identity string
+	// FileMode is the permissions of the archives SaveArchive writes.
+	FileMode os.FileMode
+	// Trace, when set, is called after every command Output runs.
+	Trace func(name string, args []string, elapsed time.Duration, err error)
+}
+
+// New returns a Client for the given runtime binary that runs commands directly.
+func New(runtime string) *Client {
+	return &Client{Runtime: runtime, Run: exec.Command, FileMode: 0600}
+}
+
+// Output runs a host command and returns its combined output. The error
+// includes the command line so callers can surface it unchanged.
+func (c *Client) Output(name string, args ...string) (string, error) {
+	cmd := c.Run(name, args...)
+	start := time.Now()
+	output, err := cmd.CombinedOutput()
+	if c.Trace != nil {
+		c.Trace(name, args, time.Since(start), err)
+	}
+	if err != nil {
+		return string(output), fmt.Errorf("command '%s %s' failed: %w", name, strings.Join(args, " "), err)
+	}
+	return string(output), nil
+}
+
+// RuntimeOutput runs a container runtime subcommand and returns its output.
+func (c *Client) RuntimeOutput(args ...string) (string, error) {
+	return c.Output(c.Runtime, args...)
+}
+
+// ImageProvenance describes the local image id, which was pulled as ref.
+// Images built locally have no digest.
+func (c *Client) ImageProvenance(ref, id string) (*ImageProvenance, error) {
+	out, err := c.RuntimeOutput("image", "inspect", id)
+	if err != nil {
+		return nil, err
+	}
+	var images []struct {
+		ID          string `json:"Id"`
+		Digest      string
+		RepoDigests []string
+		Created     time.Time
+	}
+	if err := json.Unmarshal([]byte(out), &images); err != nil {
+		return nil, fmt.Errorf("failed to parse inspect data of image %s: %w", id, err)
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("image %s not found", id)
+	}
+	img := images[0]
+	p := &ImageProvenance{Ref: ref, ID: strings.TrimPrefix(img.ID, "sha256:"), Digest: img.Digest, Created: img.Created.UTC()}
+	// Prefer the repo digest of the repository ref names; an image can be
+	// known under several.
+	repo := ref
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo = repo[:i]
+	}
+	for _, rd := range img.RepoDigests {
+		if name, _, _ := strings.Cut(rd, "@"); name == repo {
+			p.RepoDigest = rd
+			break
+		}
+		if p.RepoDigest == "" {
+			p.RepoDigest = rd
+		}
+	}
+	if p.Digest == "" {
+		_, p.Digest, _ = strings.Cut(p.RepoDigest, "@")
+	}
+	return p, nil
+}
+
+// Commit snapshots a container's filesystem into a new image.
+func (c *Client) Commit(container, image string) error {
+	_, err := c.RuntimeOutput("commit", container, image)
+	return err
+}
+
+// RemoveImage deletes an image from the runtime's storage.
+func (c *Client) RemoveImage(image string) error {
+	_, err := c.RuntimeOutput("rmi", image)
+	return err
+}
+
+// Save writes an image to a tar archive on disk.
+func (c *Client) Save(image, path string) error {
+	_, err := c.RuntimeOutput("save", "-o", path, image)
+	return err
+}
+
+// SaveStream writes an image as a docker-archive tar stream to w.
+func (c *Client) SaveStream(image string, w io.Writer) error {
+	var stderr bytes.Buffer
+	cmd := c.Run(c.Runtime, "save", image)
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("command '%s save %s' failed: %w: %s", c.Runtime, image, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Load reads an image archive from disk and returns the name of the loaded
+// image. Encrypted and gzip, zstd or xz compressed archives are decrypted and
+// decompressed on the fly, since not every runtime understands all of them.
+func (c *Client) Load(path string) (string, error) {
+	r, plain, err := c.OpenArchive(path)
+	if err != nil {
+		return "", err
+	}
+	if !plain {
+		image, err := c.LoadStream(r)
+		if closeErr := r.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", err
+		}
+		return image, nil
+	}
+	r.Close()
+
+	output, err := c.RuntimeOutput("load", "-i", path)
+	if err != nil {
+		return "", err
+	}
+	return loadedImageFromOutput(output)
+}
+
+// LoadStream reads an image archive from r and returns the name of the loaded image.
+func (c *Client) LoadStream(r io.Reader) (string, error) {
+	var out bytes.Buffer
+	cmd := c.Run(c.Runtime, "load")
+	cmd.Stdin = r
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("command '%s load' failed: %w: %s", c.Runtime, err, strings.TrimSpace(out.String()))
+	}
+	return loadedImageFromOutput(out.String())
+}
+
+// ParseLoadedImage extracts the image reference from the output of
+// 'podman load' / 'docker load'. It returns "" if no image was reported.
+func ParseLoadedImage(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Contains(line, "Loaded image:") {
+			parts := strings.SplitN(line, "Loaded image:", 2)
+			if len(parts) == 2 {
+				return strings.TrimSpace(parts[1])
+			}
+		}
+		// docker reports untagged archives by ID only.
+		if strings.Contains(line, "Loaded image ID:") {
+			parts := strings.SplitN(line, "Loaded image ID:", 2)
+			if len(parts) == 2 {
+				return strings.TrimSpace(parts[1])
+			}
+		}
+	}
+	return ""
+}
+
+func loadedImageFromOutput(output string) (string, error) {
+	image := ParseLoadedImage(output)
+	if image == "" {
+		return "", fmt.Errorf("could not determine the name of the loaded image")
+	}
+	return image, nil
+}
+
+// Export writes a container's flattened root filesystem as a plain tar
+// archive, usable with chroot, systemd-nspawn or LXC.
+func (c *Client) Export(container, path string) error {
+	_, err := c.RuntimeOutput("export", "-o", path, container)
+	return err
+}
+
+// Tag adds a new reference to an existing image.
+func (c *Client) Tag(image, ref string) error {
+	_, err := c.RuntimeOutput("tag", image, ref)
+	return err
+}
+
+// Retag moves an image to ref, dropping its previous reference. An image ID
+// (which is not a reference) is left as it is.
+func (c *Client) Retag(image, ref string) error {
+	if err := c.Tag(image, ref); err != nil {
+		return err
+	}
+	if image == ref || IsImageID(image) {
+		return nil
+	}
+	return c.RemoveImage(image)
+}
+
+// IsImageID reports whether s is an image ID ("sha256:<hex>" or bare hex)
+// rather than a name.
+func IsImageID(s string) bool {
+	s = strings.TrimPrefix(s, "sha256:")
+	if len(s) < 12 {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
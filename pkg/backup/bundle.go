@@ -0,0 +1,184 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// BundledHomePrefix is the directory inside a bundle archive holding the
+// isolated home. Bundles are ordinary image archives with the home appended
+// under this prefix, so runtimes load them like any other backup.
+const BundledHomePrefix = ".distrobox-backup/home/"
+
+// SaveBundle is SaveCompressed with the contents of homeDir appended to the
+// archive, so an isolated container round-trips in a single file. The home is
+// read with tar(1), which preserves ownership, permissions and links.
+func (c *Client) SaveBundle(image, path string, m *Manifest, comp Compression, level int, homeDir string) error {
+	return c.SaveArchive(image, path, m, SaveOptions{Compression: comp, Level: level, HomeDir: homeDir})
+}
+
+// Ways a home archive records who owns its files.
+const (
+	// OwnerNames is tar's default: user and group names as well as IDs.
+	OwnerNames = "names"
+	// OwnerNumeric records and restores the numeric IDs only, ignoring
+	// the names known on either machine.
+	OwnerNumeric = "numeric"
+	// OwnerUser records every file as owned by the user making the backup
+	// and gives it to the user restoring it.
+	OwnerUser = "user"
+)
+
+// HomeOptions controls what a home archive keeps of file ownership and
+// extended attributes.
+type HomeOptions struct {
+	Owner  string // OwnerNames (or ""), OwnerNumeric or OwnerUser
+	Xattrs bool   // keep extended attributes; tar drops them by default
+	// Exclude lists paths relative to the home to leave out.
+	Exclude []string
+}
+
+// xattrArgs make tar keep SELinux labels, file capabilities (both security.*)
+// and user.* attributes. Other namespaces, such as trusted.*, need root to
+// read and would only produce warnings.
+var xattrArgs = []string{"--xattrs", "--xattrs-include=security.*", "--xattrs-include=user.*"}
+
+// HomeOptions returns the options the home of the backup was archived with.
+func (m *Manifest) HomeOptions() HomeOptions {
+	return HomeOptions{Owner: m.HomeOwner, Xattrs: m.HomeXattrs, Exclude: m.HomeExcluded}
+}
+
+// CreateArgs returns the tar(1) options that archive a home as o says.
+func (o HomeOptions) CreateArgs() []string {
+	var args []string
+	switch o.Owner {
+	case OwnerNumeric:
+		args = append(args, "--numeric-owner")
+	case OwnerUser:
+		args = append(args, fmt.Sprintf("--owner=+%d", os.Getuid()), fmt.Sprintf("--group=+%d", os.Getgid()))
+	}
+	if o.Xattrs {
+		// Only the POSIX format can hold extended attributes.
+		args = append(append(args, "--format=posix"), xattrArgs...)
+	}
+	for _, p := range o.Exclude {
+		args = append(args, "--exclude=./"+strings.TrimPrefix(p, "./"))
+	}
+	return args
+}
+
+// ExtractArgs returns the tar(1) options that extract a home archived with
+// o. Owners only matter when extracting as root; other users always get
+// the files, and the attributes they may not set (file capabilities and
+// labels the SELinux policy does not let them assign) are warned about.
+func (o HomeOptions) ExtractArgs() []string {
+	var args []string
+	switch o.Owner {
+	case OwnerNumeric:
+		args = append(args, "--numeric-owner")
+	case OwnerUser:
+		args = append(args, "--no-same-owner")
+	}
+	if o.Xattrs {
+		args = append(args, xattrArgs...)
+	}
+	return args
+}
+
+// ExtractBundledHome extracts the home stored in a bundle archive into dest
+// with tar(1). It returns ErrNoBundledHome if the archive has none.
+func (c *Client) ExtractBundledHome(path, dest string, opts HomeOptions) error {
+	r, _, err := c.OpenArchive(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var stderr bytes.Buffer
+	cmd := c.Run("tar", append([]string{"-xf", "-", "-C", dest}, opts.ExtractArgs()...)...)
+	cmd.Stderr = &stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	found, copyErr := copyBundledHome(in, r)
+	in.Close()
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("command 'tar -xf - -C %s' failed: %w: %s", dest, err, strings.TrimSpace(stderr.String()))
+	}
+	if copyErr != nil {
+		return copyErr
+	}
+	if !found {
+		return ErrNoBundledHome
+	}
+	return nil
+}
+
+// ErrNoBundledHome is returned when an archive carries no home directory.
+var ErrNoBundledHome = errors.New("archive has no bundled home directory")
+
+// copyBundledHome writes the members below BundledHomePrefix of the archive
+// read from r as a tar stream to w, with the prefix removed.
+func copyBundledHome(w io.Writer, r io.Reader) (bool, error) {
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	found := false
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return found, err
+		}
+		if !strings.HasPrefix(hdr.Name, BundledHomePrefix) {
+			continue
+		}
+		found = true
+		hdr.Name = "./" + strings.TrimPrefix(hdr.Name, BundledHomePrefix)
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = "./" + strings.TrimPrefix(hdr.Linkname, BundledHomePrefix)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return found, err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return found, err
+		}
+	}
+	return found, tw.Close()
+}
+
+// appendHome copies a tar stream of a home directory into tw, moving every
+// member below BundledHomePrefix.
+func appendHome(tw *tar.Writer, home io.Reader) error {
+	tr := tar.NewReader(home)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading home archive: %w", err)
+		}
+		hdr.Name = BundledHomePrefix + strings.TrimPrefix(hdr.Name, "./")
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = BundledHomePrefix + strings.TrimPrefix(hdr.Linkname, "./")
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Compression is an archive compression format. gzip is handled natively;
+// zstd and xz use the host's zstd and xz commands.
+type Compression string
+
+const (
+	CompressNone Compression = ""
+	CompressGzip Compression = "gzip"
+	CompressZstd Compression = "zstd"
+	CompressXz   Compression = "xz"
+)
+
+// Compressions lists the supported compressed formats.
+var Compressions = []Compression{CompressGzip, CompressZstd, CompressXz}
+
+var (
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// ParseCompression accepts a format name ("none", "gzip"/"gz", "zstd"/"zst", "xz").
+func ParseCompression(s string) (Compression, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "none":
+		return CompressNone, nil
+	case "gzip", "gz":
+		return CompressGzip, nil
+	case "zstd", "zst":
+		return CompressZstd, nil
+	case "xz":
+		return CompressXz, nil
+	}
+	return CompressNone, fmt.Errorf("unknown compression %q: must be none, gzip, zstd or xz", s)
+}
+
+func (c Compression) String() string {
+	if c == CompressNone {
+		return "none"
+	}
+	return string(c)
+}
+
+// Ext returns the file extension appended after ".tar".
+func (c Compression) Ext() string {
+	switch c {
+	case CompressGzip:
+		return ".gz"
+	case CompressZstd:
+		return ".zst"
+	case CompressXz:
+		return ".xz"
+	}
+	return ""
+}
+
+// Levels returns the valid compression levels and the default one.
+func (c Compression) Levels() (min, max, def int) {
+	switch c {
+	case CompressGzip:
+		return 1, 9, 6
+	case CompressZstd:
+		return 1, 19, 3
+	case CompressXz:
+		return 0, 9, 6
+	}
+	return 0, 0, 0
+}
+
+// Command returns the host program needed for c, or "" if none is.
+func (c Compression) Command() string {
+	if c == CompressZstd || c == CompressXz {
+		return string(c)
+	}
+	return ""
+}
+
+// TrimExt removes encryption and compression extensions from a file name.
+func TrimExt(name string) string {
+	name = TrimCipherExt(name)
+	for _, c := range Compressions {
+		if strings.HasSuffix(name, c.Ext()) {
+			return strings.TrimSuffix(name, c.Ext())
+		}
+	}
+	return name
+}
+
+// DetectCompression identifies a compression format from leading bytes.
+func DetectCompression(head []byte) Compression {
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return CompressGzip
+	case bytes.HasPrefix(head, zstdMagic):
+		return CompressZstd
+	case bytes.HasPrefix(head, xzMagic):
+		return CompressXz
+	}
+	return CompressNone
+}
+
+// Compress returns a writer compressing into w with the given level (0 for
+// the format's default). Closing it flushes the stream and reports errors
+// of the compressor; it does not close w.
+func (c *Client) Compress(w io.Writer, comp Compression, level int) (io.WriteCloser, error) {
+	if comp == CompressNone {
+		return nopWriteCloser{w}, nil
+	}
+	min, max, def := comp.Levels()
+	if level == 0 {
+		level = def
+	}
+	if level < min || level > max {
+		return nil, fmt.Errorf("%s compression level must be between %d and %d", comp, min, max)
+	}
+	if comp == CompressGzip {
+		return gzip.NewWriterLevel(w, level)
+	}
+	cmd := c.Run(comp.Command(), "-c", "-T0", "-"+strconv.Itoa(level))
+	return startFilter(cmd, w)
+}
+
+// Decompress returns a reader of r's content, decompressing it if it starts
+// with a known compression header. The returned format is what was found.
+func (c *Client) Decompress(r io.Reader) (io.ReadCloser, Compression, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(len(xzMagic))
+	comp := DetectCompression(head)
+	switch comp {
+	case CompressNone:
+		return io.NopCloser(br), comp, nil
+	case CompressGzip:
+		gz, err := gzip.NewReader(br)
+		return gz, comp, err
+	}
+	cmd := c.Run(comp.Command(), "-d", "-c")
+	cmd.Stdin = br
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, comp, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, comp, fmt.Errorf("could not start %s: %w", comp.Command(), err)
+	}
+	return &filterReader{ReadCloser: out, cmd: cmd, stderr: &stderr}, comp, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// filterWriter feeds an external compressor whose output goes to the
+// underlying writer.
+type filterWriter struct {
+	io.WriteCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func startFilter(cmd *exec.Cmd, w io.Writer) (io.WriteCloser, error) {
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start %s: %w", cmd.Path, err)
+	}
+	return &filterWriter{WriteCloser: in, cmd: cmd, stderr: &stderr}, nil
+}
+
+func (f *filterWriter) Close() error {
+	f.WriteCloser.Close()
+	if err := f.cmd.Wait(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", f.cmd.Path, err, strings.TrimSpace(f.stderr.String()))
+	}
+	return nil
+}
+
+// filterReader reads the output of an external decompressor.
+type filterReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func (f *filterReader) Close() error {
+	f.ReadCloser.Close()
+	err := f.cmd.Wait()
+	switch {
+	case err == nil:
+		return nil
+	case f.stderr.Len() > 0:
+		return fmt.Errorf("%s failed: %w: %s", f.cmd.Path, err, strings.TrimSpace(f.stderr.String()))
+	}
+	return fmt.Errorf("%s failed: %w", f.cmd.Path, err)
+}
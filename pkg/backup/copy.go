@@ -0,0 +1,41 @@
+package backup
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// StorageReference returns the containers-image reference (as understood by
+// skopeo) of an image in the runtime's local storage.
+func (c *Client) StorageReference(image string) string {
+	if c.Runtime == "docker" {
+		return "docker-daemon:" + image
+	}
+	return "containers-storage:" + image
+}
+
+// CopyImage copies an image from local storage straight to dest, a
+// containers-image reference such as docker://registry/repo:tag or
+// oci:/path, without writing an archive first. It uses skopeo; without it,
+// docker:// destinations are pushed by the runtime.
+func (c *Client) CopyImage(image, dest string) error {
+	if _, err := exec.LookPath("skopeo"); err == nil {
+		_, err := c.Output("skopeo", "copy", c.StorageReference(image), dest)
+		return err
+	}
+	if strings.HasPrefix(dest, "docker://") {
+		if c.Runtime == "docker" {
+			ref := strings.TrimPrefix(dest, "docker://")
+			if err := c.Tag(image, ref); err != nil {
+				return err
+			}
+			defer c.RemoveImage(ref)
+			_, err := c.RuntimeOutput("push", ref)
+			return err
+		}
+		_, err := c.RuntimeOutput("push", image, dest)
+		return err
+	}
+	return fmt.Errorf("skopeo is required to copy to %s", dest)
+}
@@ -0,0 +1,119 @@
+package backup
+
+import "strings"
+
+// ExtraFlags are the distrobox-create settings of a container beyond its
+// name, image, home, init, nvidia and unshare options. They are recorded in
+// the manifest so that a restored or converted container gets them back.
+type ExtraFlags struct {
+	// Volumes are --volume specs, SOURCE:DESTINATION[:ro].
+	Volumes []string `json:"volumes,omitempty"`
+	// Env and Labels are KEY=VALUE pairs passed as --env and --label.
+	Env    []string `json:"env,omitempty"`
+	Labels []string `json:"labels,omitempty"`
+	// InitHooks and PreInitHooks run on every start of the container.
+	InitHooks    string `json:"init_hooks,omitempty"`
+	PreInitHooks string `json:"pre_init_hooks,omitempty"`
+}
+
+// IsZero reports whether no extra flag is set.
+func (f ExtraFlags) IsZero() bool {
+	return len(f.Volumes) == 0 && len(f.Env) == 0 && len(f.Labels) == 0 && f.InitHooks == "" && f.PreInitHooks == ""
+}
+
+// args returns the distrobox-create arguments for the flags. Environment
+// and labels go through --additional-flags, which distrobox-create passes
+// to the runtime through the shell, so they are quoted.
+func (f ExtraFlags) args() []string {
+	var args []string
+	for _, v := range f.Volumes {
+		args = append(args, "--volume", v)
+	}
+	for _, e := range f.Env {
+		args = append(args, "--additional-flags", "--env "+quoteFlag(e))
+	}
+	for _, l := range f.Labels {
+		args = append(args, "--additional-flags", "--label "+quoteFlag(l))
+	}
+	if f.PreInitHooks != "" {
+		args = append(args, "--pre-init-hooks", f.PreInitHooks)
+	}
+	if f.InitHooks != "" {
+		args = append(args, "--init-hooks", f.InitHooks)
+	}
+	return args
+}
+
+func quoteFlag(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// CreateOptions describes the distrobox-create invocation used to turn an
+// image back into a distrobox.
+type CreateOptions struct {
+	Name   string
+	Image  string
+	Home   string // custom home directory; empty shares the host home
+	Init   bool
+	Nvidia bool
+	// Unshare lists namespaces passed as --unshare-<name> (ipc, netns,
+	// process, devsys).
+	Unshare []string
+	Extra   ExtraFlags
+	// ExtraArgs are appended verbatim to distrobox-create.
+	ExtraArgs []string
+	// Toolbox creates a toolbx container with `toolbox create` instead,
+	// which only takes the name and image.
+	Toolbox bool
+}
+
+// ManagerToolbox is the Manifest.Manager of toolbx containers.
+const ManagerToolbox = "toolbox"
+
+// Args returns the distrobox-create arguments for the options.
+func (o CreateOptions) Args() []string {
+	args := []string{"--name", o.Name, "--image", o.Image}
+	if o.Home != "" {
+		args = append(args, "--home", o.Home)
+	}
+	if o.Init {
+		args = append(args, "--init")
+	}
+	if o.Nvidia {
+		args = append(args, "--nvidia")
+	}
+	for _, ns := range o.Unshare {
+		args = append(args, "--unshare-"+ns)
+	}
+	args = append(args, o.Extra.args()...)
+	return append(args, o.ExtraArgs...)
+}
+
+// CreateFromImage creates a new distrobox from an image that is already
+// present in the runtime's storage.
+func (c *Client) CreateFromImage(opts CreateOptions) error {
+	if opts.Toolbox {
+		_, err := c.Output("toolbox", "--assumeyes", "create", "--image", opts.Image, opts.Name)
+		return err
+	}
+	_, err := c.Output("distrobox-create", opts.Args()...)
+	return err
+}
+
+// RemoveContainer force-removes a distrobox.
+func (c *Client) RemoveContainer(name string) error {
+	_, err := c.Output("distrobox-rm", "-f", name)
+	return err
+}
+
+// RemoveToolbox force-removes a toolbx container.
+func (c *Client) RemoveToolbox(name string) error {
+	_, err := c.Output("toolbox", "rm", "--force", name)
+	return err
+}
+
+// RenameContainer gives a container a new name in the runtime.
+func (c *Client) RenameContainer(name, newName string) error {
+	_, err := c.RuntimeOutput("rename", name, newName)
+	return err
+}
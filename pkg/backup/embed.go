@@ -0,0 +1,309 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// EmbeddedManifestName is the tar member holding the manifest. It is always
+// the first member of archives written by SaveWithManifest, so a reader only
+// needs the first ManifestProbeSize bytes of an archive to get its metadata.
+// Runtimes ignore the extra member when loading the image.
+const EmbeddedManifestName = ".distrobox-backup/manifest.json"
+
+// ManifestProbeSize is how many leading bytes of an archive are enough to
+// read an embedded manifest.
+const ManifestProbeSize = 64 << 10
+
+// ErrNoManifest is returned when an archive has no embedded manifest.
+var ErrNoManifest = errors.New("archive has no embedded manifest")
+
+// EmbedManifest writes m as the first member of a tar stream and then copies
+// every member of the image archive read from src.
+func EmbedManifest(w io.Writer, m *Manifest, src io.Reader) error {
+	return embed(w, m, src, nil)
+}
+
+// embed is EmbedManifest that also appends the tar stream home, if any,
+// below BundledHomePrefix.
+func embed(w io.Writer, m *Manifest, src, home io.Reader) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	hdr := &tar.Header{
+		Name:    EmbeddedManifestName,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+		Format:  tar.FormatPAX,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading image archive: %w", err)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	if home != nil {
+		if err := appendHome(tw, home); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// ReadEmbeddedManifest decodes the manifest at the start of an archive, which
+// may be compressed. r only has to provide the first ManifestProbeSize bytes
+// of the uncompressed stream.
+func ReadEmbeddedManifest(r io.Reader) (*Manifest, error) {
+	dec, _, err := New("").Decompress(r)
+	if err != nil {
+		return nil, ErrNoManifest
+	}
+	defer dec.Close()
+	tr := tar.NewReader(dec)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != EmbeddedManifestName {
+		return nil, ErrNoManifest
+	}
+	var m Manifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, fmt.Errorf("corrupt embedded manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// ReadArchiveManifest reads the embedded manifest of an archive file.
+func ReadArchiveManifest(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadEmbeddedManifest(f)
+}
+
+// SaveWithManifest saves an image to path with m embedded as the first member.
+func (c *Client) SaveWithManifest(image, path string, m *Manifest) error {
+	return c.SaveCompressed(image, path, m, CompressNone, 0)
+}
+
+// SaveCompressed is SaveWithManifest writing the archive through comp at the
+// given level (0 for the format's default).
+func (c *Client) SaveCompressed(image, path string, m *Manifest, comp Compression, level int) error {
+	return c.SaveArchive(image, path, m, SaveOptions{Compression: comp, Level: level})
+}
+
+// SaveOptions control how SaveArchive writes an archive.
+type SaveOptions struct {
+	Compression Compression
+	Level       int    // 0 for the format's default
+	HomeDir     string // isolated home to bundle, if any
+	Home        HomeOptions
+	Encryption  Encryption
+	// Progress, if set, is told how many bytes of the image's save stream
+	// (and of the bundled home) have been archived.
+	Progress ProgressFunc
+}
+
+// SaveArchive saves an image to path with m embedded as the first member,
+// optionally bundling a home directory, then compressing and encrypting the
+// archive as opts say. Once it succeeds, m.DataSize holds the bytes archived
+// before compression.
+func (c *Client) SaveArchive(image, path string, m *Manifest, opts SaveOptions) error {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, c.FileMode)
+	if err != nil {
+		return err
+	}
+	if err := out.Chmod(c.FileMode); err != nil {
+		out.Close()
+		return err
+	}
+	if err := c.WriteArchive(image, out, m, opts); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// WriteArchive is SaveArchive writing the archive to w.
+func (c *Client) WriteArchive(image string, out io.Writer, m *Manifest, opts SaveOptions) error {
+	homeDir := opts.HomeDir
+	progress := opts.Progress
+	if progress == nil {
+		progress = func(int64) {}
+	}
+	counter := newProgressCounter(progress)
+	var home io.Reader
+	var homeCmd *exec.Cmd
+	var homeStderr bytes.Buffer
+	if homeDir != "" {
+		homeCmd = c.Run("tar", append(append([]string{"-cf", "-"}, opts.Home.CreateArgs()...), "-C", homeDir, ".")...)
+		homeCmd.Stderr = &homeStderr
+		out, err := homeCmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := homeCmd.Start(); err != nil {
+			return err
+		}
+		home = counter.reader(out)
+		defer func() {
+			if homeCmd != nil {
+				homeCmd.Process.Kill()
+				homeCmd.Wait()
+			}
+		}()
+	}
+
+	ew, err := c.Encrypt(out, opts.Encryption)
+	if err != nil {
+		return err
+	}
+	cw, err := c.Compress(ew, opts.Compression, opts.Level)
+	if err != nil {
+		ew.Close()
+		return err
+	}
+	pr, pw := io.Pipe()
+	saveErr := make(chan error, 1)
+	go func() {
+		err := c.SaveStream(image, counter.writer(pw))
+		pw.CloseWithError(err)
+		saveErr <- err
+	}()
+	embedErr := embed(cw, m, pr, home)
+	pr.CloseWithError(embedErr)
+	if homeCmd != nil {
+		if embedErr != nil {
+			homeCmd.Process.Kill() // it may be blocked writing to us
+		}
+		if err := homeCmd.Wait(); err != nil && embedErr == nil {
+			embedErr = fmt.Errorf("command 'tar -cf - -C %s .' failed: %w: %s", homeDir, err, strings.TrimSpace(homeStderr.String()))
+		}
+		homeCmd = nil
+	}
+	if closeErr := cw.Close(); embedErr == nil {
+		embedErr = closeErr
+	}
+	if closeErr := ew.Close(); embedErr == nil {
+		embedErr = closeErr
+	}
+	if err := <-saveErr; err != nil {
+		return err
+	}
+	if embedErr != nil {
+		return embedErr
+	}
+	m.DataSize = counter.done.Load()
+	return nil
+}
+
+// ReplaceEmbeddedManifest rewrites an archive so its embedded manifest is m.
+// Archives without an embedded manifest gain one; compressed archives are
+// recompressed with the same format; encrypted archives are refused with
+// ErrEncrypted. The archive is rewritten through a temporary file next to it
+// and renamed into place.
+func (c *Client) ReplaceEmbeddedManifest(path string, m *Manifest) error {
+	if cipher, err := FileCipher(path); err != nil {
+		return err
+	} else if cipher != EncryptNone {
+		return ErrEncrypted
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".rewrite"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	dec, comp, err := c.Decompress(in)
+	if err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	defer dec.Close()
+	cw, err := c.Compress(out, comp, 0)
+	if err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(copyWithoutManifest(pw, dec))
+	}()
+	err = EmbedManifest(cw, m, pr)
+	pr.CloseWithError(err)
+	if closeErr := cw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// copyWithoutManifest copies a tar stream, dropping an embedded manifest.
+func copyWithoutManifest(w io.Writer, r io.Reader) error {
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Name == EmbeddedManifestName {
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
@@ -0,0 +1,276 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Cipher is an archive encryption tool. Both age and gpg are run as host
+// commands, so keys stay in the user's own keyrings.
+type Cipher string
+
+const (
+	EncryptNone Cipher = ""
+	EncryptAge  Cipher = "age"
+	EncryptGPG  Cipher = "gpg"
+)
+
+// Ciphers lists the supported encryption tools.
+var Ciphers = []Cipher{EncryptAge, EncryptGPG}
+
+var (
+	ageMagic      = []byte("age-encryption.org/")
+	ageArmorMagic = []byte("-----BEGIN AGE ENCRYPTED FILE-----")
+	gpgArmorMagic = []byte("-----BEGIN PGP MESSAGE-----")
+	// cipherProbeSize covers the first tar header, whose magic rules out
+	// a binary OpenPGP message.
+	cipherProbeSize = 512
+)
+
+// ErrEncrypted is returned by operations that cannot work on encrypted
+// archives.
+var ErrEncrypted = errors.New("archive is encrypted")
+
+// ParseCipher accepts an encryption name ("none", "age", "gpg"/"gnupg").
+func ParseCipher(s string) (Cipher, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "none":
+		return EncryptNone, nil
+	case "age":
+		return EncryptAge, nil
+	case "gpg", "gnupg":
+		return EncryptGPG, nil
+	}
+	return EncryptNone, fmt.Errorf("unknown encryption %q: must be none, age or gpg", s)
+}
+
+func (c Cipher) String() string {
+	if c == EncryptNone {
+		return "none"
+	}
+	return string(c)
+}
+
+// Ext returns the file extension appended to encrypted archives.
+func (c Cipher) Ext() string {
+	if c == EncryptNone {
+		return ""
+	}
+	return "." + string(c)
+}
+
+// Command returns the host program needed for c, or "" if none is.
+func (c Cipher) Command() string {
+	return string(c)
+}
+
+// TrimCipherExt removes an encryption extension from a file name.
+func TrimCipherExt(name string) string {
+	for _, c := range Ciphers {
+		if strings.HasSuffix(name, c.Ext()) {
+			return strings.TrimSuffix(name, c.Ext())
+		}
+	}
+	return name
+}
+
+// DetectCipher identifies an encrypted stream from its leading bytes.
+func DetectCipher(head []byte) Cipher {
+	switch {
+	case bytes.HasPrefix(head, ageMagic), bytes.HasPrefix(head, ageArmorMagic):
+		return EncryptAge
+	case bytes.HasPrefix(head, gpgArmorMagic):
+		return EncryptGPG
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return EncryptNone
+	case isPGPMessage(head):
+		return EncryptGPG
+	}
+	return EncryptNone
+}
+
+// isPGPMessage reports whether head starts with a public-key or
+// symmetric-key encrypted session key packet, which every encrypted binary
+// OpenPGP message starts with: a packet header with one of those tags and
+// a definite length, and a body of a known version that fits it (RFC 4880,
+// sections 4.2, 5.1 and 5.3).
+func isPGPMessage(head []byte) bool {
+	tag, length, body, ok := pgpPacketHeader(head)
+	if !ok || len(body) < 2 {
+		return false
+	}
+	switch tag {
+	case 1: // version, key ID (or key version), algorithm, session key
+		return (body[0] == 3 && length >= 12) || (body[0] == 6 && length >= 4)
+	case 3: // version, cipher algorithm, S2K specifier or AEAD algorithm
+		return body[0] >= 4 && body[0] <= 6 && body[1] >= 1 && body[1] <= 13 && length >= 4
+	}
+	return false
+}
+
+// pgpPacketHeader parses the OpenPGP packet header at the start of head and
+// returns the packet's tag, its body length and the bytes of the body in
+// head. Packets of indeterminate or partial length are not reported, as
+// session key packets have neither.
+func pgpPacketHeader(head []byte) (tag byte, length int, body []byte, ok bool) {
+	if len(head) < 2 {
+		return 0, 0, nil, false
+	}
+	switch b := head[0]; b & 0xc0 {
+	case 0xc0: // new format
+		tag = b & 0x3f
+		switch l := int(head[1]); {
+		case l < 192:
+			return tag, l, head[2:], true
+		case l < 224 && len(head) >= 3:
+			return tag, (l-192)<<8 + int(head[2]) + 192, head[3:], true
+		case l == 255 && len(head) >= 6:
+			return tag, int(binary.BigEndian.Uint32(head[2:6])), head[6:], true
+		}
+	case 0x80: // old format
+		tag = (b >> 2) & 0x0f
+		size := 1 << (b & 3) // 1, 2 or 4 octets; 3 is indeterminate
+		if b&3 == 3 || len(head) < 1+size {
+			break
+		}
+		for _, c := range head[1 : 1+size] {
+			length = length<<8 | int(c)
+		}
+		return tag, length, head[1+size:], true
+	}
+	return 0, 0, nil, false
+}
+
+// FileCipher reports how an archive file is encrypted.
+func FileCipher(path string) (Cipher, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return EncryptNone, err
+	}
+	defer f.Close()
+	head := make([]byte, cipherProbeSize)
+	n, _ := io.ReadFull(f, head)
+	return DetectCipher(head[:n]), nil
+}
+
+// Encryption selects how new archives are encrypted. Recipient is an age
+// public key or recipients file for age, and a key ID or email for gpg.
+type Encryption struct {
+	Cipher    Cipher
+	Recipient string
+}
+
+// Encrypt returns a writer encrypting into w. Closing it flushes the stream
+// and reports errors of the encryption tool; it does not close w.
+func (c *Client) Encrypt(w io.Writer, enc Encryption) (io.WriteCloser, error) {
+	if enc.Cipher == EncryptNone {
+		return nopWriteCloser{w}, nil
+	}
+	if enc.Recipient == "" {
+		return nil, fmt.Errorf("%s encryption needs a recipient", enc.Cipher)
+	}
+	switch enc.Cipher {
+	case EncryptAge:
+		flag := "-r"
+		if _, err := os.Stat(enc.Recipient); err == nil {
+			flag = "-R" // a recipients file
+		}
+		return startFilter(c.Run("age", "--encrypt", flag, enc.Recipient), w)
+	case EncryptGPG:
+		return startFilter(c.Run("gpg", "--batch", "--yes", "--encrypt", "--recipient", enc.Recipient, "--output", "-"), w)
+	}
+	return nil, fmt.Errorf("unknown encryption %q", enc.Cipher)
+}
+
+// Decrypt returns a reader of r's content, decrypting it if it is an age or
+// gpg encrypted stream. age needs the client's Identity file; gpg asks its
+// agent for the key. The returned cipher is what was found.
+func (c *Client) Decrypt(r io.Reader) (io.ReadCloser, Cipher, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(cipherProbeSize)
+	cipher := DetectCipher(head)
+	var args []string
+	switch cipher {
+	case EncryptNone:
+		return io.NopCloser(br), cipher, nil
+	case EncryptAge:
+		if c.Identity == "" {
+			return nil, cipher, fmt.Errorf("the archive is encrypted with age, but no identity file is configured")
+		}
+		args = []string{"--decrypt", "-i", c.Identity}
+	case EncryptGPG:
+		args = []string{"--quiet", "--decrypt"}
+	}
+	cmd := c.Run(cipher.Command(), args...)
+	cmd.Stdin = br
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, cipher, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, cipher, fmt.Errorf("could not start %s: %w", cipher.Command(), err)
+	}
+	return &filterReader{ReadCloser: out, cmd: cmd, stderr: &stderr}, cipher, nil
+}
+
+// OpenArchive opens an archive file and returns its plain tar stream,
+// decrypting and decompressing it as needed. plain reports that the file
+// needed neither, so runtimes can read it directly.
+func (c *Client) OpenArchive(path string) (r io.ReadCloser, plain bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	dec, cipher, err := c.Decrypt(f)
+	if err != nil {
+		f.Close()
+		return nil, false, err
+	}
+	tr, comp, err := c.Decompress(dec)
+	if err != nil {
+		dec.Close()
+		f.Close()
+		return nil, false, err
+	}
+	return &archiveReader{Reader: tr, closers: []io.Closer{tr, dec, f}}, cipher == EncryptNone && comp == CompressNone, nil
+}
+
+// openArchiveStream is OpenArchive for an archive read from r, which the
+// caller closes.
+func (c *Client) openArchiveStream(r io.Reader) (io.ReadCloser, error) {
+	dec, _, err := c.Decrypt(r)
+	if err != nil {
+		return nil, err
+	}
+	tr, _, err := c.Decompress(dec)
+	if err != nil {
+		dec.Close()
+		return nil, err
+	}
+	return &archiveReader{Reader: tr, closers: []io.Closer{tr, dec}}, nil
+}
+
+// archiveReader closes every stage of an OpenArchive pipeline, innermost
+// first, and reports the first error.
+type archiveReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (a *archiveReader) Close() error {
+	var first error
+	for _, c := range a.closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,58 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+)
+
+// tarHead returns the first header block of a tar archive holding a file
+// named name.
+func tarHead(t *testing.T, name string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 0, Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()[:cipherProbeSize]
+}
+
+func TestDetectCipher(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want Cipher
+	}{
+		{"empty", nil, EncryptNone},
+		{"tar", tarHead(t, "etc/hostname"), EncryptNone},
+		// A file name can start with bytes that look like a packet header.
+		{"tar with a UTF-8 name", tarHead(t, "\xc3\x84rger.txt"), EncryptNone},
+		{"tar with a packet-like name", tarHead(t, "\x8c\x0d\x04\x09notes"), EncryptNone},
+		{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, EncryptNone},
+		{"gzip", []byte{0x1f, 0x8b, 0x08, 0x00}, EncryptNone},
+		{"age", []byte("age-encryption.org/v1\n-> X25519 abc\n"), EncryptAge},
+		{"age armored", []byte("-----BEGIN AGE ENCRYPTED FILE-----\nYWdl\n"), EncryptAge},
+		{"gpg armored", []byte("-----BEGIN PGP MESSAGE-----\n\nhQEM\n"), EncryptGPG},
+		// Public-key session key packet, v3: old format, 2-octet length.
+		{"gpg public key, old format", append([]byte{0x85, 0x01, 0x0c, 0x03}, make([]byte, 16)...), EncryptGPG},
+		// Public-key session key packet, v3: new format, 1-octet length.
+		{"gpg public key, new format", append([]byte{0xc1, 0x5e, 0x03}, make([]byte, 16)...), EncryptGPG},
+		// Symmetric-key session key packet, v4, AES-256, iterated S2K.
+		{"gpg symmetric", []byte{0x8c, 0x0d, 0x04, 0x09, 0x03, 0x08, 0, 0, 0, 0, 0, 0, 0, 0, 0xff}, EncryptGPG},
+		{"gpg symmetric, new format", []byte{0xc3, 0x0d, 0x04, 0x09, 0x03, 0x08, 0, 0, 0, 0, 0, 0, 0, 0, 0xff}, EncryptGPG},
+		{"session key packet of an unknown version", []byte{0x8c, 0x0d, 0x09, 0x09, 0x03, 0x08}, EncryptNone},
+		{"session key packet of an unknown cipher", []byte{0x8c, 0x0d, 0x04, 0x63, 0x03, 0x08}, EncryptNone},
+		{"other packet", []byte{0xa3, 0x01, 0x78, 0x9c}, EncryptNone},
+		{"indeterminate length", []byte{0x87, 0x03, 0x00, 0x00}, EncryptNone},
+		{"truncated", []byte{0x85}, EncryptNone},
+	}
+	for _, tt := range tests {
+		if got := DetectCipher(tt.head); got != tt.want {
+			t.Errorf("%s: DetectCipher = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StorageDriver returns the storage driver of the runtime (overlay, vfs,
+// btrfs, ...).
+func (c *Client) StorageDriver() (string, error) {
+	format := "{{.Store.GraphDriverName}}"
+	if c.Runtime == "docker" {
+		format = "{{.Driver}}"
+	}
+	out, err := c.RuntimeOutput("info", "--format", format)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// LayerCount returns the number of filesystem layers of an image.
+func (c *Client) LayerCount(image string) (int, error) {
+	out, err := c.RuntimeOutput("image", "inspect", "--format", "{{len .RootFS.Layers}}", image)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return 0, fmt.Errorf("unexpected layer count %q", strings.TrimSpace(out))
+	}
+	return n, nil
+}
+
+// imageConfig is the part of an image's configuration that Flatten keeps.
+type imageConfig struct {
+	Env        []string
+	Labels     map[string]string
+	Entrypoint []string
+	Cmd        []string
+	User       string
+	WorkingDir string
+}
+
+// changes returns the --change options that give an imported image this
+// configuration.
+func (ic imageConfig) changes() []string {
+	var changes []string
+	for _, e := range ic.Env {
+		changes = append(changes, "--change", "ENV "+e)
+	}
+	for k, v := range ic.Labels {
+		changes = append(changes, "--change", fmt.Sprintf("LABEL %s=%s", strconv.Quote(k), strconv.Quote(v)))
+	}
+	// The JSON (exec) form keeps the arguments exactly as they were.
+	if len(ic.Entrypoint) > 0 {
+		entrypoint, _ := json.Marshal(ic.Entrypoint)
+		changes = append(changes, "--change", "ENTRYPOINT "+string(entrypoint))
+	}
+	if len(ic.Cmd) > 0 {
+		cmd, _ := json.Marshal(ic.Cmd)
+		changes = append(changes, "--change", "CMD "+string(cmd))
+	}
+	if ic.User != "" {
+		changes = append(changes, "--change", "USER "+ic.User)
+	}
+	if ic.WorkingDir != "" {
+		changes = append(changes, "--change", "WORKDIR "+ic.WorkingDir)
+	}
+	return changes
+}
+
+// Flatten creates ref as a single-layer copy of image: the root filesystem
+// of a temporary container is exported and imported again, keeping the
+// image's environment, labels, entrypoint, command, user and working
+// directory.
+func (c *Client) Flatten(image, ref string) error {
+	var changes []string
+	if out, err := c.RuntimeOutput("image", "inspect", "--format", "{{json .Config}}", image); err == nil {
+		var ic imageConfig
+		if json.Unmarshal([]byte(strings.TrimSpace(out)), &ic) == nil {
+			changes = ic.changes()
+		}
+	}
+
+	out, err := c.RuntimeOutput("create", image, "true")
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	container := strings.TrimSpace(lines[len(lines)-1])
+	defer c.RuntimeOutput("rm", "-f", container)
+
+	export := c.Run(c.Runtime, "export", container)
+	stream, err := export.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var exportErr bytes.Buffer
+	export.Stderr = &exportErr
+	if err := export.Start(); err != nil {
+		return err
+	}
+	var importOut bytes.Buffer
+	imp := c.Run(c.Runtime, append(append([]string{"import"}, changes...), "-", ref)...)
+	imp.Stdin = stream
+	imp.Stdout = &importOut
+	imp.Stderr = &importOut
+	importErr := imp.Run()
+	if err := export.Wait(); err != nil {
+		return fmt.Errorf("command '%s export %s' failed: %w: %s", c.Runtime, container, err, strings.TrimSpace(exportErr.String()))
+	}
+	if importErr != nil {
+		return fmt.Errorf("command '%s import - %s' failed: %w: %s", c.Runtime, ref, importErr, strings.TrimSpace(importOut.String()))
+	}
+	return nil
+}
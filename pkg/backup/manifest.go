@@ -0,0 +1,143 @@
+package backup
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// ManifestVersion is the schema version written into new manifests.
+const ManifestVersion = 1
+
+// Isolation types recorded in a manifest.
+const (
+	IsolationStandard = "standard"
+	IsolationIsolated = "isolated"
+)
+
+// Manifest describes a backup archive: where it came from and how the
+// container should be recreated.
+type Manifest struct {
+	Version          int       `json:"version"`
+	ContainerName    string    `json:"container_name"`
+	Image            string    `json:"image"`
+	Distro           string    `json:"distro,omitempty"`
+	DistroVersion    string    `json:"distro_version,omitempty"`
+	DistroboxVersion string    `json:"distrobox_version,omitempty"`
+	Runtime          string    `json:"runtime,omitempty"`
+	StorageDriver    string    `json:"storage_driver,omitempty"`
+	Isolation        string    `json:"isolation"`
+	HostDistro       string    `json:"host_distro,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	Size             int64     `json:"size,omitempty"`
+	SHA256           string    `json:"sha256,omitempty"`
+	// DataSize is how much data went into the archive before compression
+	// and encryption: the saved image plus a bundled home. Like Size, it is
+	// only recorded in the sidecar.
+	DataSize int64 `json:"data_size,omitempty"`
+	// Encryption is the Cipher the archive is encrypted with; it is only
+	// recorded in the sidecar, as the embedded copy is encrypted too.
+	Encryption string `json:"encryption,omitempty"`
+
+	// Home is the container's home directory at backup time; HostHome is
+	// the home of the host user who made the backup. Together they let a
+	// restore relocate homes across users.
+	Home     string `json:"home,omitempty"`
+	HostHome string `json:"host_home,omitempty"`
+	// HomeBundled is set when the home is stored inside the archive below
+	// BundledHomePrefix.
+	HomeBundled bool `json:"home_bundled,omitempty"`
+	// HomeOwner and HomeXattrs are the HomeOptions the home archive was
+	// made with, so a restore extracts it the same way.
+	HomeOwner  string `json:"home_owner,omitempty"`
+	HomeXattrs bool   `json:"home_xattrs,omitempty"`
+	// HomeExcluded lists paths, relative to the home, that were left out
+	// of the home archive.
+	HomeExcluded []string `json:"home_excluded,omitempty"`
+
+	// Tags and Note are user metadata that can be edited after the backup.
+	Tags []string `json:"tags,omitempty"`
+	Note string   `json:"note,omitempty"`
+
+	// Manager is ManagerToolbox for toolbx containers; empty means
+	// distrobox.
+	Manager string `json:"manager,omitempty"`
+	// Unshare lists the namespaces the container did not share with the
+	// host (distrobox-create --unshare-<name>).
+	Unshare []string `json:"unshare,omitempty"`
+	// Init, Nvidia and Extra are the other distrobox-create settings of
+	// the container.
+	Init   bool        `json:"init,omitempty"`
+	Nvidia bool        `json:"nvidia,omitempty"`
+	Extra  *ExtraFlags `json:"create_flags,omitempty"`
+
+	// Exports are the apps and binaries exported to the host with
+	// distrobox-export, re-exported after a restore.
+	Exports []Export `json:"exports,omitempty"`
+
+	// BaseImage is the image the container was created from, as it was
+	// when the backup was taken.
+	BaseImage *ImageProvenance `json:"base_image,omitempty"`
+
+	// RestoreAfter names containers that must be restored before this one
+	// when several are restored together.
+	RestoreAfter []string `json:"restore_after,omitempty"`
+
+	// SystemPaths marks a system files archive: a tarball of these paths
+	// of the container's filesystem rather than an image.
+	SystemPaths []string `json:"system_paths,omitempty"`
+	// Packages are the packages installed on purpose in the container when
+	// a system files archive was taken, to reinstall on a fresh base image.
+	Packages []string `json:"packages,omitempty"`
+}
+
+// ImageProvenance identifies an image exactly enough to pull it again or to
+// tell whether its tag has moved on since.
+type ImageProvenance struct {
+	Ref string `json:"ref"`
+	ID  string `json:"id,omitempty"`
+	// Digest is the manifest digest the image was pulled by, and
+	// RepoDigest the reference pulling that exact image again.
+	Digest     string    `json:"digest,omitempty"`
+	RepoDigest string    `json:"repo_digest,omitempty"`
+	Created    time.Time `json:"created,omitempty"`
+}
+
+// Export is one distrobox-export of a container: an application (App) or a
+// binary (Bin, the path inside the container) exported to ExportPath.
+type Export struct {
+	App        string `json:"app,omitempty"`
+	Bin        string `json:"bin,omitempty"`
+	ExportPath string `json:"export_path,omitempty"`
+}
+
+// ReadManifest loads a manifest from a JSON file.
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// WriteManifest stores a manifest as indented JSON.
+func WriteManifest(path string, m *Manifest) error {
+	return WriteManifestMode(path, m, 0644)
+}
+
+// WriteManifestMode is WriteManifest creating the file with permissions
+// perm, which also apply when it already exists.
+func WriteManifestMode(path string, m *Manifest, perm os.FileMode) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), perm); err != nil {
+		return err
+	}
+	return os.Chmod(path, perm)
+}
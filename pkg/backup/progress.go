@@ -0,0 +1,123 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ProgressFunc receives the number of bytes processed so far while an image
+// streams to or from an archive. It is called from the copying goroutine
+// and must not block.
+type ProgressFunc func(done int64)
+
+// progressCounter adds up the bytes passing through readers and writers it
+// wraps and reports the total after each transfer.
+type progressCounter struct {
+	done     atomic.Int64
+	progress ProgressFunc
+}
+
+func newProgressCounter(progress ProgressFunc) *progressCounter {
+	if progress == nil {
+		return nil
+	}
+	return &progressCounter{progress: progress}
+}
+
+func (p *progressCounter) add(n int) {
+	if n > 0 {
+		p.progress(p.done.Add(int64(n)))
+	}
+}
+
+func (p *progressCounter) reader(r io.Reader) io.Reader {
+	if p == nil || r == nil {
+		return r
+	}
+	return &countingReader{r: r, p: p}
+}
+
+func (p *progressCounter) writer(w io.Writer) io.Writer {
+	if p == nil {
+		return w
+	}
+	return &countingWriter{w: w, p: p}
+}
+
+type countingReader struct {
+	r io.Reader
+	p *progressCounter
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.p.add(n)
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	p *progressCounter
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.p.add(n)
+	return n, err
+}
+
+// ImageSize returns the size of an image as the runtime reports it, which
+// is close to the length of its `save` stream.
+func (c *Client) ImageSize(image string) (int64, error) {
+	out, err := c.RuntimeOutput("image", "inspect", "--format", "{{.Size}}", image)
+	if err != nil {
+		return 0, err
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected image size %q", strings.TrimSpace(out))
+	}
+	return size, nil
+}
+
+// LoadWithProgress is Load reporting the bytes read from the archive file,
+// whose size is the total. The archive is always streamed to the runtime so
+// every byte is counted.
+func (c *Client) LoadWithProgress(path string, progress ProgressFunc) (string, error) {
+	if progress == nil {
+		return c.Load(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return c.LoadArchiveStream(f, progress)
+}
+
+// LoadArchiveStream loads an archive as Load does, but read from r, such as
+// a download in progress: it is decrypted and decompressed on the fly, and
+// progress (if set) receives the bytes read from r.
+func (c *Client) LoadArchiveStream(r io.Reader, progress ProgressFunc) (string, error) {
+	ar, err := c.openArchiveStream(newProgressCounter(progress).reader(r))
+	if err != nil {
+		return "", err
+	}
+	image, err := c.LoadStream(ar)
+	if closeErr := ar.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return image, nil
+}
+
+// SaveStreamWithProgress is SaveStream reporting the bytes written to w.
+func (c *Client) SaveStreamWithProgress(image string, w io.Writer, progress ProgressFunc) error {
+	return c.SaveStream(image, newProgressCounter(progress).writer(w))
+}